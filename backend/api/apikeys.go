@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -22,8 +23,65 @@ type APIKey struct {
 	CreatedAt time.Time  `json:"createdAt"`
 	LastUsed  *time.Time `json:"lastUsed,omitempty"`
 	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"` // nil never expires
+	Tier      string     `json:"tier,omitempty"`      // rate-limit tier; empty means standard
+	Scopes    []string   `json:"scopes,omitempty"`    // ScopeRead and/or ScopeWrite; nil (older keys) allows both
+	Status    string     `json:"status,omitempty"`    // set by ListKeys: active, expired or revoked
 }
 
+// API key scopes. Read keys may only use GET endpoints; write keys may
+// also create, change and delete, and can read too.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// HasScope reports whether the key may use endpoints needing scope
+func (k *APIKey) HasScope(scope string) bool {
+	if k.Scopes == nil {
+		return true
+	}
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeWrite {
+			return true
+		}
+	}
+	return false
+}
+
+// Key statuses reported by ListKeys
+const (
+	KeyActive  = "active"
+	KeyExpired = "expired"
+	KeyRevoked = "revoked"
+)
+
+// Errors returned by ValidateKey
+var (
+	ErrInvalidKey = errors.New("invalid API key")
+	ErrKeyRevoked = errors.New("API key revoked")
+	ErrKeyExpired = errors.New("API key expired")
+)
+
+// status returns the key's status at now. Revocation wins over expiry.
+func (k *APIKey) status(now time.Time) string {
+	switch {
+	case k.RevokedAt != nil:
+		return KeyRevoked
+	case k.ExpiresAt != nil && !now.Before(*k.ExpiresAt):
+		return KeyExpired
+	default:
+		return KeyActive
+	}
+}
+
+// API key tiers. Internal keys are for the app's own services and trusted
+// jobs, get a higher rate limit, and can only be created by admins.
+const (
+	TierStandard = "standard"
+	TierInternal = "internal"
+)
+
 // APIKeyStore manages API keys on disk
 type APIKeyStore struct {
 	mu       sync.RWMutex
@@ -79,8 +137,11 @@ func sha256Hex(s string) string {
 	return hex.EncodeToString(h[:])
 }
 
-// GenerateKey creates a new API key, returning the raw key (only shown once)
-func GenerateKey(name, userID string) (string, *APIKey, error) {
+// GenerateKey creates a new API key, returning the raw key (only shown once).
+// The key is limited to scopes and stops working at expiresAt unless it is
+// nil. Callers are responsible for checking the user may create the given
+// tier.
+func GenerateKey(name, userID, tier string, scopes []string, expiresAt *time.Time) (string, *APIKey, error) {
 	raw := make([]byte, 32)
 	if _, err := rand.Read(raw); err != nil {
 		return "", nil, err
@@ -99,6 +160,9 @@ func GenerateKey(name, userID string) (string, *APIKey, error) {
 		Prefix:    prefix,
 		UserID:    userID,
 		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+		Tier:      tier,
+		Scopes:    scopes,
 	}
 
 	keyStore.mu.Lock()
@@ -112,34 +176,45 @@ func GenerateKey(name, userID string) (string, *APIKey, error) {
 	return rawKey, &key, nil
 }
 
-// ValidateKey checks a raw API key and returns the associated key record
+// ValidateKey checks a raw API key and returns the associated key record.
+// Known keys that no longer work fail with ErrKeyRevoked or ErrKeyExpired.
 func ValidateKey(rawKey string) (*APIKey, error) {
 	hash := sha256Hex(rawKey)
 
 	keyStore.mu.Lock()
 	defer keyStore.mu.Unlock()
 
+	now := time.Now()
 	for i := range keyStore.keys {
-		if keyStore.keys[i].KeyHash == hash && keyStore.keys[i].RevokedAt == nil {
-			now := time.Now()
-			keyStore.keys[i].LastUsed = &now
-			_ = keyStore.save()
-			return &keyStore.keys[i], nil
+		if keyStore.keys[i].KeyHash != hash {
+			continue
+		}
+		switch keyStore.keys[i].status(now) {
+		case KeyRevoked:
+			return nil, ErrKeyRevoked
+		case KeyExpired:
+			return nil, ErrKeyExpired
 		}
+		keyStore.keys[i].LastUsed = &now
+		_ = keyStore.save()
+		return &keyStore.keys[i], nil
 	}
-	return nil, fmt.Errorf("invalid API key")
+	return nil, ErrInvalidKey
 }
 
-// ListKeys returns all keys for a user (without hashes)
+// ListKeys returns all keys for a user (without hashes), including revoked
+// and expired ones, with their status
 func ListKeys(userID string) []APIKey {
 	keyStore.mu.RLock()
 	defer keyStore.mu.RUnlock()
 
+	now := time.Now()
 	var result []APIKey
 	for _, k := range keyStore.keys {
 		if k.UserID == userID {
 			safe := k
 			safe.KeyHash = ""
+			safe.Status = k.status(now)
 			result = append(result, safe)
 		}
 	}
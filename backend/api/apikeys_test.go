@@ -0,0 +1,104 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// useRateLimits installs per-minute limits for the standard and internal
+// tiers for the rest of the test.
+func useRateLimits(t *testing.T, standard, internal int) {
+	t.Helper()
+	old := rateLimiters
+	rateLimiters = map[string]*RateLimiter{
+		TierStandard: NewRateLimiter(standard, time.Minute),
+		TierInternal: NewRateLimiter(internal, time.Minute),
+	}
+	for _, rl := range rateLimiters {
+		t.Cleanup(rl.Close)
+	}
+	t.Cleanup(func() { rateLimiters = old })
+}
+
+// allowedRequests sends n requests with rawKey and counts those let through.
+func allowedRequests(t *testing.T, app *fiber.App, rawKey string, n int) int {
+	t.Helper()
+	allowed := 0
+	for i := 0; i < n; i++ {
+		req := httptest.NewRequest("GET", "/ping", nil)
+		req.Header.Set("Authorization", "Bearer "+rawKey)
+		res, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		switch res.StatusCode {
+		case 200:
+			allowed++
+		case 429:
+		default:
+			t.Fatalf("request %d = %d", i+1, res.StatusCode)
+		}
+	}
+	return allowed
+}
+
+func TestInternalKeysGetTheHigherLimit(t *testing.T) {
+	if err := InitAPIKeyStore(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	useRateLimits(t, 3, 10)
+	app := fiber.New()
+	app.Get("/ping", apiKeyAuthMiddleware, func(c *fiber.Ctx) error { return c.SendString("pong") })
+
+	standard, _, err := GenerateKey("standard", "user", TierStandard, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	internal, _, err := GenerateKey("internal", "user", TierInternal, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := allowedRequests(t, app, standard, 12); n != 3 {
+		t.Errorf("standard key got %d of 12 requests, want 3", n)
+	}
+	if n := allowedRequests(t, app, internal, 12); n != 10 {
+		t.Errorf("internal key got %d of 12 requests, want 10", n)
+	}
+}
+
+func TestOnlyAdminsCreateInternalKeys(t *testing.T) {
+	if err := InitAPIKeyStore(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	app := newTestAPI(t, &Config{IsAdmin: func(userID string) bool { return userID == "admin" }})
+	app.Post("/keys", createAPIKey)
+
+	status, resp := doJSON(t, app, "POST", "/keys", createKeyRequest{Name: "job", Tier: TierInternal})
+	if status != 403 {
+		t.Errorf("non-admin creating an internal key = %d %q, want 403", status, resp.Error)
+	}
+	if status, _ := doJSON(t, app, "POST", "/keys", createKeyRequest{Name: "job", Tier: "unlimited"}); status != 400 {
+		t.Errorf("creating a key of an unknown tier = %d, want 400", status)
+	}
+	_, resp = doJSON(t, app, "POST", "/keys", createKeyRequest{Name: "job"})
+	if tier := resp.Data.(map[string]interface{})["tier"]; tier != TierStandard {
+		t.Errorf("default key tier = %v, want standard", tier)
+	}
+	if keys := ListKeys("user"); len(keys) != 1 || keys[0].Tier != TierStandard {
+		t.Errorf("user's keys = %+v, want one standard key", keys)
+	}
+
+	admin := fiber.New()
+	admin.Use(func(c *fiber.Ctx) error {
+		c.Locals("apiKeyUserID", "admin")
+		return c.Next()
+	})
+	admin.Post("/keys", createAPIKey)
+	if status, resp := doJSON(t, admin, "POST", "/keys", createKeyRequest{Name: "job", Tier: TierInternal}); status != 200 || resp.Data.(map[string]interface{})["tier"] != TierInternal {
+		t.Errorf("admin creating an internal key = %d %v", status, resp.Data)
+	}
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"md-office-backend/storage"
+	"md-office-backend/validation"
+)
+
+// ArchiveDir is the workspace folder archived documents are moved into.
+// Archiving is a deliberate, long-term move out of the active listings;
+// archived documents keep their folder layout and can be restored at any
+// time. Listings and search skip this folder.
+const ArchiveDir = ".archive"
+
+// TrashDir is the workspace folder the web UI moves deleted files into until
+// they are restored or the trash is emptied. Listings and search skip it.
+const TrashDir = ".trash"
+
+type ArchiveRequest struct {
+	IDs []string `json:"ids" validate:"required,max=500"`
+}
+
+// ArchiveResult reports the outcome for one requested ID
+type ArchiveResult struct {
+	ID    string `json:"id"`
+	Path  string `json:"path,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+func isArchiveDir(root, path string) bool {
+	return path == filepath.Join(root, ArchiveDir)
+}
+
+func isTrashDir(root, path string) bool {
+	return path == filepath.Join(root, TrashDir)
+}
+
+func commitWorkspace(c *fiber.Ctx, message string) {
+	if apiConfig == nil || apiConfig.Commit == nil {
+		return
+	}
+	if err := apiConfig.Commit(apiUserID(c), message); err != nil {
+		fmt.Printf("Warning: commit failed: %v\n", err)
+	}
+}
+
+// moveDocument renames src to dst within root, refusing to overwrite
+func moveDocument(root, src, dst string) error {
+	srcFull, err := storage.ResolveInRoot(root, src)
+	if err != nil {
+		return fmt.Errorf("access denied")
+	}
+	dstFull, err := storage.ResolveInRoot(root, dst)
+	if err != nil {
+		return fmt.Errorf("access denied")
+	}
+	info, err := os.Stat(srcFull)
+	if err != nil || info.IsDir() {
+		return fmt.Errorf("document not found")
+	}
+	if _, err := os.Stat(dstFull); err == nil {
+		return fmt.Errorf("%s already exists", filepath.ToSlash(dst))
+	}
+	if err := os.MkdirAll(filepath.Dir(dstFull), 0755); err != nil {
+		return err
+	}
+	return os.Rename(srcFull, dstFull)
+}
+
+// archiveHandler moves the given documents under .archive/ and commits
+func archiveHandler(c *fiber.Ctx) error {
+	root := workspaceRoot(c)
+	var req ArchiveRequest
+	if errs := validation.ParseBody(c, &req); errs != nil {
+		return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
+	}
+
+	results := make([]ArchiveResult, 0, len(req.IDs))
+	var moved []string
+	for _, id := range req.IDs {
+		relPath := filepath.Clean(idToPath(root, id))
+		res := ArchiveResult{ID: id}
+		if relPath == ArchiveDir || strings.HasPrefix(relPath, ArchiveDir+string(filepath.Separator)) {
+			res.Error = "document is already archived"
+		} else if !pathAllowed(c, relPath, true) {
+			res.Error = "access denied"
+		} else if err := moveDocument(root, relPath, filepath.Join(ArchiveDir, relPath)); err != nil {
+			res.Error = err.Error()
+		} else {
+			res.ID = pathToID(relPath)
+			res.Path = filepath.ToSlash(relPath)
+			moved = append(moved, res.Path)
+			indexChanged(root, relPath)
+		}
+		results = append(results, res)
+	}
+
+	if len(moved) > 0 {
+		commitWorkspace(c, fmt.Sprintf("Archive %s", strings.Join(moved, ", ")))
+	}
+
+	return c.JSON(APIResponse{Data: map[string]interface{}{
+		"results":  results,
+		"archived": len(moved),
+	}})
+}
+
+// unarchiveHandler moves archived documents back to their original paths.
+// IDs are those returned by listArchiveHandler (the original path's ID).
+func unarchiveHandler(c *fiber.Ctx) error {
+	root := workspaceRoot(c)
+	var req ArchiveRequest
+	if errs := validation.ParseBody(c, &req); errs != nil {
+		return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
+	}
+
+	archiveRoot := filepath.Join(root, ArchiveDir)
+	results := make([]ArchiveResult, 0, len(req.IDs))
+	var restored []string
+	for _, id := range req.IDs {
+		relPath := filepath.Clean(idToPath(archiveRoot, id))
+		res := ArchiveResult{ID: id}
+		if !pathAllowed(c, relPath, true) {
+			res.Error = "access denied"
+		} else if err := moveDocument(root, filepath.Join(ArchiveDir, relPath), relPath); err != nil {
+			res.Error = err.Error()
+		} else {
+			res.ID = pathToID(relPath)
+			res.Path = filepath.ToSlash(relPath)
+			restored = append(restored, res.Path)
+			indexChanged(root, relPath)
+		}
+		results = append(results, res)
+	}
+
+	if len(restored) > 0 {
+		commitWorkspace(c, fmt.Sprintf("Unarchive %s", strings.Join(restored, ", ")))
+	}
+
+	return c.JSON(APIResponse{Data: map[string]interface{}{
+		"results":  results,
+		"restored": len(restored),
+	}})
+}
+
+// listArchiveHandler lists archived documents of every type. Paths and IDs
+// refer to where each document lives when restored.
+func listArchiveHandler(c *fiber.Ctx) error {
+	root := workspaceRoot(c)
+	archiveRoot := filepath.Join(root, ArchiveDir)
+	docTypeFilter := c.Query("type", "")
+	docs := []Document{}
+
+	err := filepath.WalkDir(archiveRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || skipLink(root, path, d) {
+			return nil
+		}
+		relPath, _ := filepath.Rel(archiveRoot, path)
+		dt := extensionToDocType(relPath)
+		if docTypeFilter != "" && dt != docTypeFilter || !pathAllowed(c, relPath, false) {
+			return nil
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil
+		}
+		docs = append(docs, Document{
+			ID:        pathToID(relPath),
+			Title:     strings.TrimSuffix(filepath.Base(relPath), docTypeToExtension(dt)),
+			Path:      relPath,
+			Type:      dt,
+			CreatedAt: createdAt(root, relPath, info.ModTime()),
+			UpdatedAt: info.ModTime(),
+			Size:      documentSize(path, info),
+		})
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return c.Status(500).JSON(APIResponse{Error: err.Error()})
+	}
+
+	return c.JSON(APIResponse{Data: docs})
+}
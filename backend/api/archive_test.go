@@ -0,0 +1,130 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// denySecret is a PathAllowed hook that keeps secret/ from the caller
+func denySecret(userID, relPath string, write bool) bool {
+	return !strings.HasPrefix(filepath.ToSlash(relPath), "secret/")
+}
+
+func TestPathACLDeniesDocumentWrites(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"secret/plan.md":          "# Plan",
+		".archive/secret/old.md":  "# Old",
+		".archive/notes/draft.md": "# Draft",
+	})
+	app := newTestAPI(t, &Config{WorkspaceDir: root, PathAllowed: denySecret})
+	app.Post("/docs", makeCreateHandler("docs"))
+	app.Get("/archive", listArchiveHandler)
+	app.Post("/archive", archiveHandler)
+	app.Post("/archive/restore", unarchiveHandler)
+
+	status, resp := doJSON(t, app, "POST", "/docs", CreateDocumentRequest{Title: "New", Folder: "secret"})
+	if status != 403 {
+		t.Errorf("create in secret/ = %d %q, want 403", status, resp.Error)
+	}
+	if _, err := os.Stat(filepath.Join(root, "secret", "New.md")); err == nil {
+		t.Error("document was created in secret/")
+	}
+
+	_, resp = doJSON(t, app, "POST", "/archive", ArchiveRequest{IDs: []string{pathToID("secret/plan.md")}})
+	if n := resp.Data.(map[string]interface{})["archived"]; n != float64(0) {
+		t.Errorf("archived %v restricted documents, want 0", n)
+	}
+	_, resp = doJSON(t, app, "POST", "/archive/restore", ArchiveRequest{IDs: []string{pathToID("secret/old.md")}})
+	if n := resp.Data.(map[string]interface{})["restored"]; n != float64(0) {
+		t.Errorf("restored %v restricted documents, want 0", n)
+	}
+
+	_, resp = doJSON(t, app, "GET", "/archive", nil)
+	docs := resp.Data.([]interface{})
+	if len(docs) != 1 || docs[0].(map[string]interface{})["path"] != "notes/draft.md" {
+		t.Errorf("archive listing = %v, want notes/draft.md only", docs)
+	}
+}
+
+func TestArchiveAndRestore(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"plan.md":          "# Plan\n\nquarterly goals",
+		"notes/meeting.md": "# Meeting\n\nquarterly review",
+		"keep.md":          "# Keep",
+	})
+	var commits []string
+	app := newTestAPI(t, &Config{WorkspaceDir: root, Commit: func(userID, message string) error {
+		commits = append(commits, message)
+		return nil
+	}})
+	app.Get("/docs", makeListHandler("docs"))
+	app.Get("/search", searchHandler)
+	app.Get("/archive", listArchiveHandler)
+	app.Post("/archive", archiveHandler)
+	app.Post("/archive/restore", unarchiveHandler)
+
+	paths := func(url string) []string {
+		t.Helper()
+		_, resp := doJSON(t, app, "GET", url, nil)
+		var got []string
+		docs, ok := resp.Data.([]interface{})
+		if !ok {
+			docs, _ = resp.Data.(map[string]interface{})["results"].([]interface{})
+		}
+		for _, d := range docs {
+			got = append(got, d.(map[string]interface{})["path"].(string))
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	ids := []string{pathToID("plan.md"), pathToID("notes/meeting.md")}
+	_, resp := doJSON(t, app, "POST", "/archive", ArchiveRequest{IDs: ids})
+	if n := resp.Data.(map[string]interface{})["archived"]; n != float64(2) {
+		t.Fatalf("archived %v documents, want 2: %v", n, resp.Data)
+	}
+	if _, err := os.Stat(filepath.Join(root, ArchiveDir, "notes", "meeting.md")); err != nil {
+		t.Errorf("archived document not under %s: %v", ArchiveDir, err)
+	}
+	if got := paths("/docs"); !reflect.DeepEqual(got, []string{"keep.md"}) {
+		t.Errorf("list after archiving = %v, want keep.md only", got)
+	}
+	if got := paths("/search?q=quarterly"); len(got) != 0 {
+		t.Errorf("search after archiving = %v, want no hits", got)
+	}
+	if got := paths("/archive"); !reflect.DeepEqual(got, []string{"notes/meeting.md", "plan.md"}) {
+		t.Errorf("archive listing = %v", got)
+	}
+
+	_, resp = doJSON(t, app, "POST", "/archive", ArchiveRequest{IDs: ids[:1]})
+	if n := resp.Data.(map[string]interface{})["archived"]; n != float64(0) {
+		t.Errorf("archived %v documents a second time, want 0", n)
+	}
+
+	// A new plan.md keeps the archived one from being restored over it
+	writeTestFiles(t, root, map[string]string{"plan.md": "# New plan"})
+	_, resp = doJSON(t, app, "POST", "/archive/restore", ArchiveRequest{IDs: ids})
+	if n := resp.Data.(map[string]interface{})["restored"]; n != float64(1) {
+		t.Fatalf("restored %v documents, want 1: %v", n, resp.Data)
+	}
+	if got := paths("/docs"); !reflect.DeepEqual(got, []string{"keep.md", "notes/meeting.md", "plan.md"}) {
+		t.Errorf("list after restoring = %v", got)
+	}
+	if got := paths("/archive"); !reflect.DeepEqual(got, []string{"plan.md"}) {
+		t.Errorf("archive listing after restoring = %v, want the blocked plan.md", got)
+	}
+	if content, _ := os.ReadFile(filepath.Join(root, "plan.md")); string(content) != "# New plan" {
+		t.Errorf("plan.md = %q, want the new one kept", content)
+	}
+
+	want := []string{"Archive plan.md, notes/meeting.md", "Unarchive notes/meeting.md"}
+	if !reflect.DeepEqual(commits, want) {
+		t.Errorf("commits = %q, want %q", commits, want)
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html"
+	"mime"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"md-office-backend/storage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxBundleSize caps the images a bundled export embeds in total.
+const maxBundleSize = 20 << 20
+
+var htmlImagePattern = regexp.MustCompile(`(<img\b[^>]*?\bsrc=")([^"]+)(")`)
+
+// assetBundler inlines the workspace images a document references as data
+// URIs, so an exported file is readable without the workspace.
+type assetBundler struct {
+	c       *fiber.Ctx
+	root    string
+	docDir  string // workspace-relative directory of the exported document
+	total   int64
+	inlined map[string]string // src -> data URI
+	err     error
+}
+
+func newAssetBundler(c *fiber.Ctx, root, docPath string) *assetBundler {
+	return &assetBundler{c: c, root: root, docDir: filepath.Dir(docPath), inlined: map[string]string{}}
+}
+
+// bundleImages embeds the sources of the <img> tags in rendered HTML, both
+// markdown images and inline tags.
+func bundleImages(doc string, b *assetBundler) string {
+	return htmlImagePattern.ReplaceAllStringFunc(doc, func(tag string) string {
+		m := htmlImagePattern.FindStringSubmatch(tag)
+		return m[1] + html.EscapeString(b.inline(html.UnescapeString(m[2]))) + m[3]
+	})
+}
+
+// inline returns src as a data URI, or unchanged if it isn't a readable
+// workspace image. Once the size cap is exceeded b.err is set.
+func (b *assetBundler) inline(src string) string {
+	if uri, ok := b.inlined[src]; ok {
+		return uri
+	}
+	if b.err != nil || strings.Contains(src, ":") || strings.HasPrefix(src, "//") {
+		return src // remote, data: or already failed
+	}
+
+	p := src
+	if i := strings.IndexAny(p, "?#"); i >= 0 {
+		p = p[:i]
+	}
+	p, err := url.PathUnescape(p)
+	if err != nil {
+		return src
+	}
+	rel := filepath.Join(b.docDir, p)
+	if strings.HasPrefix(p, "/") {
+		rel = filepath.Clean(p[1:])
+	}
+	full, err := storage.ResolveInRoot(b.root, rel)
+	if err != nil || !pathAllowed(b.c, rel, false) {
+		return src
+	}
+	contentType := mime.TypeByExtension(strings.ToLower(filepath.Ext(full)))
+	if !strings.HasPrefix(contentType, "image/") {
+		return src
+	}
+	size, err := storage.Size(full)
+	if err != nil {
+		return src
+	}
+	if b.total += size; b.total > maxBundleSize {
+		b.err = fmt.Errorf("Bundled images exceed %d MB; export without bundle=true", maxBundleSize>>20)
+		return src
+	}
+	data, err := storage.ReadFile(full)
+	if err != nil {
+		return src
+	}
+	uri := "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data)
+	b.inlined[src] = uri
+	return uri
+}
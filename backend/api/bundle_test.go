@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBundledExportInlinesImages(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"notes/img/a b.png": "PNG bytes",
+		"logo.png":          "logo",
+		"notes/doc.md": "# Trip\n\n![pic](img/a%20b.png \"title\") and ![logo](/logo.png)\n\n" +
+			"<img src=\"../logo.png\" width=\"3\">\n\n![remote](https://example.com/x.png) ![gone](missing.png) ![escape](../../etc/passwd.png)\n",
+	})
+	app := newTestAPI(t, &Config{WorkspaceDir: root})
+	app.Get("/export/:type/:id", exportHandler)
+	export := func(query string) (int, string) {
+		t.Helper()
+		res, err := app.Test(httptest.NewRequest("GET", "/export/docs/"+pathToID("notes/doc.md")+"?format=html"+query, nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(body)
+	}
+
+	pic := "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte("PNG bytes"))
+	logo := "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte("logo"))
+	status, html := export("&bundle=true")
+	if status != 200 {
+		t.Fatalf("bundled export = %d %s", status, html)
+	}
+	if !strings.Contains(html, `src="`+pic+`"`) || strings.Count(html, logo) != 2 {
+		t.Errorf("bundled export doesn't inline the workspace images:\n%s", html)
+	}
+	for _, kept := range []string{`src="https://example.com/x.png"`, `src="missing.png"`, `src="../../etc/passwd.png"`} {
+		if !strings.Contains(html, kept) {
+			t.Errorf("bundled export changed %s:\n%s", kept, html)
+		}
+	}
+
+	if _, html := export(""); strings.Contains(html, "data:image") {
+		t.Errorf("export without bundle=true inlined images:\n%s", html)
+	}
+}
+
+func TestBundledExportSizeCap(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"big.png": strings.Repeat("x", maxBundleSize+1),
+		"doc.md":  "![big](big.png)",
+	})
+	app := newTestAPI(t, &Config{WorkspaceDir: root})
+	app.Get("/export/:type/:id", exportHandler)
+
+	status, resp := doJSON(t, app, "GET", "/export/docs/"+pathToID("doc.md")+"?format=html&bundle=true", nil)
+	if status != 413 || resp.Error == "" {
+		t.Errorf("export over the cap = %d %+v, want 413", status, resp)
+	}
+}
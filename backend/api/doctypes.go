@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// DocType describes a kind of document served under /api/v1/<Name>/.
+type DocType struct {
+	Name      string // route segment and Document.Type, e.g. "sheets"
+	Extension string // file suffix, e.g. ".sheet.json"
+	// NewContent returns the content of a document created without any.
+	// Nil means new documents start empty.
+	NewContent func(title string) string
+}
+
+// docTypes holds every registered type; Config.DocTypes picks which are served
+var docTypes = []DocType{
+	{Name: "docs", Extension: ".md", NewContent: func(title string) string { return "# " + title + "\n" }},
+	{Name: "sheets", Extension: ".sheet.json", NewContent: jsonContent(`{"cells":{},"meta":{"title":%s}}`)},
+	{Name: "slides", Extension: ".slides.json", NewContent: jsonContent(`{"slides":[],"meta":{"title":%s}}`)},
+	{Name: "databases", Extension: ".db.json", NewContent: jsonContent(`{"columns":[],"rows":[],"meta":{"title":%s}}`)},
+}
+
+// jsonContent returns a NewContent func filling %s in template with the
+// title as a JSON string.
+func jsonContent(template string) func(string) string {
+	return func(title string) string {
+		quoted, _ := json.Marshal(title)
+		return strings.Replace(template, "%s", string(quoted), 1)
+	}
+}
+
+// RegisterDocType adds a document type, or replaces the registered type with
+// the same name. Call it before RegisterRoutes.
+func RegisterDocType(t DocType) {
+	for i := range docTypes {
+		if docTypes[i].Name == t.Name {
+			docTypes[i] = t
+			return
+		}
+	}
+	docTypes = append(docTypes, t)
+}
+
+// enabledDocTypes returns the registered types allowed by Config.DocTypes,
+// in registration order.
+func enabledDocTypes() []DocType {
+	if apiConfig == nil || len(apiConfig.DocTypes) == 0 {
+		return docTypes
+	}
+	var enabled []DocType
+	for _, t := range docTypes {
+		for _, name := range apiConfig.DocTypes {
+			if name == t.Name {
+				enabled = append(enabled, t)
+				break
+			}
+		}
+	}
+	return enabled
+}
+
+// lookupDocType finds a registered type, enabled or not. Disabled types have
+// no routes but their files keep their type in search and archive listings.
+func lookupDocType(name string) (DocType, bool) {
+	for _, t := range docTypes {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return DocType{}, false
+}
+
+func docTypeToExtension(docType string) string {
+	if t, ok := lookupDocType(docType); ok {
+		return t.Extension
+	}
+	return ".md"
+}
+
+// extensionToDocType returns the registered type with the longest extension
+// matching path, so "a.sheet.json" isn't mistaken for a plain ".json" type.
+func extensionToDocType(path string) string {
+	best := DocType{Name: "docs"}
+	for _, t := range docTypes {
+		if strings.HasSuffix(path, t.Extension) && len(t.Extension) > len(best.Extension) {
+			best = t
+		}
+	}
+	return best.Name
+}
+
+func newDocumentContent(docType, title string) string {
+	if t, ok := lookupDocType(docType); ok && t.NewContent != nil {
+		return t.NewContent(title)
+	}
+	return ""
+}
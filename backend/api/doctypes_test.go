@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCustomDocType(t *testing.T) {
+	saved := append([]DocType(nil), docTypes...)
+	t.Cleanup(func() { docTypes = saved })
+	RegisterDocType(DocType{Name: "boards", Extension: ".board.json", NewContent: jsonContent(`{"lanes":[],"title":%s}`)})
+
+	if got := extensionToDocType("q3.board.json"); got != "boards" {
+		t.Errorf("extensionToDocType(q3.board.json) = %q, want boards", got)
+	}
+	if got := extensionToDocType("q3.sheet.json"); got != "sheets" {
+		t.Errorf("extensionToDocType(q3.sheet.json) = %q, want sheets", got)
+	}
+	if got := docTypeToExtension("boards"); got != ".board.json" {
+		t.Errorf("docTypeToExtension(boards) = %q", got)
+	}
+
+	root := t.TempDir()
+	oldConfig, oldLimiters := apiConfig, rateLimiters
+	t.Cleanup(func() {
+		for _, rl := range rateLimiters {
+			rl.Close()
+		}
+		apiConfig, rateLimiters = oldConfig, oldLimiters
+	})
+	var rawKey string
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Request().Header.Set("Authorization", "Bearer "+rawKey)
+		return c.Next()
+	})
+	RegisterRoutes(app, &Config{WorkspaceDir: root, ConfigDir: t.TempDir(), DocTypes: []string{"docs", "boards"}})
+	rawKey, _, err := GenerateKey("test", "user", TierStandard, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, resp := doJSON(t, app, "POST", "/api/v1/boards", CreateDocumentRequest{Title: "Q3"})
+	doc, _ := resp.Data.(map[string]interface{})
+	if status != 201 || doc["type"] != "boards" || doc["path"] != "Q3.board.json" {
+		t.Fatalf("create board = %d %+v", status, resp)
+	}
+	if content, _ := os.ReadFile(filepath.Join(root, "Q3.board.json")); string(content) != `{"lanes":[],"title":"Q3"}` {
+		t.Errorf("new board content = %q", content)
+	}
+	_, resp = doJSON(t, app, "GET", "/api/v1/boards", nil)
+	if results := resp.Data.(map[string]interface{})["results"].([]interface{}); len(results) != 1 {
+		t.Errorf("boards = %v, want the new board", results)
+	}
+	_, resp = doJSON(t, app, "GET", "/api/v1/docs", nil)
+	if results, _ := resp.Data.(map[string]interface{})["results"].([]interface{}); len(results) != 0 {
+		t.Errorf("docs = %v, want the board left out", results)
+	}
+
+	res, err := app.Test(httptest.NewRequest("GET", "/api/v1/sheets", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 404 {
+		t.Errorf("disabled sheets route = %d, want 404", res.StatusCode)
+	}
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// documentETag identifies a version of a stored document by its
+// modification time and size, so it can be computed without reading the
+// content.
+func documentETag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header value
+// lists etag. Weak validators compare by their opaque part.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// preconditionFailed checks the request's If-Match against the document's
+// current version. It is true when the client edited an older version and
+// the request must be refused with 412.
+func preconditionFailed(c *fiber.Ctx, info os.FileInfo) bool {
+	ifMatch := c.Get(fiber.HeaderIfMatch)
+	return ifMatch != "" && !etagMatches(ifMatch, documentETag(info))
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentIfMatchUpdates(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{"doc.md": "# Original"})
+	info, err := os.Stat(filepath.Join(root, "doc.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := documentETag(info)
+
+	app := newTestAPI(t, &Config{WorkspaceDir: root})
+	app.Put("/docs/:id", makeUpdateHandler("docs"))
+
+	const clients = 8
+	statuses := make(chan int, clients)
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body, _ := json.Marshal(UpdateDocumentRequest{Content: "# Edit " + string(rune('a'+i)) + " with a longer body"})
+			req := httptest.NewRequest("PUT", "/docs/"+pathToID("doc.md"), bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("If-Match", etag)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			statuses <- resp.StatusCode
+		}(i)
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[200] != 1 || counts[412] != clients-1 {
+		t.Errorf("statuses %v, want one 200 and %d 412s", counts, clients-1)
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Search scores: any filename match ranks above every content-only match.
+const (
+	nameMatchBase    = 1.0
+	contentMatchOnly = 0.5
+)
+
+// nameScore rates how well name matches the lowercase query, from 0 (no
+// match) to 1 (exact). Substring matches are checked first; the fuzzy
+// subsequence and typo matching only runs when fuzzy is set.
+func nameScore(name, qLower string, fuzzy bool) float64 {
+	n := strings.ToLower(name)
+	if n == qLower {
+		return 1
+	}
+	if i := strings.Index(n, qLower); i >= 0 {
+		if i == 0 {
+			return 0.9
+		}
+		// Earlier matches rank higher
+		return 0.8 - 0.3*float64(i)/float64(len(n))
+	}
+	if !fuzzy {
+		return 0
+	}
+
+	if span := subsequenceSpan(n, qLower); span > 0 {
+		// Tighter spans are closer matches
+		return 0.3 + 0.3*float64(utf8.RuneCountInString(qLower))/float64(span)
+	}
+
+	// Tolerate small typos against individual words of the name
+	maxDist := utf8.RuneCountInString(qLower) / 4
+	if maxDist < 1 {
+		maxDist = 1
+	}
+	for _, word := range strings.FieldsFunc(n, isWordSep) {
+		if d := levenshtein(word, qLower); d <= maxDist {
+			return 0.3 - 0.05*float64(d)
+		}
+	}
+	return 0
+}
+
+func isWordSep(r rune) bool {
+	return r == '-' || r == '_' || r == '.' || r == ' ' || r == '/'
+}
+
+// subsequenceSpan returns the length (in runes) of the shortest window of s
+// containing q as a subsequence, or 0 if q is not a subsequence of s.
+func subsequenceSpan(s, q string) int {
+	sr, qr := []rune(s), []rune(q)
+	if len(qr) == 0 {
+		return 0
+	}
+	best := 0
+	for start := range sr {
+		if sr[start] != qr[0] {
+			continue
+		}
+		j := 0
+		for i := start; i < len(sr); i++ {
+			if sr[i] == qr[j] {
+				j++
+				if j == len(qr) {
+					if span := i - start + 1; best == 0 || span < best {
+						best = span
+					}
+					break
+				}
+			}
+		}
+		if j < len(qr) {
+			break // no later start can match either
+		}
+	}
+	return best
+}
+
+func levenshtein(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	cur := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		cur[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(br)]
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNameScore(t *testing.T) {
+	if s := nameScore("repository-overview", "repo", false); s <= 0 {
+		t.Errorf("prefix match scored %v", s)
+	}
+	if s := nameScore("overview", "ovrview", false); s != 0 {
+		t.Errorf("fuzzy match scored %v without fuzzy set", s)
+	}
+	for _, q := range []string{"rpovw", "ovrview", "overveiw"} {
+		if s := nameScore("repository-overview", q, true); s <= 0 {
+			t.Errorf("fuzzy query %q did not match repository-overview", q)
+		}
+	}
+	if s := nameScore("repository-overview", "zzz", true); s != 0 {
+		t.Errorf("unrelated query scored %v", s)
+	}
+
+	exact := nameScore("repo", "repo", true)
+	prefix := nameScore("repo-notes", "repo", true)
+	inner := nameScore("my-repo", "repo", true)
+	subsequence := nameScore("release-plan-old", "repo", true)
+	if !(exact > prefix && prefix > inner && inner > subsequence && subsequence > 0) {
+		t.Errorf("scores exact %v, prefix %v, inner %v, subsequence %v; want them in that order",
+			exact, prefix, inner, subsequence)
+	}
+}
+
+func TestSearchRanksFilenameMatchesFirst(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"a/b/c/d/notes.md":       "see the repository overview for details",
+		"repository-overview.md": "top level",
+		"unrelated.md":           "nothing here",
+		"archive/reop-draft.md":  "old",
+	})
+	app := newTestAPI(t, &Config{WorkspaceDir: root})
+	app.Get("/search", searchHandler)
+
+	paths := func(url string) []string {
+		t.Helper()
+		_, resp := doJSON(t, app, "GET", url, nil)
+		var got []string
+		docs, _ := resp.Data.(map[string]interface{})["results"].([]interface{})
+		for _, d := range docs {
+			got = append(got, d.(map[string]interface{})["path"].(string))
+		}
+		return got
+	}
+	if got := paths("/search?q=repository"); !reflect.DeepEqual(got, []string{"repository-overview.md", "a/b/c/d/notes.md"}) {
+		t.Errorf("search = %v, want the filename hit above the content hit", got)
+	}
+	if got := paths("/search?q=rpovw"); len(got) != 0 {
+		t.Errorf("search without fuzzy = %v, want no matches", got)
+	}
+	if got := paths("/search?q=rpovw&fuzzy=true"); !reflect.DeepEqual(got, []string{"repository-overview.md"}) {
+		t.Errorf("fuzzy search = %v, want repository-overview.md", got)
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+
+	"github.com/gofiber/fiber/v2"
+
+	"md-office-backend/gitops"
+	"md-office-backend/storage"
+)
+
+// DocumentRevision is a document's content as of a commit
+type DocumentRevision struct {
+	ID      string `json:"id"`
+	Path    string `json:"path"`
+	Type    string `json:"type"`
+	Hash    string `json:"hash"`
+	Content string `json:"content"`
+}
+
+var commitHashPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// makeHistoryHandler lists the commits that changed a document, newest
+// first, paged like the workspace history (see gitops.ParseHistoryQuery).
+// The document needn't exist any more.
+func makeHistoryHandler(docType string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		root := workspaceRoot(c)
+		relPath := idToPath(root, c.Params("id"))
+		if _, err := storage.ResolveInRoot(root, relPath); err != nil || !pathAllowed(c, relPath, false) {
+			return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+		}
+
+		q, err := gitops.ParseHistoryQuery(c)
+		if err != nil {
+			return c.Status(400).JSON(APIResponse{Error: err.Error()})
+		}
+		q.Path = filepath.ToSlash(filepath.Clean(relPath))
+
+		if apiConfig.History == nil {
+			return c.JSON(APIResponse{Data: gitops.CommitPage{Commits: []gitops.GitCommit{}}})
+		}
+		page, err := apiConfig.History(root, q)
+		if errors.Is(err, gitops.ErrUnknownCursor) {
+			return c.Status(400).JSON(APIResponse{Error: "cursor is not a commit in this history"})
+		}
+		if err != nil {
+			return c.Status(500).JSON(APIResponse{Error: err.Error()})
+		}
+		return c.JSON(APIResponse{Data: page})
+	}
+}
+
+// makeRevisionHandler returns a document's content as of the commit :hash.
+func makeRevisionHandler(docType string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		root := workspaceRoot(c)
+		relPath := idToPath(root, c.Params("id"))
+		if _, err := storage.ResolveInRoot(root, relPath); err != nil || !pathAllowed(c, relPath, false) {
+			return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+		}
+
+		hash := c.Params("hash")
+		if !commitHashPattern.MatchString(hash) {
+			return c.Status(400).JSON(APIResponse{Error: "hash must be a full 40-character commit hash"})
+		}
+
+		var content []byte
+		ok := false
+		if apiConfig.FileAt != nil {
+			content, ok = apiConfig.FileAt(root, relPath, hash)
+		}
+		if !ok {
+			return c.Status(404).JSON(APIResponse{Error: "Document not found at this commit"})
+		}
+
+		return c.JSON(APIResponse{Data: DocumentRevision{
+			ID:      pathToID(relPath),
+			Path:    relPath,
+			Type:    docType,
+			Hash:    hash,
+			Content: string(content),
+		}})
+	}
+}
@@ -3,52 +3,107 @@ package api
 import (
 	"sync"
 	"time"
+
+	"md-office-backend/metrics"
 )
 
-// RateLimiter implements per-key token bucket rate limiting
+// rateLimited counts requests rejected with 429, by key tier
+var rateLimited = metrics.NewCounterVec("md_office_rate_limited_total",
+	"API requests rejected by the rate limiter", "tier")
+
+// RateLimiter implements per-key sliding window rate limiting: a key may make
+// at most rate requests in any trailing window, so there is no burst across
+// window boundaries. A janitor goroutine drops the buckets of idle keys until
+// Close is called.
 type RateLimiter struct {
 	mu      sync.Mutex
 	buckets map[string]*bucket
 	rate    int           // requests per window
 	window  time.Duration // window duration
+	now     func() time.Time
+
+	stop      chan struct{}
+	closeOnce sync.Once
 }
 
+// bucket holds the times of a key's allowed requests within the trailing
+// window, oldest first.
 type bucket struct {
-	tokens    int
-	lastReset time.Time
+	hits []time.Time
 }
 
 // NewRateLimiter creates a rate limiter (e.g., 60 requests per minute)
 func NewRateLimiter(rate int, window time.Duration) *RateLimiter {
-	return &RateLimiter{
+	rl := &RateLimiter{
 		buckets: make(map[string]*bucket),
 		rate:    rate,
 		window:  window,
+		now:     time.Now,
+		stop:    make(chan struct{}),
+	}
+	go rl.janitor()
+	return rl
+}
+
+// Close stops the janitor. The limiter keeps working, without eviction.
+func (rl *RateLimiter) Close() {
+	rl.closeOnce.Do(func() { close(rl.stop) })
+}
+
+// janitor evicts idle buckets once per window.
+func (rl *RateLimiter) janitor() {
+	ticker := time.NewTicker(rl.window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			rl.evictIdle()
+		case <-rl.stop:
+			return
+		}
+	}
+}
+
+// evictIdle removes the buckets of keys with no request in the trailing
+// window. Such a bucket counts nothing, so dropping it doesn't change what
+// Allow returns for the key.
+func (rl *RateLimiter) evictIdle() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	for key, b := range rl.buckets {
+		if len(b.hits) == 0 || !now.Before(b.hits[len(b.hits)-1].Add(rl.window)) {
+			delete(rl.buckets, key)
+		}
 	}
 }
 
-// Allow checks if a request is allowed for the given key
+// Allow checks if a request is allowed for the given key. It also returns
+// how many more requests are allowed right now and when the oldest counted
+// request leaves the window, freeing a slot.
 func (rl *RateLimiter) Allow(key string) (bool, int, time.Time) {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
+	now := rl.now()
 	b, ok := rl.buckets[key]
 	if !ok {
-		b = &bucket{tokens: rl.rate, lastReset: time.Now()}
+		b = &bucket{}
 		rl.buckets[key] = b
 	}
 
-	// Reset if window has passed
-	if time.Since(b.lastReset) >= rl.window {
-		b.tokens = rl.rate
-		b.lastReset = time.Now()
+	// Forget requests that have left the window
+	expired := 0
+	for expired < len(b.hits) && !now.Before(b.hits[expired].Add(rl.window)) {
+		expired++
 	}
+	b.hits = b.hits[expired:]
 
-	if b.tokens <= 0 {
-		resetAt := b.lastReset.Add(rl.window)
-		return false, 0, resetAt
+	if len(b.hits) >= rl.rate {
+		return false, 0, b.hits[0].Add(rl.window)
 	}
 
-	b.tokens--
-	return true, b.tokens, b.lastReset.Add(rl.window)
+	b.hits = append(b.hits, now)
+	return true, rl.rate - len(b.hits), b.hits[0].Add(rl.window)
 }
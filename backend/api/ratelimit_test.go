@@ -0,0 +1,91 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable time source for RateLimiter.now
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestLimiter(t *testing.T, rate int, window time.Duration) (*RateLimiter, *fakeClock) {
+	t.Helper()
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	rl := NewRateLimiter(rate, window)
+	rl.now = clock.now
+	t.Cleanup(rl.Close)
+	return rl, clock
+}
+
+func TestRateLimiterSlidingWindowBoundary(t *testing.T) {
+	rl, clock := newTestLimiter(t, 5, time.Minute)
+	first := clock.t
+
+	// Fill the window, spread over its first 40 seconds
+	for i := 0; i < 5; i++ {
+		allowed, remaining, reset := rl.Allow("k")
+		if !allowed || remaining != 4-i || !reset.Equal(first.Add(time.Minute)) {
+			t.Fatalf("request %d = %v, %d remaining, reset %v", i, allowed, remaining, reset)
+		}
+		clock.t = clock.t.Add(10 * time.Second)
+	}
+	if allowed, remaining, _ := rl.Allow("k"); allowed || remaining != 0 {
+		t.Errorf("request over the limit = %v, %d remaining; want denied", allowed, remaining)
+	}
+
+	// Just before the oldest hit leaves the window nothing is freed, even
+	// though a fixed window starting at the first hit would have reset
+	clock.t = first.Add(time.Minute - time.Nanosecond)
+	for i := 0; i < 3; i++ {
+		if allowed, _, reset := rl.Allow("k"); allowed || !reset.Equal(first.Add(time.Minute)) {
+			t.Errorf("just before the oldest hit expires = %v (reset %v), want denied", allowed, reset)
+		}
+	}
+
+	// At expiry exactly one slot frees up, and the next frees 10s later
+	clock.t = first.Add(time.Minute)
+	if allowed, _, _ := rl.Allow("k"); !allowed {
+		t.Error("once the oldest hit expired = denied, want one more request")
+	}
+	if allowed, _, reset := rl.Allow("k"); allowed || !reset.Equal(first.Add(70*time.Second)) {
+		t.Errorf("second request after expiry = %v (reset %v), want denied until the next hit expires", allowed, reset)
+	}
+	clock.t = first.Add(70 * time.Second)
+	if allowed, _, _ := rl.Allow("k"); !allowed {
+		t.Error("after the second hit expired = denied, want allowed")
+	}
+
+	// Other keys have their own window
+	if allowed, remaining, _ := rl.Allow("other"); !allowed || remaining != 4 {
+		t.Errorf("another key = %v, %d remaining; want a full window", allowed, remaining)
+	}
+}
+
+func TestRateLimiterEvictsIdleKeys(t *testing.T) {
+	rl, clock := newTestLimiter(t, 5, time.Minute)
+	rl.Allow("idle")
+	clock.t = clock.t.Add(30 * time.Second)
+	rl.Allow("busy")
+
+	// idle's last request left the window; busy's is still in it
+	clock.t = clock.t.Add(45 * time.Second)
+	rl.evictIdle()
+	rl.mu.Lock()
+	_, idleKept := rl.buckets["idle"]
+	_, busyKept := rl.buckets["busy"]
+	rl.mu.Unlock()
+	if idleKept || !busyKept {
+		t.Errorf("after the sweep idle kept = %v, busy kept = %v; want only busy", idleKept, busyKept)
+	}
+	if allowed, remaining, _ := rl.Allow("idle"); !allowed || remaining != 4 {
+		t.Errorf("evicted key = %v, %d remaining; want a fresh window", allowed, remaining)
+	}
+
+	rl.Close()
+	rl.Close() // idempotent; the cleanup closes it a third time
+	if allowed, _, _ := rl.Allow("busy"); !allowed {
+		t.Error("limiter stopped allowing requests after Close")
+	}
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"bytes"
+	"html"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	goldhtml "github.com/yuin/goldmark/renderer/html"
+)
+
+// markdown renders documents the way the editor shows them: CommonMark
+// with GitHub's tables, task lists, strikethrough and autolinks. Raw HTML in
+// a document is kept, as the editor keeps it.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(goldhtml.WithUnsafe()),
+)
+
+// renderMarkdown converts a markdown document to an HTML fragment.
+func renderMarkdown(content []byte) (string, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert(content, &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// htmlDocument wraps an HTML fragment in a standalone page.
+func htmlDocument(title, body string) string {
+	return "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>" + html.EscapeString(title) +
+		"</title>\n</head>\n<body>\n" + body + "</body>\n</html>\n"
+}
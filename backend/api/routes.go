@@ -1,22 +1,34 @@
 package api
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"io/fs"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v2"
+
+	"md-office-backend/gitops"
+	"md-office-backend/ignore"
+	"md-office-backend/storage"
+	"md-office-backend/validation"
 )
 
 // APIResponse is the standard response envelope
 type APIResponse struct {
-	Data  interface{} `json:"data,omitempty"`
-	Error string      `json:"error,omitempty"`
+	Data   interface{}       `json:"data,omitempty"`
+	Error  string            `json:"error,omitempty"`
+	Fields validation.Errors `json:"fields,omitempty"` // field-level validation failures
 }
 
 // Document types for the API
@@ -29,20 +41,32 @@ type Document struct {
 	CreatedAt    time.Time `json:"createdAt"`
 	UpdatedAt    time.Time `json:"updatedAt"`
 	Size         int64     `json:"size"`
+	Score        float64   `json:"score,omitempty"` // search relevance, higher first
 }
 
 type CreateDocumentRequest struct {
-	Title   string `json:"title"`
+	Title   string `json:"title" validate:"required,max=200"`
 	Type    string `json:"type"`
 	Content string `json:"content"`
-	Folder  string `json:"folder,omitempty"`
+	Folder  string `json:"folder,omitempty" validate:"max=1024"`
 }
 
 type UpdateDocumentRequest struct {
-	Title   string `json:"title,omitempty"`
+	Title   string `json:"title,omitempty" validate:"max=200"`
 	Content string `json:"content"`
 }
 
+type RenameDocumentRequest struct {
+	Title string `json:"title" validate:"required,max=200"`
+}
+
+// MoveDocumentRequest moves a document into Folder ("" is the workspace
+// root), optionally renaming it to Title.
+type MoveDocumentRequest struct {
+	Folder string `json:"folder" validate:"max=1024"`
+	Title  string `json:"title,omitempty" validate:"max=200"`
+}
+
 type ExportRequest struct {
 	Format string `json:"format"` // markdown, html
 }
@@ -55,14 +79,74 @@ type SearchQuery struct {
 
 // Config holds runtime config for API routes
 type Config struct {
-	WorkspaceDir string
+	WorkspaceDir string // used when WorkspaceDirFor is nil or returns ""
 	ConfigDir    string
 	GetUserID    func(c *fiber.Ctx) string
+	// WorkspaceDirFor returns the active workspace directory of a user
+	WorkspaceDirFor func(userID string) string
+	// WorkspaceIDFor returns the ID of a user's active workspace, which
+	// webhook events are scoped to. Nil means events carry no workspace.
+	WorkspaceIDFor func(userID string) string
+	// CheckWorkspace returns an error unless a user holds at least level
+	// ("viewer" or "editor") in their active workspace. Nil means every key
+	// owner may read and write.
+	CheckWorkspace func(userID, level string) error
+	// ShouldCompress reports whether a document of the given size is stored
+	// gzip-compressed in the user's workspace. Nil means never compress.
+	ShouldCompress func(userID string, size int) bool
+	// IsAdmin reports whether a user may mint internal-tier API keys.
+	// Nil means nobody can.
+	IsAdmin func(userID string) bool
+	// Maintenance reports read-only maintenance mode for /health
+	Maintenance func() map[string]interface{}
+	// Subsystems probes the server's subsystems for /health. Nil means
+	// only the API itself is reported.
+	Subsystems func() []Subsystem
+	// FoldNameCase reports whether names differing only by case collide in
+	// the user's workspace. Nil means they collide only on filesystems that
+	// ignore case.
+	FoldNameCase func(userID string) bool
+	// PathAllowed reports whether a user may read, or with write change, a
+	// workspace-relative path under the workspace's per-path ACLs. Nil
+	// means workspace permissions alone decide.
+	PathAllowed func(userID, relPath string, write bool) bool
+	// DocTypes lists the document types served under /api/v1/ by name
+	// (see RegisterDocType). Empty serves every registered type.
+	DocTypes []string
+	// Commit records pending changes in the user's workspace repository.
+	// Nil means changes are left uncommitted.
+	Commit func(userID, message string) error
+	// CreatedAt returns when the document at a workspace-relative path under
+	// root was created, or false when that isn't known. Nil, or false, means
+	// the modification time is used.
+	CreatedAt func(root, relPath string) (time.Time, bool)
+	// SearchFiles lists the files in the search index of the workspace at
+	// root, marking those whose content contains the lowercase query. Nil
+	// means searches read every file.
+	SearchFiles func(root, query string) []IndexedFile
+	// FileChanged tells the search index that a workspace-relative path
+	// under root was written, moved away or deleted. Nil means no index is
+	// kept.
+	FileChanged func(root, relPath string)
+	// History pages the commits of the repository of the workspace at root
+	// (q.Path is slash-separated). It returns gitops.ErrUnknownCursor for a
+	// cursor outside the history. Nil means documents have no history.
+	History func(root string, q gitops.HistoryQuery) (*gitops.CommitPage, error)
+	// FileAt returns the content of a workspace-relative path under root as
+	// of a commit, or false if the commit or the path at it doesn't exist.
+	FileAt func(root, relPath, hash string) ([]byte, bool)
 }
 
 var (
-	rateLimiter *RateLimiter
-	apiConfig   *Config
+	rateLimiters map[string]*RateLimiter // by key tier
+	apiConfig    *Config
+)
+
+// Per-minute request limits by key tier (override with API_RATE_LIMIT /
+// API_INTERNAL_RATE_LIMIT)
+const (
+	defaultStandardRateLimit = 120
+	defaultInternalRateLimit = 1200
 )
 
 // RegisterRoutes sets up /api/v1/ routes
@@ -74,10 +158,16 @@ func RegisterRoutes(app fiber.Router, cfg *Config) {
 		fmt.Printf("Warning: API key store init failed: %v\n", err)
 	}
 
-	// Rate limiter: 120 requests per minute per key
-	rateLimiter = NewRateLimiter(120, time.Minute)
+	// Rate limiters: per key, per minute, with a higher limit for internal keys
+	for _, rl := range rateLimiters {
+		rl.Close()
+	}
+	rateLimiters = map[string]*RateLimiter{
+		TierStandard: NewRateLimiter(envRateLimit("API_RATE_LIMIT", defaultStandardRateLimit), time.Minute),
+		TierInternal: NewRateLimiter(envRateLimit("API_INTERNAL_RATE_LIMIT", defaultInternalRateLimit), time.Minute),
+	}
 
-	v1 := app.Group("/api/v1", apiKeyAuthMiddleware)
+	v1 := app.Group("/api/v1", apiKeyAuthMiddleware, workspaceRoleMiddleware)
 
 	// API key management (uses JWT auth, not API key)
 	keys := app.Group("/api/v1/keys", jwtPassthrough(cfg))
@@ -85,16 +175,37 @@ func RegisterRoutes(app fiber.Router, cfg *Config) {
 	keys.Post("/", createAPIKey)
 	keys.Delete("/:id", revokeAPIKey)
 
-	// Document CRUD for each type
-	for _, docType := range []string{"docs", "sheets", "slides", "databases"} {
+	// Document CRUD for each enabled type
+	for _, name := range cfg.DocTypes {
+		if _, ok := lookupDocType(name); !ok {
+			fmt.Printf("Warning: unknown document type %q in config\n", name)
+		}
+	}
+	for _, t := range enabledDocTypes() {
+		docType := t.Name
 		group := v1.Group("/" + docType)
 		group.Get("/", makeListHandler(docType))
+		if docType == "sheets" {
+			group.Post("/import", importSheetHandler)
+		}
 		group.Get("/:id", makeGetHandler(docType))
 		group.Post("/", makeCreateHandler(docType))
 		group.Put("/:id", makeUpdateHandler(docType))
+		group.Patch("/:id", makeRenameHandler(docType))
+		group.Post("/:id/move", makeMoveHandler(docType))
+		group.Get("/:id/history", makeHistoryHandler(docType))
+		group.Get("/:id/history/:hash", makeRevisionHandler(docType))
 		group.Delete("/:id", makeDeleteHandler(docType))
 	}
 
+	// Archive
+	v1.Get("/archive", listArchiveHandler)
+	v1.Post("/archive", archiveHandler)
+	v1.Post("/archive/restore", unarchiveHandler)
+
+	// ID <-> path resolution
+	v1.Get("/resolve", resolveHandler)
+
 	// Search
 	v1.Get("/search", searchHandler)
 
@@ -114,25 +225,75 @@ func apiKeyAuthMiddleware(c *fiber.Ctx) error {
 
 	rawKey := strings.TrimPrefix(authHeader, "Bearer ")
 	key, err := ValidateKey(rawKey)
+	if err == ErrKeyExpired || err == ErrKeyRevoked {
+		return c.Status(401).JSON(APIResponse{Error: err.Error()})
+	}
 	if err != nil {
 		return c.Status(401).JSON(APIResponse{Error: "Invalid API key"})
 	}
 
 	// Rate limiting
-	allowed, remaining, resetAt := rateLimiter.Allow(key.ID)
+	allowed, remaining, resetAt := rateLimiterFor(key.Tier).Allow(key.ID)
 	c.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
 	c.Set("X-RateLimit-Reset", resetAt.Format(time.RFC3339))
 
 	if !allowed {
+		rateLimited.Inc(key.Tier)
 		c.Set("Retry-After", strconv.Itoa(int(time.Until(resetAt).Seconds())))
 		return c.Status(429).JSON(APIResponse{Error: "Rate limit exceeded"})
 	}
 
+	if scope := requiredScope(c.Method()); !key.HasScope(scope) {
+		return c.Status(403).JSON(APIResponse{Error: "API key lacks the " + scope + " scope"})
+	}
+
 	c.Locals("apiKeyUserID", key.UserID)
 	c.Locals("apiKeyID", key.ID)
 	return c.Next()
 }
 
+// workspaceRoleMiddleware requires the key owner to be a viewer of their
+// active workspace for safe methods and an editor for everything else
+func workspaceRoleMiddleware(c *fiber.Ctx) error {
+	if apiConfig.CheckWorkspace == nil {
+		return c.Next()
+	}
+	level := "editor"
+	if requiredScope(c.Method()) == ScopeRead {
+		level = "viewer"
+	}
+	if err := apiConfig.CheckWorkspace(apiUserID(c), level); err != nil {
+		return c.Status(403).JSON(APIResponse{Error: err.Error()})
+	}
+	return c.Next()
+}
+
+// requiredScope returns the key scope a request method needs: reads for
+// safe methods, writes for everything else
+func requiredScope(method string) string {
+	switch method {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return ScopeRead
+	}
+	return ScopeWrite
+}
+
+func envRateLimit(name string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
+// rateLimiterFor returns the limiter for a key tier; unknown tiers get the
+// standard limit
+func rateLimiterFor(tier string) *RateLimiter {
+	if rl, ok := rateLimiters[tier]; ok {
+		return rl
+	}
+	return rateLimiters[TierStandard]
+}
+
 // jwtPassthrough reuses the existing JWT auth for key management endpoints
 func jwtPassthrough(cfg *Config) fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -160,6 +321,12 @@ func listAPIKeys(c *fiber.Ctx) error {
 
 type createKeyRequest struct {
 	Name string `json:"name"`
+	Tier string `json:"tier,omitempty"` // standard (default) or internal
+	// read and/or write; defaults to both
+	Scopes []string `json:"scopes,omitempty"`
+	// At most one of these; without either the key never expires
+	TTLDays   int        `json:"ttlDays,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
 }
 
 func createAPIKey(c *fiber.Ctx) error {
@@ -169,16 +336,54 @@ func createAPIKey(c *fiber.Ctx) error {
 		return c.Status(400).JSON(APIResponse{Error: "name is required"})
 	}
 
-	rawKey, key, err := GenerateKey(req.Name, userID)
+	switch req.Tier {
+	case "", TierStandard:
+		req.Tier = TierStandard
+	case TierInternal:
+		if apiConfig == nil || apiConfig.IsAdmin == nil || !apiConfig.IsAdmin(userID) {
+			return c.Status(403).JSON(APIResponse{Error: "only admins can create internal keys"})
+		}
+	default:
+		return c.Status(400).JSON(APIResponse{Error: "tier must be standard or internal"})
+	}
+
+	if req.Scopes == nil {
+		req.Scopes = []string{ScopeRead, ScopeWrite}
+	}
+	if len(req.Scopes) == 0 {
+		return c.Status(400).JSON(APIResponse{Error: "scopes must not be empty"})
+	}
+	for _, scope := range req.Scopes {
+		if scope != ScopeRead && scope != ScopeWrite {
+			return c.Status(400).JSON(APIResponse{Error: "scopes must be read or write"})
+		}
+	}
+
+	switch {
+	case req.TTLDays != 0 && req.ExpiresAt != nil:
+		return c.Status(400).JSON(APIResponse{Error: "give ttlDays or expiresAt, not both"})
+	case req.TTLDays < 0:
+		return c.Status(400).JSON(APIResponse{Error: "ttlDays must be positive"})
+	case req.TTLDays > 0:
+		expiresAt := time.Now().AddDate(0, 0, req.TTLDays)
+		req.ExpiresAt = &expiresAt
+	case req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()):
+		return c.Status(400).JSON(APIResponse{Error: "expiresAt must be in the future"})
+	}
+
+	rawKey, key, err := GenerateKey(req.Name, userID, req.Tier, req.Scopes, req.ExpiresAt)
 	if err != nil {
 		return c.Status(500).JSON(APIResponse{Error: err.Error()})
 	}
 
 	return c.JSON(APIResponse{Data: map[string]interface{}{
-		"key":    rawKey,
-		"id":     key.ID,
-		"name":   key.Name,
-		"prefix": key.Prefix,
+		"key":       rawKey,
+		"id":        key.ID,
+		"name":      key.Name,
+		"prefix":    key.Prefix,
+		"tier":      key.Tier,
+		"scopes":    key.Scopes,
+		"expiresAt": key.ExpiresAt,
 	}})
 }
 
@@ -193,66 +398,148 @@ func revokeAPIKey(c *fiber.Ctx) error {
 
 // --- Document helpers ---
 
-func docTypeToExtension(docType string) string {
-	switch docType {
-	case "docs":
-		return ".md"
-	case "sheets":
-		return ".sheet.json"
-	case "slides":
-		return ".slides.json"
-	case "databases":
-		return ".db.json"
-	default:
-		return ".md"
+// apiUserID returns the user owning the request's API key
+func apiUserID(c *fiber.Ctx) string {
+	uid, _ := c.Locals("apiKeyUserID").(string)
+	return uid
+}
+
+// workspaceRoot returns the workspace directory the request operates on
+func workspaceRoot(c *fiber.Ctx) string {
+	if apiConfig.WorkspaceDirFor != nil {
+		if dir := apiConfig.WorkspaceDirFor(apiUserID(c)); dir != "" {
+			return dir
+		}
 	}
+	return apiConfig.WorkspaceDir
 }
 
-func extensionToDocType(path string) string {
-	switch {
-	case strings.HasSuffix(path, ".sheet.json"):
-		return "sheets"
-	case strings.HasSuffix(path, ".slides.json"):
-		return "slides"
-	case strings.HasSuffix(path, ".db.json"):
-		return "databases"
-	case strings.HasSuffix(path, ".md"):
-		return "docs"
-	default:
-		return "docs"
+// createdAt returns when the document at relPath was created, falling back
+// to its modification time.
+func createdAt(root, relPath string, modTime time.Time) time.Time {
+	if apiConfig.CreatedAt != nil {
+		if when, ok := apiConfig.CreatedAt(root, relPath); ok {
+			return when
+		}
 	}
+	return modTime
 }
 
+// documentSize is the size of a document's content, which for one stored
+// compressed is not its size on disk.
+func documentSize(fullPath string, info os.FileInfo) int64 {
+	if size, err := storage.Size(fullPath); err == nil {
+		return size
+	}
+	return info.Size()
+}
+
+func shouldCompress(c *fiber.Ctx, size int) bool {
+	return apiConfig.ShouldCompress != nil && apiConfig.ShouldCompress(apiUserID(c), size)
+}
+
+func pathAllowed(c *fiber.Ctx, relPath string, write bool) bool {
+	return apiConfig.PathAllowed == nil || apiConfig.PathAllowed(apiUserID(c), relPath, write)
+}
+
+func foldNameCase(c *fiber.Ctx, root string) bool {
+	if apiConfig.FoldNameCase != nil && apiConfig.FoldNameCase(apiUserID(c)) {
+		return true
+	}
+	return storage.CaseInsensitive(root)
+}
+
+// pathToID encodes a workspace-relative path as a URL-safe, reversible ID.
 func pathToID(path string) string {
-	return strings.ReplaceAll(strings.ReplaceAll(path, "/", "_"), "\\", "_")
+	return base64.RawURLEncoding.EncodeToString([]byte(filepath.ToSlash(path)))
+}
+
+// decodeID reverses pathToID. ok is false if id is not a valid encoded path.
+func decodeID(id string) (path string, ok bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil || len(raw) == 0 || !utf8.Valid(raw) || strings.ContainsRune(string(raw), 0) {
+		return "", false
+	}
+	return filepath.FromSlash(string(raw)), true
 }
 
-func idToPath(id string) string {
+// legacyIDToPath maps the old "/"→"_" IDs back to a path. The scheme is
+// lossy and only kept so existing clients keep working during the transition.
+func legacyIDToPath(id string) string {
 	return strings.ReplaceAll(id, "_", "/")
 }
 
-func listDocuments(docType string) ([]Document, error) {
+// idToPath resolves an ID to a workspace-relative path, accepting both
+// encoded and legacy IDs. An encoded ID wins unless only the legacy
+// interpretation names an existing file.
+func idToPath(root, id string) string {
+	decoded, ok := decodeID(id)
+	if !ok {
+		return legacyIDToPath(id)
+	}
+	if _, err := os.Stat(filepath.Join(root, decoded)); err == nil {
+		return decoded
+	}
+	legacy := legacyIDToPath(id)
+	if _, err := os.Stat(filepath.Join(root, legacy)); err == nil {
+		return legacy
+	}
+	return decoded
+}
+
+func isIgnored(root string, ignored *ignore.Matcher, path string, isDir bool) bool {
+	if ignored == nil {
+		return false
+	}
+	relPath, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return ignored.Match(relPath, isDir)
+}
+
+// skipLink reports whether a walked entry is a symlink that listings leave
+// out: links to directories, and links that resolve outside the workspace.
+func skipLink(root, path string, d fs.DirEntry) bool {
+	if d.Type()&fs.ModeSymlink == 0 {
+		return false
+	}
+	link := storage.InspectLink(root, path)
+	return !link.Inside || link.IsDir
+}
+
+func listDocuments(root, docType string, ignored *ignore.Matcher) ([]Document, error) {
 	ext := docTypeToExtension(docType)
 	var docs []Document
 
-	err := filepath.WalkDir(apiConfig.WorkspaceDir, func(path string, d fs.DirEntry, err error) error {
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
 		if err != nil || d.IsDir() {
-			if d != nil && d.IsDir() && d.Name() == ".git" {
+			if d != nil && d.IsDir() && (d.Name() == ".git" || isArchiveDir(root, path) || isTrashDir(root, path)) {
 				return filepath.SkipDir
 			}
+			if d != nil && d.IsDir() && path != root && isIgnored(root, ignored, path, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if isIgnored(root, ignored, path, false) {
 			return nil
 		}
 
-		if !strings.HasSuffix(path, ext) {
+		if extensionToDocType(path) != docType || !strings.HasSuffix(path, ext) {
 			return nil
 		}
 
-		info, err := d.Info()
+		if skipLink(root, path, d) {
+			return nil
+		}
+		info, err := os.Stat(path)
 		if err != nil {
 			return nil
 		}
 
-		relPath, _ := filepath.Rel(apiConfig.WorkspaceDir, path)
+		relPath, _ := filepath.Rel(root, path)
 		title := strings.TrimSuffix(filepath.Base(relPath), ext)
 
 		docs = append(docs, Document{
@@ -260,9 +547,9 @@ func listDocuments(docType string) ([]Document, error) {
 			Title:     title,
 			Path:      relPath,
 			Type:      docType,
-			CreatedAt: info.ModTime(), // Approximation
+			CreatedAt: createdAt(root, relPath, info.ModTime()),
 			UpdatedAt: info.ModTime(),
-			Size:      info.Size(),
+			Size:      documentSize(path, info),
 		})
 
 		return nil
@@ -273,46 +560,140 @@ func listDocuments(docType string) ([]Document, error) {
 
 // --- CRUD handlers ---
 
+// Document list pages hold defaultListLimit documents unless ?limit= asks
+// for more, up to maxListLimit.
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+// documentLess orders documents by a ?sort= field, ascending. Ties fall back
+// to the path so pages are stable.
+var documentLess = map[string]func(a, b Document) bool{
+	"updatedAt": func(a, b Document) bool { return a.UpdatedAt.Before(b.UpdatedAt) },
+	"createdAt": func(a, b Document) bool { return a.CreatedAt.Before(b.CreatedAt) },
+	"title":     func(a, b Document) bool { return strings.ToLower(a.Title) < strings.ToLower(b.Title) },
+	"size":      func(a, b Document) bool { return a.Size < b.Size },
+}
+
+// makeListHandler lists documents of docType a page at a time: ?page= (from
+// 1), ?limit=, ?sort= (updatedAt, createdAt, title or size) and ?order= (asc
+// or desc).
+// By default the first 50 come most recently updated first; title sorts
+// default to ascending.
 func makeListHandler(docType string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		docs, err := listDocuments(docType)
+		sortBy := c.Query("sort", "updatedAt")
+		less, ok := documentLess[sortBy]
+		if !ok {
+			return c.Status(400).JSON(APIResponse{Error: "sort must be updatedAt, createdAt, title or size"})
+		}
+		order := c.Query("order", "desc")
+		if sortBy == "title" {
+			order = c.Query("order", "asc")
+		}
+		if order != "asc" && order != "desc" {
+			return c.Status(400).JSON(APIResponse{Error: "order must be asc or desc"})
+		}
+		page := c.QueryInt("page", 1)
+		if page < 1 {
+			page = 1
+		}
+		limit := c.QueryInt("limit", defaultListLimit)
+		if limit <= 0 || limit > maxListLimit {
+			limit = defaultListLimit
+		}
+
+		root := workspaceRoot(c)
+		all, err := listDocuments(root, docType, ignore.ForRequest(c, root))
 		if err != nil {
 			return c.Status(500).JSON(APIResponse{Error: err.Error()})
 		}
-		if docs == nil {
-			docs = []Document{}
+		docs := []Document{}
+		for _, doc := range all {
+			if pathAllowed(c, doc.Path, false) {
+				docs = append(docs, doc)
+			}
+		}
+
+		sort.Slice(docs, func(i, j int) bool {
+			a, b := docs[i], docs[j]
+			if order == "desc" {
+				a, b = b, a
+			}
+			if less(a, b) != less(b, a) {
+				return less(a, b)
+			}
+			return docs[i].Path < docs[j].Path
+		})
+		total := len(docs)
+		start := (page - 1) * limit
+		if start > total {
+			start = total
 		}
-		return c.JSON(APIResponse{Data: docs})
+		end := start + limit
+		if end > total {
+			end = total
+		}
+
+		return c.JSON(APIResponse{Data: map[string]interface{}{
+			"results": docs[start:end],
+			"total":   total,
+			"page":    page,
+			"limit":   limit,
+		}})
 	}
 }
 
+// wantContent reports whether a document response should carry the content.
+// Clients that already hold it (e.g. right after a save) pass ?content=false
+// to get just the metadata.
+func wantContent(c *fiber.Ctx) bool {
+	return c.QueryBool("content", true)
+}
+
 func makeGetHandler(docType string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		root := workspaceRoot(c)
 		id := c.Params("id")
-		relPath := idToPath(id)
-		fullPath := filepath.Join(apiConfig.WorkspaceDir, relPath)
+		relPath := idToPath(root, id)
+		fullPath, err := storage.ResolveInRoot(root, relPath)
 
-		if !strings.HasPrefix(fullPath, apiConfig.WorkspaceDir) {
+		if err != nil || !pathAllowed(c, relPath, false) {
 			return c.Status(403).JSON(APIResponse{Error: "Access denied"})
 		}
 
-		content, err := os.ReadFile(fullPath)
-		if err != nil {
+		info, err := os.Stat(fullPath)
+		if err != nil || info.IsDir() {
 			return c.Status(404).JSON(APIResponse{Error: "Document not found"})
 		}
 
-		info, _ := os.Stat(fullPath)
+		// The ETag covers the document, with or without its content
+		etag := documentETag(info)
+		c.Set(fiber.HeaderETag, etag)
+		if ifNoneMatch := c.Get(fiber.HeaderIfNoneMatch); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag) {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+
 		ext := docTypeToExtension(docType)
 		title := strings.TrimSuffix(filepath.Base(relPath), ext)
 
 		doc := Document{
-			ID:        id,
+			ID:        pathToID(relPath),
 			Title:     title,
 			Path:      relPath,
 			Type:      docType,
-			Content:   string(content),
+			CreatedAt: createdAt(root, relPath, info.ModTime()),
 			UpdatedAt: info.ModTime(),
-			Size:      info.Size(),
+			Size:      documentSize(fullPath, info),
+		}
+
+		if wantContent(c) {
+			content, err := storage.ReadFile(fullPath)
+			if err != nil {
+				return c.Status(404).JSON(APIResponse{Error: "Document not found"})
+			}
+			doc.Content = string(content)
 		}
 
 		return c.JSON(APIResponse{Data: doc})
@@ -322,146 +703,334 @@ func makeGetHandler(docType string) fiber.Handler {
 func makeCreateHandler(docType string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		var req CreateDocumentRequest
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(400).JSON(APIResponse{Error: "Invalid request body"})
+		if errs := validation.ParseBody(c, &req); errs != nil {
+			return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
 		}
+		return createDocument(c, docType, req.Title, req.Folder, req.Content)
+	}
+}
 
-		if req.Title == "" {
-			return c.Status(400).JSON(APIResponse{Error: "title is required"})
-		}
+// createDocument writes a new document of docType titled title in folder
+// and responds with it. Empty content starts the type's new document.
+func createDocument(c *fiber.Ctx, docType, title, folder, content string) error {
+	root := workspaceRoot(c)
+	if title = storage.NormalizeName(title); title == "" {
+		return c.Status(400).JSON(APIResponse{Error: "title must not be blank"})
+	}
 
-		ext := docTypeToExtension(docType)
-		folder := req.Folder
-		if folder == "" {
-			folder = "."
-		}
-		relPath := filepath.Join(folder, req.Title+ext)
-		fullPath := filepath.Join(apiConfig.WorkspaceDir, relPath)
+	ext := docTypeToExtension(docType)
+	if folder = storage.NormalizePath(folder); folder == "" {
+		folder = "."
+	}
+	relPath := filepath.Join(folder, title+ext)
+	fullPath, err := storage.ResolveInRoot(root, relPath)
 
-		if !strings.HasPrefix(fullPath, apiConfig.WorkspaceDir) {
+	if err != nil || !pathAllowed(c, relPath, true) {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+	}
+
+	if err := storage.FindCollision(root, relPath, foldNameCase(c, root)); err != nil {
+		return c.Status(409).JSON(APIResponse{Error: err.Error()})
+	}
+
+	if _, err := os.Stat(fullPath); err == nil {
+		return c.Status(409).JSON(APIResponse{Error: "Document already exists"})
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return c.Status(500).JSON(APIResponse{Error: err.Error()})
+	}
+
+	if content == "" {
+		content = newDocumentContent(docType, title)
+	}
+
+	if err := storage.WriteFile(fullPath, []byte(content), shouldCompress(c, len(content)), 0644); err != nil {
+		return c.Status(500).JSON(APIResponse{Error: err.Error()})
+	}
+	indexChanged(root, relPath)
+
+	// Fire webhook
+	go FireEvent(requestID(c), eventScope(c, relPath), docType[:len(docType)-1]+".created", map[string]interface{}{
+		"id":    pathToID(relPath),
+		"title": title,
+		"type":  docType,
+		"path":  relPath,
+	})
+
+	info, _ := os.Stat(fullPath)
+	c.Set(fiber.HeaderETag, documentETag(info))
+	doc := Document{
+		ID:        pathToID(relPath),
+		Title:     title,
+		Path:      relPath,
+		Type:      docType,
+		CreatedAt: info.ModTime(),
+		UpdatedAt: info.ModTime(),
+		Size:      documentSize(fullPath, info),
+	}
+	if wantContent(c) {
+		doc.Content = content
+	}
+
+	return c.Status(201).JSON(APIResponse{Data: doc})
+}
+
+func makeUpdateHandler(docType string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		root := workspaceRoot(c)
+		id := c.Params("id")
+		relPath := idToPath(root, id)
+		fullPath, err := storage.ResolveInRoot(root, relPath)
+
+		if err != nil || !pathAllowed(c, relPath, true) {
 			return c.Status(403).JSON(APIResponse{Error: "Access denied"})
 		}
 
-		if _, err := os.Stat(fullPath); err == nil {
-			return c.Status(409).JSON(APIResponse{Error: "Document already exists"})
+		unlock := storage.LockPath(fullPath)
+		defer unlock()
+		current, err := os.Stat(fullPath)
+		if os.IsNotExist(err) {
+			return c.Status(404).JSON(APIResponse{Error: "Document not found"})
 		}
-
-		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
-			return c.Status(500).JSON(APIResponse{Error: err.Error()})
+		if err == nil && preconditionFailed(c, current) {
+			return c.Status(412).JSON(APIResponse{Error: "Document was changed since it was read; fetch it again"})
 		}
 
-		content := req.Content
-		if content == "" {
-			switch docType {
-			case "docs":
-				content = "# " + req.Title + "\n"
-			case "sheets":
-				content = `{"cells":{},"meta":{"title":"` + req.Title + `"}}`
-			case "slides":
-				content = `{"slides":[],"meta":{"title":"` + req.Title + `"}}`
-			case "databases":
-				content = `{"columns":[],"rows":[],"meta":{"title":"` + req.Title + `"}}`
-			}
+		var req UpdateDocumentRequest
+		if errs := validation.ParseBody(c, &req); errs != nil {
+			return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
 		}
 
-		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+		if err := storage.WriteFile(fullPath, []byte(req.Content), shouldCompress(c, len(req.Content)), 0644); err != nil {
 			return c.Status(500).JSON(APIResponse{Error: err.Error()})
 		}
+		unlock()
+		indexChanged(root, relPath)
 
 		// Fire webhook
-		go FireEvent(docType[:len(docType)-1]+".created", map[string]interface{}{
-			"id":    pathToID(relPath),
-			"title": req.Title,
-			"type":  docType,
-			"path":  relPath,
+		eventName := docType[:len(docType)-1] + ".updated"
+		go FireEvent(requestID(c), eventScope(c, relPath), eventName, map[string]interface{}{
+			"id":   pathToID(relPath),
+			"type": docType,
+			"path": relPath,
 		})
 
 		info, _ := os.Stat(fullPath)
+		c.Set(fiber.HeaderETag, documentETag(info))
+		ext := docTypeToExtension(docType)
+		title := strings.TrimSuffix(filepath.Base(relPath), ext)
+
 		doc := Document{
 			ID:        pathToID(relPath),
-			Title:     req.Title,
+			Title:     title,
 			Path:      relPath,
 			Type:      docType,
-			Content:   content,
-			CreatedAt: info.ModTime(),
 			UpdatedAt: info.ModTime(),
-			Size:      info.Size(),
+			Size:      documentSize(fullPath, info),
+		}
+		if wantContent(c) {
+			doc.Content = req.Content
 		}
 
-		return c.Status(201).JSON(APIResponse{Data: doc})
+		return c.JSON(APIResponse{Data: doc})
 	}
 }
 
-func makeUpdateHandler(docType string) fiber.Handler {
+// makeRenameHandler changes a document's title, renaming its file in place
+// and keeping the type extension. The document's ID changes with its path.
+func makeRenameHandler(docType string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		root := workspaceRoot(c)
 		id := c.Params("id")
-		relPath := idToPath(id)
-		fullPath := filepath.Join(apiConfig.WorkspaceDir, relPath)
+		relPath := idToPath(root, id)
+		fullPath, err := storage.ResolveInRoot(root, relPath)
 
-		if !strings.HasPrefix(fullPath, apiConfig.WorkspaceDir) {
+		if err != nil || !pathAllowed(c, relPath, true) {
 			return c.Status(403).JSON(APIResponse{Error: "Access denied"})
 		}
 
-		if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+		info, err := os.Stat(fullPath)
+		if err != nil || info.IsDir() {
 			return c.Status(404).JSON(APIResponse{Error: "Document not found"})
 		}
 
-		var req UpdateDocumentRequest
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(400).JSON(APIResponse{Error: "Invalid request body"})
+		var req RenameDocumentRequest
+		if errs := validation.ParseBody(c, &req); errs != nil {
+			return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
+		}
+		if req.Title = storage.NormalizeName(req.Title); req.Title == "" {
+			return c.Status(400).JSON(APIResponse{Error: "title must not be blank"})
+		}
+		if strings.ContainsAny(req.Title, `/\`) {
+			// Renaming doesn't move documents between folders
+			return c.Status(400).JSON(APIResponse{Error: "title must not contain a path separator"})
 		}
 
-		if err := os.WriteFile(fullPath, []byte(req.Content), 0644); err != nil {
-			return c.Status(500).JSON(APIResponse{Error: err.Error()})
+		ext := docTypeToExtension(docType)
+		newRelPath := filepath.Join(filepath.Dir(relPath), req.Title+ext)
+		newFullPath, err := storage.ResolveInRoot(root, newRelPath)
+		if err != nil || !pathAllowed(c, newRelPath, true) {
+			return c.Status(403).JSON(APIResponse{Error: "Access denied"})
 		}
 
-		// Fire webhook
-		eventName := docType[:len(docType)-1] + ".updated"
-		go FireEvent(eventName, map[string]interface{}{
-			"id":   id,
-			"type": docType,
-			"path": relPath,
-		})
+		if newRelPath != relPath {
+			// A name differing only in case or normalization may be this
+			// document itself, in which case the rename just respells it
+			var collision *storage.CollisionError
+			if err := storage.FindCollision(root, newRelPath, foldNameCase(c, root)); errors.As(err, &collision) && collision.Existing != relPath {
+				return c.Status(409).JSON(APIResponse{Error: err.Error()})
+			}
+			if existing, err := os.Stat(newFullPath); err == nil && !os.SameFile(existing, info) {
+				return c.Status(409).JSON(APIResponse{Error: "Document already exists"})
+			}
+			if err := os.Rename(fullPath, newFullPath); err != nil {
+				return c.Status(500).JSON(APIResponse{Error: err.Error()})
+			}
+			indexChanged(root, relPath, newRelPath)
+
+			// Fire webhook
+			go FireEvent(requestID(c), eventScope(c, relPath, newRelPath), docType[:len(docType)-1]+".renamed", map[string]interface{}{
+				"id":           pathToID(newRelPath),
+				"title":        req.Title,
+				"type":         docType,
+				"path":         newRelPath,
+				"previousId":   pathToID(relPath),
+				"previousPath": relPath,
+			})
+		}
+
+		info, _ = os.Stat(newFullPath)
+		return c.JSON(APIResponse{Data: Document{
+			ID:        pathToID(newRelPath),
+			Title:     req.Title,
+			Path:      newRelPath,
+			Type:      docType,
+			UpdatedAt: info.ModTime(),
+			Size:      documentSize(newFullPath, info),
+		}})
+	}
+}
+
+// makeMoveHandler moves a document to another folder, creating it if needed,
+// and keeps the type extension. The document's ID changes with its path.
+func makeMoveHandler(docType string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		root := workspaceRoot(c)
+		id := c.Params("id")
+		relPath := idToPath(root, id)
+		fullPath, err := storage.ResolveInRoot(root, relPath)
+
+		if err != nil || !pathAllowed(c, relPath, true) {
+			return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+		}
+
+		info, err := os.Stat(fullPath)
+		if err != nil || info.IsDir() {
+			return c.Status(404).JSON(APIResponse{Error: "Document not found"})
+		}
+
+		var req MoveDocumentRequest
+		if errs := validation.ParseBody(c, &req); errs != nil {
+			return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
+		}
 
-		info, _ := os.Stat(fullPath)
 		ext := docTypeToExtension(docType)
 		title := strings.TrimSuffix(filepath.Base(relPath), ext)
+		if req.Title != "" {
+			if title = storage.NormalizeName(req.Title); title == "" {
+				return c.Status(400).JSON(APIResponse{Error: "title must not be blank"})
+			}
+			if strings.ContainsAny(title, `/\`) {
+				return c.Status(400).JSON(APIResponse{Error: "title must not contain a path separator; use folder"})
+			}
+		}
+		folder := storage.NormalizePath(req.Folder)
+		if folder == "" {
+			folder = "."
+		}
+		if top := strings.Split(filepath.Clean(folder), string(filepath.Separator))[0]; top == ArchiveDir || top == TrashDir {
+			return c.Status(400).JSON(APIResponse{Error: "Documents can't be moved into " + top})
+		}
 
-		doc := Document{
-			ID:        id,
+		newRelPath := filepath.Join(folder, title+ext)
+		newFullPath, err := storage.ResolveInRoot(root, newRelPath)
+		if err != nil || !pathAllowed(c, newRelPath, true) {
+			return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+		}
+
+		if newRelPath != relPath {
+			// As with renames, a name differing only in case or
+			// normalization may be this document itself
+			var collision *storage.CollisionError
+			if err := storage.FindCollision(root, newRelPath, foldNameCase(c, root)); errors.As(err, &collision) && collision.Existing != relPath {
+				return c.Status(409).JSON(APIResponse{Error: err.Error()})
+			}
+			if existing, err := os.Stat(newFullPath); err == nil && !os.SameFile(existing, info) {
+				return c.Status(409).JSON(APIResponse{Error: "Document already exists"})
+			}
+			if err := os.MkdirAll(filepath.Dir(newFullPath), 0755); err != nil {
+				return c.Status(500).JSON(APIResponse{Error: err.Error()})
+			}
+			if err := os.Rename(fullPath, newFullPath); err != nil {
+				return c.Status(500).JSON(APIResponse{Error: err.Error()})
+			}
+			indexChanged(root, relPath, newRelPath)
+
+			// Fire webhook
+			go FireEvent(requestID(c), eventScope(c, relPath, newRelPath), docType[:len(docType)-1]+".moved", map[string]interface{}{
+				"id":           pathToID(newRelPath),
+				"title":        title,
+				"type":         docType,
+				"path":         newRelPath,
+				"previousId":   pathToID(relPath),
+				"previousPath": relPath,
+			})
+		}
+
+		info, _ = os.Stat(newFullPath)
+		return c.JSON(APIResponse{Data: Document{
+			ID:        pathToID(newRelPath),
 			Title:     title,
-			Path:      relPath,
+			Path:      newRelPath,
 			Type:      docType,
-			Content:   req.Content,
+			CreatedAt: createdAt(root, newRelPath, info.ModTime()),
 			UpdatedAt: info.ModTime(),
-			Size:      info.Size(),
-		}
-
-		return c.JSON(APIResponse{Data: doc})
+			Size:      documentSize(newFullPath, info),
+		}})
 	}
 }
 
 func makeDeleteHandler(docType string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		root := workspaceRoot(c)
 		id := c.Params("id")
-		relPath := idToPath(id)
-		fullPath := filepath.Join(apiConfig.WorkspaceDir, relPath)
+		relPath := idToPath(root, id)
+		fullPath, err := storage.ResolveInRoot(root, relPath)
 
-		if !strings.HasPrefix(fullPath, apiConfig.WorkspaceDir) {
+		if err != nil || !pathAllowed(c, relPath, true) {
 			return c.Status(403).JSON(APIResponse{Error: "Access denied"})
 		}
 
-		if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+		unlock := storage.LockPath(fullPath)
+		defer unlock()
+		current, err := os.Stat(fullPath)
+		if os.IsNotExist(err) {
 			return c.Status(404).JSON(APIResponse{Error: "Document not found"})
 		}
+		if err == nil && preconditionFailed(c, current) {
+			return c.Status(412).JSON(APIResponse{Error: "Document was changed since it was read; fetch it again"})
+		}
 
 		if err := os.Remove(fullPath); err != nil {
 			return c.Status(500).JSON(APIResponse{Error: err.Error()})
 		}
+		unlock()
+		indexChanged(root, relPath)
 
 		// Fire webhook
-		go FireEvent(docType[:len(docType)-1]+".deleted", map[string]interface{}{
-			"id":   id,
+		go FireEvent(requestID(c), eventScope(c, relPath), docType[:len(docType)-1]+".deleted", map[string]interface{}{
+			"id":   pathToID(relPath),
 			"type": docType,
 			"path": relPath,
 		})
@@ -470,9 +1039,51 @@ func makeDeleteHandler(docType string) fiber.Handler {
 	}
 }
 
+// --- ID resolution ---
+
+// resolveHandler converts between document IDs and paths: ?path= returns the
+// ID for a path, ?id= returns the path for an encoded or legacy ID.
+func resolveHandler(c *fiber.Ctx) error {
+	root := workspaceRoot(c)
+	path := c.Query("path")
+	id := c.Query("id")
+
+	switch {
+	case path != "" && id != "":
+		return c.Status(400).JSON(APIResponse{Error: "specify either path or id, not both"})
+	case path != "":
+		relPath := filepath.Clean(filepath.FromSlash(path))
+		fullPath, err := storage.ResolveInRoot(root, relPath)
+		if err != nil {
+			return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+		}
+		_, err = os.Stat(fullPath)
+		return c.JSON(APIResponse{Data: map[string]interface{}{
+			"id":     pathToID(relPath),
+			"path":   filepath.ToSlash(relPath),
+			"exists": err == nil,
+		}})
+	case id != "":
+		relPath := idToPath(root, id)
+		fullPath, err := storage.ResolveInRoot(root, relPath)
+		if err != nil {
+			return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+		}
+		_, err = os.Stat(fullPath)
+		return c.JSON(APIResponse{Data: map[string]interface{}{
+			"id":     pathToID(relPath),
+			"path":   filepath.ToSlash(relPath),
+			"exists": err == nil,
+		}})
+	default:
+		return c.Status(400).JSON(APIResponse{Error: "path or id is required"})
+	}
+}
+
 // --- Search handler ---
 
 func searchHandler(c *fiber.Ctx) error {
+	root := workspaceRoot(c)
 	q := c.Query("q", "")
 	if q == "" {
 		return c.Status(400).JSON(APIResponse{Error: "q parameter required"})
@@ -486,54 +1097,60 @@ func searchHandler(c *fiber.Ctx) error {
 	}
 
 	qLower := strings.ToLower(q)
+	fuzzy := c.QueryBool("fuzzy")
 	var results []Document
 
-	filepath.WalkDir(apiConfig.WorkspaceDir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
-			if d != nil && d.IsDir() && d.Name() == ".git" {
-				return filepath.SkipDir
-			}
-			return nil
+	for _, f := range searchCandidates(root, qLower, ignore.ForRequest(c, root)) {
+		relPath := f.Path
+		if !pathAllowed(c, relPath, false) {
+			continue
 		}
-
-		relPath, _ := filepath.Rel(apiConfig.WorkspaceDir, path)
 		dt := extensionToDocType(relPath)
 
 		if docTypeFilter != "" && dt != docTypeFilter {
-			return nil
+			continue
 		}
 
+		ext := docTypeToExtension(dt)
+		title := strings.TrimSuffix(filepath.Base(relPath), ext)
+
 		// Check filename match
-		nameMatch := strings.Contains(strings.ToLower(filepath.Base(relPath)), qLower)
+		score := 0.0
+		if ns := nameScore(title, qLower, fuzzy); ns > 0 {
+			score = nameMatchBase + ns
+		}
 
 		// Check content match
-		contentMatch := false
-		content, err := os.ReadFile(path)
-		if err == nil {
-			contentMatch = strings.Contains(strings.ToLower(string(content)), qLower)
+		if f.ContentMatch {
+			if score == 0 {
+				score = contentMatchOnly
+			} else {
+				score += 0.1
+			}
 		}
 
-		if nameMatch || contentMatch {
-			info, _ := d.Info()
-			ext := docTypeToExtension(dt)
-			title := strings.TrimSuffix(filepath.Base(relPath), ext)
-
+		if score > 0 {
 			results = append(results, Document{
 				ID:        pathToID(relPath),
 				Title:     title,
 				Path:      relPath,
 				Type:      dt,
-				UpdatedAt: info.ModTime(),
-				Size:      info.Size(),
+				UpdatedAt: f.ModTime,
+				Size:      f.Size,
+				Score:     score,
 			})
 		}
+	}
 
-		if len(results) >= limit {
-			return filepath.SkipAll
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
 		}
-		return nil
+		return results[i].Path < results[j].Path
 	})
-
+	if len(results) > limit {
+		results = results[:limit]
+	}
 	if results == nil {
 		results = []Document{}
 	}
@@ -548,18 +1165,40 @@ func searchHandler(c *fiber.Ctx) error {
 // --- Export handler ---
 
 func exportHandler(c *fiber.Ctx) error {
+	root := workspaceRoot(c)
 	docType := c.Params("type")
 	id := c.Params("id")
 	format := c.Query("format", "markdown")
 
-	relPath := idToPath(id)
-	fullPath := filepath.Join(apiConfig.WorkspaceDir, relPath)
+	relPath := idToPath(root, id)
+	fullPath, err := storage.ResolveInRoot(root, relPath)
 
-	if !strings.HasPrefix(fullPath, apiConfig.WorkspaceDir) {
+	if err != nil || !pathAllowed(c, relPath, false) {
 		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
 	}
 
-	content, err := os.ReadFile(fullPath)
+	info, err := os.Stat(fullPath)
+	if err != nil || info.IsDir() {
+		return c.Status(404).JSON(APIResponse{Error: "Document not found"})
+	}
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	c.Set(fiber.HeaderLastModified, info.ModTime().UTC().Format(http.TimeFormat))
+
+	// The markdown export is the stored document itself, so HEAD can be
+	// answered from its size. Other formats are rendered and fasthttp drops
+	// the body for HEAD.
+	if format == "markdown" && c.Method() == fiber.MethodHead {
+		size, err := storage.Size(fullPath)
+		if err != nil {
+			return c.Status(500).JSON(APIResponse{Error: err.Error()})
+		}
+		c.Set("Content-Type", "text/markdown")
+		c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.md"`, filepath.Base(relPath)))
+		c.Response().Header.SetContentLength(int(size))
+		return nil
+	}
+
+	content, err := storage.ReadFile(fullPath)
 	if err != nil {
 		return c.Status(404).JSON(APIResponse{Error: "Document not found"})
 	}
@@ -570,31 +1209,36 @@ func exportHandler(c *fiber.Ctx) error {
 		c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.md"`, filepath.Base(relPath)))
 		return c.Send(content)
 	case "html":
-		// Simple markdown-to-HTML for docs, raw JSON for others
-		html := "<html><body>"
+		// Rendered markdown for docs, escaped raw JSON for others
+		title := strings.TrimSuffix(filepath.Base(relPath), docTypeToExtension(docType))
+		body := "<pre>" + html.EscapeString(string(content)) + "</pre>\n"
 		if docType == "docs" {
-			// Basic conversion
-			lines := strings.Split(string(content), "\n")
-			for _, line := range lines {
-				if strings.HasPrefix(line, "# ") {
-					html += "<h1>" + strings.TrimPrefix(line, "# ") + "</h1>\n"
-				} else if strings.HasPrefix(line, "## ") {
-					html += "<h2>" + strings.TrimPrefix(line, "## ") + "</h2>\n"
-				} else if strings.HasPrefix(line, "### ") {
-					html += "<h3>" + strings.TrimPrefix(line, "### ") + "</h3>\n"
-				} else if line == "" {
-					html += "<br>\n"
-				} else {
-					html += "<p>" + line + "</p>\n"
+			if body, err = renderMarkdown(content); err != nil {
+				return c.Status(500).JSON(APIResponse{Error: err.Error()})
+			}
+			// bundle=true embeds referenced images so the file stands alone
+			if c.QueryBool("bundle") {
+				bundler := newAssetBundler(c, root, relPath)
+				body = bundleImages(body, bundler)
+				if bundler.err != nil {
+					return c.Status(413).JSON(APIResponse{Error: bundler.err.Error()})
 				}
 			}
-		} else {
-			html += "<pre>" + string(content) + "</pre>"
 		}
-		html += "</body></html>"
-		c.Set("Content-Type", "text/html")
+		c.Set("Content-Type", "text/html; charset=utf-8")
 		c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.html"`, filepath.Base(relPath)))
-		return c.SendString(html)
+		return c.SendString(htmlDocument(title, body))
+	case "csv":
+		if docType != "sheets" {
+			return c.Status(400).JSON(APIResponse{Error: "CSV export is only available for sheets"})
+		}
+		csvData, err := sheetToCSV(content)
+		if err != nil {
+			return c.Status(422).JSON(APIResponse{Error: "Sheet is not valid JSON: " + err.Error()})
+		}
+		c.Set("Content-Type", "text/csv; charset=utf-8")
+		c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, strings.TrimSuffix(filepath.Base(relPath), docTypeToExtension(docType))))
+		return c.Send(csvData)
 	case "json":
 		c.Set("Content-Type", "application/json")
 		// If content is already JSON, send as-is; otherwise wrap
@@ -605,16 +1249,46 @@ func exportHandler(c *fiber.Ctx) error {
 		wrapped, _ := json.Marshal(map[string]string{"content": string(content)})
 		return c.Send(wrapped)
 	default:
-		return c.Status(400).JSON(APIResponse{Error: "Unsupported format. Use: markdown, html, json"})
+		return c.Status(400).JSON(APIResponse{Error: "Unsupported format. Use: markdown, html, json, csv"})
 	}
 }
 
 // --- Health handler ---
 
+// Subsystem is the result of probing one part of the server. The server
+// can't do its job without a critical one.
+type Subsystem struct {
+	Name     string
+	OK       bool
+	Critical bool
+}
+
+// healthHandler reports whether each subsystem is up. The status is
+// "degraded" when any is down, and the response is 503 when a critical one
+// is, so load balancers take the server out of rotation.
 func healthHandler(c *fiber.Ctx) error {
-	return c.JSON(map[string]interface{}{
+	health := map[string]interface{}{
 		"status":    "ok",
 		"timestamp": time.Now().Format(time.RFC3339),
 		"version":   "1.0.0",
-	})
+	}
+	if apiConfig != nil && apiConfig.Maintenance != nil {
+		health["maintenance"] = apiConfig.Maintenance()
+	}
+
+	status := fiber.StatusOK
+	if apiConfig != nil && apiConfig.Subsystems != nil {
+		subsystems := map[string]bool{}
+		for _, s := range apiConfig.Subsystems() {
+			subsystems[s.Name] = s.OK
+			if !s.OK {
+				health["status"] = "degraded"
+				if s.Critical {
+					status = fiber.StatusServiceUnavailable
+				}
+			}
+		}
+		health["subsystems"] = subsystems
+	}
+	return c.Status(status).JSON(health)
 }
@@ -0,0 +1,334 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"md-office-backend/storage"
+	"md-office-backend/validation"
+)
+
+func TestWorkspaceRoleMiddleware(t *testing.T) {
+	var levels []string
+	app := newTestAPI(t, &Config{CheckWorkspace: func(userID, level string) error {
+		levels = append(levels, level)
+		if level == "editor" {
+			return errors.New("insufficient permissions")
+		}
+		return nil
+	}})
+	app.Use(workspaceRoleMiddleware)
+	ok := func(c *fiber.Ctx) error { return c.JSON(APIResponse{Data: "ok"}) }
+	app.Get("/docs", ok)
+	app.Put("/docs/:id", ok)
+	app.Post("/archive", ok)
+
+	tests := []struct {
+		method, url string
+		want        int
+	}{
+		{"GET", "/docs", 200},
+		{"PUT", "/docs/x", 403},
+		{"POST", "/archive", 403},
+	}
+	for _, tt := range tests {
+		if status, resp := doJSON(t, app, tt.method, tt.url, nil); status != tt.want {
+			t.Errorf("viewer %s %s = %d %q, want %d", tt.method, tt.url, status, resp.Error, tt.want)
+		}
+	}
+	if want := []string{"viewer", "editor", "editor"}; !reflect.DeepEqual(levels, want) {
+		t.Errorf("checked levels %v, want %v", levels, want)
+	}
+}
+
+func TestCreateDocumentReportsFieldErrors(t *testing.T) {
+	root := t.TempDir()
+	app := newTestAPI(t, &Config{WorkspaceDir: root})
+	app.Post("/docs", makeCreateHandler("docs"))
+
+	status, resp := doJSON(t, app, "POST", "/docs", CreateDocumentRequest{Title: strings.Repeat("t", 201)})
+	if status != 400 {
+		t.Fatalf("create with a long title = %d, want 400", status)
+	}
+	want := validation.Errors{{Field: "title", Rule: "max", Message: "title must be at most 200 characters"}}
+	if !reflect.DeepEqual(resp.Fields, want) {
+		t.Errorf("fields = %+v, want %+v", resp.Fields, want)
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 0 {
+		t.Errorf("workspace not empty after a rejected create: %v", entries)
+	}
+}
+
+func TestCompressedDocumentsReadAsPlaintext(t *testing.T) {
+	root := t.TempDir()
+	app := newTestAPI(t, &Config{WorkspaceDir: root, ShouldCompress: func(userID string, size int) bool { return true }})
+	app.Post("/docs", makeCreateHandler("docs"))
+	app.Get("/docs/:id", makeGetHandler("docs"))
+
+	content := "# Plan\n\nship it\n"
+	status, resp := doJSON(t, app, "POST", "/docs", CreateDocumentRequest{Title: "Plan", Content: content})
+	if status != 200 && status != 201 {
+		t.Fatalf("create: %d %s", status, resp.Error)
+	}
+	raw, err := os.ReadFile(filepath.Join(root, "Plan.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !storage.IsCompressed(raw) {
+		t.Errorf("stored bytes are not gzip: %q", raw)
+	}
+
+	_, resp = doJSON(t, app, "GET", "/docs/"+pathToID("Plan.md"), nil)
+	doc, _ := resp.Data.(map[string]interface{})
+	if doc["content"] != content || doc["size"] != float64(len(content)) {
+		t.Errorf("read back %q (size %v), want %q", doc["content"], doc["size"], content)
+	}
+}
+
+func TestDocumentIDsAreReversible(t *testing.T) {
+	paths := []string{"a_b/c.md", "a/b/c.md", "a/b_c.md", "notes/ünïcode file.md"}
+	ids := map[string]string{}
+	for _, p := range paths {
+		id := pathToID(p)
+		if other, dup := ids[id]; dup {
+			t.Errorf("%q and %q share the ID %q", p, other, id)
+		}
+		ids[id] = p
+		if got, ok := decodeID(id); !ok || filepath.ToSlash(got) != p {
+			t.Errorf("decodeID(pathToID(%q)) = %q, %v", p, got, ok)
+		}
+	}
+
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{"a_b/c.md": "underscore", "a/b/c.md": "nested"})
+	app := newTestAPI(t, &Config{WorkspaceDir: root})
+	app.Get("/docs/:id", makeGetHandler("docs"))
+	app.Get("/resolve", resolveHandler)
+
+	content := func(id string) interface{} {
+		t.Helper()
+		_, resp := doJSON(t, app, "GET", "/docs/"+id, nil)
+		doc, _ := resp.Data.(map[string]interface{})
+		return doc["content"]
+	}
+	if got := content(pathToID("a_b/c.md")); got != "underscore" {
+		t.Errorf("a_b/c.md reads %v", got)
+	}
+	if got := content(pathToID("a/b/c.md")); got != "nested" {
+		t.Errorf("a/b/c.md reads %v", got)
+	}
+	// Old "/"→"_" IDs keep working during the transition
+	if got := content("a_b_c.md"); got != "nested" {
+		t.Errorf("legacy ID reads %v, want a/b/c.md", got)
+	}
+
+	_, resp := doJSON(t, app, "GET", "/resolve?path=a_b/c.md", nil)
+	byPath, _ := resp.Data.(map[string]interface{})
+	if byPath["id"] != pathToID("a_b/c.md") || byPath["exists"] != true {
+		t.Errorf("resolve by path = %v", byPath)
+	}
+	_, resp = doJSON(t, app, "GET", "/resolve?id="+pathToID("a/b/c.md"), nil)
+	byID, _ := resp.Data.(map[string]interface{})
+	if byID["path"] != "a/b/c.md" {
+		t.Errorf("resolve by id = %v", byID)
+	}
+	if status, _ := doJSON(t, app, "GET", "/resolve?path=../outside.md", nil); status != 403 {
+		t.Errorf("resolve outside the workspace = %d, want 403", status)
+	}
+}
+
+func TestIgnoreFileHidesDocuments(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		".mdofficeignore": "build/\n",
+		"notes.md":        "release output",
+		"build/out.md":    "generated output",
+	})
+	app := newTestAPI(t, &Config{WorkspaceDir: root})
+	app.Get("/docs", makeListHandler("docs"))
+	app.Get("/search", searchHandler)
+
+	paths := func(url string) []string {
+		t.Helper()
+		_, resp := doJSON(t, app, "GET", url, nil)
+		var got []string
+		docs, _ := resp.Data.(map[string]interface{})["results"].([]interface{})
+		for _, d := range docs {
+			got = append(got, d.(map[string]interface{})["path"].(string))
+		}
+		sort.Strings(got)
+		return got
+	}
+	if got := paths("/docs"); !reflect.DeepEqual(got, []string{"notes.md"}) {
+		t.Errorf("list = %v, want notes.md only", got)
+	}
+	if got := paths("/docs?includeIgnored=true"); !reflect.DeepEqual(got, []string{"build/out.md", "notes.md"}) {
+		t.Errorf("list with ignored paths = %v", got)
+	}
+	if got := paths("/search?q=output"); !reflect.DeepEqual(got, []string{"notes.md"}) {
+		t.Errorf("search = %v, want notes.md only", got)
+	}
+}
+
+func TestExportHead(t *testing.T) {
+	root := t.TempDir()
+	content := "# Plan\n\nship it\n"
+	if err := storage.WriteFile(filepath.Join(root, "Plan.md"), []byte(content), true, 0644); err != nil {
+		t.Fatal(err)
+	}
+	app := newTestAPI(t, &Config{WorkspaceDir: root})
+	app.Get("/export/:type/:id", exportHandler)
+	url := "/export/docs/" + pathToID("Plan.md")
+
+	send := func(method, url string) (*http.Response, string) {
+		t.Helper()
+		res, err := app.Test(httptest.NewRequest(method, url, nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return res, string(body)
+	}
+
+	res, body := send("HEAD", url)
+	if res.StatusCode != 200 || body != "" {
+		t.Errorf("HEAD = %d %q, want 200 and no body", res.StatusCode, body)
+	}
+	if got := res.Header.Get("Content-Length"); got != strconv.Itoa(len(content)) {
+		t.Errorf("HEAD Content-Length = %s, want the plaintext size %d", got, len(content))
+	}
+	if res.Header.Get("Content-Type") != "text/markdown" || res.Header.Get("Last-Modified") == "" || res.Header.Get("Cache-Control") == "" {
+		t.Errorf("HEAD headers = %v", res.Header)
+	}
+
+	res, body = send("GET", url)
+	if res.StatusCode != 200 || body != content {
+		t.Errorf("GET = %d %q, want %q", res.StatusCode, body, content)
+	}
+
+	if res, body = send("HEAD", url+"?format=html"); res.StatusCode != 200 || body != "" {
+		t.Errorf("HEAD as html = %d %q, want 200 and no body", res.StatusCode, body)
+	}
+	if res, _ = send("HEAD", "/export/docs/"+pathToID("missing.md")); res.StatusCode != 404 {
+		t.Errorf("HEAD of a missing document = %d, want 404", res.StatusCode)
+	}
+}
+
+func TestHealthReportsMaintenance(t *testing.T) {
+	maintenance := map[string]interface{}{"enabled": false}
+	app := newTestAPI(t, &Config{Maintenance: func() map[string]interface{} { return maintenance }})
+	app.Get("/health", healthHandler)
+
+	health := func() (int, map[string]interface{}) {
+		t.Helper()
+		res, err := app.Test(httptest.NewRequest("GET", "/health", nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var out map[string]interface{}
+		if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		state, _ := out["maintenance"].(map[string]interface{})
+		return res.StatusCode, state
+	}
+	if _, state := health(); state["enabled"] != false {
+		t.Errorf("maintenance = %v, want off", state)
+	}
+	maintenance = map[string]interface{}{"enabled": true, "message": "Backing up"}
+	if status, state := health(); status != 200 || state["enabled"] != true || state["message"] != "Backing up" {
+		t.Errorf("health = %d with maintenance %v, want 200 reporting it on", status, state)
+	}
+}
+
+func TestSymlinkedDocuments(t *testing.T) {
+	root, outside := t.TempDir(), t.TempDir()
+	writeTestFiles(t, root, map[string]string{"docs/a.md": "inside words"})
+	writeTestFiles(t, outside, map[string]string{"secret.md": "outside words"})
+	for link, target := range map[string]string{
+		"in.md":  filepath.Join(root, "docs", "a.md"),
+		"out.md": filepath.Join(outside, "secret.md"),
+		"outdir": outside,
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skip("symlinks not supported:", err)
+		}
+	}
+	app := newTestAPI(t, &Config{WorkspaceDir: root})
+	app.Get("/docs", makeListHandler("docs"))
+	app.Get("/docs/:id", makeGetHandler("docs"))
+	app.Get("/search", searchHandler)
+
+	paths := func(url string) []string {
+		t.Helper()
+		_, resp := doJSON(t, app, "GET", url, nil)
+		var got []string
+		docs, _ := resp.Data.(map[string]interface{})["results"].([]interface{})
+		for _, d := range docs {
+			got = append(got, d.(map[string]interface{})["path"].(string))
+		}
+		sort.Strings(got)
+		return got
+	}
+	if got := paths("/docs"); !reflect.DeepEqual(got, []string{"docs/a.md", "in.md"}) {
+		t.Errorf("list = %v, want the outside links left out", got)
+	}
+	if got := paths("/search?q=outside"); len(got) != 0 {
+		t.Errorf("search reached outside the workspace: %v", got)
+	}
+	if status, _ := doJSON(t, app, "GET", "/docs/"+pathToID("out.md"), nil); status != 403 && status != 404 {
+		t.Errorf("reading out.md = %d, want it refused", status)
+	}
+	if status, resp := doJSON(t, app, "GET", "/docs/"+pathToID("in.md"), nil); status != 200 || resp.Data.(map[string]interface{})["content"] != "inside words" {
+		t.Errorf("reading in.md = %d %v", status, resp.Data)
+	}
+}
+
+func TestContentCanBeOmitted(t *testing.T) {
+	app := newTestAPI(t, &Config{WorkspaceDir: t.TempDir()})
+	app.Post("/docs", makeCreateHandler("docs"))
+	app.Get("/docs/:id", makeGetHandler("docs"))
+	app.Put("/docs/:id", makeUpdateHandler("docs"))
+	id := pathToID("Plan.md")
+
+	check := func(what string, resp APIResponse, want string) {
+		t.Helper()
+		doc, _ := resp.Data.(map[string]interface{})
+		if resp.Error != "" || doc["path"] != "Plan.md" {
+			t.Fatalf("%s: %+v", what, resp)
+		}
+		content, present := doc["content"]
+		if want == "" && present {
+			t.Errorf("%s returned content %q, want it omitted", what, content)
+		}
+		if want != "" && content != want {
+			t.Errorf("%s returned content %v, want %q", what, content, want)
+		}
+	}
+
+	_, resp := doJSON(t, app, "POST", "/docs?content=false", CreateDocumentRequest{Title: "Plan", Content: "# Plan\n"})
+	check("create with ?content=false", resp, "")
+	_, resp = doJSON(t, app, "GET", "/docs/"+id, nil)
+	check("get", resp, "# Plan\n")
+	_, resp = doJSON(t, app, "GET", "/docs/"+id+"?content=false", nil)
+	check("get with ?content=false", resp, "")
+
+	_, resp = doJSON(t, app, "PUT", "/docs/"+id+"?content=false", UpdateDocumentRequest{Content: "# Plan v2\n"})
+	check("update with ?content=false", resp, "")
+	_, resp = doJSON(t, app, "PUT", "/docs/"+id, UpdateDocumentRequest{Content: "# Plan v2\n"})
+	check("update", resp, "# Plan v2\n")
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"md-office-backend/ignore"
+	"md-office-backend/storage"
+)
+
+// IndexedFile is a file of a workspace search index, as Config.SearchFiles
+// reports it.
+type IndexedFile struct {
+	Path         string // workspace-relative
+	ModTime      time.Time
+	Size         int64
+	ContentMatch bool // content contains the query, ignoring case
+}
+
+// searchCandidates returns the files under root a search for the lowercase
+// query looks at. With Config.SearchFiles they come from the search index,
+// which holds the workspace's text files outside dot-directories (.git and
+// the archive among them); otherwise every file is read.
+func searchCandidates(root, qLower string, ignored *ignore.Matcher) []IndexedFile {
+	if apiConfig != nil && apiConfig.SearchFiles != nil {
+		var files []IndexedFile
+		for _, f := range apiConfig.SearchFiles(root, qLower) {
+			if !ignored.Match(f.Path, false) {
+				files = append(files, f)
+			}
+		}
+		return files
+	}
+
+	var files []IndexedFile
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			if d != nil && d.IsDir() && (d.Name() == ".git" || isArchiveDir(root, path) || isTrashDir(root, path)) {
+				return filepath.SkipDir
+			}
+			if d != nil && d.IsDir() && path != root && isIgnored(root, ignored, path, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if isIgnored(root, ignored, path, false) || skipLink(root, path, d) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		relPath, _ := filepath.Rel(root, path)
+		content, err := storage.ReadFile(path)
+		files = append(files, IndexedFile{
+			Path:         relPath,
+			ModTime:      info.ModTime(),
+			Size:         documentSize(path, info),
+			ContentMatch: err == nil && strings.Contains(strings.ToLower(string(content)), qLower),
+		})
+		return nil
+	})
+	return files
+}
+
+// indexChanged tells the search index that relPaths under root were
+// written, moved away or deleted.
+func indexChanged(root string, relPaths ...string) {
+	if apiConfig == nil || apiConfig.FileChanged == nil {
+		return
+	}
+	for _, p := range relPaths {
+		apiConfig.FileChanged(root, p)
+	}
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"md-office-backend/storage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Sheet cells are keyed the way the editor keys them: column letters then
+// the 1-based row, e.g. "A1", "B2", "AA10". Columns count A..Z, AA..AZ,
+// BA.. (bijective base 26), so column 1 is A, 26 is Z and 27 is AA. In CSV,
+// record r (1-based) is row r and field c is column c; a cell missing from
+// the sheet is an empty field.
+
+// maxCSVImportSize bounds the CSV accepted by the sheet import.
+const maxCSVImportSize = 10 << 20
+
+// cellRef returns the key of the cell at 1-based col and row.
+func cellRef(col, row int) string {
+	var letters []byte
+	for ; col > 0; col = (col - 1) / 26 {
+		letters = append([]byte{byte('A' + (col-1)%26)}, letters...)
+	}
+	return string(letters) + strconv.Itoa(row)
+}
+
+// parseCellRef returns the 1-based column and row of a cell key, or false
+// if key isn't one.
+func parseCellRef(key string) (col, row int, ok bool) {
+	i := 0
+	for ; i < len(key) && key[i] >= 'A' && key[i] <= 'Z'; i++ {
+		col = col*26 + int(key[i]-'A'+1)
+		if col > 1<<20 {
+			return 0, 0, false
+		}
+	}
+	if i == 0 || i == len(key) || key[i] == '0' {
+		return 0, 0, false
+	}
+	row, err := strconv.Atoi(key[i:])
+	if err != nil || row < 1 || row > 1<<20 {
+		return 0, 0, false
+	}
+	return col, row, true
+}
+
+// cellText returns what a cell shows: its computed value, else its value,
+// else its formula. Cells may also be stored as bare values.
+func cellText(raw json.RawMessage) string {
+	var cell struct {
+		Value    interface{} `json:"value"`
+		Formula  string      `json:"formula"`
+		Computed interface{} `json:"computed"`
+	}
+	if err := json.Unmarshal(raw, &cell); err != nil {
+		var value interface{}
+		json.Unmarshal(raw, &value)
+		return scalarText(value)
+	}
+	if text := scalarText(cell.Computed); text != "" {
+		return text
+	}
+	if text := scalarText(cell.Value); text != "" {
+		return text
+	}
+	return cell.Formula
+}
+
+func scalarText(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// sheetToCSV flattens a sheet's cells into a rectangular grid from A1 to
+// the last used row and column. Keys that aren't cell references are left
+// out.
+func sheetToCSV(content []byte) ([]byte, error) {
+	var sheet struct {
+		Cells map[string]json.RawMessage `json:"cells"`
+	}
+	if err := json.Unmarshal(content, &sheet); err != nil {
+		return nil, err
+	}
+
+	type position struct{ col, row int }
+	values := map[position]string{}
+	cols, rows := 0, 0
+	for key, raw := range sheet.Cells {
+		col, row, ok := parseCellRef(key)
+		if !ok {
+			continue
+		}
+		text := cellText(raw)
+		if text == "" {
+			continue
+		}
+		values[position{col, row}] = text
+		if col > cols {
+			cols = col
+		}
+		if row > rows {
+			rows = row
+		}
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	record := make([]string, cols)
+	for row := 1; row <= rows; row++ {
+		for col := 1; col <= cols; col++ {
+			record[col-1] = values[position{col, row}]
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// csvToSheet builds sheet content titled title from CSV. Empty fields get
+// no cell; fields starting with "=" become formulas for the editor to
+// compute. Rows may have different lengths.
+func csvToSheet(r io.Reader, title string) (string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	cells := map[string]map[string]string{}
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		for i, value := range record {
+			if row == 1 && i == 0 {
+				value = strings.TrimPrefix(value, "\ufeff")
+			}
+			if value == "" {
+				continue
+			}
+			cell := map[string]string{"value": value}
+			if strings.HasPrefix(value, "=") {
+				cell = map[string]string{"value": "", "formula": value}
+			}
+			cells[cellRef(i+1, row)] = cell
+		}
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"cells": cells,
+		"meta":  map[string]string{"title": title},
+	})
+	return string(data), err
+}
+
+// importSheetHandler creates a sheet from an uploaded CSV, sent as the
+// multipart field "file". The title is the form's "title", or the file
+// name without its extension; "folder" places it like a created sheet.
+func importSheetHandler(c *fiber.Ctx) error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(APIResponse{Error: "No file provided"})
+	}
+	if file.Size > maxCSVImportSize {
+		return c.Status(413).JSON(APIResponse{Error: fmt.Sprintf("CSV exceeds %d bytes", maxCSVImportSize)})
+	}
+
+	title := c.FormValue("title")
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(file.Filename), filepath.Ext(file.Filename))
+	}
+	title = storage.NormalizeName(title)
+
+	f, err := file.Open()
+	if err != nil {
+		return c.Status(500).JSON(APIResponse{Error: "Failed to read file"})
+	}
+	defer f.Close()
+
+	content, err := csvToSheet(f, title)
+	if err != nil {
+		return c.Status(400).JSON(APIResponse{Error: "Invalid CSV: " + err.Error()})
+	}
+	return createDocument(c, "sheets", title, c.FormValue("folder"), content)
+}
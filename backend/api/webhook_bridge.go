@@ -1,8 +1,30 @@
 package api
 
-import "md-office-backend/webhooks"
+import (
+	"md-office-backend/webhooks"
 
-// FireEvent dispatches a webhook event
-func FireEvent(event string, payload interface{}) {
-	webhooks.FireEvent(event, payload)
+	"github.com/gofiber/fiber/v2"
+)
+
+// FireEvent dispatches a webhook event tagged with the originating request's
+// ID. Pass requestID(c) and eventScope(c, ...), not c: the context is reused
+// once the handler returns.
+func FireEvent(requestID string, scope webhooks.Scope, event string, payload interface{}) {
+	webhooks.FireEvent(requestID, scope, event, payload)
+}
+
+// eventScope is the caller's workspace and the documents an event names, so
+// only subscribers who can see them receive it.
+func eventScope(c *fiber.Ctx, paths ...string) webhooks.Scope {
+	scope := webhooks.Scope{Paths: paths}
+	if apiConfig != nil && apiConfig.WorkspaceIDFor != nil {
+		scope.WorkspaceID = apiConfig.WorkspaceIDFor(apiUserID(c))
+	}
+	return scope
+}
+
+// requestID returns the X-Request-ID the server assigned the request.
+func requestID(c *fiber.Ctx) string {
+	id, _ := c.Locals("requestID").(string)
+	return id
 }
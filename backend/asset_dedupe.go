@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Upload deduplication: with dedupe on (dedupe=true on the upload, or the
+// workspace's dedupeUploads setting), an upload whose bytes match a file
+// already in the target directory gets that file back instead of a copy.
+// Files handed out this way are recorded so deleteItem can refuse to remove
+// them while documents still link to them.
+
+type assetHash struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+var (
+	assetHashesMu sync.Mutex
+	assetHashes   = map[string]assetHash{} // full path -> last computed hash
+
+	dedupedAssetsMu sync.Mutex
+)
+
+func wantDedupe(c *fiber.Ctx, ws *Workspace) bool {
+	if v := c.FormValue("dedupe"); v != "" {
+		if on, err := strconv.ParseBool(v); err == nil {
+			return on
+		}
+	}
+	return ws.Settings.DedupeUploads
+}
+
+func hashReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashUpload(file *multipart.FileHeader) (string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return hashReader(f)
+}
+
+// cachedFileHash hashes a file, reusing the last result while its size and
+// modification time are unchanged.
+func cachedFileHash(path string, info os.FileInfo) (string, error) {
+	assetHashesMu.Lock()
+	cached, ok := assetHashes[path]
+	assetHashesMu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.sum, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sum, err := hashReader(f)
+	if err != nil {
+		return "", err
+	}
+
+	assetHashesMu.Lock()
+	assetHashes[path] = assetHash{size: info.Size(), modTime: info.ModTime(), sum: sum}
+	assetHashesMu.Unlock()
+	return sum, nil
+}
+
+// findDuplicateAsset returns the path of a file in dir with the given size
+// and content hash, or "" if there is none. Only files of the same size are
+// hashed.
+func findDuplicateAsset(dir string, size int64, sum string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.Size() != size {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if existing, err := cachedFileHash(path, info); err == nil && existing == sum {
+			return path
+		}
+	}
+	return ""
+}
+
+// Deduplicated assets are kept per workspace in deduped-assets.json in the
+// config directory ({"<workspace id>": ["assets/a.png", ...]}).
+func dedupedAssetsPath() string {
+	return filepath.Join(configDir, "deduped-assets.json")
+}
+
+func loadDedupedAssets() map[string][]string {
+	assets := map[string][]string{}
+	if data, err := os.ReadFile(dedupedAssetsPath()); err == nil {
+		json.Unmarshal(data, &assets)
+	}
+	return assets
+}
+
+func saveDedupedAssets(assets map[string][]string) error {
+	data, err := json.MarshalIndent(assets, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dedupedAssetsPath(), data, 0644)
+}
+
+func assetKey(relPath string) string {
+	return filepath.ToSlash(filepath.Clean(relPath))
+}
+
+func markDedupedAsset(workspaceID, relPath string) error {
+	dedupedAssetsMu.Lock()
+	defer dedupedAssetsMu.Unlock()
+
+	assets := loadDedupedAssets()
+	key := assetKey(relPath)
+	for _, p := range assets[workspaceID] {
+		if p == key {
+			return nil
+		}
+	}
+	assets[workspaceID] = append(assets[workspaceID], key)
+	sort.Strings(assets[workspaceID])
+	return saveDedupedAssets(assets)
+}
+
+func isDedupedAsset(workspaceID, relPath string) bool {
+	dedupedAssetsMu.Lock()
+	defer dedupedAssetsMu.Unlock()
+
+	key := assetKey(relPath)
+	for _, p := range loadDedupedAssets()[workspaceID] {
+		if p == key {
+			return true
+		}
+	}
+	return false
+}
+
+func forgetDedupedAsset(workspaceID, relPath string) error {
+	dedupedAssetsMu.Lock()
+	defer dedupedAssetsMu.Unlock()
+
+	assets := loadDedupedAssets()
+	key := assetKey(relPath)
+	kept := assets[workspaceID][:0]
+	for _, p := range assets[workspaceID] {
+		if p != key {
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) == len(assets[workspaceID]) {
+		return nil
+	}
+	if len(kept) == 0 {
+		delete(assets, workspaceID)
+	} else {
+		assets[workspaceID] = kept
+	}
+	return saveDedupedAssets(assets)
+}
+
+// assetReferences lists the documents that link to an asset, either by its
+// workspace path or by its upload URL.
+func assetReferences(ws *Workspace, relPath string) []string {
+	key := assetKey(relPath)
+	return indexFor(ws.Path).Referencing(key, uploadURL(key))
+}
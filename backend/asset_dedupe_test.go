@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func assetNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestUploadDeduplication(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "alice", Settings: WorkspaceSettings{DedupeUploads: true}}, nil)
+	t.Cleanup(func() { indexFor(ws.Path).Invalidate() })
+	user := "alice"
+	app := newTestApp(&user)
+	app.Post("/files/upload", uploadFile)
+	app.Delete("/files/:path", deleteItem)
+
+	upload := func(name, content string) map[string]interface{} {
+		t.Helper()
+		status, resp := uploadTestFile(t, app, "/files/upload", "", name, content)
+		if status != 200 || resp.Error != "" {
+			t.Fatalf("upload %s: %d %s", name, status, resp.Error)
+		}
+		return resp.Data.(map[string]interface{})
+	}
+
+	first := upload("a.png", "PNG bytes")
+	second := upload("b.png", "PNG bytes")
+	if second["path"] != first["path"] || second["url"] != first["url"] || second["deduplicated"] != true {
+		t.Errorf("second upload of the same bytes = %+v, want %s back", second, first["path"])
+	}
+	upload("c.png", "other bytes")
+	if names := assetNames(t, filepath.Join(ws.Path, "assets")); !reflect.DeepEqual(names, []string{"a.png", "c.png"}) {
+		t.Errorf("stored assets = %v, want one copy of the duplicate", names)
+	}
+
+	// A shared asset stays while a document links to it
+	writeTestFiles(t, ws.Path, map[string]string{"doc.md": "![a](" + first["url"].(string) + ")"})
+	indexFor(ws.Path).Invalidate()
+	if status, resp := doJSON(t, app, "DELETE", "/files/assets%2Fa.png", nil); status != 409 {
+		t.Errorf("delete of a referenced asset = %d %+v, want 409", status, resp)
+	}
+	if _, err := os.Stat(filepath.Join(ws.Path, "assets", "a.png")); err != nil {
+		t.Errorf("referenced asset removed: %v", err)
+	}
+
+	writeTestFiles(t, ws.Path, map[string]string{"doc.md": "no images"})
+	indexFor(ws.Path).Invalidate()
+	if status, resp := doJSON(t, app, "DELETE", "/files/assets%2Fa.png", nil); status != 200 || resp.Error != "" {
+		t.Errorf("delete of an unreferenced asset = %d %s", status, resp.Error)
+	}
+	if isDedupedAsset(ws.ID, "assets/a.png") {
+		t.Error("deleted asset is still tracked")
+	}
+}
+
+func TestUploadWithoutDedupeKeepsCopies(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "alice"}, nil)
+	user := "alice"
+	app := newTestApp(&user)
+	app.Post("/files/upload", uploadFile)
+
+	for _, name := range []string{"a.png", "b.png"} {
+		if _, resp := uploadTestFile(t, app, "/files/upload", "", name, "PNG bytes"); resp.Error != "" {
+			t.Fatalf("upload %s: %s", name, resp.Error)
+		}
+	}
+	if names := assetNames(t, filepath.Join(ws.Path, "assets")); !reflect.DeepEqual(names, []string{"a.png", "b.png"}) {
+		t.Errorf("stored assets = %v, want both uploads", names)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Browsers load images embedded in markdown without the Authorization
+// header, so the asset route also accepts the access token from a cookie.
+// Login and refresh set it alongside the token they return; it is scoped to
+// /files, HTTP-only and same-site, and only ever authorizes reads.
+const assetTokenCookie = "md_office_asset_token"
+
+// assetPathPrefix is where workspace files are served to the browser
+const assetPathPrefix = "/files"
+
+func setAssetCookie(c *fiber.Ctx, token string) {
+	c.Cookie(&fiber.Cookie{
+		Name:     assetTokenCookie,
+		Value:    token,
+		Path:     assetPathPrefix,
+		Expires:  time.Now().Add(accessTokenTTL),
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteStrictMode,
+	})
+}
+
+func clearAssetCookie(c *fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{
+		Name:     assetTokenCookie,
+		Path:     assetPathPrefix,
+		Expires:  time.Unix(0, 0),
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteStrictMode,
+	})
+}
+
+// assetAuthMiddleware authenticates like authMiddleware, falling back to the
+// asset cookie when the request has no Authorization header.
+func assetAuthMiddleware(c *fiber.Ctx) error {
+	if c.Get(fiber.HeaderAuthorization) == "" {
+		if token := c.Cookies(assetTokenCookie); token != "" {
+			c.Request().Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		}
+	}
+	return authMiddleware(c)
+}
@@ -132,16 +132,26 @@ func getConnectedProviders(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"data": providers})
 }
 
+// disconnectProvider revokes the token with the provider where it can and
+// deletes it locally; revocation failures come back as warnings.
 func disconnectProvider(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	provider := c.Params("provider")
 	giteaURL := c.Query("gitea_url", "")
 
+	// Revoking is best-effort; the local token goes either way
+	warnings := []string{}
+	if rec, err := GetToken(userID, provider, giteaURL); err == nil {
+		if err := RevokeToken(rec); err != nil {
+			warnings = append(warnings, "token could not be revoked with the provider: "+err.Error())
+		}
+	}
+
 	if err := DeleteToken(userID, provider, giteaURL); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to disconnect"})
 	}
 
-	return c.JSON(fiber.Map{"data": "disconnected"})
+	return c.JSON(fiber.Map{"data": "disconnected", "warnings": warnings})
 }
 
 func savePAT(c *fiber.Ctx) error {
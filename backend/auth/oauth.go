@@ -1,12 +1,16 @@
 package auth
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/oauth2"
@@ -96,6 +100,111 @@ func ExchangeCode(provider, giteaURL, code, callbackURL string) (*oauth2.Token,
 	return token, user, nil
 }
 
+// tokenExpirySkew renews tokens this long before they expire, so a token
+// doesn't lapse between GetValidToken and the request that uses it.
+const tokenExpirySkew = time.Minute
+
+// refreshMu serializes refreshes; providers that rotate refresh tokens
+// reject the old one once it has been used.
+var refreshMu sync.Mutex
+
+// GetValidToken is GetToken, renewing the access token with the stored
+// refresh token when it has expired (or is about to). Tokens without an
+// expiry, such as PATs, and expired tokens without a refresh token are
+// returned as stored.
+func GetValidToken(userID, provider, giteaURL string) (*TokenRecord, error) {
+	rec, err := GetToken(userID, provider, giteaURL)
+	if err != nil || !needsRefresh(rec) {
+		return rec, err
+	}
+
+	refreshMu.Lock()
+	defer refreshMu.Unlock()
+	// Another request may have refreshed it while we waited
+	rec, err = GetToken(userID, provider, giteaURL)
+	if err != nil || !needsRefresh(rec) {
+		return rec, err
+	}
+
+	cfg := GetOAuthConfig(provider, giteaURL, "")
+	if cfg == nil {
+		return nil, fmt.Errorf("unknown provider: %s", provider)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	token, err := cfg.TokenSource(ctx, &oauth2.Token{RefreshToken: rec.RefreshToken}).Token()
+	if err != nil {
+		return nil, fmt.Errorf("refresh %s token: %w", provider, err)
+	}
+	rec.AccessToken = token.AccessToken
+	if token.RefreshToken != "" {
+		rec.RefreshToken = token.RefreshToken
+	}
+	if token.TokenType != "" {
+		rec.TokenType = token.TokenType
+	}
+	rec.Expiry = token.Expiry
+	if err := SaveToken(rec); err != nil {
+		return nil, fmt.Errorf("save refreshed token: %w", err)
+	}
+	return rec, nil
+}
+
+func needsRefresh(rec *TokenRecord) bool {
+	return rec.RefreshToken != "" && !rec.Expiry.IsZero() && time.Now().Add(tokenExpirySkew).After(rec.Expiry)
+}
+
+// RevokeToken revokes rec's grant with the provider, so the token stops
+// working there too. Bitbucket and Gitea have no revocation API; for them
+// the user has to revoke access in the provider's settings.
+func RevokeToken(rec *TokenRecord) error {
+	cfg := GetOAuthConfig(rec.Provider, rec.GiteaURL, "")
+	if cfg == nil {
+		return fmt.Errorf("unknown provider: %s", rec.Provider)
+	}
+
+	var req *http.Request
+	var err error
+	switch rec.Provider {
+	case "github":
+		body, _ := json.Marshal(map[string]string{"access_token": rec.AccessToken})
+		req, err = http.NewRequest("DELETE", "https://api.github.com/applications/"+url.PathEscape(cfg.ClientID)+"/token", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth(cfg.ClientID, cfg.ClientSecret)
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("Content-Type", "application/json")
+	case "gitlab":
+		form := url.Values{
+			"client_id":     {cfg.ClientID},
+			"client_secret": {cfg.ClientSecret},
+			"token":         {rec.AccessToken},
+		}
+		req, err = http.NewRequest("POST", "https://gitlab.com/oauth/revoke", strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	default:
+		return fmt.Errorf("%s has no token revocation API; revoke access in your %s account settings", rec.Provider, rec.Provider)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
 // FetchProviderUser fetches user info from the provider API.
 func FetchProviderUser(provider, giteaURL, accessToken string) (*ProviderUser, error) {
 	switch provider {
@@ -91,6 +91,15 @@ func InitStore() error {
 	return nil
 }
 
+// Ping reports whether the database is open and answering queries.
+func Ping() error {
+	if db == nil {
+		return fmt.Errorf("store not initialized")
+	}
+	var one int
+	return db.QueryRow("SELECT 1").Scan(&one)
+}
+
 func loadOrGenerateKey(path string) ([]byte, error) {
 	data, err := os.ReadFile(path)
 	if err == nil && len(data) == 64 {
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/gofiber/fiber/v2"
+
+	"md-office-backend/storage"
+	"md-office-backend/validation"
+)
+
+// BatchOperation is one step of a batch. Deletes go to the trash.
+type BatchOperation struct {
+	Op      string `json:"op" validate:"required,oneof=create save delete mkdir"`
+	Path    string `json:"path" validate:"required,max=1024"`
+	Content string `json:"content,omitempty"`
+	// For save, as in SaveFileRequest
+	BaseHash string `json:"baseHash,omitempty" validate:"max=64"`
+}
+
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations" validate:"required,max=500"`
+	// Atomic batches are applied in full or not at all
+	Atomic bool `json:"atomic,omitempty"`
+	// Commit message; defaults to a count of the changes
+	Message string `json:"message,omitempty" validate:"max=500"`
+}
+
+// BatchResult reports how one operation went, in request order
+type BatchResult struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// errNotApplied marks the operations of an atomic batch that was undone
+var errNotApplied = errors.New("not applied: the batch was rolled back")
+
+// appliedOp is an operation that changed the workspace, with how to undo
+// it and what to announce once the batch stands.
+type appliedOp struct {
+	undo  func() error
+	after func()
+}
+
+// batchFiles applies several file operations, holding the lock of every file
+// they touch, and commits them together. Each operation is checked as its own endpoint
+// would check it; failures are reported per operation, and in an atomic
+// batch the first one undoes everything applied before it.
+func batchFiles(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	ws, err := checkWorkspacePermission(userID, "editor")
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	var req BatchRequest
+	if errs := validation.ParseBody(c, &req); errs != nil {
+		return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
+	}
+
+	var fullPaths []string
+	for _, op := range req.Operations {
+		if fullPath, err := resolveWithinWorkspace(ws, batchOpPath(op)); err == nil {
+			fullPaths = append(fullPaths, fullPath)
+		}
+	}
+	unlock := storage.LockPaths(fullPaths)
+	defer unlock()
+
+	username := c.Locals("username").(string)
+	results := make([]BatchResult, len(req.Operations))
+	var applied []appliedOp
+	failed := -1
+	for i, op := range req.Operations {
+		results[i] = BatchResult{Op: op.Op, Path: op.Path}
+		done, err := applyBatchOperation(c, ws, userID, username, op)
+		if err != nil {
+			results[i].Error = err.Error()
+			if req.Atomic {
+				failed = i
+				break
+			}
+			continue
+		}
+		results[i].OK = true
+		applied = append(applied, done)
+	}
+
+	if failed >= 0 {
+		for i := len(applied) - 1; i >= 0; i-- {
+			if err := applied[i].undo(); err != nil {
+				log.Printf("Failed to roll back batch operation: %v", err)
+			}
+		}
+		for i := range results {
+			if i != failed {
+				results[i].OK = false
+				results[i].Error = errNotApplied.Error()
+			}
+		}
+		return c.Status(409).JSON(APIResponse{
+			Error: fmt.Sprintf("Operation %d failed: %s; no changes were made", failed+1, results[failed].Error),
+			Data:  fiber.Map{"results": results, "rolledBack": true},
+		})
+	}
+	unlock()
+
+	for _, op := range applied {
+		op.after()
+	}
+	if len(applied) > 0 {
+		message := req.Message
+		if message == "" {
+			message = fmt.Sprintf("Apply %d file operations", len(applied))
+		}
+		if err := commitAndNotify(c, ws, message, username); err != nil {
+			log.Printf("Failed to commit changes: %v", err)
+		}
+	}
+
+	return c.JSON(APIResponse{Data: fiber.Map{"results": results}})
+}
+
+// applyBatchOperation checks and applies one operation.
+func applyBatchOperation(c *fiber.Ctx, ws *Workspace, userID, username string, op BatchOperation) (appliedOp, error) {
+	if errs := validation.Struct(&op); errs != nil {
+		return appliedOp{}, errs
+	}
+	path := batchOpPath(op)
+	if path == "" {
+		return appliedOp{}, errors.New("Path is required")
+	}
+
+	if inTrash(path) {
+		return appliedOp{}, errors.New("Use /api/files/trash to manage deleted items")
+	}
+	fullPath, err := resolveWithinWorkspace(ws, path)
+	if err != nil || !subtreeWritable(ws, userID, path) {
+		return appliedOp{}, errors.New("Access denied")
+	}
+
+	switch op.Op {
+	case "create":
+		if err := nameCollision(ws, path); err != nil {
+			return appliedOp{}, err
+		}
+		if _, err := os.Stat(fullPath); err == nil {
+			return appliedOp{}, errors.New("File already exists")
+		}
+		return writeBatchFile(c, ws, path, fullPath, op.Content, eventFileCreated)
+
+	case "save":
+		if op.BaseHash != "" {
+			conflict, err := saveConflict(fullPath, op.BaseHash, op.Content)
+			if err != nil {
+				return appliedOp{}, err
+			}
+			if conflict != nil {
+				return appliedOp{}, errors.New("File has changed since it was loaded")
+			}
+		}
+		return writeBatchFile(c, ws, path, fullPath, op.Content, eventFileSaved)
+
+	case "delete":
+		dedupedAsset := isDedupedAsset(ws.ID, path)
+		if dedupedAsset && len(assetReferences(ws, path)) > 0 {
+			return appliedOp{}, errors.New("Asset is still referenced by other documents")
+		}
+		item, err := moveToTrash(ws, path, fullPath, username)
+		if err != nil {
+			return appliedOp{}, err
+		}
+		return appliedOp{
+			undo: func() error {
+				if err := os.Rename(trashedPath(ws, item), fullPath); err != nil {
+					return err
+				}
+				return purgeTrashItem(ws, item)
+			},
+			after: func() {
+				indexFor(ws.Path).Remove(path)
+				if dedupedAsset {
+					if err := forgetDedupedAsset(ws.ID, path); err != nil {
+						log.Printf("Failed to update deduplicated assets: %v", err)
+					}
+				}
+				fireWorkspaceEvent(c, ws, eventFileDeleted, map[string]interface{}{"path": path})
+			},
+		}, nil
+
+	default: // mkdir
+		if err := nameCollision(ws, path); err != nil {
+			return appliedOp{}, err
+		}
+		created, err := mkdirAllTracked(fullPath)
+		if err != nil {
+			return appliedOp{}, err
+		}
+		return appliedOp{undo: func() error { return removeCreatedDirs(created) }, after: func() {}}, nil
+	}
+}
+
+// batchOpPath is the workspace-relative path op applies to. New files and
+// folders get normalized names, as createFile and createDirectory give them.
+func batchOpPath(op BatchOperation) string {
+	if op.Op == "create" || op.Op == "mkdir" {
+		return storage.NormalizePath(op.Path)
+	}
+	return op.Path
+}
+
+// writeBatchFile writes content to fullPath, keeping what was there so the
+// write can be undone.
+func writeBatchFile(c *fiber.Ctx, ws *Workspace, path, fullPath, content, event string) (appliedOp, error) {
+	previous, readErr := os.ReadFile(fullPath)
+	var mode os.FileMode = 0644
+	if info, err := os.Stat(fullPath); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	created, err := mkdirAllTracked(filepath.Dir(fullPath))
+	if err != nil {
+		return appliedOp{}, err
+	}
+	if err := storage.WriteFile(fullPath, []byte(content), shouldCompress(ws, len(content)), 0644); err != nil {
+		removeCreatedDirs(created)
+		return appliedOp{}, err
+	}
+
+	return appliedOp{
+		undo: func() error {
+			if readErr == nil {
+				// Stored bytes as they were, compressed or not
+				return storage.WriteFile(fullPath, previous, false, mode)
+			}
+			if err := os.Remove(fullPath); err != nil {
+				return err
+			}
+			return removeCreatedDirs(created)
+		},
+		after: func() {
+			indexFor(ws.Path).Update(path)
+			fireWorkspaceEvent(c, ws, event, map[string]interface{}{"path": path, "size": len(content)})
+		},
+	}, nil
+}
+
+// mkdirAllTracked is os.MkdirAll that returns the directories it created,
+// outermost first.
+func mkdirAllTracked(dir string) ([]string, error) {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		missing = append([]string{d}, missing...)
+		if parent := filepath.Dir(d); parent == d {
+			break
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return missing, nil
+}
+
+// removeCreatedDirs removes directories made by mkdirAllTracked, innermost
+// first, stopping at one that something else has since been put in.
+func removeCreatedDirs(dirs []string) error {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Remove(dirs[i]); err != nil && !os.IsNotExist(err) {
+			if entries, _ := os.ReadDir(dirs[i]); len(entries) > 0 {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+func TestAtomicBatchRollsBack(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "owner"}, map[string]string{
+		"keep.md":   "keep",
+		"remove.md": "remove",
+	})
+	repo, err := git.PlainOpen(ws.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := repo.Head()
+
+	user := "owner"
+	app := newTestApp(&user)
+	app.Post("/files/batch", batchFiles)
+
+	status, resp := doJSON(t, app, "POST", "/files/batch", BatchRequest{
+		Atomic: true,
+		Operations: []BatchOperation{
+			{Op: "create", Path: "new/dir/a.md", Content: "a"},
+			{Op: "save", Path: "keep.md", Content: "changed"},
+			{Op: "delete", Path: "remove.md"},
+			{Op: "mkdir", Path: "empty/folder"},
+			{Op: "create", Path: "keep.md"}, // already exists
+		},
+	})
+	if status != 409 {
+		t.Fatalf("batch = %d %q, want 409", status, resp.Error)
+	}
+	results := resp.Data.(map[string]interface{})["results"].([]interface{})
+	for i, r := range results {
+		if ok := r.(map[string]interface{})["ok"]; ok != false {
+			t.Errorf("operation %d reported ok after the rollback", i+1)
+		}
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(ws.Path, "keep.md")); string(data) != "keep" {
+		t.Errorf("keep.md = %q, want its original content", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(ws.Path, "remove.md")); string(data) != "remove" {
+		t.Errorf("remove.md = %q, want it restored", data)
+	}
+	for _, dir := range []string{"new", "empty"} {
+		if _, err := os.Stat(filepath.Join(ws.Path, dir)); !os.IsNotExist(err) {
+			t.Errorf("%s/ was left behind: %v", dir, err)
+		}
+	}
+	if items, _ := trashItems(ws); len(items) != 0 {
+		t.Errorf("trash holds %d items after the rollback", len(items))
+	}
+	if after, _ := repo.Head(); after.Hash() != before.Hash() {
+		t.Error("a rolled-back batch was committed")
+	}
+}
+
+func TestBatchCommitsOnce(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "owner"}, map[string]string{"a.md": "a"})
+	user := "owner"
+	app := newTestApp(&user)
+	app.Post("/files/batch", batchFiles)
+
+	status, resp := doJSON(t, app, "POST", "/files/batch", BatchRequest{
+		Message: "Reorganize",
+		Operations: []BatchOperation{
+			{Op: "save", Path: "a.md", Content: "a2", BaseHash: contentHash([]byte("a"))},
+			{Op: "create", Path: "b.md", Content: "b"},
+			{Op: "save", Path: "a.md", Content: "a3", BaseHash: contentHash([]byte("a"))}, // stale now
+		},
+	})
+	if status != 200 {
+		t.Fatalf("batch = %d %q, want 200", status, resp.Error)
+	}
+	results := resp.Data.(map[string]interface{})["results"].([]interface{})
+	if results[2].(map[string]interface{})["ok"] != false {
+		t.Error("a save with a stale base hash succeeded")
+	}
+
+	repo, _ := git.PlainOpen(ws.Path)
+	head, _ := repo.Head()
+	commit, _ := repo.CommitObject(head.Hash())
+	if commit.Message != "Reorganize" {
+		t.Errorf("head commit %q, want the batch message", commit.Message)
+	}
+	parent, _ := commit.Parent(0)
+	if parent.Message != "Initial commit" {
+		t.Errorf("batch made more than one commit (parent %q)", parent.Message)
+	}
+}
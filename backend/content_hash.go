@@ -0,0 +1,46 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+
+	"md-office-backend/storage"
+)
+
+// Saves are checked against the version the editor loaded: getFile returns
+// the hash of the content and saveFile compares the BaseHash it is sent with
+// the hash of what is on disk now, holding the file's storage.LockPath lock
+// across the check and the write. Nothing is stored; the hash is worked out
+// from the logical (decompressed) content when needed.
+
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// saveConflict returns both versions when the file at fullPath no longer
+// has the content hashed by baseHash, or nil when it does. A file deleted
+// since it was loaded conflicts too.
+func saveConflict(fullPath, baseHash, yours string) (fiber.Map, error) {
+	current, err := storage.ReadFile(fullPath)
+	if os.IsNotExist(err) {
+		return fiber.Map{"code": "conflict", "exists": false, "yourContent": yours}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	hash := contentHash(current)
+	if hash == baseHash {
+		return nil, nil
+	}
+	return fiber.Map{
+		"code":           "conflict",
+		"exists":         true,
+		"currentHash":    hash,
+		"currentContent": string(current),
+		"yourContent":    yours,
+	}, nil
+}
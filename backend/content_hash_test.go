@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestSaveConflict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.md")
+	if err := os.WriteFile(path, []byte("one"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if conflict, err := saveConflict(path, contentHash([]byte("one")), "mine"); err != nil || conflict != nil {
+		t.Errorf("matching hash: %v, %v; want no conflict", conflict, err)
+	}
+	conflict, err := saveConflict(path, contentHash([]byte("older")), "mine")
+	if err != nil || conflict == nil || conflict["currentContent"] != "one" || conflict["yourContent"] != "mine" {
+		t.Errorf("stale hash: %v, %v; want a conflict with both versions", conflict, err)
+	}
+	conflict, err = saveConflict(path+".gone", "abc", "mine")
+	if err != nil || conflict == nil || conflict["exists"] != false {
+		t.Errorf("deleted file: %v, %v; want a conflict", conflict, err)
+	}
+}
+
+func TestConcurrentSavesWithSameBaseHash(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "owner"}, map[string]string{"doc.md": "original"})
+	user := "owner"
+	app := newTestApp(&user)
+	app.Post("/files", saveFile)
+
+	const editors = 8
+	base := contentHash([]byte("original"))
+	statuses := make(chan int, editors)
+	var wg sync.WaitGroup
+	for i := 0; i < editors; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			status, _ := doJSON(t, app, "POST", "/files", SaveFileRequest{
+				Path:     "doc.md",
+				Content:  "edit " + string(rune('a'+i)),
+				BaseHash: base,
+			})
+			statuses <- status
+		}(i)
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[200] != 1 || counts[409] != editors-1 {
+		t.Errorf("statuses %v, want one 200 and %d 409s", counts, editors-1)
+	}
+	data, _ := os.ReadFile(filepath.Join(ws.Path, "doc.md"))
+	if string(data) == "original" {
+		t.Error("no save was written")
+	}
+}
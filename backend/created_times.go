@@ -0,0 +1,138 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// A document's creation time is the author time of the earliest commit that
+// added its path. Working it out means diffing every commit against its
+// parent, so the results are kept per workspace together with the commits
+// already read; a new HEAD only costs the commits made since.
+type createdTimes struct {
+	mu      sync.Mutex
+	repo    *git.Repository // from repoForWorkspace; a different one starts over
+	head    plumbing.Hash
+	seen    map[plumbing.Hash]bool
+	created map[string]time.Time // slash-separated path -> creation time
+}
+
+var (
+	createdTimesByWorkspace   = map[string]*createdTimes{}
+	createdTimesByWorkspaceMu sync.Mutex
+)
+
+// fileCreatedAt returns when relPath was first committed in the repository
+// of ws, or false if no commit adds it. A rename counts as creating the new
+// path.
+func fileCreatedAt(ws *Workspace, relPath string) (time.Time, bool) {
+	repo := repoForWorkspace(ws)
+	if repo == nil {
+		return time.Time{}, false
+	}
+
+	createdTimesByWorkspaceMu.Lock()
+	ct, ok := createdTimesByWorkspace[ws.ID]
+	if !ok || ct.repo != repo {
+		ct = &createdTimes{repo: repo, seen: map[plumbing.Hash]bool{}, created: map[string]time.Time{}}
+		createdTimesByWorkspace[ws.ID] = ct
+	}
+	createdTimesByWorkspaceMu.Unlock()
+
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	head, err := ct.repo.Head()
+	if err != nil {
+		return time.Time{}, false // no commits yet
+	}
+	if ct.head != head.Hash() {
+		if err := ct.readHistory(ct.repo, head.Hash()); err != nil {
+			return time.Time{}, false
+		}
+		ct.head = head.Hash()
+	}
+	when, ok := ct.created[filepath.ToSlash(filepath.Clean(relPath))]
+	return when, ok
+}
+
+// forgetCreatedTimes drops what is known about a deleted workspace
+func forgetCreatedTimes(workspaceID string) {
+	createdTimesByWorkspaceMu.Lock()
+	delete(createdTimesByWorkspace, workspaceID)
+	createdTimesByWorkspaceMu.Unlock()
+}
+
+// readHistory records the paths added by every commit reachable from head
+// that hasn't been read yet. Commits are visited in any order, so each path
+// keeps the earliest time seen.
+func (ct *createdTimes) readHistory(repo *git.Repository, head plumbing.Hash) error {
+	pending := []plumbing.Hash{head}
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if ct.seen[hash] {
+			continue
+		}
+
+		commit, err := repo.CommitObject(hash)
+		if err != nil {
+			return err
+		}
+		added, err := addedPaths(commit)
+		if err != nil {
+			return err
+		}
+		when := commit.Author.When
+		for _, path := range added {
+			if earliest, ok := ct.created[path]; !ok || when.Before(earliest) {
+				ct.created[path] = when
+			}
+		}
+
+		ct.seen[hash] = true
+		pending = append(pending, commit.ParentHashes...)
+	}
+	return nil
+}
+
+// addedPaths lists the files commit adds relative to its first parent; for
+// a root commit that is every file in it.
+func addedPaths(commit *object.Commit) ([]string, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	if commit.NumParents() == 0 {
+		err := tree.Files().ForEach(func(f *object.File) error {
+			paths = append(paths, f.Name)
+			return nil
+		})
+		return paths, err
+	}
+
+	parent, err := commit.Parent(0)
+	if err != nil {
+		return nil, err
+	}
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := parentTree.Diff(tree)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		if change.From.Name == "" {
+			paths = append(paths, change.To.Name)
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestFileCreatedAt(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{}, nil)
+	wt, err := repoForWorkspace(ws).Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitOn := func(day int, files map[string]string) {
+		t.Helper()
+		writeTestFiles(t, ws.Path, files)
+		if err := wt.AddGlob("."); err != nil {
+			t.Fatal(err)
+		}
+		when := time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC)
+		if _, err := wt.Commit("edit", &git.CommitOptions{Author: &object.Signature{Name: "test", When: when}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	commitOn(1, map[string]string{"a.md": "1"})
+	commitOn(2, map[string]string{"a.md": "2", "docs/b.md": "1"})
+	commitOn(3, map[string]string{"a.md": "3"})
+
+	for path, day := range map[string]int{"a.md": 1, "docs/b.md": 2, "./docs/../a.md": 1} {
+		when, ok := fileCreatedAt(ws, path)
+		if want := time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC); !ok || !when.Equal(want) {
+			t.Errorf("fileCreatedAt(%q) = %v, %v; want %v", path, when, ok, want)
+		}
+	}
+	if _, ok := fileCreatedAt(ws, "missing.md"); ok {
+		t.Error("uncommitted path has a creation time")
+	}
+
+	forgetCreatedTimes(ws.ID)
+	createdTimesByWorkspaceMu.Lock()
+	_, cached := createdTimesByWorkspace[ws.ID]
+	createdTimesByWorkspaceMu.Unlock()
+	if cached {
+		t.Error("creation times still cached after forgetCreatedTimes")
+	}
+
+	// A workspace recreated at the same ID reads its new repository
+	if err := os.RemoveAll(filepath.Join(ws.Path, ".git")); err != nil {
+		t.Fatal(err)
+	}
+	forgetWorkspaceRepos(ws.Path)
+	if _, ok := fileCreatedAt(ws, "a.md"); ok {
+		t.Error("creation time read from a removed repository")
+	}
+}
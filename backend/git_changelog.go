@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GitChangelog is the commit history of a range, grouped into sections.
+type GitChangelog struct {
+	From     string             `json:"from,omitempty"` // empty means from the first commit
+	To       string             `json:"to"`
+	Commits  int                `json:"commits"` // non-merge commits included
+	Sections []ChangelogSection `json:"sections"`
+}
+
+type ChangelogSection struct {
+	Type    string           `json:"type"` // conventional-commit type, "other", or "" when ungrouped
+	Title   string           `json:"title"`
+	Entries []ChangelogEntry `json:"entries"`
+}
+
+type ChangelogEntry struct {
+	Hash     string `json:"hash"`
+	Scope    string `json:"scope,omitempty"`
+	Subject  string `json:"subject"`
+	Breaking bool   `json:"breaking,omitempty"`
+	Author   string `json:"author"`
+	Date     string `json:"date"`
+}
+
+// Sections in the order they're rendered; types not listed go under "Other Changes"
+var changelogSections = []struct{ Type, Title string }{
+	{"feat", "Features"},
+	{"fix", "Bug Fixes"},
+	{"perf", "Performance"},
+	{"refactor", "Refactoring"},
+	{"docs", "Documentation"},
+	{"test", "Tests"},
+	{"build", "Build"},
+	{"ci", "CI"},
+	{"chore", "Chores"},
+	{"other", "Other Changes"},
+}
+
+// type(scope)!: subject
+var conventionalCommitPattern = regexp.MustCompile(`^([a-zA-Z]+)(?:\(([^)]*)\))?(!)?:\s*(.+)$`)
+
+// parseCommitSubject splits a commit's first line into its conventional
+// commit type, scope and subject. Commits that don't follow the convention
+// get type "other".
+func parseCommitSubject(message string) (typ, scope, subject string, breaking bool) {
+	line := strings.TrimSpace(strings.SplitN(message, "\n", 2)[0])
+	m := conventionalCommitPattern.FindStringSubmatch(line)
+	if m == nil {
+		return "other", "", line, false
+	}
+	typ = strings.ToLower(m[1])
+	for _, s := range changelogSections {
+		if s.Type == typ {
+			return typ, m[2], m[4], m[3] == "!"
+		}
+	}
+	return "other", m[2], m[4], m[3] == "!"
+}
+
+// buildChangelog collects the non-merge commits in from..to, newest first.
+// With group set, entries are sorted into conventional-commit sections.
+// When readable is set, commits that only change files it rejects are left
+// out.
+func buildChangelog(repo *git.Repository, fromRev, toRev string, group bool, readable func(string) bool) (*GitChangelog, error) {
+	toHash, err := repo.ResolveRevision(plumbing.Revision(toRev))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid to commit: %v", err)
+	}
+	excluded, err := reachableFrom(repo, fromRev)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := repo.Log(&git.LogOptions{From: *toHash})
+	if err != nil {
+		return nil, err
+	}
+
+	changelog := &GitChangelog{From: fromRev, To: toRev, Sections: []ChangelogSection{}}
+	byType := map[string][]ChangelogEntry{}
+	var all []ChangelogEntry
+	err = logs.ForEach(func(commit *object.Commit) error {
+		if excluded[commit.Hash] || commit.NumParents() > 1 {
+			return nil
+		}
+		if readable != nil {
+			visible, err := changesReadableFile(commit, readable)
+			if err != nil || !visible {
+				return err
+			}
+		}
+		typ, scope, subject, breaking := parseCommitSubject(commit.Message)
+		entry := ChangelogEntry{
+			Hash:     commit.Hash.String(),
+			Scope:    scope,
+			Subject:  subject,
+			Breaking: breaking,
+			Author:   commit.Author.Name,
+			Date:     commit.Author.When.Format(time.RFC3339),
+		}
+		if !group {
+			// Keep the full first line when not grouping by type
+			entry.Scope, entry.Breaking = "", false
+			entry.Subject = strings.TrimSpace(strings.SplitN(commit.Message, "\n", 2)[0])
+		}
+		byType[typ] = append(byType[typ], entry)
+		all = append(all, entry)
+		changelog.Commits++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !group {
+		if len(all) > 0 {
+			changelog.Sections = append(changelog.Sections, ChangelogSection{Title: "Changes", Entries: all})
+		}
+		return changelog, nil
+	}
+	for _, s := range changelogSections {
+		if entries := byType[s.Type]; len(entries) > 0 {
+			changelog.Sections = append(changelog.Sections, ChangelogSection{Type: s.Type, Title: s.Title, Entries: entries})
+		}
+	}
+	return changelog, nil
+}
+
+// changesReadableFile reports whether commit changes at least one file that
+// readable accepts, compared with its first parent.
+func changesReadableFile(commit *object.Commit, readable func(string) bool) (bool, error) {
+	files, err := commitFiles(commit)
+	if err != nil {
+		return false, err
+	}
+	for _, name := range files {
+		if readable(name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// commitFiles lists the files commit adds, changes or removes compared with
+// its first parent; a rename lists both names.
+func commitFiles(commit *object.Commit) ([]string, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	var parentTree *object.Tree
+	if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return nil, err
+		}
+	}
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, change := range changes {
+		for _, name := range []string{change.From.Name, change.To.Name} {
+			if name != "" {
+				files = append(files, name)
+			}
+		}
+	}
+	return files, nil
+}
+
+func renderChangelogMarkdown(cl *GitChangelog) string {
+	var b strings.Builder
+	b.WriteString("# Changelog\n\n")
+	from := cl.From
+	if from == "" {
+		from = "the first commit"
+	}
+	fmt.Fprintf(&b, "Changes from %s to %s.\n", from, cl.To)
+
+	if cl.Commits == 0 {
+		b.WriteString("\nNo changes in this range.\n")
+		return b.String()
+	}
+	for _, s := range cl.Sections {
+		fmt.Fprintf(&b, "\n## %s\n\n", s.Title)
+		for _, e := range s.Entries {
+			b.WriteString("- ")
+			if e.Breaking {
+				b.WriteString("**BREAKING** ")
+			}
+			if e.Scope != "" {
+				fmt.Fprintf(&b, "**%s:** ", e.Scope)
+			}
+			fmt.Fprintf(&b, "%s (%s)\n", e.Subject, e.Hash[:7])
+		}
+	}
+	return b.String()
+}
+
+// getGitChangelog renders the commits in ?from=..?to= as a markdown download
+// (default) or JSON with ?format=json. ?group=false lists commits without
+// conventional-commit sections.
+func getGitChangelog(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	ws, err := checkWorkspacePermission(userID, "viewer")
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	repo := repoForWorkspace(ws)
+	if repo == nil {
+		return c.JSON(APIResponse{Error: "Git repository not available"})
+	}
+
+	format := c.Query("format", "markdown")
+	if format != "markdown" && format != "json" {
+		return c.Status(400).JSON(APIResponse{Error: "format must be markdown or json"})
+	}
+
+	changelog, err := buildChangelog(repo, c.Query("from"), c.Query("to", "HEAD"), c.QueryBool("group", true), readableBy(ws, userID))
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	if format == "json" {
+		return c.JSON(APIResponse{Data: changelog})
+	}
+	c.Set(fiber.HeaderContentType, "text/markdown; charset=utf-8")
+	c.Set("Content-Disposition", `attachment; filename="CHANGELOG.md"`)
+	return c.SendString(renderChangelogMarkdown(changelog))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestParseCommitSubject(t *testing.T) {
+	for _, tc := range []struct {
+		message, typ, scope, subject string
+		breaking                     bool
+	}{
+		{"feat(editor): add tables\n\nbody", "feat", "editor", "add tables", false},
+		{"Fix: crash on save", "fix", "", "crash on save", false},
+		{"feat!: new api", "feat", "", "new api", true},
+		{"wip(x): unknown type", "other", "x", "unknown type", false},
+		{"Update notes", "other", "", "Update notes", false},
+	} {
+		typ, scope, subject, breaking := parseCommitSubject(tc.message)
+		if typ != tc.typ || scope != tc.scope || subject != tc.subject || breaking != tc.breaking {
+			t.Errorf("parseCommitSubject(%q) = %q %q %q %v", tc.message, typ, scope, subject, breaking)
+		}
+	}
+}
+
+func TestGitChangelog(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "alice"}, map[string]string{"a.md": "a"})
+	repo := repoForWorkspace(ws)
+	first, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, message := range []string{"feat(editor): add tables", "fix: crash on save", "Tidy up", "feat!: new api"} {
+		opts := &git.CommitOptions{AllowEmptyCommits: true, Author: &object.Signature{Name: "test", When: time.Now().Add(time.Duration(i) * time.Second)}}
+		if _, err := wt.Commit(message, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	user := "alice"
+	app := newTestApp(&user)
+	app.Get("/git/changelog", getGitChangelog)
+
+	_, resp := doJSON(t, app, "GET", "/git/changelog?format=json&from="+first.Hash().String(), nil)
+	data, _ := json.Marshal(resp.Data)
+	var changelog GitChangelog
+	json.Unmarshal(data, &changelog)
+	var titles []string
+	for _, s := range changelog.Sections {
+		titles = append(titles, s.Title)
+	}
+	if changelog.Commits != 4 || strings.Join(titles, ",") != "Features,Bug Fixes,Other Changes" {
+		t.Fatalf("changelog = %+v, want 4 commits in Features, Bug Fixes and Other Changes", changelog)
+	}
+	if features := changelog.Sections[0].Entries; len(features) != 2 || features[0].Subject != "new api" || !features[0].Breaking || features[1].Scope != "editor" {
+		t.Errorf("features = %+v, want the breaking change first, then the editor one", features)
+	}
+
+	req := httptest.NewRequest("GET", "/git/changelog?from="+first.Hash().String(), nil)
+	httpResp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	markdown, _ := io.ReadAll(httpResp.Body)
+	httpResp.Body.Close()
+	if !strings.Contains(httpResp.Header.Get("Content-Disposition"), "CHANGELOG.md") {
+		t.Errorf("Content-Disposition = %q, want a CHANGELOG.md download", httpResp.Header.Get("Content-Disposition"))
+	}
+	for _, want := range []string{"## Features\n\n- **BREAKING** new api (", "- **editor:** add tables (", "## Bug Fixes\n\n- crash on save (", "## Other Changes\n\n- Tidy up ("} {
+		if !strings.Contains(string(markdown), want) {
+			t.Errorf("markdown changelog is missing %q:\n%s", want, markdown)
+		}
+	}
+
+	_, resp = doJSON(t, app, "GET", "/git/changelog?format=json&group=false&from="+first.Hash().String(), nil)
+	data, _ = json.Marshal(resp.Data)
+	json.Unmarshal(data, &changelog)
+	if len(changelog.Sections) != 1 || len(changelog.Sections[0].Entries) != 4 || changelog.Sections[0].Entries[0].Subject != "feat!: new api" {
+		t.Errorf("ungrouped changelog = %+v", changelog)
+	}
+
+	httpResp, err = app.Test(httptest.NewRequest("GET", "/git/changelog?from=HEAD", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	markdown, _ = io.ReadAll(httpResp.Body)
+	httpResp.Body.Close()
+	if !strings.Contains(string(markdown), "No changes in this range.") {
+		t.Errorf("empty range changelog:\n%s", markdown)
+	}
+	if _, resp := doJSON(t, app, "GET", "/git/changelog?format=json&from=no-such-ref", nil); resp.Error == "" {
+		t.Error("changelog from an unknown ref succeeded")
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/binary"
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+
+	"md-office-backend/storage"
+)
+
+// diffChange renders one file's patch as a GitDiffChange. Content is the
+// unified diff of that file alone, as git diff would print it.
+func diffChange(fp fdiff.FilePatch) (GitDiffChange, error) {
+	from, to := fp.Files()
+	change := GitDiffChange{Type: "modified"}
+	switch {
+	case from == nil:
+		change.Type = "added"
+		change.File = to.Path()
+	case to == nil:
+		change.Type = "deleted"
+		change.File = from.Path()
+	default:
+		change.File = to.Path()
+	}
+
+	for _, chunk := range fp.Chunks() {
+		lines := strings.Count(chunk.Content(), "\n")
+		if !strings.HasSuffix(chunk.Content(), "\n") && chunk.Content() != "" {
+			lines++
+		}
+		switch chunk.Type() {
+		case fdiff.Add:
+			change.Additions += lines
+		case fdiff.Delete:
+			change.Deletions += lines
+		}
+	}
+
+	var buf bytes.Buffer
+	err := fdiff.NewUnifiedEncoder(&buf, fdiff.DefaultContextLines).Encode(filePatches{fp})
+	change.Content = buf.String()
+	return change, err
+}
+
+// commitDiff diffs the trees of two commits, limited to file when set.
+func commitDiff(from, to *object.Commit, file string) ([]GitDiffChange, error) {
+	fromTree, err := from.Tree()
+	if err != nil {
+		return nil, err
+	}
+	toTree, err := to.Tree()
+	if err != nil {
+		return nil, err
+	}
+	return treeDiff(fromTree, toTree, file)
+}
+
+// commitChanges diffs commit against its first parent, or the empty tree
+// for a root commit.
+func commitChanges(commit *object.Commit) ([]GitDiffChange, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	var parentTree *object.Tree
+	if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return nil, err
+		}
+	}
+	return treeDiff(parentTree, tree, "")
+}
+
+// treeDiff diffs two trees, limited to file when set; a nil from is the
+// empty tree. Blobs are compared as their logical content, so compressed
+// documents diff as the text they hold.
+func treeDiff(from, to *object.Tree, file string) ([]GitDiffChange, error) {
+	treeChanges, err := object.DiffTree(from, to)
+	if err != nil {
+		return nil, err
+	}
+	changes := []GitDiffChange{}
+	for _, tc := range treeChanges {
+		if file != "" && tc.From.Name != file && tc.To.Name != file {
+			continue
+		}
+		fromFile, toFile, err := tc.Files()
+		if err != nil {
+			return nil, err
+		}
+		src, err := blobDiffFile(fromFile)
+		if err != nil {
+			return nil, err
+		}
+		dst, err := blobDiffFile(toFile)
+		if err != nil {
+			return nil, err
+		}
+		change, err := diffChange(newContentPatch(src, dst))
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// blobDiffFile reads a committed file for diffing, or returns nil for a
+// missing side.
+func blobDiffFile(f *object.File) (*diffFile, error) {
+	if f == nil {
+		return nil, nil
+	}
+	content, err := f.Contents()
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := storage.Decode(f.Name, []byte(content))
+	if err != nil {
+		return nil, err
+	}
+	return &diffFile{path: f.Name, hash: f.Hash, mode: f.Mode, content: string(decoded)}, nil
+}
+
+// worktreeDiff diffs HEAD against the files on disk for every path the
+// worktree status reports as changed, limited to file when set. In a repo
+// without commits every file counts as added.
+func worktreeDiff(repo *git.Repository, file string) ([]GitDiffChange, error) {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	var head *object.Tree
+	if ref, err := repo.Head(); err == nil {
+		commit, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			return nil, err
+		}
+		if head, err = commit.Tree(); err != nil {
+			return nil, err
+		}
+	}
+
+	root := worktree.Filesystem.Root()
+	changes := []GitDiffChange{}
+	for path := range status {
+		if file != "" && path != file {
+			continue
+		}
+
+		var from, to *diffFile
+		if head != nil {
+			if f, err := head.File(path); err == nil {
+				if from, err = blobDiffFile(f); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(path))); err == nil {
+			content, err := storage.Decode(path, data)
+			if err != nil {
+				return nil, err
+			}
+			to = &diffFile{
+				path:    path,
+				hash:    plumbing.ComputeHash(plumbing.BlobObject, data),
+				mode:    filemode.Regular,
+				content: string(content),
+			}
+			if from != nil {
+				to.mode = from.mode
+			}
+		}
+		if from == nil && to == nil {
+			continue
+		}
+		if from != nil && to != nil && (from.hash == to.hash || from.content == to.content) {
+			continue // staged, mode-only or recompressed; contents match HEAD
+		}
+
+		change, err := diffChange(newContentPatch(from, to))
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].File < changes[j].File })
+	return changes, nil
+}
+
+// filePatches adapts a list of file patches to fdiff.Patch for the encoder.
+type filePatches []fdiff.FilePatch
+
+func (p filePatches) FilePatches() []fdiff.FilePatch { return p }
+func (p filePatches) Message() string                { return "" }
+
+// diffFile is one side of a change, holding the file's logical content. A
+// nil *diffFile is a missing side (added or deleted file).
+type diffFile struct {
+	path    string
+	hash    plumbing.Hash
+	mode    filemode.FileMode
+	content string
+}
+
+func (f *diffFile) Hash() plumbing.Hash     { return f.hash }
+func (f *diffFile) Mode() filemode.FileMode { return f.mode }
+func (f *diffFile) Path() string            { return f.path }
+
+type diffChunk struct {
+	content string
+	op      fdiff.Operation
+}
+
+func (c diffChunk) Content() string       { return c.content }
+func (c diffChunk) Type() fdiff.Operation { return c.op }
+
+// contentPatch is a file patch between two diffFiles, built the way go-git
+// builds patches between commits but from the logical content.
+type contentPatch struct {
+	from, to *diffFile
+	binary   bool
+	chunks   []fdiff.Chunk
+}
+
+func newContentPatch(from, to *diffFile) *contentPatch {
+	p := &contentPatch{from: from, to: to}
+	var src, dst string
+	if from != nil {
+		src = from.content
+	}
+	if to != nil {
+		dst = to.content
+	}
+	if isBinaryContent(src) || isBinaryContent(dst) {
+		p.binary = true
+		return p
+	}
+	for _, d := range diff.Do(src, dst) {
+		op := fdiff.Equal
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			op = fdiff.Add
+		case diffmatchpatch.DiffDelete:
+			op = fdiff.Delete
+		}
+		p.chunks = append(p.chunks, diffChunk{content: d.Text, op: op})
+	}
+	return p
+}
+
+func isBinaryContent(s string) bool {
+	isBin, _ := binary.IsBinary(strings.NewReader(s))
+	return isBin
+}
+
+func (p *contentPatch) IsBinary() bool { return p.binary }
+
+func (p *contentPatch) Files() (fdiff.File, fdiff.File) {
+	// Return untyped nils for missing sides so callers can compare to nil
+	var from, to fdiff.File
+	if p.from != nil {
+		from = p.from
+	}
+	if p.to != nil {
+		to = p.to
+	}
+	return from, to
+}
+
+func (p *contentPatch) Chunks() []fdiff.Chunk { return p.chunks }
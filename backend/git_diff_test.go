@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"md-office-backend/storage"
+)
+
+func writeCompressed(t *testing.T, root, rel, content string) {
+	t.Helper()
+	if err := storage.WriteFile(filepath.Join(root, rel), []byte(content), true, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiffDecodesCompressedDocuments(t *testing.T) {
+	root := t.TempDir()
+	writeCompressed(t, root, "doc.md", "# Title\n\nfirst\n")
+	if err := commitWorkspaceDir(root, "Add doc", "test"); err != nil {
+		t.Fatal(err)
+	}
+	writeCompressed(t, root, "doc.md", "# Title\n\nsecond\nthird\n")
+	if err := commitWorkspaceDir(root, "Edit doc", "test"); err != nil {
+		t.Fatal(err)
+	}
+	writeCompressed(t, root, "doc.md", "# Title\n\nfourth\n")
+
+	repo, err := git.PlainOpen(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, _ := repo.Head()
+	to, _ := repo.CommitObject(head.Hash())
+	from, _ := to.Parent(0)
+
+	check := func(name string, changes []GitDiffChange, err error, adds, dels int, text string) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(changes) != 1 {
+			t.Fatalf("%s: %d changes, want 1", name, len(changes))
+		}
+		c := changes[0]
+		if c.Additions != adds || c.Deletions != dels || !strings.Contains(c.Content, text) {
+			t.Errorf("%s: +%d -%d\n%s\nwant +%d -%d containing %q", name, c.Additions, c.Deletions, c.Content, adds, dels, text)
+		}
+	}
+
+	changes, err := commitDiff(from, to, "doc.md")
+	check("commitDiff", changes, err, 2, 1, "+second\n")
+	changes, err = commitChanges(to)
+	check("commitChanges", changes, err, 2, 1, "-first\n")
+	changes, err = worktreeDiff(repo, "")
+	check("worktreeDiff", changes, err, 1, 2, "+fourth\n")
+
+	// Rewriting the same text compressed anew is not a change
+	writeCompressed(t, root, "doc.md", "# Title\n\nsecond\nthird\n")
+	if changes, err := worktreeDiff(repo, ""); err != nil || len(changes) != 0 {
+		t.Errorf("worktreeDiff after rewriting the committed text = %v, %v; want no changes", changes, err)
+	}
+}
+
+func TestDiffStatOverRange(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "alice"}, map[string]string{"a.md": "1\n2\n"})
+	repo := repoForWorkspace(ws)
+	first, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitTestFiles(t, ws.Path, map[string]string{"a.md": "1\n3\n4\n", "b.md": "x\n"})
+	tip, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A side branch off the first commit adds c.md and is merged back
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wt.Checkout(&git.CheckoutOptions{Hash: first.Hash(), Branch: "refs/heads/side", Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	commitTestFiles(t, ws.Path, map[string]string{"c.md": "s\n"})
+	side, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wt.Checkout(&git.CheckoutOptions{Branch: tip.Name()}); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFiles(t, ws.Path, map[string]string{"c.md": "s\n"})
+	if _, err := wt.Add("c.md"); err != nil {
+		t.Fatal(err)
+	}
+	sig := &object.Signature{Name: "test", Email: "test@mdoffice.local", When: time.Now()}
+	if _, err := wt.Commit("Merge side", &git.CommitOptions{Author: sig, Parents: []plumbing.Hash{tip.Hash(), side.Hash()}}); err != nil {
+		t.Fatal(err)
+	}
+
+	user := "alice"
+	app := newTestApp(&user)
+	app.Get("/git/diffstat", getGitDiffStat)
+	diffStat := func(query string) GitDiffStat {
+		t.Helper()
+		_, resp := doJSON(t, app, "GET", "/git/diffstat"+query, nil)
+		if resp.Error != "" {
+			t.Fatalf("diffstat%s: %s", query, resp.Error)
+		}
+		data, _ := json.Marshal(resp.Data)
+		var stat GitDiffStat
+		json.Unmarshal(data, &stat)
+		return stat
+	}
+
+	stat := diffStat("?from=" + first.Hash().String())
+	want := []GitFileStat{{File: "a.md", Insertions: 2, Deletions: 1}, {File: "b.md", Insertions: 1}, {File: "c.md", Insertions: 1}}
+	if stat.Commits != 2 || stat.FilesChanged != 3 || stat.Insertions != 4 || stat.Deletions != 1 || !reflect.DeepEqual(stat.Files, want) {
+		t.Errorf("diffstat since the first commit = %+v, want 2 commits and %+v", stat, want)
+	}
+
+	stat = diffStat("")
+	if stat.Commits != 3 || stat.Insertions != 6 || stat.Deletions != 1 || stat.Files[0] != (GitFileStat{File: "a.md", Insertions: 4, Deletions: 1}) {
+		t.Errorf("diffstat of the whole history = %+v, want the first commit's 2 lines added", stat)
+	}
+
+	stat = diffStat("?from=" + first.Hash().String() + "&to=" + tip.Hash().String())
+	if stat.Commits != 1 || stat.FilesChanged != 2 || stat.Insertions != 3 || stat.Deletions != 1 {
+		t.Errorf("diffstat of the second commit alone = %+v", stat)
+	}
+}
+
+func TestGitMergeBase(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "alice"}, map[string]string{"a.md": "1\n"})
+	repo := repoForWorkspace(ws)
+	fork, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitTestFiles(t, ws.Path, map[string]string{"a.md": "2\n"})
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wt.Checkout(&git.CheckoutOptions{Hash: fork.Hash(), Branch: "refs/heads/side", Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	commitTestFiles(t, ws.Path, map[string]string{"b.md": "side\n"})
+
+	user := "alice"
+	app := newTestApp(&user)
+	app.Get("/git/merge-base", getGitMergeBase)
+
+	status, resp := doJSON(t, app, "GET", "/git/merge-base?a="+fork.Name().Short()+"&b=side", nil)
+	data, _ := resp.Data.(map[string]interface{})
+	if status != 200 || data["hash"] != fork.Hash().String() {
+		t.Errorf("merge base = %d %+v, want the fork point %s", status, resp, fork.Hash())
+	}
+
+	if status, _ := doJSON(t, app, "GET", "/git/merge-base?a=side", nil); status != 400 {
+		t.Errorf("merge base without b = %d, want 400", status)
+	}
+	if _, resp := doJSON(t, app, "GET", "/git/merge-base?a=side&b=no-such-branch", nil); resp.Error == "" {
+		t.Error("merge base with an unknown ref succeeded")
+	}
+}
+
+func TestGitHistoryStream(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "alice"}, map[string]string{"a.md": "a"})
+	wt, err := repoForWorkspace(ws).Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 150; i++ {
+		opts := &git.CommitOptions{AllowEmptyCommits: true, Author: &object.Signature{Name: "test", When: time.Now()}}
+		if _, err := wt.Commit(fmt.Sprint("Commit ", i), opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	user := "alice"
+	app := newTestApp(&user)
+	app.Get("/git/history", getGitHistory)
+	stream := func(query string) []GitCommit {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", "/git/history?stream=true"+query, nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("content type = %q", ct)
+		}
+		var commits []GitCommit
+		lines := bufio.NewScanner(resp.Body)
+		for lines.Scan() {
+			var commit GitCommit
+			if err := json.Unmarshal(lines.Bytes(), &commit); err != nil || commit.Hash == "" {
+				t.Fatalf("bad line %q: %v", lines.Text(), err)
+			}
+			commits = append(commits, commit)
+		}
+		return commits
+	}
+
+	if commits := stream("&limit=5"); len(commits) != 5 || commits[0].Message != "Commit 149" || commits[4].Message != "Commit 145" {
+		t.Errorf("streamed %d commits starting %+v, want the newest 5", len(commits), commits)
+	}
+	// Unlike pages, streams run past DefaultHistoryLimit without ?limit=
+	if commits := stream(""); len(commits) != 151 {
+		t.Errorf("streamed %d commits, want all 151", len(commits))
+	}
+}
+
+func TestGitFileStatus(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "alice"}, map[string]string{"docs/a.md": "a", "docs/b.md": "b", "c.md": "c"})
+	writeTestFiles(t, ws.Path, map[string]string{"docs/a.md": "changed", "docs/new.md": "new", "staged.md": "staged"})
+	if err := os.Remove(filepath.Join(ws.Path, "c.md")); err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repoForWorkspace(ws).Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wt.Add("staged.md"); err != nil {
+		t.Fatal(err)
+	}
+
+	user := "alice"
+	app := newTestApp(&user)
+	app.Get("/git/file-status", getGitFileStatus)
+	fileStatus := func(query string) map[string]interface{} {
+		t.Helper()
+		_, resp := doJSON(t, app, "GET", "/git/file-status"+query, nil)
+		if resp.Error != "" {
+			t.Fatalf("file-status%s: %s", query, resp.Error)
+		}
+		files, _ := resp.Data.(map[string]interface{})
+		return files
+	}
+
+	want := map[string]interface{}{"docs/a.md": "modified", "docs/new.md": "new", "staged.md": "added", "c.md": "deleted"}
+	if files := fileStatus(""); !reflect.DeepEqual(files, want) {
+		t.Errorf("file status = %v, want %v", files, want)
+	}
+	if files := fileStatus("?path=docs"); !reflect.DeepEqual(files, map[string]interface{}{"docs/a.md": "modified", "docs/new.md": "new"}) {
+		t.Errorf("file status under docs = %v", files)
+	}
+	if files := fileStatus("?path=doc"); len(files) != 0 {
+		t.Errorf("file status under doc = %v, want nothing from docs/", files)
+	}
+}
+
+func TestGitHistoryPaging(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "alice"}, map[string]string{"docs/a.md": "0"})
+	for i := 1; i < 13; i++ {
+		if i%3 == 0 {
+			commitTestFiles(t, ws.Path, map[string]string{"docs/a.md": fmt.Sprint(i)})
+		} else {
+			commitTestFiles(t, ws.Path, map[string]string{"other.md": fmt.Sprint(i)})
+		}
+	}
+	user := "alice"
+	app := newTestApp(&user)
+	app.Get("/git/history", getGitHistory)
+	page := func(query string) (int, GitHistory) {
+		t.Helper()
+		status, resp := doJSON(t, app, "GET", "/git/history"+query, nil)
+		data, _ := json.Marshal(resp.Data)
+		var history GitHistory
+		json.Unmarshal(data, &history)
+		return status, history
+	}
+
+	_, all := page("")
+	if len(all.Commits) != 13 || all.NextCursor != "" {
+		t.Fatalf("full history = %d commits, cursor %q; want 13 and no cursor", len(all.Commits), all.NextCursor)
+	}
+	var walked []GitCommit
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("paging never ended")
+		}
+		status, p := page("?limit=5&cursor=" + cursor)
+		if status != 200 || len(p.Commits) > 5 {
+			t.Fatalf("page %d = %d with %d commits", pages, status, len(p.Commits))
+		}
+		walked = append(walked, p.Commits...)
+		if p.NextCursor == "" {
+			break
+		}
+		cursor = p.NextCursor
+	}
+	if !reflect.DeepEqual(walked, all.Commits) {
+		t.Errorf("paged history differs from the full history")
+	}
+
+	if _, p := page("?skip=2&limit=3"); !reflect.DeepEqual(p.Commits, all.Commits[2:5]) {
+		t.Errorf("skip=2&limit=3 = %+v", p.Commits)
+	}
+	if _, p := page("?path=docs/a.md"); len(p.Commits) != 5 {
+		t.Errorf("history of docs/a.md = %d commits, want 5", len(p.Commits))
+	}
+	if status, _ := page("?cursor=" + strings.Repeat("0", 40)); status != 400 {
+		t.Errorf("unknown cursor = %d, want 400", status)
+	}
+}
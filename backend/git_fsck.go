@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/gofiber/fiber/v2"
+
+	"md-office-backend/validation"
+)
+
+// GitFsckReport lists integrity problems found in a workspace repo. Auto
+// commits and hard resets can leave HEAD detached or refs pointing at
+// objects that no longer exist.
+type GitFsckReport struct {
+	OK       bool             `json:"ok"`
+	Head     string           `json:"head,omitempty"`   // commit HEAD resolves to
+	Branch   string           `json:"branch,omitempty"` // empty when detached
+	Problems []GitFsckProblem `json:"problems"`
+}
+
+type GitFsckProblem struct {
+	Check       string `json:"check"` // "head", "detached", "branch", "refs" or "worktree"
+	Message     string `json:"message"`
+	Remediation string `json:"remediation"`
+	Fixed       bool   `json:"fixed,omitempty"`
+}
+
+type GitFsckFixRequest struct {
+	Branch string `json:"branch" validate:"max=255"` // name for the branch a detached HEAD is moved onto
+}
+
+func (r *GitFsckReport) add(check, message, remediation string) {
+	r.Problems = append(r.Problems, GitFsckProblem{Check: check, Message: message, Remediation: remediation})
+}
+
+// fsckRepo checks that HEAD resolves to a commit on an existing branch,
+// that every ref points at an existing object, and that the worktree
+// matches the index.
+func fsckRepo(repo *git.Repository) *GitFsckReport {
+	report := &GitFsckReport{Problems: []GitFsckProblem{}}
+
+	head, err := repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		report.add("head", "HEAD is missing: "+err.Error(), "Check out a branch to recreate HEAD")
+		return report
+	}
+
+	if head.Type() == plumbing.SymbolicReference {
+		report.Branch = head.Target().Short()
+		branch, err := repo.Storer.Reference(head.Target())
+		if err != nil {
+			if hasBranches(repo) {
+				report.add("branch", fmt.Sprintf("HEAD points to branch %s, which does not exist", report.Branch),
+					"Check out one of the existing branches")
+			}
+			// Otherwise the repo simply has no commits yet
+		} else {
+			report.Head = branch.Hash().String()
+		}
+	} else {
+		report.Head = head.Hash().String()
+		report.add("detached", "HEAD is detached at "+head.Hash().String()[:7],
+			"Create a branch at HEAD (POST /api/git/fsck) so new commits aren't lost")
+	}
+
+	if report.Head != "" {
+		if _, err := repo.CommitObject(plumbing.NewHash(report.Head)); err != nil {
+			report.add("head", fmt.Sprintf("HEAD commit %s can't be read: %v", report.Head[:7], err),
+				"Reset the branch to a known good commit")
+		}
+	}
+
+	refs, err := repo.Storer.IterReferences()
+	if err == nil {
+		refs.ForEach(func(ref *plumbing.Reference) error {
+			if ref.Type() != plumbing.HashReference || ref.Name() == plumbing.HEAD {
+				return nil
+			}
+			if err := repo.Storer.HasEncodedObject(ref.Hash()); err != nil {
+				report.add("refs", fmt.Sprintf("%s points to missing object %s", ref.Name(), ref.Hash().String()[:7]),
+					"Delete the ref or point it at an existing commit")
+			}
+			return nil
+		})
+	}
+
+	if worktree, err := repo.Worktree(); err == nil {
+		status, err := worktree.Status()
+		if err != nil {
+			report.add("worktree", "Worktree status failed: "+err.Error(), "Inspect the repository with git status")
+		} else if !status.IsClean() {
+			report.add("worktree", fmt.Sprintf("%d file(s) differ from the last commit", len(status)),
+				"Save (commit) or revert the uncommitted changes")
+		}
+	}
+
+	report.OK = len(report.Problems) == 0
+	return report
+}
+
+func hasBranches(repo *git.Repository) bool {
+	branches, err := repo.Branches()
+	if err != nil {
+		return false
+	}
+	defer branches.Close()
+	_, err = branches.Next()
+	return err == nil
+}
+
+// fixDetachedHead creates branch at the detached HEAD commit and attaches
+// HEAD to it. The worktree is untouched since the commit doesn't change.
+func fixDetachedHead(repo *git.Repository, branch string) error {
+	head, err := repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return err
+	}
+	if head.Type() != plumbing.HashReference {
+		return nil
+	}
+
+	if branch == "" {
+		branch = "recovered-" + head.Hash().String()[:7]
+	}
+	name := plumbing.NewBranchReferenceName(branch)
+	if err := name.Validate(); err != nil {
+		return fmt.Errorf("invalid branch name %q", branch)
+	}
+	if _, err := repo.Storer.Reference(name); err == nil {
+		return fmt.Errorf("branch %s already exists", branch)
+	}
+
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(name, head.Hash())); err != nil {
+		return err
+	}
+	return repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, name))
+}
+
+func workspaceRepoForOwner(c *fiber.Ctx) (*git.Repository, error) {
+	userID := c.Locals("userID").(string)
+
+	ws, err := checkWorkspacePermission(userID, "owner")
+	if err != nil {
+		return nil, err
+	}
+	repo := repoForWorkspace(ws)
+	if repo == nil {
+		return nil, fmt.Errorf("Git repository not available")
+	}
+	return repo, nil
+}
+
+// getGitFsck reports integrity problems in the workspace repo (owner only)
+func getGitFsck(c *fiber.Ctx) error {
+	repo, err := workspaceRepoForOwner(c)
+	if err != nil {
+		return c.Status(403).JSON(APIResponse{Error: err.Error()})
+	}
+	return c.JSON(APIResponse{Data: fsckRepo(repo)})
+}
+
+// fixGitFsck repairs what can be repaired safely (a detached HEAD is moved
+// onto a new branch) and returns the report from before the fix, with
+// repaired problems marked.
+func fixGitFsck(c *fiber.Ctx) error {
+	repo, err := workspaceRepoForOwner(c)
+	if err != nil {
+		return c.Status(403).JSON(APIResponse{Error: err.Error()})
+	}
+
+	var req GitFsckFixRequest
+	if len(c.Body()) > 0 {
+		if errs := validation.ParseBody(c, &req); errs != nil {
+			return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
+		}
+	}
+
+	report := fsckRepo(repo)
+	for i, p := range report.Problems {
+		if p.Check != "detached" {
+			continue
+		}
+		if err := fixDetachedHead(repo, req.Branch); err != nil {
+			return c.JSON(APIResponse{Error: "Failed to fix detached HEAD: " + err.Error(), Data: report})
+		}
+		report.Problems[i].Fixed = true
+		break
+	}
+
+	return c.JSON(APIResponse{Data: report})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestFsckDetachedHead(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "alice", Permissions: map[string]string{"bob": "editor"}}, map[string]string{"a.md": "a"})
+	repo := repoForWorkspace(ws)
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := "alice"
+	app := newTestApp(&user)
+	app.Get("/git/fsck", getGitFsck)
+	app.Post("/git/fsck", fixGitFsck)
+	fsck := func(method string, body interface{}) GitFsckReport {
+		t.Helper()
+		status, resp := doJSON(t, app, method, "/git/fsck", body)
+		if status != 200 || resp.Error != "" {
+			t.Fatalf("%s fsck: %d %s", method, status, resp.Error)
+		}
+		data, _ := json.Marshal(resp.Data)
+		var report GitFsckReport
+		json.Unmarshal(data, &report)
+		return report
+	}
+
+	if report := fsck("GET", nil); !report.OK || report.Branch != "master" || len(report.Problems) != 0 {
+		t.Errorf("healthy repo = %+v, want no problems", report)
+	}
+
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(plumbing.HEAD, head.Hash())); err != nil {
+		t.Fatal(err)
+	}
+	report := fsck("GET", nil)
+	if report.OK || report.Branch != "" || len(report.Problems) != 1 || report.Problems[0].Check != "detached" {
+		t.Fatalf("detached HEAD = %+v, want one detached problem", report)
+	}
+
+	user = "bob"
+	if status, _ := doJSON(t, app, "GET", "/git/fsck", nil); status != 403 {
+		t.Errorf("fsck by an editor = %d, want 403", status)
+	}
+	user = "alice"
+
+	if report := fsck("POST", GitFsckFixRequest{Branch: "rescue"}); len(report.Problems) != 1 || !report.Problems[0].Fixed {
+		t.Errorf("fix = %+v, want the detached HEAD fixed", report)
+	}
+	if report := fsck("GET", nil); !report.OK || report.Branch != "rescue" || report.Head != head.Hash().String() {
+		t.Errorf("after the fix = %+v, want HEAD on rescue at %s", report, head.Hash())
+	}
+}
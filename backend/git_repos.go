@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// Each workspace directory is its own git repository. Handlers resolve the
+// repo from the request's workspace with repoForWorkspace; opened repos are
+// cached by workspace ID so requests in different workspaces never share
+// git state.
+var (
+	workspaceRepos   = map[string]*workspaceRepo{}
+	workspaceReposMu sync.Mutex
+)
+
+type workspaceRepo struct {
+	path string
+	repo *git.Repository
+}
+
+// repoForWorkspace returns the git repository of ws, or nil if it has none.
+func repoForWorkspace(ws *Workspace) *git.Repository {
+	workspaceReposMu.Lock()
+	defer workspaceReposMu.Unlock()
+
+	if cached, ok := workspaceRepos[ws.ID]; ok && cached.path == ws.Path {
+		return cached.repo
+	}
+	repo, err := git.PlainOpen(ws.Path)
+	if err != nil {
+		// Not cached, so a repository initialized later is picked up
+		delete(workspaceRepos, ws.ID)
+		return nil
+	}
+	workspaceRepos[ws.ID] = &workspaceRepo{path: ws.Path, repo: repo}
+	return repo
+}
+
+// forgetWorkspaceRepos drops cached repos at dir, e.g. after the directory
+// was recreated.
+func forgetWorkspaceRepos(dir string) {
+	workspaceReposMu.Lock()
+	defer workspaceReposMu.Unlock()
+
+	for id, cached := range workspaceRepos {
+		if cached.path == dir {
+			delete(workspaceRepos, id)
+		}
+	}
+}
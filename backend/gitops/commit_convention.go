@@ -0,0 +1,104 @@
+package gitops
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CommitConvention is a connected repo's optional commit-message format.
+// Both fields are empty by default, which leaves messages unchecked.
+type CommitConvention struct {
+	Template string `json:"template,omitempty"` // used when a commit has no message
+	Pattern  string `json:"pattern,omitempty"`  // regexp every message must match
+}
+
+// validate checks that the pattern compiles and that the template, used as
+// the message of commits without one, satisfies it.
+func (cc CommitConvention) validate() error {
+	if cc.Pattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile(cc.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid commit pattern: %w", err)
+	}
+	if cc.Template != "" && !re.MatchString(cc.Template) {
+		return fmt.Errorf("commit template %q does not match the commit pattern", cc.Template)
+	}
+	return nil
+}
+
+// conventionError reports a message that breaks the repo's convention.
+type conventionError struct {
+	CommitConvention
+	Message string
+}
+
+func (e *conventionError) Error() string {
+	return fmt.Sprintf("commit message %q does not match the repository's convention %s", e.Message, e.Pattern)
+}
+
+// commitMessage returns the message to commit: msg, or the template when msg
+// is empty. It fails with a *conventionError when the result doesn't match
+// the pattern. fallback is used when there is neither a message nor a
+// template.
+func (cc CommitConvention) commitMessage(msg, fallback string) (string, error) {
+	if msg == "" {
+		msg = cc.Template
+	}
+	if msg == "" {
+		msg = fallback
+	}
+	if cc.Pattern == "" {
+		return msg, nil
+	}
+	re, err := regexp.Compile(cc.Pattern)
+	if err != nil {
+		return "", err
+	}
+	if !re.MatchString(msg) {
+		return "", &conventionError{CommitConvention: cc, Message: msg}
+	}
+	return msg, nil
+}
+
+func getCommitConvention(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	cr, err := getConnectedRepo(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "no connected repo"})
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	return c.JSON(fiber.Map{"data": cr.Config.Commit})
+}
+
+// setCommitConvention replaces the connected repo's commit convention. Send
+// empty fields to turn it off.
+func setCommitConvention(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	cr, err := getConnectedRepo(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "no connected repo"})
+	}
+
+	var req CommitConvention
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+	}
+	if err := req.validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.Config.Commit = req
+	saveUserRepoConfig(userID, cr.Config, cr.LocalPath)
+
+	return c.JSON(fiber.Map{"data": req})
+}
@@ -0,0 +1,92 @@
+package gitops
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommitConvention(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cr, _ := connectTestRepo(t, "alice")
+	app := newTestApp("alice")
+	app.Post("/commit", commitChanges)
+	app.Put("/commit-convention", setCommitConvention)
+	put := func(body interface{}) int {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest("PUT", "/commit-convention", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		res, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	headMessage := func() string {
+		t.Helper()
+		head, err := cr.Repo.Head()
+		if err != nil {
+			t.Fatal(err)
+		}
+		commit, err := cr.Repo.CommitObject(head.Hash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(commit.Message)
+	}
+
+	if status := put(CommitConvention{Pattern: "("}); status != 400 {
+		t.Errorf("invalid pattern = %d, want 400", status)
+	}
+	if status := put(CommitConvention{Pattern: `^docs: `, Template: "update"}); status != 400 {
+		t.Errorf("template breaking the pattern = %d, want 400", status)
+	}
+	if status := put(CommitConvention{Pattern: `^(feat|fix|docs)(\(.+\))?: .+`, Template: "docs: update notes"}); status != 200 {
+		t.Fatalf("set convention = %d", status)
+	}
+
+	before := headMessage()
+	if err := os.WriteFile(filepath.Join(cr.LocalPath, "a.md"), []byte("one"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	status, body := postJSON(t, app, "/commit", map[string]string{"message": "updated stuff"})
+	if status != 400 || !strings.Contains(body, `"code":"commit_convention"`) || !strings.Contains(body, `"template":"docs: update notes"`) {
+		t.Errorf("non-conforming message = %d %s, want 400 with the convention", status, body)
+	}
+	if headMessage() != before {
+		t.Error("non-conforming message was committed")
+	}
+
+	if status, body := postJSON(t, app, "/commit", map[string]string{"message": "fix(notes): typo"}); status != 200 {
+		t.Fatalf("conforming message = %d %s", status, body)
+	}
+	if got := headMessage(); got != "fix(notes): typo" {
+		t.Errorf("committed %q", got)
+	}
+
+	if err := os.WriteFile(filepath.Join(cr.LocalPath, "a.md"), []byte("two"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if status, body := postJSON(t, app, "/commit", map[string]string{}); status != 200 {
+		t.Fatalf("commit without a message = %d %s", status, body)
+	}
+	if got := headMessage(); got != "docs: update notes" {
+		t.Errorf("commit without a message used %q, want the template", got)
+	}
+}
+
+func TestCommitConventionOffByDefault(t *testing.T) {
+	msg, err := CommitConvention{}.commitMessage("", "fallback")
+	if err != nil || msg != "fallback" {
+		t.Errorf("empty convention = %q, %v; want the fallback", msg, err)
+	}
+	if msg, err := (CommitConvention{}).commitMessage("anything goes", "fallback"); err != nil || msg != "anything goes" {
+		t.Errorf("empty convention = %q, %v; want the message unchanged", msg, err)
+	}
+}
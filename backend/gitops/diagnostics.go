@@ -0,0 +1,163 @@
+package gitops
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/gofiber/fiber/v2"
+
+	"md-office-backend/auth"
+	"md-office-backend/providers"
+)
+
+// RepoDiagnostics describes a connected repo's state for troubleshooting.
+// It never contains the access token.
+type RepoDiagnostics struct {
+	Provider         string   `json:"provider"`
+	Owner            string   `json:"owner"`
+	Name             string   `json:"name"`
+	LocalPath        string   `json:"localPath"`
+	Subdirectory     string   `json:"subdirectory,omitempty"`
+	ConfiguredBranch string   `json:"configuredBranch"`
+	Cloned           bool     `json:"cloned"`
+	Branch           string   `json:"branch,omitempty"` // empty when HEAD is detached
+	Detached         bool     `json:"detached"`
+	Head             string   `json:"head,omitempty"`
+	RemoteURL        string   `json:"remoteUrl,omitempty"` // credentials stripped
+	Clean            bool     `json:"clean"`
+	ChangedFiles     int      `json:"changedFiles"`
+	TokenPresent     bool     `json:"tokenPresent"`
+	TokenValid       bool     `json:"tokenValid"`
+	TokenError       string   `json:"tokenError,omitempty"`
+	TokenExpiry      string   `json:"tokenExpiry,omitempty"`
+	LastSync         string   `json:"lastSync,omitempty"` // since server start
+	Problems         []string `json:"problems"`
+}
+
+// InspectRepo fills in the local git state of the clone at localPath:
+// branch, HEAD, origin URL and worktree cleanliness.
+func InspectRepo(localPath string, d *RepoDiagnostics) {
+	repo, err := gogit.PlainOpen(localPath)
+	if err != nil {
+		d.Problems = append(d.Problems, "local clone missing or unreadable: "+err.Error())
+		return
+	}
+	d.Cloned = true
+
+	head, err := repo.Head()
+	switch {
+	case err != nil:
+		d.Problems = append(d.Problems, "HEAD unresolved: "+err.Error())
+	case head.Name().IsBranch():
+		d.Branch = head.Name().Short()
+		d.Head = head.Hash().String()
+	default:
+		d.Detached = true
+		d.Head = head.Hash().String()
+		d.Problems = append(d.Problems, "HEAD is detached")
+	}
+	if d.Branch != "" && d.ConfiguredBranch != "" && d.Branch != d.ConfiguredBranch {
+		d.Problems = append(d.Problems, fmt.Sprintf("checked out %s but configured for %s", d.Branch, d.ConfiguredBranch))
+	}
+
+	if remote, err := repo.Remote("origin"); err != nil {
+		d.Problems = append(d.Problems, "no origin remote")
+	} else if urls := remote.Config().URLs; len(urls) > 0 {
+		d.RemoteURL = redactURL(urls[0])
+	}
+
+	wt, err := repo.Worktree()
+	if err == nil {
+		var status gogit.Status
+		if status, err = wt.Status(); err == nil {
+			d.Clean = status.IsClean()
+			for _, s := range status {
+				if s.Worktree != gogit.Unmodified || s.Staging != gogit.Unmodified {
+					d.ChangedFiles++
+				}
+			}
+		}
+	}
+	if err != nil {
+		d.Problems = append(d.Problems, "worktree status failed: "+err.Error())
+	}
+}
+
+// redactURL drops any userinfo (e.g. an embedded token) from a remote URL
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	u.User = nil
+	return u.String()
+}
+
+// getDiagnostics reports the connected repo's git, token and sync state.
+// It works even when the provider token is gone, which is when it's needed.
+func getDiagnostics(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	var (
+		cfg       *RepoConfig
+		localPath string
+		lastSync  time.Time
+	)
+	if cr := cachedConnectedRepo(userID); cr != nil {
+		cr.mu.Lock()
+		cfg, localPath, lastSync = cr.Config, cr.LocalPath, cr.LastSync
+		cr.mu.Unlock()
+	} else {
+		var err error
+		if cfg, localPath, err = readUserRepoConfig(userID); err != nil {
+			return c.JSON(fiber.Map{"data": fiber.Map{"connected": false}})
+		}
+	}
+
+	d := RepoDiagnostics{
+		Provider:         cfg.Provider,
+		Owner:            cfg.Owner,
+		Name:             cfg.Name,
+		LocalPath:        localPath,
+		Subdirectory:     cfg.Subdirectory,
+		ConfiguredBranch: cfg.Branch,
+		Problems:         []string{},
+	}
+	if !lastSync.IsZero() {
+		d.LastSync = lastSync.Format(time.RFC3339)
+	}
+
+	InspectRepo(localPath, &d)
+	checkToken(userID, cfg, &d)
+
+	return c.JSON(fiber.Map{"data": fiber.Map{"connected": true, "repo": d}})
+}
+
+// checkToken records whether the user still has a provider token and whether
+// the provider accepts it for this repo.
+func checkToken(userID string, cfg *RepoConfig, d *RepoDiagnostics) {
+	token, err := auth.GetToken(userID, cfg.Provider, cfg.GiteaURL)
+	if err != nil {
+		d.Problems = append(d.Problems, "no "+cfg.Provider+" token; reconnect the provider account")
+		return
+	}
+	d.TokenPresent = true
+	if token, err = auth.GetValidToken(userID, cfg.Provider, cfg.GiteaURL); err != nil {
+		d.TokenError = err.Error()
+		d.Problems = append(d.Problems, "token expired and could not be refreshed; reconnect the provider account")
+		return
+	}
+	if !token.Expiry.IsZero() {
+		d.TokenExpiry = token.Expiry.Format(time.RFC3339)
+	}
+
+	client := &providers.Client{Provider: cfg.Provider, GiteaURL: cfg.GiteaURL, AccessToken: token.AccessToken}
+	if _, err := client.ListBranches(cfg.Owner, cfg.Name); err != nil {
+		d.TokenError = err.Error()
+		d.Problems = append(d.Problems, "provider rejected the token or repo is inaccessible")
+		return
+	}
+	d.TokenValid = true
+}
@@ -0,0 +1,110 @@
+package gitops
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"md-office-backend/auth"
+)
+
+// fakeGitea accepts the access token "good" for the test/notes repo.
+func fakeGitea(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer good" {
+			http.Error(w, `{"message": "token is required"}`, http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v1/repos/test/notes/branches":
+			fmt.Fprint(w, `[{"name": "master"}]`)
+		case "/api/v1/repos/test/notes":
+			fmt.Fprint(w, `{"default_branch": "master"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func getDiagnosticsFor(t *testing.T, userID string) RepoDiagnostics {
+	t.Helper()
+	app := newTestApp(userID)
+	app.Get("/diagnostics", getDiagnostics)
+	res, err := app.Test(httptest.NewRequest("GET", "/diagnostics", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if strings.Contains(string(body), "good") {
+		t.Errorf("diagnostics include the access token: %s", body)
+	}
+	var out struct {
+		Data struct {
+			Connected bool            `json:"connected"`
+			Repo      RepoDiagnostics `json:"repo"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil || !out.Data.Connected {
+		t.Fatalf("diagnostics = %s, %v; want a connected repo", body, err)
+	}
+	return out.Data.Repo
+}
+
+func TestDiagnostics(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if err := auth.InitStore(); err != nil {
+		t.Fatal(err)
+	}
+	srv := fakeGitea(t)
+
+	cr, _ := connectTestRepo(t, "alice")
+	cr.Config.Provider, cr.Config.GiteaURL = "gitea", srv.URL
+	if err := auth.SaveToken(&auth.TokenRecord{UserID: "alice", Provider: "gitea", GiteaURL: srv.URL, AccessToken: "good"}); err != nil {
+		t.Fatal(err)
+	}
+	head, err := cr.Repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := getDiagnosticsFor(t, "alice")
+	if !d.Cloned || d.Branch != "master" || d.Detached || d.Head != head.Hash().String() || d.RemoteURL == "" {
+		t.Errorf("git state = %+v, want master at %s with a remote", d, head.Hash())
+	}
+	if !d.Clean || d.ChangedFiles != 0 {
+		t.Errorf("clean clone reported clean=%v with %d changed files", d.Clean, d.ChangedFiles)
+	}
+	if !d.TokenPresent || !d.TokenValid || len(d.Problems) != 0 {
+		t.Errorf("token present=%v valid=%v, problems %v; want a working token", d.TokenPresent, d.TokenValid, d.Problems)
+	}
+
+	if err := os.WriteFile(filepath.Join(cr.LocalPath, "draft.md"), []byte("draft"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if d = getDiagnosticsFor(t, "alice"); d.Clean || d.ChangedFiles != 1 {
+		t.Errorf("dirty clone reported clean=%v with %d changed files, want 1", d.Clean, d.ChangedFiles)
+	}
+
+	if err := auth.SaveToken(&auth.TokenRecord{UserID: "alice", Provider: "gitea", GiteaURL: srv.URL, AccessToken: "revoked"}); err != nil {
+		t.Fatal(err)
+	}
+	if d = getDiagnosticsFor(t, "alice"); !d.TokenPresent || d.TokenValid || d.TokenError == "" {
+		t.Errorf("rejected token: present=%v valid=%v error %q", d.TokenPresent, d.TokenValid, d.TokenError)
+	}
+
+	bob, _ := connectTestRepo(t, "bob")
+	bob.Config.Provider, bob.Config.GiteaURL = "gitea", srv.URL
+	d = getDiagnosticsFor(t, "bob")
+	if d.TokenPresent || d.TokenValid || len(d.Problems) != 1 || !strings.Contains(d.Problems[0], "no gitea token") {
+		t.Errorf("missing token: present=%v valid=%v, problems %v", d.TokenPresent, d.TokenValid, d.Problems)
+	}
+}
@@ -1,7 +1,11 @@
 package gitops
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -14,6 +18,7 @@ import (
 
 	"md-office-backend/auth"
 	"md-office-backend/providers"
+	"md-office-backend/storage"
 )
 
 // ConnectedRepo tracks a user's connected repository.
@@ -21,13 +26,38 @@ type ConnectedRepo struct {
 	Config   *RepoConfig      `json:"config"`
 	Repo     *gogit.Repository `json:"-"`
 	LocalPath string           `json:"localPath"`
+	LastSync  time.Time         `json:"lastSync"` // last successful pull or push
+
+	// mu serializes mutating git/worktree operations on this repo.
+	// repoMu only guards the userRepos map, not the repo itself.
+	mu sync.Mutex
 }
 
 var (
-	userRepos = make(map[string]*ConnectedRepo) // userID -> repo
+	userRepos   = make(map[string]*ConnectedRepo) // userID + "/" + repoKey.id() -> repo
+	activeRepos = make(map[string]string)         // userID -> repoKey.id() of the repo in use
 	repoMu   sync.RWMutex
 )
 
+// repoKey identifies a connected repo. The same owner/name on two providers,
+// or on two Gitea servers, are different repos.
+type repoKey struct {
+	Provider string
+	GiteaURL string
+	Owner    string
+	Name     string
+}
+
+func keyOf(cfg *RepoConfig) repoKey {
+	return repoKey{Provider: cfg.Provider, GiteaURL: cfg.GiteaURL, Owner: cfg.Owner, Name: cfg.Name}
+}
+
+// id is a short digest of the key, safe to use in file names.
+func (k repoKey) id() string {
+	sum := sha256.Sum256([]byte(k.Provider + "\x00" + k.GiteaURL + "\x00" + k.Owner + "\x00" + k.Name))
+	return hex.EncodeToString(sum[:8])
+}
+
 // RegisterRoutes adds git operations routes.
 func RegisterRoutes(app fiber.Router, authMiddleware fiber.Handler) {
 	g := app.Group("/git-provider", authMiddleware)
@@ -36,14 +66,28 @@ func RegisterRoutes(app fiber.Router, authMiddleware fiber.Handler) {
 	g.Get("/repos", listRepos)
 	g.Post("/repos", createRepo)
 	g.Get("/repos/:owner/:name/branches", listRepoBranches)
+	g.Get("/repos/:owner/:name/default-branch", getRepoDefaultBranch)
+	g.Get("/repos/:owner/:name/pulls", listRepoPulls)
 
 	// Connect/setup a repo for editing
 	g.Post("/connect", connectRepo)
 	g.Get("/status", getSyncStatus)
 	g.Post("/sync", syncRepo)
+	g.Get("/operations", listOperations)
+	g.Post("/operations/:id/cancel", cancelOperation)
 	g.Post("/commit", commitChanges)
+	g.Get("/commit-convention", getCommitConvention)
+	g.Put("/commit-convention", setCommitConvention)
 	g.Post("/create-branch", createNewBranch)
 	g.Post("/create-pr", createPR)
+	g.Get("/my-prs", listMyPRs)
+	g.Get("/merge-base", getMergeBase)
+	g.Get("/compare", getRepoCompare)
+	g.Get("/history", getRepoHistory)
+	g.Get("/web-url", getWebFileURL)
+	g.Get("/diagnostics", getDiagnostics)
+	g.Get("/local-clones", listLocalClones)
+	g.Delete("/local-clones/:owner/:name", deleteLocalClone)
 
 	// File operations on connected repo
 	g.Get("/files", listRepoFiles)
@@ -56,7 +100,7 @@ func getProviderClient(c *fiber.Ctx) (*providers.Client, error) {
 	provider := c.Query("provider", "github")
 	giteaURL := c.Query("gitea_url", "")
 
-	token, err := auth.GetToken(userID, provider, giteaURL)
+	token, err := auth.GetValidToken(userID, provider, giteaURL)
 	if err != nil {
 		return nil, fmt.Errorf("not connected to %s: %w", provider, err)
 	}
@@ -68,6 +112,16 @@ func getProviderClient(c *fiber.Ctx) (*providers.Client, error) {
 	}, nil
 }
 
+// connectedRepoClient is a provider client for the connected repo's provider
+// and Gitea server, which needn't match the request's ?provider=.
+func connectedRepoClient(userID string, cfg *RepoConfig) (*providers.Client, error) {
+	token, err := auth.GetValidToken(userID, cfg.Provider, cfg.GiteaURL)
+	if err != nil {
+		return nil, fmt.Errorf("not connected to %s: %w", cfg.Provider, err)
+	}
+	return &providers.Client{Provider: cfg.Provider, GiteaURL: cfg.GiteaURL, AccessToken: token.AccessToken}, nil
+}
+
 func listRepos(c *fiber.Ctx) error {
 	client, err := getProviderClient(c)
 	if err != nil {
@@ -76,9 +130,13 @@ func listRepos(c *fiber.Ctx) error {
 
 	page := c.QueryInt("page", 1)
 	perPage := c.QueryInt("per_page", 20)
-	search := c.Query("search", "")
+	filter := providers.RepoFilter{
+		Search:   c.Query("search", ""),
+		Language: c.Query("language", ""),
+		Topic:    c.Query("topic", ""),
+	}
 
-	repos, err := client.ListRepos(page, perPage, search)
+	repos, err := client.ListRepos(page, perPage, filter)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -123,24 +181,72 @@ func listRepoBranches(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"data": branches})
 }
 
+// listRepoPulls lists a repo's pull requests, open ones unless ?state= is
+// closed, merged or all, so the editor can point at an existing PR before
+// opening a duplicate.
+func listRepoPulls(c *fiber.Ctx) error {
+	client, err := getProviderClient(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	state := c.Query("state", providers.PRStateOpen)
+	if state != providers.PRStateOpen && state != providers.PRStateClosed && state != providers.PRStateMerged && state != "all" {
+		return c.Status(400).JSON(fiber.Map{"error": "state must be open, closed, merged or all"})
+	}
+
+	prs, err := client.ListPRs(c.Params("owner"), c.Params("name"), state)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"data": prs})
+}
+
+func getRepoDefaultBranch(c *fiber.Ctx) error {
+	client, err := getProviderClient(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	branch, err := client.DefaultBranch(c.Params("owner"), c.Params("name"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"data": fiber.Map{"defaultBranch": branch}})
+}
+
 func connectRepo(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
+	username := c.Locals("username").(string)
 
 	var req struct {
-		Provider      string `json:"provider"`
-		GiteaURL      string `json:"giteaUrl"`
-		Owner         string `json:"owner"`
-		RepoName      string `json:"repoName"`
-		CloneURL      string `json:"cloneUrl"`
-		Branch        string `json:"branch"`
-		DefaultBranch string `json:"defaultBranch"`
-		Subdirectory  string `json:"subdirectory"`
+		Provider       string `json:"provider"`
+		GiteaURL       string `json:"giteaUrl"`
+		Owner          string `json:"owner"`
+		RepoName       string `json:"repoName"`
+		CloneURL       string `json:"cloneUrl"`
+		Branch         string `json:"branch"`
+		DefaultBranch  string `json:"defaultBranch"`
+		Subdirectory   string `json:"subdirectory"`
+		CommitTemplate string `json:"commitTemplate"`
+		CommitPattern  string `json:"commitPattern"`
 	}
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
 	}
 
-	token, err := auth.GetToken(userID, req.Provider, req.GiteaURL)
+	subdirectory, err := CleanSubdirectory(req.Subdirectory)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid subdirectory: " + err.Error()})
+	}
+	convention := CommitConvention{Template: req.CommitTemplate, Pattern: req.CommitPattern}
+	if err := convention.validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	token, err := auth.GetValidToken(userID, req.Provider, req.GiteaURL)
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "not connected to provider"})
 	}
@@ -153,31 +259,54 @@ func connectRepo(c *fiber.Ctx) error {
 		CloneURL:      req.CloneURL,
 		Branch:        req.Branch,
 		DefaultBranch: req.DefaultBranch,
-		Subdirectory:  req.Subdirectory,
+		Subdirectory:  subdirectory,
+		Commit:        convention,
 		AccessToken:   token.AccessToken,
 		Username:      token.Username,
 	}
 
-	// Clone to user-specific directory
-	homeDir, _ := os.UserHomeDir()
-	localPath := filepath.Join(homeDir, ".md-office", "repos", userID, req.Owner, req.RepoName)
+	// Reconnecting reuses the repo's clone; a new repo gets its own
+	key := keyOf(cfg)
+	localPath := clonePath(userID, key)
+	if _, savedPath, err := readSavedRepoConfig(userID, key); err == nil && savedPath != "" {
+		localPath = savedPath
+	}
+
+	op, err := startOperation(c, userID, "connect", req.Owner+"/"+req.RepoName)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer op.finish()
 
 	// If already cloned, try to pull
 	var repo *gogit.Repository
+	var lastSync time.Time
+	emptyRemote := false
 	if _, err := os.Stat(filepath.Join(localPath, ".git")); err == nil {
 		repo, err = gogit.PlainOpen(localPath)
 		if err != nil {
 			// Corrupt, re-clone
 			os.RemoveAll(localPath)
-			repo, err = CloneRepo(cfg, localPath)
+			repo, emptyRemote, err = cloneOrInit(op.ctx, cfg, localPath, username)
+			if op.cancelled(err) {
+				os.RemoveAll(localPath)
+				return cancelledResponse(c, op)
+			}
 			if err != nil {
 				return c.Status(500).JSON(fiber.Map{"error": "clone failed: " + err.Error()})
 			}
-		} else {
-			_ = PullChanges(repo, cfg)
+		} else if err := PullChanges(op.ctx, repo, cfg); err == nil {
+			lastSync = time.Now()
+		} else if op.cancelled(err) {
+			return cancelledResponse(c, op)
 		}
 	} else {
-		repo, err = CloneRepo(cfg, localPath)
+		repo, emptyRemote, err = cloneOrInit(op.ctx, cfg, localPath, username)
+		if op.cancelled(err) {
+			// Don't leave a partial clone behind for the next connect to trip over
+			os.RemoveAll(localPath)
+			return cancelledResponse(c, op)
+		}
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": "clone failed: " + err.Error()})
 		}
@@ -192,28 +321,66 @@ func connectRepo(c *fiber.Ctx) error {
 
 	// Save the config for this user
 	repoMu.Lock()
-	userRepos[userID] = &ConnectedRepo{
+	userRepos[userID+"/"+key.id()] = &ConnectedRepo{
 		Config:    cfg,
 		Repo:      repo,
 		LocalPath: localPath,
+		LastSync:  lastSync,
 	}
+	activeRepos[userID] = key.id()
 	repoMu.Unlock()
 
 	// Persist repo config
 	saveUserRepoConfig(userID, cfg, localPath)
 
 	return c.JSON(fiber.Map{"data": fiber.Map{
-		"connected": true,
-		"localPath": localPath,
-		"branch":    cfg.Branch,
+		"connected":   true,
+		"localPath":   localPath,
+		"branch":      cfg.Branch,
+		"emptyRemote": emptyRemote,
+		"operationId": op.ID,
 	}})
 }
 
-func getConnectedRepo(userID string) (*ConnectedRepo, error) {
+// cloneOrInit clones the remote, falling back to a freshly initialized local
+// repo, whose first commit is made as username, when the remote has no
+// commits yet. The bool reports the fallback.
+func cloneOrInit(ctx context.Context, cfg *RepoConfig, localPath, username string) (*gogit.Repository, bool, error) {
+	repo, err := CloneRepo(ctx, cfg, localPath)
+	if errors.Is(err, ErrEmptyRemote) {
+		repo, err = InitEmptyClone(cfg, localPath, username, fmt.Sprintf("%s@mdoffice.local", username))
+		return repo, true, err
+	}
+	return repo, false, err
+}
+
+// clonePath picks the clone directory for a repo: repos/<userID>/<owner>/<name>,
+// suffixed with the key ID when another of the user's repos (the same name
+// on another provider or Gitea server) already uses that directory.
+func clonePath(userID string, key repoKey) string {
+	path := filepath.Join(reposRoot(), userID, key.Owner, key.Name)
+	for _, saved := range savedRepoConfigs(userID) {
+		if saved.localPath == path && keyOf(saved.cfg) != key {
+			return path + "-" + key.id()
+		}
+	}
+	return path
+}
+
+// cachedConnectedRepo returns the repo userID is using if it is loaded.
+func cachedConnectedRepo(userID string) *ConnectedRepo {
 	repoMu.RLock()
-	cr, ok := userRepos[userID]
-	repoMu.RUnlock()
-	if ok {
+	defer repoMu.RUnlock()
+	if id, ok := activeRepos[userID]; ok {
+		return userRepos[userID+"/"+id]
+	}
+	return nil
+}
+
+// getConnectedRepo returns the repo userID connected last, which the
+// connected-repo endpoints act on.
+func getConnectedRepo(userID string) (*ConnectedRepo, error) {
+	if cr := cachedConnectedRepo(userID); cr != nil {
 		return cr, nil
 	}
 
@@ -224,8 +391,20 @@ func getConnectedRepo(userID string) (*ConnectedRepo, error) {
 	}
 
 	repoMu.Lock()
-	userRepos[userID] = cr
-	repoMu.Unlock()
+	defer repoMu.Unlock()
+	// Another request may have loaded it, or connected another repo,
+	// concurrently; keep a single instance per repo so everyone shares the
+	// same repo lock.
+	if id, ok := activeRepos[userID]; ok {
+		return userRepos[userID+"/"+id], nil
+	}
+	id := keyOf(cr.Config).id()
+	if existing, ok := userRepos[userID+"/"+id]; ok {
+		cr = existing
+	} else {
+		userRepos[userID+"/"+id] = cr
+	}
+	activeRepos[userID] = id
 
 	return cr, nil
 }
@@ -238,7 +417,9 @@ func getSyncStatus(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"data": SyncStatus{State: "disconnected"}})
 	}
 
+	cr.mu.Lock()
 	status, err := GetSyncStatus(cr.Repo, cr.Config)
+	cr.mu.Unlock()
 	if err != nil {
 		return c.JSON(fiber.Map{"data": SyncStatus{State: "error", Message: err.Error()}})
 	}
@@ -254,10 +435,23 @@ func syncRepo(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "no connected repo"})
 	}
 
+	op, err := startOperation(c, userID, "sync", cr.Config.Owner+"/"+cr.Config.Name)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer op.finish()
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
 	// Pull first
-	if err := PullChanges(cr.Repo, cr.Config); err != nil {
+	if err := PullChanges(op.ctx, cr.Repo, cr.Config); err != nil {
+		if op.cancelled(err) {
+			return cancelledResponse(c, op)
+		}
 		return c.Status(500).JSON(fiber.Map{"error": "pull failed: " + err.Error()})
 	}
+	cr.LastSync = time.Now()
 
 	return c.JSON(fiber.Map{"data": "synced"})
 }
@@ -274,8 +468,18 @@ func commitChanges(c *fiber.Ctx) error {
 	var req struct {
 		Message string `json:"message"`
 	}
-	if err := c.BodyParser(&req); err != nil || req.Message == "" {
-		req.Message = fmt.Sprintf("Update from MD Office at %s", time.Now().Format(time.RFC3339))
+	c.BodyParser(&req)
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	message, err := cr.Config.Commit.commitMessage(req.Message, fmt.Sprintf("Update from MD Office at %s", time.Now().Format(time.RFC3339)))
+	var convErr *conventionError
+	if errors.As(err, &convErr) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error(), "code": "commit_convention", "pattern": convErr.Pattern, "template": convErr.Template})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	// Check for conflicts first
@@ -288,9 +492,10 @@ func commitChanges(c *fiber.Ctx) error {
 	}
 
 	email := fmt.Sprintf("%s@mdoffice.local", username)
-	if err := CommitAndPush(cr.Repo, cr.Config, req.Message, username, email); err != nil {
+	if err := CommitAndPush(cr.Repo, cr.Config, message, username, email); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
+	cr.LastSync = time.Now()
 
 	return c.JSON(fiber.Map{"data": "committed and pushed"})
 }
@@ -311,6 +516,9 @@ func createNewBranch(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "branch name required"})
 	}
 
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
 	if err := CreateBranch(cr.Repo, req.Name); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -330,6 +538,105 @@ func createNewBranch(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"data": "branch created"})
 }
 
+// getMergeBase returns the common ancestor of ?a= and ?b= in the connected
+// repo. Remote branches can be given as origin/<name>.
+func getMergeBase(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	a, b := c.Query("a"), c.Query("b")
+	if a == "" || b == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "a and b are required"})
+	}
+
+	cr, err := getConnectedRepo(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "no connected repo"})
+	}
+
+	cr.mu.Lock()
+	base, err := MergeBase(cr.Repo, a, b)
+	cr.mu.Unlock()
+	if err == ErrUnrelatedHistories {
+		return c.Status(409).JSON(fiber.Map{"error": err.Error(), "code": "unrelated_histories"})
+	}
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"data": base})
+}
+
+// getWebFileURL links ?path= (relative to the connected subdirectory) to
+// the provider's web view of the file on the working branch, or ?branch=.
+func getWebFileURL(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	cr, err := getConnectedRepo(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "no connected repo"})
+	}
+
+	filePath := c.Query("path")
+	if filePath == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "path is required"})
+	}
+	fullPath, err := ScopedPath(cr.LocalPath, cr.Config.Subdirectory, filePath)
+	if err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "access denied"})
+	}
+	repoPath, _ := filepath.Rel(cr.LocalPath, fullPath)
+
+	branch := c.Query("branch", cr.Config.Branch)
+	if branch == "" {
+		branch = cr.Config.DefaultBranch
+	}
+	if branch == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "could not determine branch"})
+	}
+
+	client := &providers.Client{Provider: cr.Config.Provider, GiteaURL: cr.Config.GiteaURL}
+	webURL := client.WebFileURL(cr.Config.Owner, cr.Config.Name, branch, filepath.ToSlash(repoPath))
+	if webURL == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "unsupported provider: " + cr.Config.Provider})
+	}
+
+	return c.JSON(fiber.Map{"data": fiber.Map{"url": webURL, "branch": branch, "path": filepath.ToSlash(repoPath)}})
+}
+
+// getRepoCompare asks the provider what ?head= (default the working branch)
+// changes relative to ?base= (default the repo's default branch), as a pull
+// request would show it. Only pushed commits are included.
+func getRepoCompare(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	cr, err := getConnectedRepo(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "no connected repo"})
+	}
+
+	client, err := connectedRepoClient(userID, cr.Config)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	head := c.Query("head", cr.Config.Branch)
+	base := c.Query("base", cr.Config.DefaultBranch)
+	if base == "" {
+		if base, err = client.DefaultBranch(cr.Config.Owner, cr.Config.Name); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "could not determine base branch: " + err.Error()})
+		}
+	}
+	if head == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "head is required"})
+	}
+
+	result, err := client.Compare(cr.Config.Owner, cr.Config.Name, base, head)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"data": result})
+}
+
 func createPR(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 
@@ -338,7 +645,7 @@ func createPR(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "no connected repo"})
 	}
 
-	client, err := getProviderClient(c)
+	client, err := connectedRepoClient(userID, cr.Config)
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -355,19 +662,64 @@ func createPR(c *fiber.Ctx) error {
 		req.Title = fmt.Sprintf("MD Office: changes from %s", cr.Config.Branch)
 	}
 
+	base := cr.Config.DefaultBranch
+	if base == "" {
+		if base, err = client.DefaultBranch(cr.Config.Owner, cr.Config.Name); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "could not determine base branch: " + err.Error()})
+		}
+	}
+
+	cr.mu.Lock()
+	err = CheckPRPreflight(cr.Repo, cr.Config, cr.Config.Branch, base)
+	cr.mu.Unlock()
+	var preflight *PreflightError
+	if errors.As(err, &preflight) {
+		return c.Status(400).JSON(fiber.Map{"error": preflight.Message, "code": preflight.Code})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Protection rules are advisory: the PR can still be opened
+	warnings := []string{}
+	if protection, err := client.GetBranchProtection(cr.Config.Owner, cr.Config.Name, base); err == nil && protection.Protected {
+		if protection.RequiredApprovals > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s is protected and needs %d approving review(s) before merging", base, protection.RequiredApprovals))
+		} else {
+			warnings = append(warnings, fmt.Sprintf("%s is protected; reviews or status checks may be required before merging", base))
+		}
+	}
+
 	pr, err := client.CreatePR(providers.PRRequest{
 		Title:     req.Title,
 		Body:      req.Body,
 		Head:      cr.Config.Branch,
-		Base:      cr.Config.DefaultBranch,
+		Base:      base,
 		RepoOwner: cr.Config.Owner,
 		RepoName:  cr.Config.Name,
 	})
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
-
-	return c.JSON(fiber.Map{"data": pr})
+	pr.State = providers.PRStateOpen
+
+	if err := trackPR(userID, TrackedPR{
+		Provider:  client.Provider,
+		GiteaURL:  client.GiteaURL,
+		Owner:     cr.Config.Owner,
+		Repo:      cr.Config.Name,
+		Number:    pr.Number,
+		Branch:    cr.Config.Branch,
+		Base:      base,
+		URL:       pr.HTMLURL,
+		Title:     pr.Title,
+		State:     providers.PRStateOpen,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		log.Printf("Failed to record PR %d for %s: %v", pr.Number, userID, err)
+	}
+
+	return c.JSON(fiber.Map{"data": pr, "warnings": warnings})
 }
 
 func listRepoFiles(c *fiber.Ctx) error {
@@ -379,6 +731,9 @@ func listRepoFiles(c *fiber.Ctx) error {
 	}
 
 	files, err := ListFiles(cr.LocalPath, cr.Config.Subdirectory)
+	if errors.Is(err, ErrOutsideRepo) {
+		return c.Status(403).JSON(fiber.Map{"error": "access denied"})
+	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -395,14 +750,8 @@ func getRepoFile(c *fiber.Ctx) error {
 	}
 
 	filePath := c.Params("*")
-	root := cr.LocalPath
-	if cr.Config.Subdirectory != "" {
-		root = filepath.Join(root, cr.Config.Subdirectory)
-	}
-	fullPath := filepath.Join(root, filePath)
-
-	// Security check
-	if !filepath.HasPrefix(fullPath, cr.LocalPath) {
+	fullPath, err := ScopedPath(cr.LocalPath, cr.Config.Subdirectory, filePath)
+	if err != nil {
 		return c.Status(403).JSON(fiber.Map{"error": "access denied"})
 	}
 
@@ -435,21 +784,18 @@ func saveRepoFile(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
 	}
 
-	root := cr.LocalPath
-	if cr.Config.Subdirectory != "" {
-		root = filepath.Join(root, cr.Config.Subdirectory)
-	}
-	fullPath := filepath.Join(root, req.Path)
-
-	// Security check
-	if !filepath.HasPrefix(fullPath, cr.LocalPath) {
+	fullPath, err := ScopedPath(cr.LocalPath, cr.Config.Subdirectory, req.Path)
+	if err != nil {
 		return c.Status(403).JSON(fiber.Map{"error": "access denied"})
 	}
 
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
 	// Create parent dirs
 	os.MkdirAll(filepath.Dir(fullPath), 0755)
 
-	if err := os.WriteFile(fullPath, []byte(req.Content), 0644); err != nil {
+	if err := storage.WriteFile(fullPath, []byte(req.Content), false, 0644); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -457,39 +803,98 @@ func saveRepoFile(c *fiber.Ctx) error {
 }
 
 // Persistence helpers
+//
+// Every repo a user connects keeps its config in
+// repo-configs/<userID>/<repoKey.id()>.json, so connecting another repo
+// doesn't lose its settings. repo-configs/<userID>.json is a copy of the one
+// in use.
 
-func saveUserRepoConfig(userID string, cfg *RepoConfig, localPath string) {
+func repoConfigsDir() string {
 	homeDir, _ := os.UserHomeDir()
-	cfgDir := filepath.Join(homeDir, ".md-office", "repo-configs")
-	os.MkdirAll(cfgDir, 0755)
+	return filepath.Join(homeDir, ".md-office", "repo-configs")
+}
+
+// saveUserRepoConfig persists cfg and makes it the user's repo in use.
+func saveUserRepoConfig(userID string, cfg *RepoConfig, localPath string) {
+	cfgDir := repoConfigsDir()
+	os.MkdirAll(filepath.Join(cfgDir, userID), 0755)
 
 	data := map[string]interface{}{
-		"provider":      cfg.Provider,
-		"giteaUrl":      cfg.GiteaURL,
-		"owner":         cfg.Owner,
-		"name":          cfg.Name,
-		"cloneUrl":      cfg.CloneURL,
-		"branch":        cfg.Branch,
-		"defaultBranch": cfg.DefaultBranch,
-		"subdirectory":  cfg.Subdirectory,
-		"localPath":     localPath,
+		"provider":       cfg.Provider,
+		"giteaUrl":       cfg.GiteaURL,
+		"owner":          cfg.Owner,
+		"name":           cfg.Name,
+		"cloneUrl":       cfg.CloneURL,
+		"branch":         cfg.Branch,
+		"defaultBranch":  cfg.DefaultBranch,
+		"subdirectory":   cfg.Subdirectory,
+		"commitTemplate": cfg.Commit.Template,
+		"commitPattern":  cfg.Commit.Pattern,
+		"localPath":      localPath,
+	}
+	// A repo in use from before configs were kept per repo only has the
+	// copy; keep it before that is overwritten
+	activePath := filepath.Join(cfgDir, userID+".json")
+	if prev, _, err := readRepoConfigFile(activePath); err == nil {
+		prevPath := filepath.Join(cfgDir, userID, keyOf(prev).id()+".json")
+		if _, err := os.Stat(prevPath); os.IsNotExist(err) {
+			if b, err := os.ReadFile(activePath); err == nil {
+				os.WriteFile(prevPath, b, 0644)
+			}
+		}
 	}
+
 	b, _ := json.MarshalIndent(data, "", "  ")
-	os.WriteFile(filepath.Join(cfgDir, userID+".json"), b, 0644)
+	os.WriteFile(filepath.Join(cfgDir, userID, keyOf(cfg).id()+".json"), b, 0644)
+	os.WriteFile(activePath, b, 0644)
 }
 
-func loadUserRepoConfig(userID string) (*ConnectedRepo, error) {
-	homeDir, _ := os.UserHomeDir()
-	cfgPath := filepath.Join(homeDir, ".md-office", "repo-configs", userID+".json")
+// readUserRepoConfig reads the persisted config of the repo in use, without
+// its token
+func readUserRepoConfig(userID string) (*RepoConfig, string, error) {
+	return readRepoConfigFile(filepath.Join(repoConfigsDir(), userID+".json"))
+}
 
+// readSavedRepoConfig reads the persisted config of one of the user's repos.
+func readSavedRepoConfig(userID string, key repoKey) (*RepoConfig, string, error) {
+	return readRepoConfigFile(filepath.Join(repoConfigsDir(), userID, key.id()+".json"))
+}
+
+type savedRepoConfig struct {
+	cfg       *RepoConfig
+	localPath string
+}
+
+// savedRepoConfigs lists every repo config the user has persisted,
+// including one in use from before configs were kept per repo.
+func savedRepoConfigs(userID string) []savedRepoConfig {
+	var saved []savedRepoConfig
+	seen := map[repoKey]bool{}
+	add := func(path string) {
+		if cfg, localPath, err := readRepoConfigFile(path); err == nil && !seen[keyOf(cfg)] {
+			seen[keyOf(cfg)] = true
+			saved = append(saved, savedRepoConfig{cfg: cfg, localPath: localPath})
+		}
+	}
+	add(filepath.Join(repoConfigsDir(), userID+".json"))
+	entries, _ := os.ReadDir(filepath.Join(repoConfigsDir(), userID))
+	for _, e := range entries {
+		if !e.IsDir() && filepath.Ext(e.Name()) == ".json" {
+			add(filepath.Join(repoConfigsDir(), userID, e.Name()))
+		}
+	}
+	return saved
+}
+
+func readRepoConfigFile(cfgPath string) (*RepoConfig, string, error) {
 	data, err := os.ReadFile(cfgPath)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	var m map[string]string
 	if err := json.Unmarshal(data, &m); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	cfg := &RepoConfig{
@@ -501,12 +906,19 @@ func loadUserRepoConfig(userID string) (*ConnectedRepo, error) {
 		Branch:        m["branch"],
 		DefaultBranch: m["defaultBranch"],
 		Subdirectory:  m["subdirectory"],
+		Commit:        CommitConvention{Template: m["commitTemplate"], Pattern: m["commitPattern"]},
 	}
+	return cfg, m["localPath"], nil
+}
 
-	localPath := m["localPath"]
+func loadUserRepoConfig(userID string) (*ConnectedRepo, error) {
+	cfg, localPath, err := readUserRepoConfig(userID)
+	if err != nil {
+		return nil, err
+	}
 
 	// Get token
-	token, err := auth.GetToken(userID, cfg.Provider, cfg.GiteaURL)
+	token, err := auth.GetValidToken(userID, cfg.Provider, cfg.GiteaURL)
 	if err != nil {
 		return nil, fmt.Errorf("no token: %w", err)
 	}
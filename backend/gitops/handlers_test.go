@@ -0,0 +1,233 @@
+package gitops
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/gofiber/fiber/v2"
+)
+
+// connectTestRepo connects userID to a clone of a new bare repository with
+// one commit, and returns the clone and the bare repository's path.
+func connectTestRepo(t *testing.T, userID string) (*ConnectedRepo, string) {
+	t.Helper()
+	bare := t.TempDir()
+	if _, err := gogit.PlainInit(bare, true); err != nil {
+		t.Fatal(err)
+	}
+	local := t.TempDir()
+	repo, err := InitEmptyClone(&RepoConfig{Name: "notes", CloneURL: bare, Branch: "master"}, local, "test", "test@mdoffice.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Push(&gogit.PushOptions{RemoteName: "origin"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &RepoConfig{Provider: "github", Owner: "test", Name: "notes", CloneURL: bare, Branch: "master", DefaultBranch: "master"}
+	cr := &ConnectedRepo{Config: cfg, Repo: repo, LocalPath: local}
+	id := keyOf(cfg).id()
+	repoMu.Lock()
+	userRepos[userID+"/"+id] = cr
+	activeRepos[userID] = id
+	repoMu.Unlock()
+	t.Cleanup(func() {
+		repoMu.Lock()
+		delete(userRepos, userID+"/"+id)
+		delete(activeRepos, userID)
+		repoMu.Unlock()
+	})
+	return cr, bare
+}
+
+func newTestApp(userID string) *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userID", userID)
+		c.Locals("username", userID)
+		return c.Next()
+	})
+	return app
+}
+
+func postJSON(t *testing.T, app *fiber.App, url string, body interface{}) (int, string) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", url, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	out, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(out)
+}
+
+func TestConcurrentSavesAndCommits(t *testing.T) {
+	cr, bare := connectTestRepo(t, "alice")
+	app := newTestApp("alice")
+	app.Post("/file", saveRepoFile)
+	app.Post("/commit", commitChanges)
+
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make(chan string, 2*n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path := fmt.Sprintf("notes/%d.md", i)
+			if status, body := postJSON(t, app, "/file", map[string]string{"path": path, "content": path}); status != 200 {
+				errs <- fmt.Sprintf("save %s: %d %s", path, status, body)
+			}
+			if status, body := postJSON(t, app, "/commit", map[string]string{"message": "Add " + path}); status != 200 {
+				errs <- fmt.Sprintf("commit %s: %d %s", path, status, body)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// Every file is in the pushed history and the worktree is clean
+	remote, err := gogit.PlainOpen(bare)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := remote.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := cr.Repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Hash() != local.Hash() {
+		t.Errorf("remote at %s, local at %s", head.Hash(), local.Hash())
+	}
+	commit, err := remote.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		path := fmt.Sprintf("notes/%d.md", i)
+		f, err := commit.File(path)
+		if err != nil {
+			t.Errorf("%s missing from the pushed tree: %v", path, err)
+			continue
+		}
+		if content, _ := f.Contents(); content != path {
+			t.Errorf("%s = %q", path, content)
+		}
+	}
+	wt, err := cr.Repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, err := wt.Status(); err != nil || !status.IsClean() {
+		t.Errorf("worktree not clean after the commits: %v %v", status, err)
+	}
+	if _, err := os.Stat(filepath.Join(cr.LocalPath, ".git", "index.lock")); err == nil {
+		t.Error("index.lock left behind")
+	}
+}
+
+func TestConnectRejectsEscapingSubdirectory(t *testing.T) {
+	app := newTestApp("alice")
+	app.Post("/connect", connectRepo)
+
+	status, body := postJSON(t, app, "/connect", map[string]string{"provider": "github", "owner": "test", "repoName": "notes", "subdirectory": "../../etc"})
+	if status != 400 || !strings.Contains(body, "invalid subdirectory") {
+		t.Errorf("connecting with an escaping subdirectory = %d %s, want 400", status, body)
+	}
+}
+
+func TestSubdirectoryScopesFileOperations(t *testing.T) {
+	cr, _ := connectTestRepo(t, "alice")
+	cr.Config.Subdirectory = filepath.Join("docs", "notes") // not in the repo yet
+	app := newTestApp("alice")
+	app.Get("/files", listRepoFiles)
+	app.Get("/file/*", getRepoFile)
+	app.Post("/file", saveRepoFile)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/files", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("listing a missing subdirectory = %d, want 200", resp.StatusCode)
+	}
+
+	if status, body := postJSON(t, app, "/file", map[string]string{"path": "a.md", "content": "hello"}); status != 200 {
+		t.Fatalf("saving into the subdirectory = %d %s", status, body)
+	}
+	if content, err := os.ReadFile(filepath.Join(cr.LocalPath, "docs", "notes", "a.md")); err != nil || string(content) != "hello" {
+		t.Errorf("saved file = %q, %v; want it under docs/notes", content, err)
+	}
+	resp, err = app.Test(httptest.NewRequest("GET", "/file/a.md", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("reading back a.md = %d, want 200", resp.StatusCode)
+	}
+
+	if status, _ := postJSON(t, app, "/file", map[string]string{"path": "../../outside.md", "content": "x"}); status != 403 {
+		t.Errorf("saving outside the subdirectory = %d, want 403", status)
+	}
+	if _, err := os.Stat(filepath.Join(cr.LocalPath, "outside.md")); err == nil {
+		t.Error("file written outside the subdirectory")
+	}
+}
+
+func TestWebFileURLUsesSubdirectory(t *testing.T) {
+	cr, _ := connectTestRepo(t, "alice")
+	cr.Config.Subdirectory = "docs"
+	app := newTestApp("alice")
+	app.Get("/web-url", getWebFileURL)
+
+	get := func(url string) (int, map[string]string) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", url, nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out struct {
+			Data map[string]string `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out.Data
+	}
+
+	status, data := get("/web-url?path=notes/a%20b.md")
+	if want := "https://github.com/test/notes/blob/master/docs/notes/a%20b.md"; status != 200 || data["url"] != want || data["path"] != "docs/notes/a b.md" {
+		t.Errorf("web url = %d %v, want %s", status, data, want)
+	}
+	if status, data := get("/web-url?path=a.md&branch=draft"); data["url"] != "https://github.com/test/notes/blob/draft/docs/a.md" {
+		t.Errorf("web url on ?branch= = %d %v", status, data)
+	}
+	if status, _ := get("/web-url?path=../secret.md"); status != 403 {
+		t.Errorf("web url outside the subdirectory = %d, want 403", status)
+	}
+	if status, _ := get("/web-url"); status != 400 {
+		t.Errorf("web url without a path = %d, want 400", status)
+	}
+}
@@ -0,0 +1,208 @@
+package gitops
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Page sizes for history listings. A request without ?limit= gets
+// DefaultHistoryLimit commits; larger limits are capped at MaxHistoryLimit.
+const (
+	DefaultHistoryLimit = 100
+	MaxHistoryLimit     = 500
+)
+
+// ErrUnknownCursor is returned by WalkCommits when the cursor commit is not
+// in the history being walked.
+var ErrUnknownCursor = errors.New("unknown cursor")
+
+// GitCommit is one entry in a commit history listing. The workspace and
+// connected-repo history endpoints both return it.
+type GitCommit struct {
+	Hash    string `json:"hash"`
+	Message string `json:"message"`
+	Author  string `json:"author"`
+	Date    string `json:"date"`
+}
+
+// CommitPage is one page of a history listing. NextCursor is set when more
+// commits follow; pass it back as ?cursor= to fetch them.
+type CommitPage struct {
+	Commits    []GitCommit `json:"commits"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+// HistoryQuery selects a page of history. Commits are those that changed
+// Path (all when empty), starting after the commit Cursor and then after the
+// first Skip matches, up to Limit of them (no limit when 0).
+type HistoryQuery struct {
+	Path   string
+	Cursor string
+	Skip   int
+	Limit  int
+}
+
+// ParseHistoryQuery reads ?path=, ?cursor=, ?skip= and ?limit= from the
+// request. The limit defaults to DefaultHistoryLimit and is capped at
+// MaxHistoryLimit.
+func ParseHistoryQuery(c *fiber.Ctx) (HistoryQuery, error) {
+	q := HistoryQuery{
+		Path:   c.Query("path"),
+		Cursor: c.Query("cursor"),
+		Skip:   c.QueryInt("skip"),
+		Limit:  c.QueryInt("limit", DefaultHistoryLimit),
+	}
+	if q.Skip < 0 || q.Limit < 0 {
+		return q, fmt.Errorf("skip and limit must not be negative")
+	}
+	if q.Limit == 0 || q.Limit > MaxHistoryLimit {
+		q.Limit = MaxHistoryLimit
+	}
+	if q.Path != "" {
+		q.Path = filepath.ToSlash(filepath.Clean(q.Path))
+	}
+	return q, nil
+}
+
+// WalkCommits calls fn for each commit from logs selected by q and returns
+// the cursor for the next page, or "" when the history is exhausted. The
+// iterator is always closed.
+func WalkCommits(logs object.CommitIter, q HistoryQuery, fn func(GitCommit) error) (string, error) {
+	defer logs.Close()
+
+	seenCursor := q.Cursor == ""
+	matched, sent := 0, 0
+	last, next := "", ""
+	err := logs.ForEach(func(commit *object.Commit) error {
+		if !seenCursor {
+			seenCursor = commit.Hash.String() == q.Cursor
+			return nil
+		}
+		if q.Path != "" && !touchesPath(commit, q.Path) {
+			return nil
+		}
+
+		matched++
+		if matched <= q.Skip {
+			return nil
+		}
+		if q.Limit > 0 && sent == q.Limit {
+			// One more match exists, so the page isn't the last
+			next = last
+			return storer.ErrStop
+		}
+		if err := fn(toGitCommit(commit)); err != nil {
+			return err
+		}
+		sent++
+		last = commit.Hash.String()
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if !seenCursor {
+		return "", ErrUnknownCursor
+	}
+	return next, nil
+}
+
+// PageCommits collects the page of logs selected by q.
+func PageCommits(logs object.CommitIter, q HistoryQuery) (*CommitPage, error) {
+	page := &CommitPage{Commits: []GitCommit{}}
+	next, err := WalkCommits(logs, q, func(commit GitCommit) error {
+		page.Commits = append(page.Commits, commit)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	page.NextCursor = next
+	return page, nil
+}
+
+// touchesPath reports whether commit changed path (a file or folder),
+// i.e. its entry differs from the one in each parent. A merge that takes
+// path unchanged from one side doesn't count, as with git log -- path.
+func touchesPath(commit *object.Commit, path string) bool {
+	hash, ok := pathEntry(commit, path)
+	touched := ok || commit.NumParents() > 0
+	commit.Parents().ForEach(func(parent *object.Commit) error {
+		if parentHash, parentOK := pathEntry(parent, path); parentOK == ok && parentHash == hash {
+			touched = false
+			return storer.ErrStop
+		}
+		return nil
+	})
+	return touched
+}
+
+// pathEntry returns the hash of path's tree entry in commit, if present.
+func pathEntry(commit *object.Commit, path string) (plumbing.Hash, bool) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return plumbing.ZeroHash, false
+	}
+	entry, err := tree.FindEntry(path)
+	if err != nil {
+		return plumbing.ZeroHash, false
+	}
+	return entry.Hash, true
+}
+
+func toGitCommit(commit *object.Commit) GitCommit {
+	return GitCommit{
+		Hash:    commit.Hash.String(),
+		Message: commit.Message,
+		Author:  commit.Author.Name,
+		Date:    commit.Author.When.Format(time.RFC3339),
+	}
+}
+
+// getRepoHistory lists the connected repo's commits on the checked-out
+// branch. ?path= is relative to the connected subdirectory; paging is as for
+// the workspace history (see ParseHistoryQuery).
+func getRepoHistory(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	cr, err := getConnectedRepo(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "no connected repo"})
+	}
+
+	q, err := ParseHistoryQuery(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if q.Path != "" {
+		fullPath, err := ScopedPath(cr.LocalPath, cr.Config.Subdirectory, q.Path)
+		if err != nil {
+			return c.Status(403).JSON(fiber.Map{"error": "access denied"})
+		}
+		repoPath, _ := filepath.Rel(cr.LocalPath, fullPath)
+		q.Path = filepath.ToSlash(repoPath)
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	logs, err := cr.Repo.Log(&gogit.LogOptions{})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	page, err := PageCommits(logs, q)
+	if err == ErrUnknownCursor {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error(), "code": "unknown_cursor"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"data": page})
+}
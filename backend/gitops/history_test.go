@@ -0,0 +1,152 @@
+package gitops
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gofiber/fiber/v2"
+)
+
+// countingIter counts the commits a walk pulls from the log and whether it
+// was closed.
+type countingIter struct {
+	object.CommitIter
+	yielded int
+	closed  bool
+}
+
+func (it *countingIter) ForEach(fn func(*object.Commit) error) error {
+	return it.CommitIter.ForEach(func(commit *object.Commit) error {
+		it.yielded++
+		return fn(commit)
+	})
+}
+
+func (it *countingIter) Close() {
+	it.closed = true
+	it.CommitIter.Close()
+}
+
+func TestWalkCommitsStopsAtTheLimit(t *testing.T) {
+	repo, err := gogit.PlainInit(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const total = 500
+	for i := 0; i < total; i++ {
+		opts := &gogit.CommitOptions{AllowEmptyCommits: true, Author: &object.Signature{Name: "test", When: time.Now()}}
+		if _, err := wt.Commit(fmt.Sprint("Commit ", i), opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logs, err := repo.Log(&gogit.LogOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	it := &countingIter{CommitIter: logs}
+	var messages []string
+	next, err := WalkCommits(it, HistoryQuery{Limit: 10}, func(commit GitCommit) error {
+		messages = append(messages, commit.Message)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 10 || messages[0] != fmt.Sprint("Commit ", total-1) || messages[9] != fmt.Sprint("Commit ", total-10) {
+		t.Errorf("walked %v, want the newest 10 commits", messages)
+	}
+	if next == "" {
+		t.Error("no next cursor for a history longer than the limit")
+	}
+	if it.yielded > 11 || !it.closed {
+		t.Errorf("walk read %d of %d commits (closed %v), want it to stop after the limit and close the log", it.yielded, total, it.closed)
+	}
+}
+
+// getHistoryPage fetches one page from a history endpoint answering with
+// {"data": CommitPage} or {"error": ...}.
+func getHistoryPage(t *testing.T, app *fiber.App, url string) (int, CommitPage) {
+	t.Helper()
+	res, err := app.Test(httptest.NewRequest("GET", url, nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var out struct {
+		Data CommitPage `json:"data"`
+	}
+	json.NewDecoder(res.Body).Decode(&out)
+	return res.StatusCode, out.Data
+}
+
+func TestRepoHistoryPaging(t *testing.T) {
+	cr, _ := connectTestRepo(t, "alice")
+	if err := os.MkdirAll(filepath.Join(cr.LocalPath, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 12; i++ {
+		path := "other.md"
+		if i%3 == 0 {
+			path = filepath.Join("docs", "a.md")
+		}
+		commitFile(t, cr.Repo, path, fmt.Sprint(i))
+	}
+	app := newTestApp("alice")
+	app.Get("/history", getRepoHistory)
+
+	_, all := getHistoryPage(t, app, "/history")
+	if len(all.Commits) != 13 || all.NextCursor != "" {
+		t.Fatalf("full history = %d commits, cursor %q; want 13 and no cursor", len(all.Commits), all.NextCursor)
+	}
+
+	var walked []GitCommit
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("paging never ended")
+		}
+		status, page := getHistoryPage(t, app, "/history?limit=5&cursor="+cursor)
+		if status != 200 || len(page.Commits) > 5 {
+			t.Fatalf("page %d = %d with %d commits", pages, status, len(page.Commits))
+		}
+		walked = append(walked, page.Commits...)
+		if page.NextCursor == "" {
+			break
+		}
+		if page.NextCursor != page.Commits[len(page.Commits)-1].Hash {
+			t.Errorf("cursor %s isn't the page's last commit", page.NextCursor)
+		}
+		cursor = page.NextCursor
+	}
+	if !reflect.DeepEqual(walked, all.Commits) {
+		t.Errorf("paged history differs from the full history")
+	}
+
+	if _, page := getHistoryPage(t, app, "/history?skip=2&limit=3"); !reflect.DeepEqual(page.Commits, all.Commits[2:5]) {
+		t.Errorf("skip=2&limit=3 = %+v", page.Commits)
+	}
+	cr.Config.Subdirectory = "docs"
+	if _, page := getHistoryPage(t, app, "/history?path=a.md"); len(page.Commits) != 4 {
+		t.Errorf("history of docs/a.md = %d commits, want 4", len(page.Commits))
+	}
+	if status, _ := getHistoryPage(t, app, "/history?cursor="+strings.Repeat("0", 40)); status != 400 {
+		t.Errorf("unknown cursor = %d, want 400", status)
+	}
+	if status, _ := getHistoryPage(t, app, "/history?limit=-1"); status != 400 {
+		t.Errorf("negative limit = %d, want 400", status)
+	}
+}
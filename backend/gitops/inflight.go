@@ -0,0 +1,113 @@
+package gitops
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Operation is an in-progress clone or sync that its user can cancel. Send
+// X-Operation-ID with the request to pick the ID up front; otherwise the
+// server assigns one, listed by GET /operations while the operation runs.
+type Operation struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"` // "connect" or "sync"
+	Repo      string    `json:"repo"` // owner/name
+	StartedAt time.Time `json:"startedAt"`
+
+	userID string
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+var (
+	operations   = make(map[string]*Operation) // ID -> operation
+	operationsMu sync.Mutex
+)
+
+var operationIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// startOperation registers an operation for the request and sets the
+// X-Operation-ID response header. Call finish when the operation is done.
+func startOperation(c *fiber.Ctx, userID, kind, repo string) (*Operation, error) {
+	id := c.Get("X-Operation-ID")
+	if id != "" && !operationIDPattern.MatchString(id) {
+		return nil, errors.New("X-Operation-ID must be 1-64 letters, digits, '-' or '_'")
+	}
+
+	operationsMu.Lock()
+	defer operationsMu.Unlock()
+	if id == "" {
+		id = newOperationID()
+	} else if _, taken := operations[id]; taken {
+		return nil, errors.New("an operation with this ID is already running")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	op := &Operation{ID: id, Kind: kind, Repo: repo, StartedAt: time.Now(), userID: userID, ctx: ctx, cancel: cancel}
+	operations[id] = op
+	c.Set("X-Operation-ID", id)
+	return op, nil
+}
+
+func (op *Operation) finish() {
+	operationsMu.Lock()
+	delete(operations, op.ID)
+	operationsMu.Unlock()
+	op.cancel()
+}
+
+// cancelled reports whether err came from the operation being cancelled.
+func (op *Operation) cancelled(err error) bool {
+	return err != nil && op.ctx.Err() != nil
+}
+
+func newOperationID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func cancelledResponse(c *fiber.Ctx, op *Operation) error {
+	return c.Status(409).JSON(fiber.Map{"error": op.Kind + " cancelled", "code": "cancelled", "operationId": op.ID})
+}
+
+// listOperations returns the caller's running clone and sync operations.
+func listOperations(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	operationsMu.Lock()
+	ops := []*Operation{}
+	for _, op := range operations {
+		if op.userID == userID {
+			ops = append(ops, op)
+		}
+	}
+	operationsMu.Unlock()
+	sort.Slice(ops, func(i, j int) bool { return ops[i].StartedAt.Before(ops[j].StartedAt) })
+
+	return c.JSON(fiber.Map{"data": ops})
+}
+
+// cancelOperation aborts one of the caller's running operations. The
+// operation's own request then fails with code "cancelled".
+func cancelOperation(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	operationsMu.Lock()
+	op, ok := operations[c.Params("id")]
+	operationsMu.Unlock()
+	if !ok || op.userID != userID {
+		return c.Status(404).JSON(fiber.Map{"error": "operation not found"})
+	}
+
+	op.cancel()
+	return c.JSON(fiber.Map{"data": fiber.Map{"id": op.ID, "cancelled": true}})
+}
@@ -0,0 +1,99 @@
+package gitops
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"md-office-backend/auth"
+)
+
+func TestCancelClone(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := auth.InitStore(); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.SaveToken(&auth.TokenRecord{UserID: "alice", Provider: "github", AccessToken: "token", Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	// The remote never answers, so the clone runs until it is cancelled
+	fetching := make(chan struct{}, 1)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case fetching <- struct{}{}:
+		default:
+		}
+		<-r.Context().Done()
+	}))
+	defer slow.Close()
+
+	app := newTestApp("alice")
+	app.Post("/connect", connectRepo)
+	app.Post("/operations/:id/cancel", cancelOperation)
+
+	type result struct {
+		status int
+		body   map[string]interface{}
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		body := `{"provider": "github", "owner": "test", "repoName": "notes", "cloneUrl": "` + slow.URL + `/test/notes.git", "branch": "main"}`
+		req := httptest.NewRequest("POST", "/connect", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Operation-ID", "clone-1")
+		res, err := app.Test(req, -1)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer res.Body.Close()
+		var out map[string]interface{}
+		json.NewDecoder(res.Body).Decode(&out)
+		done <- result{status: res.StatusCode, body: out}
+	}()
+
+	select {
+	case <-fetching:
+	case <-time.After(5 * time.Second):
+		t.Fatal("clone never reached the remote")
+	}
+	local := filepath.Join(home, ".md-office", "repos", "alice", "test", "notes")
+	if _, err := os.Stat(local); err != nil {
+		t.Errorf("no partial clone while cloning: %v", err)
+	}
+
+	bob := newTestApp("bob")
+	bob.Post("/operations/:id/cancel", cancelOperation)
+	if status, _ := postJSON(t, bob, "/operations/clone-1/cancel", nil); status != 404 {
+		t.Errorf("cancel by another user = %d, want 404", status)
+	}
+	if status, body := postJSON(t, app, "/operations/clone-1/cancel", nil); status != 200 {
+		t.Fatalf("cancel = %d %s", status, body)
+	}
+
+	var res result
+	select {
+	case res = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("clone still running after cancel")
+	}
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if res.status != 409 || res.body["code"] != "cancelled" || res.body["operationId"] != "clone-1" {
+		t.Errorf("cancelled connect = %d %v, want 409 cancelled", res.status, res.body)
+	}
+	if _, err := os.Stat(local); !os.IsNotExist(err) {
+		t.Errorf("partial clone left behind: %v", err)
+	}
+	if status, _ := postJSON(t, app, "/operations/clone-1/cancel", nil); status != 404 {
+		t.Errorf("cancelling a finished operation = %d, want 404", status)
+	}
+}
@@ -0,0 +1,167 @@
+package gitops
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// LocalClone is a clone directory under ~/.md-office/repos/<userID>/. Clones
+// of repos the user has since replaced with another connection, or whose
+// connect failed, are orphaned: nothing uses them any more.
+type LocalClone struct {
+	Owner     string `json:"owner"`
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Size      int64  `json:"size"` // bytes, including .git
+	Connected bool   `json:"connected"`
+}
+
+var cloneSweepOnce sync.Once
+
+func reposRoot() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".md-office", "repos")
+}
+
+// userClones lists the clone directories of one user, unsized.
+func userClones(userID string) []LocalClone {
+	_, connectedPath, _ := readUserRepoConfig(userID)
+	userDir := filepath.Join(reposRoot(), userID)
+
+	var clones []LocalClone
+	owners, _ := os.ReadDir(userDir)
+	for _, o := range owners {
+		if !o.IsDir() {
+			continue
+		}
+		names, _ := os.ReadDir(filepath.Join(userDir, o.Name()))
+		for _, n := range names {
+			if !n.IsDir() {
+				continue
+			}
+			path := filepath.Join(userDir, o.Name(), n.Name())
+			clones = append(clones, LocalClone{
+				Owner:     o.Name(),
+				Name:      n.Name(),
+				Path:      path,
+				Connected: path == connectedPath,
+			})
+		}
+	}
+	return clones
+}
+
+func dirSize(root string) int64 {
+	var size int64
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// cloneInUse reports whether a connect or sync of owner/name is running for
+// userID, in which case its directory must be left alone.
+func cloneInUse(userID, owner, name string) bool {
+	operationsMu.Lock()
+	defer operationsMu.Unlock()
+	for _, op := range operations {
+		if op.userID == userID && op.Repo == owner+"/"+name {
+			return true
+		}
+	}
+	return false
+}
+
+// removeClone deletes a clone and its owner directory once that is empty.
+func removeClone(clone LocalClone) error {
+	if err := os.RemoveAll(clone.Path); err != nil {
+		return err
+	}
+	os.Remove(filepath.Dir(clone.Path)) // only succeeds when empty
+	return nil
+}
+
+func listLocalClones(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	clones := userClones(userID)
+	for i := range clones {
+		clones[i].Size = dirSize(clones[i].Path)
+	}
+	if clones == nil {
+		clones = []LocalClone{}
+	}
+	return c.JSON(fiber.Map{"data": clones})
+}
+
+// deleteLocalClone removes one of the caller's orphaned clones. The
+// connected clone, and clones with a connect or sync running, are refused.
+func deleteLocalClone(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	owner, name := c.Params("owner"), c.Params("name")
+
+	for _, clone := range userClones(userID) {
+		if clone.Owner != owner || clone.Name != name {
+			continue
+		}
+		if clone.Connected {
+			return c.Status(409).JSON(fiber.Map{"error": "clone is the connected repo; connect another repo first", "code": "connected"})
+		}
+		if cloneInUse(userID, owner, name) {
+			return c.Status(409).JSON(fiber.Map{"error": "an operation is running on this clone", "code": "in_use"})
+		}
+		if err := removeClone(clone); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"data": fiber.Map{"removed": clone.Path}})
+	}
+	return c.Status(404).JSON(fiber.Map{"error": "clone not found"})
+}
+
+// PruneOrphanedClones removes every user's orphaned clones and returns their
+// paths.
+func PruneOrphanedClones() []string {
+	var removed []string
+	users, _ := os.ReadDir(reposRoot())
+	for _, u := range users {
+		if !u.IsDir() {
+			continue
+		}
+		for _, clone := range userClones(u.Name()) {
+			if clone.Connected || cloneInUse(u.Name(), clone.Owner, clone.Name) {
+				continue
+			}
+			if err := removeClone(clone); err != nil {
+				log.Printf("Failed to prune orphaned clone %s: %v", clone.Path, err)
+				continue
+			}
+			removed = append(removed, clone.Path)
+		}
+	}
+	return removed
+}
+
+// StartCloneSweep prunes orphaned clones now and then every interval.
+func StartCloneSweep(interval time.Duration) {
+	cloneSweepOnce.Do(func() {
+		go func() {
+			for {
+				if removed := PruneOrphanedClones(); len(removed) > 0 {
+					log.Printf("Pruned %d orphaned clone(s): %v", len(removed), removed)
+				}
+				time.Sleep(interval)
+			}
+		}()
+	})
+}
@@ -0,0 +1,106 @@
+package gitops
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOrphanedClones(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	userDir := filepath.Join(reposRoot(), "alice")
+	connected := filepath.Join(userDir, "acme", "notes")
+	orphan := filepath.Join(userDir, "acme", "old")
+	for _, dir := range []string{filepath.Join(connected, ".git"), filepath.Join(orphan, ".git")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(orphan, "a.md"), []byte("12345"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	saveUserRepoConfig("alice", &RepoConfig{Owner: "acme", Name: "notes"}, connected)
+
+	app := newTestApp("alice")
+	app.Get("/local-clones", listLocalClones)
+	app.Delete("/local-clones/:owner/:name", deleteLocalClone)
+	send := func(method, url string) (int, json.RawMessage) {
+		t.Helper()
+		res, err := app.Test(httptest.NewRequest(method, url, nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var out struct {
+			Data json.RawMessage `json:"data"`
+		}
+		json.NewDecoder(res.Body).Decode(&out)
+		return res.StatusCode, out.Data
+	}
+
+	_, data := send("GET", "/local-clones")
+	var clones []LocalClone
+	json.Unmarshal(data, &clones)
+	if len(clones) != 2 {
+		t.Fatalf("clones = %+v, want the connected one and the orphan", clones)
+	}
+	for _, clone := range clones {
+		switch clone.Name {
+		case "notes":
+			if !clone.Connected {
+				t.Errorf("connected clone listed as orphaned: %+v", clone)
+			}
+		case "old":
+			if clone.Connected || clone.Size != 5 || clone.Path != orphan {
+				t.Errorf("orphaned clone = %+v, want it unconnected with 5 bytes", clone)
+			}
+		}
+	}
+
+	if status, _ := send("DELETE", "/local-clones/acme/notes"); status != 409 {
+		t.Errorf("deleting the connected clone = %d, want 409", status)
+	}
+	if status, _ := send("DELETE", "/local-clones/acme/missing"); status != 404 {
+		t.Errorf("deleting an unknown clone = %d, want 404", status)
+	}
+	if status, _ := send("DELETE", "/local-clones/acme/old"); status != 200 {
+		t.Errorf("deleting the orphan = %d, want 200", status)
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Errorf("orphaned clone still on disk: %v", err)
+	}
+	if _, err := os.Stat(connected); err != nil {
+		t.Errorf("connected clone removed: %v", err)
+	}
+}
+
+func TestPruneOrphanedClones(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	connected := filepath.Join(reposRoot(), "alice", "acme", "notes")
+	orphans := []string{filepath.Join(reposRoot(), "alice", "acme", "old"), filepath.Join(reposRoot(), "bob", "team", "wiki")}
+	for _, dir := range append([]string{connected}, orphans...) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saveUserRepoConfig("alice", &RepoConfig{Owner: "acme", Name: "notes"}, connected)
+
+	removed := PruneOrphanedClones()
+	if len(removed) != 2 {
+		t.Errorf("pruned %v, want %v", removed, orphans)
+	}
+	for _, dir := range orphans {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("%s survived the sweep", dir)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(reposRoot(), "bob", "team")); !os.IsNotExist(err) {
+		t.Error("empty owner directory left behind")
+	}
+	if _, err := os.Stat(connected); err != nil {
+		t.Errorf("connected clone pruned: %v", err)
+	}
+}
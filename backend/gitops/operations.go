@@ -1,9 +1,12 @@
 package gitops
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -11,21 +14,35 @@ import (
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
 )
 
+// ErrEmptyRemote is returned by CloneRepo when the remote has no commits
+// (e.g. a repo created without AutoInit). Use InitEmptyClone to start one.
+var ErrEmptyRemote = errors.New("remote repository is empty")
+
+// ErrOutsideRepo is returned when a subdirectory or file path would resolve
+// outside the connected repo's root.
+var ErrOutsideRepo = errors.New("path is outside the repository")
+
+// ErrUnrelatedHistories is returned by MergeBase when two refs share no
+// commits (e.g. an orphan branch).
+var ErrUnrelatedHistories = errors.New("refs have no common ancestor")
+
 // RepoConfig holds configuration for a connected repo.
 type RepoConfig struct {
-	Provider      string `json:"provider"`
-	GiteaURL      string `json:"giteaUrl,omitempty"`
-	Owner         string `json:"owner"`
-	Name          string `json:"name"`
-	CloneURL      string `json:"cloneUrl"`
-	Branch        string `json:"branch"`
-	DefaultBranch string `json:"defaultBranch"`
-	Subdirectory  string `json:"subdirectory,omitempty"`
-	AccessToken   string `json:"-"` // never serialized
-	Username      string `json:"-"`
+	Provider      string           `json:"provider"`
+	GiteaURL      string           `json:"giteaUrl,omitempty"`
+	Owner         string           `json:"owner"`
+	Name          string           `json:"name"`
+	CloneURL      string           `json:"cloneUrl"`
+	Branch        string           `json:"branch"`
+	DefaultBranch string           `json:"defaultBranch"`
+	Subdirectory  string           `json:"subdirectory,omitempty"`
+	Commit        CommitConvention `json:"commit"`
+	AccessToken   string           `json:"-"` // never serialized
+	Username      string           `json:"-"`
 }
 
 // SyncStatus represents the current sync state.
@@ -37,8 +54,9 @@ type SyncStatus struct {
 	Ahead     int    `json:"ahead"`
 }
 
-// CloneRepo clones a remote repository to a local path.
-func CloneRepo(cfg *RepoConfig, localPath string) (*gogit.Repository, error) {
+// CloneRepo clones a remote repository to a local path. Cancelling ctx
+// aborts the transfer.
+func CloneRepo(ctx context.Context, cfg *RepoConfig, localPath string) (*gogit.Repository, error) {
 	if err := os.MkdirAll(localPath, 0755); err != nil {
 		return nil, fmt.Errorf("create dir: %w", err)
 	}
@@ -56,16 +74,88 @@ func CloneRepo(cfg *RepoConfig, localPath string) (*gogit.Repository, error) {
 		Depth:         0, // full clone for history
 	}
 
-	repo, err := gogit.PlainClone(localPath, false, opts)
+	repo, err := gogit.PlainCloneContext(ctx, localPath, false, opts)
 	if err != nil {
+		if errors.Is(err, transport.ErrEmptyRemoteRepository) {
+			os.RemoveAll(localPath)
+			return nil, ErrEmptyRemote
+		}
 		return nil, fmt.Errorf("clone: %w", err)
 	}
 
 	return repo, nil
 }
 
-// PullChanges pulls latest changes from remote.
-func PullChanges(repo *gogit.Repository, cfg *RepoConfig) error {
+// InitEmptyClone sets up a local repo for an empty remote: it initializes the
+// branch, points origin at the remote and makes an initial commit so files can
+// be added and pushed like any other connected repo. The initial commit is
+// authored by the connecting user.
+func InitEmptyClone(cfg *RepoConfig, localPath, authorName, authorEmail string) (*gogit.Repository, error) {
+	if err := os.MkdirAll(localPath, 0755); err != nil {
+		return nil, fmt.Errorf("create dir: %w", err)
+	}
+
+	branch := cfg.Branch
+	if branch == "" {
+		branch = cfg.DefaultBranch
+	}
+	if branch == "" {
+		branch = "main"
+	}
+	branchRef := plumbing.NewBranchReferenceName(branch)
+
+	repo, err := gogit.PlainInitWithOptions(localPath, &gogit.PlainInitOptions{
+		InitOptions: gogit.InitOptions{DefaultBranch: branchRef},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("init: %w", err)
+	}
+
+	if _, err := repo.CreateRemote(&config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{cfg.CloneURL},
+	}); err != nil {
+		return nil, fmt.Errorf("create remote: %w", err)
+	}
+
+	readme := fmt.Sprintf("# %s\n", cfg.Name)
+	if err := os.WriteFile(filepath.Join(localPath, "README.md"), []byte(readme), 0644); err != nil {
+		return nil, fmt.Errorf("write readme: %w", err)
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("worktree: %w", err)
+	}
+	if _, err := wt.Add("README.md"); err != nil {
+		return nil, fmt.Errorf("add: %w", err)
+	}
+	_, err = wt.Commit("Initial commit", &gogit.CommitOptions{
+		Author: &object.Signature{
+			Name:  authorName,
+			Email: authorEmail,
+			When:  time.Now(),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+
+	// Track origin so later pulls/pushes work once the branch exists remotely
+	if err := repo.CreateBranch(&config.Branch{
+		Name:   branch,
+		Remote: "origin",
+		Merge:  branchRef,
+	}); err != nil {
+		return nil, fmt.Errorf("configure branch: %w", err)
+	}
+
+	return repo, nil
+}
+
+// PullChanges pulls latest changes from remote. Cancelling ctx aborts the
+// fetch.
+func PullChanges(ctx context.Context, repo *gogit.Repository, cfg *RepoConfig) error {
 	wt, err := repo.Worktree()
 	if err != nil {
 		return fmt.Errorf("worktree: %w", err)
@@ -76,7 +166,7 @@ func PullChanges(repo *gogit.Repository, cfg *RepoConfig) error {
 		Password: cfg.AccessToken,
 	}
 
-	err = wt.Pull(&gogit.PullOptions{
+	err = wt.PullContext(ctx, &gogit.PullOptions{
 		RemoteName:    "origin",
 		ReferenceName: plumbing.NewBranchReferenceName(cfg.Branch),
 		Auth:          auth,
@@ -201,6 +291,99 @@ func ListBranches(repo *gogit.Repository) ([]string, string, error) {
 	return branches, currentBranch, nil
 }
 
+// MergeBaseInfo describes the common ancestor of two refs.
+type MergeBaseInfo struct {
+	A       string   `json:"a"`
+	B       string   `json:"b"`
+	Hash    string   `json:"hash"`
+	Message string   `json:"message"`
+	Author  string   `json:"author"`
+	Date    string   `json:"date"`
+	Others  []string `json:"others,omitempty"` // further best bases in criss-cross histories
+}
+
+// MergeBase finds the best common ancestor of revisions a and b. It returns
+// ErrUnrelatedHistories when there is none.
+func MergeBase(repo *gogit.Repository, a, b string) (*MergeBaseInfo, error) {
+	commitA, err := resolveCommit(repo, a)
+	if err != nil {
+		return nil, err
+	}
+	commitB, err := resolveCommit(repo, b)
+	if err != nil {
+		return nil, err
+	}
+
+	bases, err := commitA.MergeBase(commitB)
+	if err != nil {
+		return nil, err
+	}
+	if len(bases) == 0 {
+		return nil, ErrUnrelatedHistories
+	}
+
+	// The order go-git returns bases in isn't stable; pick deterministically
+	sort.Slice(bases, func(i, j int) bool { return bases[i].Hash.String() < bases[j].Hash.String() })
+	base := bases[0]
+	info := &MergeBaseInfo{
+		A:       a,
+		B:       b,
+		Hash:    base.Hash.String(),
+		Message: base.Message,
+		Author:  base.Author.Name,
+		Date:    base.Author.When.Format(time.RFC3339),
+	}
+	for _, other := range bases[1:] {
+		info.Others = append(info.Others, other.Hash.String())
+	}
+	return info, nil
+}
+
+func resolveCommit(repo *gogit.Repository, rev string) (*object.Commit, error) {
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("invalid revision %q: %w", rev, err)
+	}
+	return repo.CommitObject(*hash)
+}
+
+// CountAheadBehind returns how many commits local has that remote doesn't,
+// and vice versa.
+func CountAheadBehind(local, remote *object.Commit) (int, int, error) {
+	localSet, err := ancestorSet(local)
+	if err != nil {
+		return 0, 0, err
+	}
+	remoteSet, err := ancestorSet(remote)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	ahead, behind := 0, 0
+	for h := range localSet {
+		if !remoteSet[h] {
+			ahead++
+		}
+	}
+	for h := range remoteSet {
+		if !localSet[h] {
+			behind++
+		}
+	}
+	return ahead, behind, nil
+}
+
+func ancestorSet(commit *object.Commit) (map[plumbing.Hash]bool, error) {
+	set := make(map[plumbing.Hash]bool)
+	iter := object.NewCommitPreorderIter(commit, nil, nil)
+	defer iter.Close()
+	err := iter.ForEach(func(c *object.Commit) error {
+		set[c.Hash] = true
+		return nil
+	})
+	return set, err
+}
+
 // GetSyncStatus checks if local repo is ahead/behind remote.
 func GetSyncStatus(repo *gogit.Repository, cfg *RepoConfig) (*SyncStatus, error) {
 	// Fetch to update remote refs
@@ -235,13 +418,18 @@ func GetSyncStatus(repo *gogit.Repository, cfg *RepoConfig) (*SyncStatus, error)
 
 // ListFiles returns files in the repo (optionally under a subdirectory).
 func ListFiles(repoPath, subdirectory string) ([]FileEntry, error) {
-	root := repoPath
-	if subdirectory != "" {
-		root = filepath.Join(repoPath, subdirectory)
+	root, err := ScopedPath(repoPath, subdirectory, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// A configured subdirectory may not exist until the first file is saved
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return []FileEntry{}, nil
 	}
 
 	var entries []FileEntry
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return nil
 		}
@@ -269,6 +457,45 @@ func ListFiles(repoPath, subdirectory string) ([]FileEntry, error) {
 	return entries, err
 }
 
+// CleanSubdirectory normalizes a repo subdirectory ("" for the repo root)
+// and rejects absolute paths, paths escaping the repo and the .git dir.
+func CleanSubdirectory(subdirectory string) (string, error) {
+	if subdirectory == "" {
+		return "", nil
+	}
+	if filepath.IsAbs(subdirectory) || strings.HasPrefix(subdirectory, "/") {
+		return "", ErrOutsideRepo
+	}
+	cleaned := filepath.Clean(filepath.FromSlash(subdirectory))
+	if cleaned == "." {
+		return "", nil
+	}
+	if cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", ErrOutsideRepo
+	}
+	if first := strings.SplitN(filepath.ToSlash(cleaned), "/", 2)[0]; first == ".git" {
+		return "", ErrOutsideRepo
+	}
+	return cleaned, nil
+}
+
+// ScopedPath joins rel onto the repo's subdirectory and verifies the result
+// stays within that scope. An empty rel returns the scope root itself.
+func ScopedPath(repoPath, subdirectory, rel string) (string, error) {
+	sub, err := CleanSubdirectory(subdirectory)
+	if err != nil {
+		return "", err
+	}
+	root := filepath.Join(repoPath, sub)
+	fullPath := filepath.Join(root, rel)
+
+	r, err := filepath.Rel(root, fullPath)
+	if err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return "", ErrOutsideRepo
+	}
+	return fullPath, nil
+}
+
 // FileEntry represents a file in the repo listing.
 type FileEntry struct {
 	Name        string `json:"name"`
@@ -0,0 +1,164 @@
+package gitops
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestInitEmptyCloneAuthor(t *testing.T) {
+	cfg := &RepoConfig{Name: "notes", CloneURL: "https://example.invalid/notes.git"}
+	repo, err := InitEmptyClone(cfg, t.TempDir(), "alice", "alice@mdoffice.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit.Author.Name != "alice" || commit.Author.Email != "alice@mdoffice.local" {
+		t.Errorf("initial commit authored by %s <%s>, want alice", commit.Author.Name, commit.Author.Email)
+	}
+}
+
+func TestCloneEmptyRemote(t *testing.T) {
+	bare := t.TempDir()
+	if _, err := gogit.PlainInit(bare, true); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &RepoConfig{Name: "notes", CloneURL: bare, Branch: "main"}
+	local := filepath.Join(t.TempDir(), "notes")
+
+	if _, err := CloneRepo(context.Background(), cfg, local); !errors.Is(err, ErrEmptyRemote) {
+		t.Fatalf("CloneRepo of an empty remote: %v, want ErrEmptyRemote", err)
+	}
+	repo, empty, err := cloneOrInit(context.Background(), cfg, local, "alice")
+	if err != nil || !empty {
+		t.Fatalf("cloneOrInit = %v, %v; want a fresh local repo", empty, err)
+	}
+
+	// The local repo takes files and pushes them like any other
+	if err := os.WriteFile(filepath.Join(local, "first.md"), []byte("# First"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CommitAndPush(repo, cfg, "Add first.md", "alice", "alice@mdoffice.local"); err != nil {
+		t.Fatalf("commit and push: %v", err)
+	}
+	remote, err := gogit.PlainOpen(bare)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := remote.Reference(plumbing.NewBranchReferenceName("main"), true)
+	if err != nil {
+		t.Fatalf("remote has no main branch: %v", err)
+	}
+	commit, err := remote.CommitObject(ref.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"README.md", "first.md"} {
+		if _, err := commit.File(name); err != nil {
+			t.Errorf("%s not pushed: %v", name, err)
+		}
+	}
+}
+
+func TestCleanSubdirectory(t *testing.T) {
+	for in, want := range map[string]string{
+		"":              "",
+		".":             "",
+		"docs":          "docs",
+		"docs/notes/":   filepath.Join("docs", "notes"),
+		"docs/../notes": "notes",
+	} {
+		if got, err := CleanSubdirectory(in); err != nil || got != want {
+			t.Errorf("CleanSubdirectory(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"..", "../../etc", "docs/../../etc", "/etc", ".git", ".git/hooks"} {
+		if got, err := CleanSubdirectory(in); !errors.Is(err, ErrOutsideRepo) {
+			t.Errorf("CleanSubdirectory(%q) = %q, %v; want ErrOutsideRepo", in, got, err)
+		}
+	}
+}
+
+// commitFile writes path and commits it on the checked-out branch.
+func commitFile(t *testing.T, repo *gogit.Repository, path, content string) plumbing.Hash {
+	t.Helper()
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(wt.Filesystem.Root(), path), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wt.Add(path); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := wt.Commit("Update "+path, &gogit.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@mdoffice.local", When: time.Now()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestMergeBase(t *testing.T) {
+	repo, err := gogit.PlainInit(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fork := commitFile(t, repo, "a.md", "1")
+	commitFile(t, repo, "a.md", "2")
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wt.Checkout(&gogit.CheckoutOptions{Hash: fork, Branch: "refs/heads/feature", Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, repo, "b.md", "feature")
+	commitFile(t, repo, "b.md", "feature 2")
+
+	base, err := MergeBase(repo, "master", "feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base.Hash != fork.String() || base.Message != "Update a.md" || base.Author != "test" || len(base.Others) != 0 {
+		t.Errorf("merge base = %+v, want the fork point %s", base, fork)
+	}
+	if base, err := MergeBase(repo, "feature", "feature~1"); err != nil || base.Hash == fork.String() {
+		t.Errorf("merge base of a branch and its parent = %+v, %v; want the parent", base, err)
+	}
+
+	// An orphan commit shares no history with master
+	head, err := repo.CommitObject(fork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphan := &object.Commit{Author: head.Author, Committer: head.Committer, Message: "Orphan", TreeHash: head.TreeHash}
+	obj := repo.Storer.NewEncodedObject()
+	if err := orphan.Encode(obj); err != nil {
+		t.Fatal(err)
+	}
+	orphanHash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MergeBase(repo, "master", orphanHash.String()); !errors.Is(err, ErrUnrelatedHistories) {
+		t.Errorf("merge base with an orphan commit: %v, want ErrUnrelatedHistories", err)
+	}
+	if _, err := MergeBase(repo, "master", "no-such-branch"); err == nil || errors.Is(err, ErrUnrelatedHistories) {
+		t.Errorf("merge base with an unknown ref: %v, want an invalid revision error", err)
+	}
+}
@@ -0,0 +1,75 @@
+package gitops
+
+import (
+	"fmt"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// PreflightError explains why a pull request can't be opened yet, before
+// the provider rejects it with a less helpful message.
+type PreflightError struct {
+	Code    string // "same_branch", "not_pushed", "unpushed_commits", "base_missing" or "no_changes"
+	Message string
+}
+
+func (e *PreflightError) Error() string { return e.Message }
+
+// CheckPRPreflight verifies that head can be proposed into base: the two
+// differ, head is on the remote with nothing left to push, and head has
+// commits base doesn't. The remote is fetched first so the check sees
+// what the provider sees; a failed fetch falls back to the last known refs.
+func CheckPRPreflight(repo *gogit.Repository, cfg *RepoConfig, head, base string) error {
+	if head == base {
+		return &PreflightError{"same_branch", fmt.Sprintf(
+			"head and base are both %s; create a branch for your changes first", head)}
+	}
+
+	_ = repo.Fetch(&gogit.FetchOptions{
+		RemoteName: "origin",
+		Auth: &http.BasicAuth{
+			Username: cfg.Username,
+			Password: cfg.AccessToken,
+		},
+	})
+
+	remoteHead, err := remoteBranchCommit(repo, head)
+	if err != nil {
+		return &PreflightError{"not_pushed", fmt.Sprintf(
+			"branch %s has not been pushed yet; sync or commit to push it", head)}
+	}
+	if localHead, err := repo.Reference(plumbing.NewBranchReferenceName(head), true); err == nil {
+		if local, err := repo.CommitObject(localHead.Hash()); err == nil {
+			if ahead, _, err := CountAheadBehind(local, remoteHead); err == nil && ahead > 0 {
+				return &PreflightError{"unpushed_commits", fmt.Sprintf(
+					"branch %s has %d commit(s) that haven't been pushed; sync first", head, ahead)}
+			}
+		}
+	}
+
+	remoteBase, err := remoteBranchCommit(repo, base)
+	if err != nil {
+		return &PreflightError{"base_missing", fmt.Sprintf(
+			"base branch %s was not found on the remote", base)}
+	}
+	ahead, _, err := CountAheadBehind(remoteHead, remoteBase)
+	if err != nil {
+		return err
+	}
+	if ahead == 0 {
+		return &PreflightError{"no_changes", fmt.Sprintf(
+			"branch %s has no commits ahead of %s; there is nothing to propose", head, base)}
+	}
+	return nil
+}
+
+func remoteBranchCommit(repo *gogit.Repository, branch string) (*object.Commit, error) {
+	ref, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", branch), true)
+	if err != nil {
+		return nil, err
+	}
+	return repo.CommitObject(ref.Hash())
+}
@@ -0,0 +1,59 @@
+package gitops
+
+import (
+	"errors"
+	"testing"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+)
+
+func preflightCode(err error) string {
+	var preflight *PreflightError
+	if errors.As(err, &preflight) {
+		return preflight.Code
+	}
+	return ""
+}
+
+func TestCheckPRPreflight(t *testing.T) {
+	cr, _ := connectTestRepo(t, "alice")
+	repo := cr.Repo
+	push := func() {
+		t.Helper()
+		refs := []config.RefSpec{"refs/heads/feature:refs/heads/feature"}
+		if err := repo.Push(&gogit.PushOptions{RemoteName: "origin", RefSpecs: refs}); err != nil && err != gogit.NoErrAlreadyUpToDate {
+			t.Fatal(err)
+		}
+	}
+
+	if err := CheckPRPreflight(repo, cr.Config, "master", "master"); preflightCode(err) != "same_branch" {
+		t.Errorf("head == base: %v, want same_branch", err)
+	}
+
+	if err := CreateBranch(repo, "feature"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckPRPreflight(repo, cr.Config, "feature", "master"); preflightCode(err) != "not_pushed" {
+		t.Errorf("unpushed branch: %v, want not_pushed", err)
+	}
+	push()
+	if err := CheckPRPreflight(repo, cr.Config, "feature", "master"); preflightCode(err) != "no_changes" {
+		t.Errorf("branch with no commits ahead: %v, want no_changes", err)
+	}
+
+	if err := CheckoutBranch(repo, "feature"); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, repo, "a.md", "change")
+	if err := CheckPRPreflight(repo, cr.Config, "feature", "master"); preflightCode(err) != "unpushed_commits" {
+		t.Errorf("branch with local commits: %v, want unpushed_commits", err)
+	}
+	push()
+	if err := CheckPRPreflight(repo, cr.Config, "feature", "master"); err != nil {
+		t.Errorf("pushed branch with a commit ahead: %v", err)
+	}
+	if err := CheckPRPreflight(repo, cr.Config, "feature", "release"); preflightCode(err) != "base_missing" {
+		t.Errorf("missing base: %v, want base_missing", err)
+	}
+}
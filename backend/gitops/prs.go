@@ -0,0 +1,142 @@
+package gitops
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"md-office-backend/auth"
+	"md-office-backend/providers"
+)
+
+// TrackedPR is a pull/merge request created through MD Office.
+type TrackedPR struct {
+	Provider    string    `json:"provider"`
+	GiteaURL    string    `json:"giteaUrl,omitempty"`
+	Owner       string    `json:"owner"`
+	Repo        string    `json:"repo"`
+	Number      int       `json:"number"`
+	Branch      string    `json:"branch"`
+	Base        string    `json:"base"`
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	State       string    `json:"state"` // open, merged, closed
+	CreatedAt   time.Time `json:"createdAt"`
+	RefreshedAt time.Time `json:"refreshedAt,omitempty"`
+	// Set when the last refresh failed; State is then the last known value
+	RefreshError string `json:"refreshError,omitempty"`
+}
+
+// Closed reports whether the PR is merged or closed, meaning its branch
+// can be cleaned up and its state no longer changes.
+func (p *TrackedPR) Closed() bool {
+	return p.State == providers.PRStateMerged || p.State == providers.PRStateClosed
+}
+
+var prStoreMu sync.Mutex
+
+func trackedPRsPath(userID string) string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".md-office", "prs", userID+".json")
+}
+
+func loadTrackedPRs(userID string) ([]TrackedPR, error) {
+	data, err := os.ReadFile(trackedPRsPath(userID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []TrackedPR{}, nil
+		}
+		return nil, err
+	}
+	var prs []TrackedPR
+	if err := json.Unmarshal(data, &prs); err != nil {
+		return nil, err
+	}
+	return prs, nil
+}
+
+func saveTrackedPRs(userID string, prs []TrackedPR) error {
+	path := trackedPRsPath(userID)
+	os.MkdirAll(filepath.Dir(path), 0755)
+	data, err := json.MarshalIndent(prs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// trackPR records a newly created PR for userID.
+func trackPR(userID string, pr TrackedPR) error {
+	prStoreMu.Lock()
+	defer prStoreMu.Unlock()
+
+	prs, err := loadTrackedPRs(userID)
+	if err != nil {
+		return err
+	}
+	prs = append(prs, pr)
+	return saveTrackedPRs(userID, prs)
+}
+
+// refreshTrackedPRs updates the state of every open PR from its provider.
+// getClient returns the provider client to use for a PR.
+func refreshTrackedPRs(prs []TrackedPR, getClient func(pr *TrackedPR) (*providers.Client, error)) {
+	for i := range prs {
+		pr := &prs[i]
+		if pr.Closed() {
+			continue
+		}
+
+		client, err := getClient(pr)
+		if err != nil {
+			pr.RefreshError = err.Error()
+			continue
+		}
+		remote, err := client.GetPR(pr.Owner, pr.Repo, pr.Number)
+		if err != nil {
+			pr.RefreshError = err.Error()
+			continue
+		}
+
+		pr.State = remote.State
+		if remote.Title != "" {
+			pr.Title = remote.Title
+		}
+		pr.RefreshError = ""
+		pr.RefreshedAt = time.Now()
+	}
+}
+
+func listMyPRs(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	prStoreMu.Lock()
+	defer prStoreMu.Unlock()
+
+	prs, err := loadTrackedPRs(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	refreshTrackedPRs(prs, func(pr *TrackedPR) (*providers.Client, error) {
+		token, err := auth.GetValidToken(userID, pr.Provider, pr.GiteaURL)
+		if err != nil {
+			return nil, err
+		}
+		return &providers.Client{
+			Provider:    pr.Provider,
+			GiteaURL:    pr.GiteaURL,
+			AccessToken: token.AccessToken,
+		}, nil
+	})
+
+	if err := saveTrackedPRs(userID, prs); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"data": prs})
+}
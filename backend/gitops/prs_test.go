@@ -0,0 +1,64 @@
+package gitops
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"md-office-backend/providers"
+)
+
+func TestTrackedPRsRefreshFromProvider(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	var fetched []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched = append(fetched, r.URL.Path)
+		switch r.URL.Path {
+		case "/api/v1/repos/test/notes/pulls/1":
+			fmt.Fprint(w, `{"number": 1, "title": "Update notes", "state": "closed", "merged": true}`)
+		case "/api/v1/repos/test/notes/pulls/2":
+			fmt.Fprint(w, `{"number": 2, "title": "Fix typo", "state": "open", "merged": false}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	for _, pr := range []TrackedPR{
+		{Provider: "gitea", GiteaURL: srv.URL, Owner: "test", Repo: "notes", Number: 1, State: providers.PRStateOpen},
+		{Provider: "gitea", GiteaURL: srv.URL, Owner: "test", Repo: "notes", Number: 2, State: providers.PRStateOpen},
+		{Provider: "gitea", GiteaURL: srv.URL, Owner: "test", Repo: "notes", Number: 3, State: providers.PRStateClosed},
+	} {
+		if err := trackPR("alice", pr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prs, err := loadTrackedPRs("alice")
+	if err != nil || len(prs) != 3 {
+		t.Fatalf("tracked PRs = %v, %v; want the 3 recorded", prs, err)
+	}
+	if other, err := loadTrackedPRs("bob"); err != nil || len(other) != 0 {
+		t.Errorf("bob's tracked PRs = %v, %v; want none", other, err)
+	}
+
+	refreshTrackedPRs(prs, func(pr *TrackedPR) (*providers.Client, error) {
+		return &providers.Client{Provider: pr.Provider, GiteaURL: pr.GiteaURL}, nil
+	})
+	if prs[0].State != providers.PRStateMerged || prs[0].Title != "Update notes" || prs[0].RefreshedAt.IsZero() {
+		t.Errorf("PR 1 = %+v, want it merged", prs[0])
+	}
+	if prs[1].State != providers.PRStateOpen || prs[1].Closed() {
+		t.Errorf("PR 2 = %+v, want it still open", prs[1])
+	}
+	if len(fetched) != 2 {
+		t.Errorf("fetched %v, want the closed PR 3 left alone", fetched)
+	}
+
+	refreshTrackedPRs(prs[1:2], func(pr *TrackedPR) (*providers.Client, error) {
+		return nil, fmt.Errorf("not connected to provider")
+	})
+	if prs[1].RefreshError == "" || prs[1].State != providers.PRStateOpen {
+		t.Errorf("PR 2 after a failed refresh = %+v, want the error and its last known state", prs[1])
+	}
+}
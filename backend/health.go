@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+
+	apiPkg "md-office-backend/api"
+	oauthAuth "md-office-backend/auth"
+	"md-office-backend/webhooks"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// subsystems probes what the server depends on for /health. Documents live
+// in the workspace and every change is committed, so the workspace and its
+// repository are critical; the server keeps serving documents without the
+// OAuth token store (connected repos) or the webhook store.
+func subsystems() []apiPkg.Subsystem {
+	info, err := os.Stat(workspaceDir)
+	workspaceOK := err == nil && info.IsDir()
+
+	_, err = git.PlainOpen(workspaceDir)
+	gitOK := err == nil
+
+	return []apiPkg.Subsystem{
+		{Name: "workspace", OK: workspaceOK, Critical: true},
+		{Name: "git", OK: gitOK, Critical: true},
+		{Name: "tokenStore", OK: oauthAuth.Ping() == nil},
+		{Name: "webhooks", OK: webhooks.Loaded()},
+	}
+}
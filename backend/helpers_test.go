@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// useTestConfig points the config directory, workspace config and user
+// store at a fresh temporary directory for the rest of the test.
+func useTestConfig(t *testing.T) {
+	t.Helper()
+	oldDir, oldConfig, oldUsers := configDir, workspaceConfigFile, userDataFile
+	configDir = t.TempDir()
+	workspaceConfigFile = filepath.Join(configDir, "workspaces.json")
+	userDataFile = filepath.Join(configDir, "users.json")
+	t.Cleanup(func() { configDir, workspaceConfigFile, userDataFile = oldDir, oldConfig, oldUsers })
+}
+
+// newTestWorkspace saves ws as the only, active workspace in a fresh config
+// and returns it. An empty ws.Path gets a temporary directory holding files
+// (relative path -> content), committed to a new git repository.
+func newTestWorkspace(t *testing.T, ws Workspace, files map[string]string) *Workspace {
+	t.Helper()
+	useTestConfig(t)
+	if ws.ID == "" {
+		ws.ID = "ws"
+	}
+	if ws.Path == "" {
+		ws.Path = t.TempDir()
+	}
+	writeTestFiles(t, ws.Path, files)
+	if err := commitWorkspaceDir(ws.Path, "Initial commit", "test"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { forgetWorkspaceRepos(ws.Path) })
+
+	setTestConfig(t, WorkspaceConfig{ActiveWorkspace: ws.ID, Workspaces: []Workspace{ws}})
+	return &ws
+}
+
+// setTestConfig replaces the workspace config with config.
+func setTestConfig(t *testing.T, config WorkspaceConfig) {
+	t.Helper()
+	err := updateWorkspaceConfig(func(c *WorkspaceConfig) error {
+		*c = config
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		full := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// commitTestFiles writes files into the repository at dir and commits them.
+func commitTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	writeTestFiles(t, dir, files)
+	if err := commitWorkspaceDir(dir, "Update files", "test"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestApp returns an app whose requests are made as *user, read when
+// each request arrives.
+func newTestApp(user *string) *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userID", *user)
+		c.Locals("username", *user)
+		return c.Next()
+	})
+	return app
+}
+
+// doJSON sends body, JSON-encoded unless nil, and decodes the response.
+func doJSON(t *testing.T, app *fiber.App, method, url string, body interface{}) (int, APIResponse) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, url, reader)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out APIResponse
+	data, _ := io.ReadAll(resp.Body)
+	json.Unmarshal(data, &out)
+	return resp.StatusCode, out
+}
+
+// uploadTestFile posts a multipart upload of name into dir ("" for the
+// default) and decodes the response.
+func uploadTestFile(t *testing.T, app *fiber.App, url, dir, name, content string) (int, APIResponse) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if dir != "" {
+		form.WriteField("dir", dir)
+	}
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	form.Close()
+
+	req := httptest.NewRequest("POST", url, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out APIResponse
+	data, _ := io.ReadAll(resp.Body)
+	json.Unmarshal(data, &out)
+	return resp.StatusCode, out
+}
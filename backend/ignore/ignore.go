@@ -0,0 +1,102 @@
+package ignore
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/gofiber/fiber/v2"
+)
+
+// FileName is the ignore file read from the workspace root
+const FileName = ".mdofficeignore"
+
+// Matcher matches workspace-relative paths against .mdofficeignore patterns.
+// A nil *Matcher matches nothing.
+type Matcher struct {
+	m gitignore.Matcher
+}
+
+type cached struct {
+	modTime time.Time
+	size    int64
+	matcher *Matcher
+}
+
+var (
+	mu    sync.Mutex
+	cache = make(map[string]cached)
+)
+
+// Load returns the matcher for the workspace at root. Patterns are parsed once
+// and re-read only when the ignore file changes. It returns nil if the
+// workspace has no ignore file.
+func Load(root string) *Matcher {
+	info, err := os.Stat(filepath.Join(root, FileName))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err != nil {
+		delete(cache, root)
+		return nil
+	}
+
+	if c, ok := cache[root]; ok && c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+		return c.matcher
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, FileName))
+	if err != nil {
+		return nil
+	}
+	matcher := Parse(data)
+	cache[root] = cached{modTime: info.ModTime(), size: info.Size(), matcher: matcher}
+	return matcher
+}
+
+// ForRequest returns the matcher for the workspace at root, or nil when the
+// request asks for ignored paths with ?includeIgnored=true.
+func ForRequest(c *fiber.Ctx, root string) *Matcher {
+	if c.QueryBool("includeIgnored") {
+		return nil
+	}
+	return Load(root)
+}
+
+// Parse builds a matcher from gitignore-style pattern lines.
+func Parse(data []byte) *Matcher {
+	var patterns []gitignore.Pattern
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(line, nil))
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+	return &Matcher{m: gitignore.NewMatcher(patterns)}
+}
+
+// Match reports whether the workspace-relative path is ignored, either
+// directly or because one of its parent directories is.
+func (m *Matcher) Match(rel string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(filepath.Clean(rel)), "/")
+	for i := 1; i < len(parts); i++ {
+		if m.m.Match(parts[:i], true) {
+			return true
+		}
+	}
+	return m.m.Match(parts, isDir)
+}
@@ -0,0 +1,71 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	m := Parse([]byte("# generated\nbuild/\n*.log\n!keep.log\n\n"))
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"build", true, true},
+		{"build/out.md", false, true},
+		{"docs/build/out.md", false, true},
+		{"builds.md", false, false},
+		{"debug.log", false, true},
+		{"keep.log", false, false},
+		{"notes.md", false, false},
+	}
+	for _, tt := range tests {
+		if got := m.Match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	var none *Matcher
+	if none.Match("build/out.md", false) {
+		t.Error("a nil matcher matched")
+	}
+	if Parse([]byte("# only comments\n")) != nil {
+		t.Error("a file without patterns gave a matcher")
+	}
+}
+
+func TestLoadRereadsChangedFile(t *testing.T) {
+	root := t.TempDir()
+	if Load(root) != nil {
+		t.Error("matcher for a workspace without an ignore file")
+	}
+
+	file := filepath.Join(root, FileName)
+	if err := os.WriteFile(file, []byte("archive/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	first := Load(root)
+	if !first.Match("archive/old.md", false) {
+		t.Fatal("archive/ not ignored")
+	}
+	if Load(root) != first {
+		t.Error("unchanged ignore file parsed again")
+	}
+
+	if err := os.WriteFile(file, []byte("drafts/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	os.Chtimes(file, later, later)
+	if m := Load(root); m.Match("archive/old.md", false) || !m.Match("drafts/a.md", false) {
+		t.Error("changed ignore file not re-read")
+	}
+
+	os.Remove(file)
+	if Load(root) != nil {
+		t.Error("matcher kept after the ignore file was removed")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key ID of the key derived from JWT_SECRET. Tokens issued before key IDs
+// were introduced carry no kid and are verified with this key.
+const defaultJWTKeyID = "default"
+
+// jwtKey is one entry of the signing key set.
+type jwtKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	SignKey   interface{} // nil for verify-only keys
+	VerifyKey interface{}
+}
+
+// jwtKeySet holds every key accepted for verification; Active signs new
+// tokens. Rotating means adding a new key, making it active and removing the
+// old one once its tokens have expired.
+type jwtKeySet struct {
+	Active string
+	Keys   map[string]*jwtKey
+}
+
+var jwtKeys *jwtKeySet // loaded in init, after jwtSecret
+
+// loadJWTKeys builds the key set from the environment:
+//
+//	JWT_KEYS       comma-separated kid:secret HS256 keys
+//	JWT_RSA_KEYS   comma-separated kid:path RS256 keys (PEM private key, or
+//	               public key for verify-only)
+//	JWT_ACTIVE_KID key used to sign new tokens (default: first key listed)
+//
+// JWT_SECRET is always available under the "default" kid. The collaboration
+// server reads the same variables to verify these tokens (collab-server/
+// server.js), so the variable names, the kid:value format and the "default"
+// kid are a contract between the two.
+func loadJWTKeys() *jwtKeySet {
+	set := &jwtKeySet{Keys: map[string]*jwtKey{}}
+	var order []string
+
+	add := func(k *jwtKey) {
+		if _, dup := set.Keys[k.ID]; dup {
+			log.Fatalf("JWT key %q is configured twice", k.ID)
+		}
+		set.Keys[k.ID] = k
+		order = append(order, k.ID)
+	}
+
+	for _, entry := range splitKeyList(os.Getenv("JWT_KEYS")) {
+		kid, secret, ok := strings.Cut(entry, ":")
+		if !ok || kid == "" || secret == "" {
+			log.Fatalf("Invalid JWT_KEYS entry %q (want kid:secret)", entry)
+		}
+		add(&jwtKey{ID: kid, Method: jwt.SigningMethodHS256, SignKey: []byte(secret), VerifyKey: []byte(secret)})
+	}
+
+	for _, entry := range splitKeyList(os.Getenv("JWT_RSA_KEYS")) {
+		kid, path, ok := strings.Cut(entry, ":")
+		if !ok || kid == "" || path == "" {
+			log.Fatalf("Invalid JWT_RSA_KEYS entry %q (want kid:path)", entry)
+		}
+		k, err := loadRSAKey(kid, path)
+		if err != nil {
+			log.Fatalf("Failed to load JWT key %q: %v", kid, err)
+		}
+		add(k)
+	}
+
+	if _, ok := set.Keys[defaultJWTKeyID]; !ok {
+		set.Keys[defaultJWTKeyID] = &jwtKey{ID: defaultJWTKeyID, Method: jwt.SigningMethodHS256, SignKey: jwtSecret, VerifyKey: jwtSecret}
+		order = append(order, defaultJWTKeyID)
+	}
+
+	set.Active = os.Getenv("JWT_ACTIVE_KID")
+	if set.Active == "" {
+		set.Active = order[0]
+	}
+	if k, ok := set.Keys[set.Active]; !ok || k.SignKey == nil {
+		log.Fatalf("JWT_ACTIVE_KID %q is not a configured signing key", set.Active)
+	}
+	return set
+}
+
+func splitKeyList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func loadRSAKey(kid, path string) (*jwtKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if priv, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+		return &jwtKey{ID: kid, Method: jwt.SigningMethodRS256, SignKey: priv, VerifyKey: &priv.PublicKey}, nil
+	}
+	pub, err := jwt.ParseRSAPublicKeyFromPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("not an RSA private or public key")
+	}
+	return &jwtKey{ID: kid, Method: jwt.SigningMethodRS256, VerifyKey: (*rsa.PublicKey)(pub)}, nil
+}
+
+// sign signs claims with the active key and records its kid in the header.
+func (s *jwtKeySet) sign(claims jwt.Claims) (string, error) {
+	k := s.Keys[s.Active]
+	token := jwt.NewWithClaims(k.Method, claims)
+	token.Header["kid"] = k.ID
+	return token.SignedString(k.SignKey)
+}
+
+// keyFunc selects the verification key by the token's kid and rejects
+// tokens whose algorithm doesn't match that key.
+func (s *jwtKeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = defaultJWTKeyID
+	}
+	k, ok := s.Keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != k.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return k.VerifyKey, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// useJWTKeys loads the key set from the given JWT_KEYS and JWT_RSA_KEYS for
+// the rest of the test.
+func useJWTKeys(t *testing.T, hmacKeys, rsaKeys string) {
+	t.Helper()
+	old := jwtKeys
+	t.Cleanup(func() { jwtKeys = old })
+	t.Setenv("JWT_KEYS", hmacKeys)
+	t.Setenv("JWT_RSA_KEYS", rsaKeys)
+	t.Setenv("JWT_ACTIVE_KID", "")
+	jwtKeys = loadJWTKeys()
+}
+
+// authStatus is the status authMiddleware gives a request bearing token.
+func authStatus(t *testing.T, token string) int {
+	t.Helper()
+	app := fiber.New()
+	app.Get("/me", authMiddleware, func(c *fiber.Ctx) error { return c.SendString(c.Locals("userID").(string)) })
+	req := httptest.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	useTestConfig(t)
+	useJWTKeys(t, "k1:secret-one", "")
+	oldToken, err := generateJWT("u1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// k2 is introduced and signs new tokens; k1 still verifies
+	useJWTKeys(t, "k2:secret-two,k1:secret-one", "")
+	newToken, err := generateJWT("u1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, &JWTClaims{})
+	if err != nil || parsed.Header["kid"] != "k2" {
+		t.Errorf("new token kid = %v, %v; want k2", parsed.Header["kid"], err)
+	}
+	for name, token := range map[string]string{"old-key": oldToken, "new-key": newToken} {
+		if status := authStatus(t, token); status != 200 {
+			t.Errorf("%s token during the overlap = %d, want 200", name, status)
+		}
+	}
+
+	// k1 is retired
+	useJWTKeys(t, "k2:secret-two", "")
+	if status := authStatus(t, oldToken); status != 401 {
+		t.Errorf("token of a removed key = %d, want 401", status)
+	}
+	if status := authStatus(t, newToken); status != 200 {
+		t.Errorf("new-key token after k1 is retired = %d, want 200", status)
+	}
+
+	claims := JWTClaims{UserID: "u1", RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}}
+	unknown := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	unknown.Header["kid"] = "k9"
+	signed, _ := unknown.SignedString([]byte("secret-two"))
+	if status := authStatus(t, signed); status != 401 {
+		t.Errorf("token with an unknown kid = %d, want 401", status)
+	}
+	legacy, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+	if status := authStatus(t, legacy); status != 200 {
+		t.Errorf("token without a kid, signed with JWT_SECRET = %d, want 200", status)
+	}
+}
+
+// The collaboration server verifies access tokens itself: it picks the key
+// named by the kid header from the same JWT_KEYS and JWT_SECRET, checks
+// HS256 with the raw secret, and reads the userId and username claims.
+func TestJWTCollabServerContract(t *testing.T) {
+	useTestConfig(t)
+	useJWTKeys(t, "k2:secret-two", "")
+	token, err := generateJWT("u1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token %q isn't a JWS", token)
+	}
+	var header, claims map[string]interface{}
+	for i, v := range []*map[string]interface{}{&header, &claims} {
+		data, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if header["kid"] != "k2" || header["alg"] != "HS256" {
+		t.Errorf("header = %v, want kid k2 and HS256", header)
+	}
+	if claims["userId"] != "u1" || claims["username"] != "alice" {
+		t.Errorf("claims = %v, want userId and username", claims)
+	}
+	_, err = jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return []byte("secret-two"), nil },
+		jwt.WithValidMethods([]string{"HS256"}))
+	if err != nil {
+		t.Errorf("token doesn't verify with k2's raw secret: %v", err)
+	}
+
+	useJWTKeys(t, "", "")
+	token, err = generateJWT("u1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = jwt.Parse(token, func(tok *jwt.Token) (interface{}, error) {
+		if tok.Header["kid"] != defaultJWTKeyID {
+			t.Errorf("kid = %v without JWT_KEYS, want %q", tok.Header["kid"], defaultJWTKeyID)
+		}
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{"HS256"}))
+	if err != nil {
+		t.Errorf("token doesn't verify with JWT_SECRET: %v", err)
+	}
+}
+
+func TestJWTRSAKeys(t *testing.T) {
+	useTestConfig(t)
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	privPath := filepath.Join(dir, "signing.pem")
+	pubPath := filepath.Join(dir, "verify.pem")
+	pubDER, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)}), 0600)
+	os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644)
+
+	useJWTKeys(t, "", "r1:"+privPath)
+	token, err := generateJWT("u1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed, _, _ := jwt.NewParser().ParseUnverified(token, &JWTClaims{}); parsed.Method.Alg() != "RS256" {
+		t.Errorf("token signed with %s, want RS256", parsed.Method.Alg())
+	}
+
+	// A server holding only the public key still verifies r1 tokens
+	useJWTKeys(t, "h1:secret-one", "r1:"+pubPath)
+	if status := authStatus(t, token); status != 200 {
+		t.Errorf("RS256 token verified with the public key = %d, want 200", status)
+	}
+
+	// An HS256 token claiming the RSA kid, keyed with the public key bytes
+	claims := JWTClaims{UserID: "u1", RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}}
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = "r1"
+	pubPEM, _ := os.ReadFile(pubPath)
+	signed, _ := forged.SignedString(pubPEM)
+	if status := authStatus(t, signed); status != 401 {
+		t.Errorf("HS256 token for an RS256 kid = %d, want 401", status)
+	}
+}
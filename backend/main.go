@@ -1,20 +1,32 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"mime"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/golang-jwt/jwt/v5"
@@ -23,21 +35,46 @@ import (
 	oauthAuth "md-office-backend/auth"
 	apiPkg "md-office-backend/api"
 	"md-office-backend/gitops"
+	"md-office-backend/ignore"
+	"md-office-backend/storage"
+	"md-office-backend/validation"
 	"md-office-backend/webhooks"
 )
 
-// JWT Configuration
-var jwtSecret = func() []byte {
-	if s := os.Getenv("JWT_SECRET"); s != "" {
-		return []byte(s)
+// JWT Configuration: the HS256 secret behind the "default" signing key and
+// signed URLs. Set in init from JWT_SECRET, see loadJWTSecret.
+var jwtSecret []byte
+
+// minJWTSecretLen is the shortest JWT_SECRET accepted (the HS256 key size).
+const minJWTSecretLen = 32
+
+// loadJWTSecret reads JWT_SECRET, exiting if it is missing or too short.
+// Outside production (APP_ENV != "production") a missing secret is replaced
+// by a random key, so tokens stop working when the server restarts.
+func loadJWTSecret() []byte {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		if os.Getenv("APP_ENV") == "production" {
+			log.Fatal("JWT_SECRET must be set when APP_ENV=production")
+		}
+		key := make([]byte, minJWTSecretLen)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatal("Failed to generate JWT secret:", err)
+		}
+		log.Println("WARNING: JWT_SECRET is not set; using a random key that changes on every restart. Set JWT_SECRET (at least 32 bytes) before deploying.")
+		return key
 	}
-	return []byte("your-secret-key-change-in-production")
-}()
+	if len(secret) < minJWTSecretLen {
+		log.Fatalf("JWT_SECRET must be at least %d bytes (got %d)", minJWTSecretLen, len(secret))
+	}
+	return []byte(secret)
+}
 
 // Data structures
 type APIResponse struct {
-	Data  interface{} `json:"data,omitempty"`
-	Error string      `json:"error,omitempty"`
+	Data   interface{}       `json:"data,omitempty"`
+	Error  string            `json:"error,omitempty"`
+	Fields validation.Errors `json:"fields,omitempty"` // field-level validation failures
 }
 
 type FileSystemItem struct {
@@ -45,24 +82,24 @@ type FileSystemItem struct {
 	Path        string            `json:"path"`
 	IsDirectory bool              `json:"isDirectory"`
 	Children    *[]FileSystemItem `json:"children,omitempty"`
+	Truncated   bool              `json:"truncated,omitempty"` // directory deeper than the depth limit, children omitted
+	Symlink     bool              `json:"symlink,omitempty"`   // see the symlink policy in package storage
 }
 
 type FileContent struct {
 	Path         string `json:"path"`
 	Content      string `json:"content"`
 	LastModified string `json:"lastModified"`
+	Size         int64  `json:"size,omitempty"`      // of the whole file, when Content is truncated
+	Truncated    bool   `json:"truncated,omitempty"` // Content is only the first FILE_CONTENT_MAX_BYTES
+	Hash         string `json:"hash,omitempty"`      // of the whole content, for SaveFileRequest.BaseHash; unset when truncated
 }
 
-type GitCommit struct {
-	Hash    string `json:"hash"`
-	Message string `json:"message"`
-	Author  string `json:"author"`
-	Date    string `json:"date"`
-}
+// GitCommit and GitHistory are shared with the connected-repo history so
+// both endpoints page the same way.
+type GitCommit = gitops.GitCommit
 
-type GitHistory struct {
-	Commits []GitCommit `json:"commits"`
-}
+type GitHistory = gitops.CommitPage
 
 type GitBranch struct {
 	Name      string `json:"name"`
@@ -85,6 +122,36 @@ type GitDiff struct {
 	Summary string          `json:"summary,omitempty"`
 }
 
+// GitDiffStat aggregates line changes over a commit range.
+type GitDiffStat struct {
+	From         string        `json:"from,omitempty"` // empty means from the first commit
+	To           string        `json:"to"`
+	Commits      int           `json:"commits"` // non-merge commits counted
+	FilesChanged int           `json:"filesChanged"`
+	Insertions   int           `json:"insertions"`
+	Deletions    int           `json:"deletions"`
+	Files        []GitFileStat `json:"files"`
+}
+
+type GitFileStat struct {
+	File       string `json:"file"`
+	Insertions int    `json:"insertions"`
+	Deletions  int    `json:"deletions"`
+}
+
+// GitRemoteDiff compares the current branch with its upstream tracking ref.
+type GitRemoteDiff struct {
+	Remote     string          `json:"remote"`
+	Branch     string          `json:"branch"`
+	Upstream   string          `json:"upstream"`
+	LocalHash  string          `json:"localHash"`
+	RemoteHash string          `json:"remoteHash"`
+	Ahead      int             `json:"ahead"`
+	Behind     int             `json:"behind"`
+	Changes    []GitDiffChange `json:"changes"`
+	FetchError string          `json:"fetchError,omitempty"` // set when the fetch failed and stale refs were used
+}
+
 // Workspace management
 type Workspace struct {
 	ID          string             `json:"id"`
@@ -94,6 +161,21 @@ type Workspace struct {
 	CreatedAt   time.Time          `json:"createdAt"`
 	Members     []WorkspaceMember  `json:"members"`
 	Permissions map[string]string  `json:"permissions"` // userId -> permission level
+	Settings    WorkspaceSettings  `json:"settings"`
+	InviteLinks []InviteLink       `json:"inviteLinks,omitempty"`
+}
+
+// WorkspaceSettings holds per-workspace options managed by the owner.
+type WorkspaceSettings struct {
+	CompressDocuments bool  `json:"compressDocuments"`          // gzip text documents at rest
+	CompressMinBytes  int64 `json:"compressMinBytes,omitempty"` // only compress documents at least this large
+	DedupeUploads     bool  `json:"dedupeUploads"`              // reuse identical files instead of storing copies
+	// Reject names that differ from an existing one only by case even when
+	// the server's filesystem tells them apart (for repos also cloned on
+	// macOS or Windows)
+	FoldNameCase bool `json:"foldNameCase"`
+	// Folders or files only some members may open (see PathACL)
+	PathACLs []PathACL `json:"pathAcls,omitempty" validate:"max=200"`
 }
 
 type WorkspaceMember struct {
@@ -105,7 +187,8 @@ type WorkspaceMember struct {
 
 type WorkspaceConfig struct {
 	Workspaces    []Workspace `json:"workspaces"`
-	ActiveWorkspace string    `json:"activeWorkspace"`
+	ActiveWorkspace string    `json:"activeWorkspace"` // server default for users without a selection
+	UserActive    map[string]string `json:"userActive,omitempty"` // userId -> selected workspace ID
 }
 
 // User authentication
@@ -128,18 +211,20 @@ type UserStorage struct {
 }
 
 type LoginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
 }
 
 type RegisterRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username string `json:"username" validate:"required,min=3,max=64"`
+	Password string `json:"password" validate:"required"`
 }
 
 type AuthResponse struct {
-	Token string   `json:"token"`
-	User  SafeUser `json:"user"`
+	Token        string          `json:"token"`
+	RefreshToken string          `json:"refreshToken"`
+	User         SafeUser        `json:"user"`
+	Preferences  json.RawMessage `json:"preferences,omitempty"`
 }
 
 type JWTClaims struct {
@@ -150,22 +235,29 @@ type JWTClaims struct {
 
 // Request types
 type SaveFileRequest struct {
-	Path    string `json:"path"`
+	Path    string `json:"path" validate:"required,max=1024"`
 	Content string `json:"content"`
+	// Hash of the content the edit started from (FileContent.Hash). When
+	// set, the save fails with 409 if the file has changed since.
+	BaseHash string `json:"baseHash,omitempty" validate:"max=64"`
 }
 
 type CreateFileRequest struct {
-	Path    string `json:"path"`
+	Path    string `json:"path" validate:"required,max=1024"`
 	Content string `json:"content"`
 }
 
 type CreateDirRequest struct {
-	Path string `json:"path"`
+	Path string `json:"path" validate:"required,max=1024"`
 }
 
 type RenameRequest struct {
-	OldPath string `json:"oldPath"`
-	NewPath string `json:"newPath"`
+	OldPath string `json:"oldPath" validate:"required,max=1024"`
+	NewPath string `json:"newPath" validate:"required,max=1024"`
+}
+
+type LastCommitsRequest struct {
+	Paths []string `json:"paths" validate:"required,max=500"`
 }
 
 type RevertRequest struct {
@@ -174,12 +266,13 @@ type RevertRequest struct {
 }
 
 type CreateWorkspaceRequest struct {
-	Name string `json:"name"`
-	Path string `json:"path"`
+	Name     string `json:"name" validate:"required,max=100"`
+	Path     string `json:"path" validate:"required,max=1024"`
+	Template string `json:"template,omitempty" validate:"max=100"` // see GET /api/workspaces/templates
 }
 
 type SwitchWorkspaceRequest struct {
-	WorkspaceID string `json:"workspaceId"`
+	WorkspaceID string `json:"workspaceId" validate:"required"`
 }
 
 type CreateBranchRequest struct {
@@ -195,15 +288,21 @@ type MergeBranchRequest struct {
 }
 
 type InviteUserRequest struct {
-	Username   string `json:"username"`
-	Permission string `json:"permission"` // editor, viewer
+	Username   string `json:"username" validate:"required"`
+	Permission string `json:"permission" validate:"required,oneof=editor viewer"`
+}
+
+type UpdateMemberRequest struct {
+	Permission string `json:"permission" validate:"required,oneof=editor viewer"`
 }
 
 type UploadResponse struct {
-	Filename string `json:"filename"`
-	Path     string `json:"path"`
-	Size     int64  `json:"size"`
-	URL      string `json:"url"`
+	Filename     string `json:"filename"`
+	Path         string `json:"path"`
+	Size         int64  `json:"size"`
+	URL          string `json:"url"`
+	Markdown     string `json:"markdown"`               // ready-to-paste link or image snippet
+	Deduplicated bool   `json:"deduplicated,omitempty"` // an identical existing file was returned
 }
 
 type SearchRequest struct {
@@ -223,6 +322,8 @@ type SearchMatch struct {
 	Content  string `json:"content"`
 	Start    int    `json:"start"`
 	End      int    `json:"end"`
+	Before   []string `json:"before,omitempty"` // ?context= lines above, not repeating the previous match's
+	After    []string `json:"after,omitempty"`  // ?context= lines below, up to the next match
 }
 
 type SearchResponse struct {
@@ -234,14 +335,44 @@ type SearchResponse struct {
 // Global variables
 var (
 	workspaceDir    string
-	gitRepo         *git.Repository
 	currentWorkspace *Workspace
 	configDir       string
 	userDataFile    string
 	workspaceConfigFile string
+
+	// Upload settings (see UPLOAD_URL_PREFIX / UPLOAD_ALLOWED_DIRS)
+	uploadURLPrefix   string
+	uploadAllowedDirs []string
+
+	// Maximum directory depth returned by the file tree (FILE_TREE_MAX_DEPTH)
+	fileTreeMaxDepth = 64
+
+	// Largest file getFile returns inline (FILE_CONTENT_MAX_BYTES); bigger
+	// ones are fetched from the raw endpoint or previewed
+	fileContentMaxBytes int64 = 5 << 20
+
+	// Path of the default workspace (WORKSPACE_PATH); recreated if it vanishes
+	defaultWorkspaceDir string
+	workspaceRecoverMu  sync.Mutex
+
+	// Directory workspace files may be deleted under (WORKSPACES_ROOT); when
+	// unset, deleting a workspace never removes files
+	workspacesRoot string
+
+	// Serializes read-modify-write updates of the workspace config file
+	workspaceConfigMu sync.Mutex
+
+	// Usernames allowed to perform admin actions (ADMIN_USERS)
+	adminUsers = map[string]bool{}
+
+	// Document types served by the REST API (API_DOC_TYPES); empty means all
+	apiDocTypes []string
 )
 
 func init() {
+	jwtSecret = loadJWTSecret()
+	jwtKeys = loadJWTKeys()
+
 	// Setup config directory
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -265,6 +396,46 @@ func init() {
 	if err == nil {
 		workspaceDir = abs
 	}
+	defaultWorkspaceDir = workspaceDir
+
+	// Upload URLs point at the asset route unless overridden
+	// (e.g. when a reverse proxy serves assets from another path)
+	uploadURLPrefix = strings.TrimSuffix(os.Getenv("UPLOAD_URL_PREFIX"), "/")
+	if uploadURLPrefix == "" {
+		uploadURLPrefix = assetPathPrefix
+	}
+	if n, err := strconv.Atoi(os.Getenv("FILE_TREE_MAX_DEPTH")); err == nil && n > 0 {
+		fileTreeMaxDepth = n
+	}
+	if n, err := strconv.ParseInt(os.Getenv("FILE_CONTENT_MAX_BYTES"), 10, 64); err == nil && n > 0 {
+		fileContentMaxBytes = n
+	}
+
+	initMaintenanceMode()
+
+	for _, name := range strings.Split(os.Getenv("ADMIN_USERS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			adminUsers[name] = true
+		}
+	}
+
+	for _, name := range strings.Split(os.Getenv("API_DOC_TYPES"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			apiDocTypes = append(apiDocTypes, name)
+		}
+	}
+
+	if root := os.Getenv("WORKSPACES_ROOT"); root != "" {
+		if abs, err := filepath.Abs(root); err == nil {
+			workspacesRoot = abs
+		}
+	}
+
+	for _, dir := range strings.Split(os.Getenv("UPLOAD_ALLOWED_DIRS"), ",") {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			uploadAllowedDirs = append(uploadAllowedDirs, filepath.Clean(dir))
+		}
+	}
 }
 
 func main() {
@@ -275,6 +446,9 @@ func main() {
 		log.Fatal("Failed to initialize app:", err)
 	}
 
+	// Index workspaces for search
+	warmSearchIndexes()
+
 	// Initialize OAuth token store
 	if err := oauthAuth.InitStore(); err != nil {
 		log.Printf("Warning: OAuth store init failed: %v", err)
@@ -284,6 +458,7 @@ func main() {
 	if err := webhooks.Init(configDir); err != nil {
 		log.Printf("Warning: Webhook store init failed: %v", err)
 	}
+	webhooks.Visible = webhookVisible
 
 	app := fiber.New(fiber.Config{
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
@@ -291,17 +466,35 @@ func main() {
 		},
 	})
 
+	// Correlation IDs for logs and webhooks
+	app.Use(requestIDMiddleware)
+
+	// Prometheus metrics (METRICS_ENABLED), for scrapers holding METRICS_TOKEN
+	if on, _ := strconv.ParseBool(os.Getenv("METRICS_ENABLED")); on {
+		token := os.Getenv("METRICS_TOKEN")
+		if token == "" {
+			log.Fatal("METRICS_TOKEN must be set when METRICS_ENABLED is")
+		}
+		initMetrics()
+		app.Use(metricsMiddleware)
+		app.Get("/metrics", requireMetricsToken(token), metricsHandler)
+	}
+
 	// Enable CORS (configurable via CORS_ORIGINS env var)
 	corsOrigins := os.Getenv("CORS_ORIGINS")
 	if corsOrigins == "" {
 		corsOrigins = "*"
 	}
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: corsOrigins,
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
-		AllowMethods: "GET, POST, PUT, DELETE, OPTIONS",
+		AllowOrigins:  corsOrigins,
+		AllowHeaders:  "Origin, Content-Type, Accept, Authorization, X-Request-ID, If-Match, If-None-Match",
+		ExposeHeaders: "X-Request-ID, ETag",
+		AllowMethods:  "GET, POST, PUT, PATCH, DELETE, OPTIONS",
 	}))
 
+	// Read-only maintenance mode (MAINTENANCE_MODE or PUT /api/admin/maintenance)
+	app.Use(maintenanceGuard)
+
 	// API routes
 	api := app.Group("/api")
 
@@ -310,48 +503,165 @@ func main() {
 	auth.Post("/register", register)
 	auth.Post("/login", login)
 	auth.Get("/me", authMiddleware, getCurrentUser)
+	auth.Post("/refresh", refreshAccessToken)
+	auth.Post("/logout", authMiddleware, logout)
+
+	// Signed download links carry their own credential
+	api.Get("/files/signed/:token", getSignedFile)
 
 	// Protected routes (require authentication)
 	protected := api.Group("/", authMiddleware)
 
+	// Admin
+	protected.Get("/admin/maintenance", getMaintenanceMode)
+	protected.Put("/admin/maintenance", updateMaintenanceMode)
+
+	// Per-user preferences
+	protected.Get("/preferences", getPreferences)
+	protected.Put("/preferences", updatePreferences)
+
 	// Workspace management
 	workspaces := protected.Group("/workspaces")
 	workspaces.Get("/", getWorkspaces)
 	workspaces.Post("/", createWorkspace)
 	workspaces.Post("/switch", switchWorkspace)
+	workspaces.Post("/join", joinWorkspace)
+	workspaces.Get("/templates", getWorkspaceTemplates)
+	workspaces.Get("/:id/settings", getWorkspaceSettings)
+	workspaces.Put("/:id/settings", updateWorkspaceSettings)
 	workspaces.Get("/:id/members", getWorkspaceMembers)
 	workspaces.Post("/:id/members", addWorkspaceMember)
+	workspaces.Post("/:id/invite-link", createInviteLink)
+	workspaces.Patch("/:id/members/:userId", updateWorkspaceMember)
 	workspaces.Delete("/:id/members/:userId", removeWorkspaceMember)
+	workspaces.Post("/:id/duplicate", duplicateWorkspace)
+	workspaces.Delete("/:id", deleteWorkspace)
 
 	// File operations
-	files := protected.Group("/files")
+	files := protected.Group("/files", requireWorkspace)
 	files.Get("/", getFiles)
+	files.Get("/last-commit", getLastCommit)
+	files.Post("/last-commits", getLastCommits)
+	files.Get("/trash", listTrash)
+	files.Post("/trash/restore", restoreTrash)
+	files.Delete("/trash", emptyTrash)
+	files.Get("/raw/*", getRawFile)
+	files.Post("/sign", signFileURL)
 	files.Get("/:path", getFile)
 	files.Post("/", saveFile)
 	files.Post("/create", createFile)
 	files.Post("/mkdir", createDirectory)
+	files.Post("/batch", batchFiles)
 	files.Delete("/:path", deleteItem)
 	files.Put("/rename", renameItem)
 	files.Post("/upload", uploadFile)
+	files.Post("/upload/init", initResumableUpload)
+	files.Get("/upload/:id", getResumableUpload)
+	files.Put("/upload/:id", appendResumableUpload)
+	files.Post("/upload/:id/complete", completeResumableUpload)
+	files.Delete("/upload/:id", abortResumableUpload)
 
 	// Search operations
-	search := protected.Group("/search")
+	search := protected.Group("/search", requireWorkspace)
 	search.Get("/", searchFiles)
+	search.Get("/suggest", suggestFiles)
+	search.Post("/reindex", reindexSearch)
 
 	// OAuth provider routes
 	oauthAuth.RegisterRoutes(api, authMiddleware)
 
 	// Git provider routes (remote repos)
 	gitops.RegisterRoutes(api, authMiddleware)
+	if interval, err := time.ParseDuration(os.Getenv("CLONE_SWEEP_INTERVAL")); err == nil && interval > 0 {
+		gitops.StartCloneSweep(interval)
+	}
 
 	// REST API v1 routes (API key auth)
 	apiV1Cfg := &apiPkg.Config{
 		WorkspaceDir: workspaceDir,
 		ConfigDir:    configDir,
+		DocTypes:     apiDocTypes,
 		GetUserID: func(c *fiber.Ctx) string {
 			uid, _ := c.Locals("userID").(string)
 			return uid
 		},
+		WorkspaceDirFor: func(userID string) string {
+			ws, err := activeWorkspaceFor(userID)
+			if err != nil {
+				return ""
+			}
+			return ws.Path
+		},
+		WorkspaceIDFor: func(userID string) string {
+			ws, err := activeWorkspaceFor(userID)
+			if err != nil {
+				return ""
+			}
+			return ws.ID
+		},
+		CheckWorkspace: func(userID, level string) error {
+			_, err := checkWorkspacePermission(userID, level)
+			return err
+		},
+		ShouldCompress: func(userID string, size int) bool {
+			ws, err := activeWorkspaceFor(userID)
+			return err == nil && shouldCompress(ws, size)
+		},
+		FoldNameCase: func(userID string) bool {
+			ws, err := activeWorkspaceFor(userID)
+			return err == nil && ws.Settings.FoldNameCase
+		},
+		PathAllowed: func(userID, relPath string, write bool) bool {
+			ws, err := activeWorkspaceFor(userID)
+			return err == nil && !inTrash(relPath) && pathAllowed(ws, userID, relPath, write)
+		},
+		IsAdmin: isAdmin,
+		Maintenance: func() map[string]interface{} {
+			return maintenanceStatus()
+		},
+		Subsystems: subsystems,
+		Commit: func(userID, message string) error {
+			ws, err := activeWorkspaceFor(userID)
+			if err != nil {
+				return err
+			}
+			return commitChangesWithAuthor(repoForWorkspace(ws), message, usernameFor(userID))
+		},
+		CreatedAt: func(root, relPath string) (time.Time, bool) {
+			ws := workspaceAtPath(root)
+			if ws == nil {
+				return time.Time{}, false
+			}
+			return fileCreatedAt(ws, relPath)
+		},
+		SearchFiles: func(root, query string) []apiPkg.IndexedFile {
+			return indexFor(root).Files(query)
+		},
+		FileChanged: func(root, relPath string) {
+			indexFor(root).Update(relPath)
+		},
+		History: func(root string, q gitops.HistoryQuery) (*gitops.CommitPage, error) {
+			repo, err := git.PlainOpen(root)
+			if err != nil {
+				return &gitops.CommitPage{Commits: []gitops.GitCommit{}}, nil
+			}
+			logs, err := repo.Log(&git.LogOptions{})
+			if err == plumbing.ErrReferenceNotFound {
+				return &gitops.CommitPage{Commits: []gitops.GitCommit{}}, nil // no commits yet
+			}
+			if err != nil {
+				return nil, err
+			}
+			return gitops.PageCommits(logs, q)
+		},
+		FileAt: func(root, relPath, hash string) ([]byte, bool) {
+			repo, err := git.PlainOpen(root)
+			if err != nil {
+				return nil, false
+			}
+			content, err := fileAtCommit(repo, hash, filepath.ToSlash(relPath))
+			return content, err == nil
+		},
 	}
 	apiPkg.RegisterRoutes(app, apiV1Cfg)
 
@@ -362,15 +672,26 @@ func main() {
 	})
 
 	// Git operations (local workspace)
-	gitRoutes := protected.Group("/git")
+	gitRoutes := protected.Group("/git", requireWorkspace)
 	gitRoutes.Get("/history", getGitHistory)
 	gitRoutes.Post("/revert", revertToCommit)
 	gitRoutes.Get("/diff", getGitDiff)
+	gitRoutes.Get("/diffstat", getGitDiffStat)
+	gitRoutes.Get("/file-status", getGitFileStatus)
+	gitRoutes.Get("/merge-base", getGitMergeBase)
+	gitRoutes.Get("/changelog", getGitChangelog)
+	gitRoutes.Get("/fsck", getGitFsck)
+	gitRoutes.Post("/fsck", fixGitFsck)
 	gitRoutes.Get("/file-at", getFileAtCommit)
 	gitRoutes.Get("/branches", getBranches)
 	gitRoutes.Post("/branches", createBranch)
+	gitRoutes.Delete("/branches/*", deleteBranch)
 	gitRoutes.Post("/checkout", checkoutBranch)
 	gitRoutes.Post("/merge", mergeBranch)
+	gitRoutes.Get("/remote-diff", getRemoteDiff)
+
+	// Workspace files at the URLs uploads return, e.g. for embedded images
+	app.Get(assetPathPrefix+"/*", assetAuthMiddleware, requireWorkspace, getRawFile)
 
 	// Serve static files (frontend)
 	app.Static("/", "../frontend/dist")
@@ -405,7 +726,6 @@ func initializeApp() error {
 	if err := initGitRepo(); err != nil {
 		log.Printf("Git initialization failed: %v", err)
 		log.Println("Continuing without git support...")
-		gitRepo = nil
 	}
 
 	return nil
@@ -416,10 +736,7 @@ func loadWorkspaceConfig() error {
 	if err != nil {
 		if os.IsNotExist(err) {
 			// Create empty config
-			config := WorkspaceConfig{
-				Workspaces: []Workspace{},
-			}
-			return saveWorkspaceConfig(&config)
+			return updateWorkspaceConfig(func(*WorkspaceConfig) error { return nil })
 		}
 		return err
 	}
@@ -441,7 +758,21 @@ func loadWorkspaceConfig() error {
 	return nil
 }
 
-func saveWorkspaceConfig(config *WorkspaceConfig) error {
+// updateWorkspaceConfig loads the workspace config, applies fn and saves the
+// result, holding workspaceConfigMu throughout so concurrent updates can't
+// overwrite each other. It is the only writer of the config file; every
+// change goes through it. Nothing is saved if fn returns an error.
+func updateWorkspaceConfig(fn func(config *WorkspaceConfig) error) error {
+	workspaceConfigMu.Lock()
+	defer workspaceConfigMu.Unlock()
+
+	config, err := loadWorkspaceConfigObject()
+	if err != nil {
+		return err
+	}
+	if err := fn(config); err != nil {
+		return err
+	}
 	data, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
 		return err
@@ -468,13 +799,14 @@ func createDefaultWorkspace() error {
 		Permissions: make(map[string]string),
 	}
 
-	config := WorkspaceConfig{
-		Workspaces:     []Workspace{workspace},
-		ActiveWorkspace: workspaceID,
-	}
-
 	currentWorkspace = &workspace
-	return saveWorkspaceConfig(&config)
+	return updateWorkspaceConfig(func(config *WorkspaceConfig) error {
+		*config = WorkspaceConfig{
+			Workspaces:      []Workspace{workspace},
+			ActiveWorkspace: workspaceID,
+		}
+		return nil
+	})
 }
 
 func generateID() string {
@@ -493,31 +825,86 @@ func authMiddleware(c *fiber.Ctx) error {
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 	
 	claims := &JWTClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, jwtKeys.keyFunc)
 
 	if err != nil || !token.Valid {
 		return c.Status(401).JSON(APIResponse{Error: "Invalid token"})
 	}
+	tokenKey := revocationKey(claims, tokenString)
+	if isTokenRevoked(tokenKey) {
+		return c.Status(401).JSON(APIResponse{Error: "Token has been revoked"})
+	}
 
 	// Store user info in context
 	c.Locals("userID", claims.UserID)
 	c.Locals("username", claims.Username)
+	c.Locals("tokenKey", tokenKey)
+	if claims.ExpiresAt != nil {
+		c.Locals("tokenExpiry", claims.ExpiresAt.Time)
+	}
 	
 	return c.Next()
 }
 
+// requireWorkspace rejects requests with 503 when the current workspace
+// directory has been removed or unmounted. The default workspace is
+// recreated instead; other workspaces require switching.
+func requireWorkspace(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+	ws, err := activeWorkspaceFor(userID)
+	if err != nil {
+		// Let the handler report the permission/config error
+		return c.Next()
+	}
+
+	if err := checkWorkspaceAvailable(ws.Path); err != nil {
+		return c.Status(503).JSON(APIResponse{
+			Error: "Workspace unavailable: switch to another workspace",
+			Data:  fiber.Map{"code": "workspace_unavailable", "path": ws.Path, "workspaceId": ws.ID},
+		})
+	}
+	return c.Next()
+}
+
+// checkWorkspaceAvailable stats a workspace directory, recreating it when
+// it is the default workspace.
+func checkWorkspaceAvailable(dir string) error {
+	info, err := os.Stat(dir)
+	if err == nil && info.IsDir() {
+		return nil
+	}
+
+	workspaceRecoverMu.Lock()
+	defer workspaceRecoverMu.Unlock()
+
+	// Another request may have recovered it already
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		return nil
+	}
+
+	if dir != defaultWorkspaceDir {
+		return fmt.Errorf("workspace directory %s is unavailable", dir)
+	}
+
+	log.Printf("Default workspace %s is missing, recreating it", dir)
+	forgetWorkspaceRepos(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to recreate workspace: %w", err)
+	}
+	if dir == workspaceDir {
+		if err := initGitRepo(); err != nil {
+			log.Printf("Git initialization failed: %v", err)
+		}
+	}
+	indexFor(dir).Invalidate()
+	return nil
+}
+
 // Authentication handlers
 func register(c *fiber.Ctx) error {
 	var req RegisterRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.JSON(APIResponse{Error: "Invalid request body"})
-	}
-
-	// Validate input
-	if req.Username == "" || req.Password == "" {
-		return c.JSON(APIResponse{Error: "Username and password required"})
+	if errs := validation.ParseBody(c, &req); errs != nil {
+		return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
 	}
 
 	// Load existing users
@@ -557,10 +944,10 @@ func register(c *fiber.Ctx) error {
 
 	// Update workspace owner if this is the first user
 	if currentWorkspace != nil && currentWorkspace.Owner == "system" {
-		config, err := loadWorkspaceConfigObject()
-		if err == nil {
+		err := updateWorkspaceConfig(func(config *WorkspaceConfig) error {
 			for i := range config.Workspaces {
-				if config.Workspaces[i].ID == currentWorkspace.ID {
+				// Another registration may have claimed it first
+				if config.Workspaces[i].ID == currentWorkspace.ID && config.Workspaces[i].Owner == "system" {
 					config.Workspaces[i].Owner = userID
 					// Initialize permissions map if nil
 					if config.Workspaces[i].Permissions == nil {
@@ -577,10 +964,13 @@ func register(c *fiber.Ctx) error {
 					}
 					// Update the currentWorkspace pointer with the corrected data
 					currentWorkspace = &config.Workspaces[i]
-					saveWorkspaceConfig(config)
 					break
 				}
 			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to assign the default workspace owner: %v", err)
 		}
 	}
 
@@ -589,17 +979,23 @@ func register(c *fiber.Ctx) error {
 	if err != nil {
 		return c.JSON(APIResponse{Error: "Failed to generate token"})
 	}
+	refresh, err := issueRefreshToken(userID)
+	if err != nil {
+		return c.JSON(APIResponse{Error: "Failed to generate token"})
+	}
+	setAssetCookie(c, token)
 
 	return c.JSON(APIResponse{Data: AuthResponse{
-		Token: token,
-		User:  SafeUser{ID: user.ID, Username: user.Username, CreatedAt: user.CreatedAt},
+		Token:        token,
+		RefreshToken: refresh,
+		User:         SafeUser{ID: user.ID, Username: user.Username, CreatedAt: user.CreatedAt},
 	}})
 }
 
 func login(c *fiber.Ctx) error {
 	var req LoginRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.JSON(APIResponse{Error: "Invalid request body"})
+	if errs := validation.ParseBody(c, &req); errs != nil {
+		return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
 	}
 
 	// Load users
@@ -632,10 +1028,22 @@ func login(c *fiber.Ctx) error {
 	if err != nil {
 		return c.JSON(APIResponse{Error: "Failed to generate token"})
 	}
+	refresh, err := issueRefreshToken(user.ID)
+	if err != nil {
+		return c.JSON(APIResponse{Error: "Failed to generate token"})
+	}
+
+	prefs, err := loadPreferences(user.ID)
+	if err != nil {
+		log.Printf("Failed to load preferences for %s: %v", user.ID, err)
+	}
+	setAssetCookie(c, token)
 
 	return c.JSON(APIResponse{Data: AuthResponse{
-		Token: token,
-		User:  SafeUser{ID: user.ID, Username: user.Username, CreatedAt: user.CreatedAt},
+		Token:        token,
+		RefreshToken: refresh,
+		User:         SafeUser{ID: user.ID, Username: user.Username, CreatedAt: user.CreatedAt},
+		Preferences:  prefs,
 	}})
 }
 
@@ -657,18 +1065,36 @@ func getCurrentUser(c *fiber.Ctx) error {
 	return c.JSON(APIResponse{Error: "User not found"})
 }
 
+// isAdmin reports whether userID's username is listed in ADMIN_USERS
+func isAdmin(userID string) bool {
+	return len(adminUsers) > 0 && adminUsers[usernameFor(userID)]
+}
+
+// usernameFor returns the username of userID, or "api" if it is unknown
+func usernameFor(userID string) string {
+	userStorage, err := loadUsers()
+	if err == nil {
+		for _, user := range userStorage.Users {
+			if user.ID == userID {
+				return user.Username
+			}
+		}
+	}
+	return "api"
+}
+
 func generateJWT(userID, username string) (string, error) {
 	claims := JWTClaims{
 		UserID:   userID,
 		Username: username,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ID:        generateID(), // jti, so logout can revoke this token
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(accessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return jwtKeys.sign(claims)
 }
 
 func loadUsers() (*UserStorage, error) {
@@ -716,9 +1142,14 @@ func getWorkspaces(c *fiber.Ctx) error {
 		}
 	}
 
+	active := config.ActiveWorkspace
+	if id, ok := config.UserActive[userID]; ok {
+		active = id
+	}
+
 	return c.JSON(APIResponse{Data: map[string]interface{}{
 		"workspaces": accessibleWorkspaces,
-		"active":     config.ActiveWorkspace,
+		"active":     active,
 	}})
 }
 
@@ -727,8 +1158,21 @@ func createWorkspace(c *fiber.Ctx) error {
 	username := c.Locals("username").(string)
 
 	var req CreateWorkspaceRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.JSON(APIResponse{Error: "Invalid request body"})
+	if errs := validation.ParseBody(c, &req); errs != nil {
+		return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
+	}
+
+	var tmpl *WorkspaceTemplate
+	if req.Template != "" {
+		templates, err := loadWorkspaceTemplates()
+		if err != nil {
+			return c.JSON(APIResponse{Error: err.Error()})
+		}
+		t, ok := templates[req.Template]
+		if !ok {
+			return c.Status(400).JSON(APIResponse{Error: fmt.Sprintf("Unknown workspace template %q", req.Template)})
+		}
+		tmpl = &t
 	}
 
 	// Create workspace directory
@@ -736,6 +1180,12 @@ func createWorkspace(c *fiber.Ctx) error {
 		return c.JSON(APIResponse{Error: "Failed to create workspace directory"})
 	}
 
+	if tmpl != nil {
+		if err := provisionWorkspace(req.Path, req.Name, *tmpl, username); err != nil {
+			return c.JSON(APIResponse{Error: "Failed to apply workspace template: " + err.Error()})
+		}
+	}
+
 	workspaceID := generateID()
 	workspace := Workspace{
 		ID:        workspaceID,
@@ -756,14 +1206,11 @@ func createWorkspace(c *fiber.Ctx) error {
 		},
 	}
 
-	config, err := loadWorkspaceConfigObject()
+	err := updateWorkspaceConfig(func(config *WorkspaceConfig) error {
+		config.Workspaces = append(config.Workspaces, workspace)
+		return nil
+	})
 	if err != nil {
-		return c.JSON(APIResponse{Error: "Failed to load workspace config"})
-	}
-
-	config.Workspaces = append(config.Workspaces, workspace)
-
-	if err := saveWorkspaceConfig(config); err != nil {
 		return c.JSON(APIResponse{Error: "Failed to save workspace config"})
 	}
 
@@ -774,48 +1221,126 @@ func switchWorkspace(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 
 	var req SwitchWorkspaceRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.JSON(APIResponse{Error: "Invalid request body"})
+	if errs := validation.ParseBody(c, &req); errs != nil {
+		return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
+	}
+
+	var targetWorkspace *Workspace
+	err := updateWorkspaceConfig(func(config *WorkspaceConfig) error {
+		// Find workspace and check access
+		for _, ws := range config.Workspaces {
+			if ws.ID == req.WorkspaceID {
+				if _, hasAccess := ws.Permissions[userID]; hasAccess || ws.Owner == userID {
+					targetWorkspace = &ws
+					break
+				} else {
+					return fiber.NewError(403, "Access denied to workspace")
+				}
+			}
+		}
+
+		if targetWorkspace == nil {
+			return fiber.NewError(404, "Workspace not found")
+		}
+
+		if info, err := os.Stat(targetWorkspace.Path); (err != nil || !info.IsDir()) && targetWorkspace.Path != defaultWorkspaceDir {
+			return fiber.NewError(503, "Workspace unavailable: directory is missing")
+		}
+
+		// Update this user's active workspace only
+		if config.UserActive == nil {
+			config.UserActive = make(map[string]string)
+		}
+		config.UserActive[userID] = req.WorkspaceID
+		return nil
+	})
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return c.Status(fe.Code).JSON(APIResponse{Error: fe.Message})
 	}
+	if err != nil {
+		return c.JSON(APIResponse{Error: "Failed to save workspace config"})
+	}
+
+	// Recreate the default workspace if needed
+	if targetWorkspace.Path == defaultWorkspaceDir {
+		if err := checkWorkspaceAvailable(targetWorkspace.Path); err != nil {
+			return c.JSON(APIResponse{Error: "Failed to create workspace directory"})
+		}
+	}
+
+	return c.JSON(APIResponse{Data: "Workspace switched successfully"})
+}
+
+// shouldCompress reports whether a document of the given size should be
+// stored gzip-compressed in ws.
+func shouldCompress(ws *Workspace, size int) bool {
+	if ws == nil || !ws.Settings.CompressDocuments {
+		return false
+	}
+	minBytes := ws.Settings.CompressMinBytes
+	if minBytes <= 0 {
+		minBytes = storage.DefaultCompressMinBytes
+	}
+	return int64(size) >= minBytes
+}
+
+func getWorkspaceSettings(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	workspaceID := c.Params("id")
 
 	config, err := loadWorkspaceConfigObject()
 	if err != nil {
 		return c.JSON(APIResponse{Error: "Failed to load workspace config"})
 	}
 
-	// Find workspace and check access
-	var targetWorkspace *Workspace
 	for _, ws := range config.Workspaces {
-		if ws.ID == req.WorkspaceID {
-			if _, hasAccess := ws.Permissions[userID]; hasAccess || ws.Owner == userID {
-				targetWorkspace = &ws
-				break
-			} else {
-				return c.JSON(APIResponse{Error: "Access denied to workspace"})
+		if ws.ID == workspaceID {
+			if _, hasAccess := ws.Permissions[userID]; !hasAccess && ws.Owner != userID {
+				return c.JSON(APIResponse{Error: "Access denied"})
 			}
+			return c.JSON(APIResponse{Data: ws.Settings})
 		}
 	}
 
-	if targetWorkspace == nil {
-		return c.JSON(APIResponse{Error: "Workspace not found"})
-	}
+	return c.JSON(APIResponse{Error: "Workspace not found"})
+}
 
-	// Update active workspace
-	config.ActiveWorkspace = req.WorkspaceID
-	currentWorkspace = targetWorkspace
-	workspaceDir = targetWorkspace.Path
+func updateWorkspaceSettings(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	workspaceID := c.Params("id")
+
+	var req WorkspaceSettings
+	if errs := validation.ParseBody(c, &req); errs != nil {
+		return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
+	}
 
-	if err := saveWorkspaceConfig(config); err != nil {
+	err := updateWorkspaceConfig(func(config *WorkspaceConfig) error {
+		for i, ws := range config.Workspaces {
+			if ws.ID != workspaceID {
+				continue
+			}
+			if ws.Owner != userID {
+				return fiber.NewError(403, "Only workspace owner can change settings")
+			}
+			config.Workspaces[i].Settings = req
+			return nil
+		}
+		return fiber.NewError(404, "Workspace not found")
+	})
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return c.Status(fe.Code).JSON(APIResponse{Error: fe.Message})
+	}
+	if err != nil {
 		return c.JSON(APIResponse{Error: "Failed to save workspace config"})
 	}
 
-	// Initialize Git for new workspace
-	if err := initGitRepo(); err != nil {
-		log.Printf("Git initialization failed: %v", err)
-		gitRepo = nil
+	if currentWorkspace != nil && currentWorkspace.ID == workspaceID {
+		currentWorkspace.Settings = req
 	}
 
-	return c.JSON(APIResponse{Data: "Workspace switched successfully"})
+	return c.JSON(APIResponse{Data: req})
 }
 
 func loadWorkspaceConfigObject() (*WorkspaceConfig, error) {
@@ -860,13 +1385,8 @@ func addWorkspaceMember(c *fiber.Ctx) error {
 	workspaceID := c.Params("id")
 
 	var req InviteUserRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.JSON(APIResponse{Error: "Invalid request body"})
-	}
-
-	// Validate permission level
-	if req.Permission != "editor" && req.Permission != "viewer" {
-		return c.JSON(APIResponse{Error: "Invalid permission level"})
+	if errs := validation.ParseBody(c, &req); errs != nil {
+		return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
 	}
 
 	// Find the user to invite
@@ -886,30 +1406,39 @@ func addWorkspaceMember(c *fiber.Ctx) error {
 	if invitedUser == nil {
 		return c.JSON(APIResponse{Error: "User not found"})
 	}
-
-	config, err := loadWorkspaceConfigObject()
-	if err != nil {
-		return c.JSON(APIResponse{Error: "Failed to load workspace config"})
+	if invitedUser.ID == userID {
+		return c.Status(400).JSON(APIResponse{Error: "You can't invite yourself"})
 	}
 
-	for i, ws := range config.Workspaces {
-		if ws.ID == workspaceID {
+	var newMember WorkspaceMember
+	err = updateWorkspaceConfig(func(config *WorkspaceConfig) error {
+		for i, ws := range config.Workspaces {
+			if ws.ID != workspaceID {
+				continue
+			}
 			// Check if current user is owner or has edit permissions
 			if ws.Owner != userID {
 				if permission, hasAccess := ws.Permissions[userID]; !hasAccess || permission == "viewer" {
-					return c.JSON(APIResponse{Error: "Insufficient permissions"})
+					return fiber.NewError(403, "Insufficient permissions")
 				}
 			}
 
+			if invitedUser.ID == ws.Owner {
+				return fiber.NewError(400, "User owns this workspace and can't be added as a member")
+			}
+
 			// Check if user is already a member
+			if _, ok := ws.Permissions[invitedUser.ID]; ok {
+				return fiber.NewError(409, "User is already a member")
+			}
 			for _, member := range ws.Members {
 				if member.UserID == invitedUser.ID {
-					return c.JSON(APIResponse{Error: "User is already a member"})
+					return fiber.NewError(409, "User is already a member")
 				}
 			}
 
 			// Add member
-			newMember := WorkspaceMember{
+			newMember = WorkspaceMember{
 				UserID:     invitedUser.ID,
 				Username:   invitedUser.Username,
 				Permission: req.Permission,
@@ -917,39 +1446,97 @@ func addWorkspaceMember(c *fiber.Ctx) error {
 			}
 
 			config.Workspaces[i].Members = append(config.Workspaces[i].Members, newMember)
-			config.Workspaces[i].Permissions[invitedUser.ID] = req.Permission
-
-			if err := saveWorkspaceConfig(config); err != nil {
-				return c.JSON(APIResponse{Error: "Failed to save workspace config"})
+			if config.Workspaces[i].Permissions == nil {
+				config.Workspaces[i].Permissions = map[string]string{}
 			}
-
-			return c.JSON(APIResponse{Data: newMember})
+			config.Workspaces[i].Permissions[invitedUser.ID] = req.Permission
+			return nil
 		}
+		return fiber.NewError(404, "Workspace not found")
+	})
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return c.Status(fe.Code).JSON(APIResponse{Error: fe.Message})
+	}
+	if err != nil {
+		return c.JSON(APIResponse{Error: "Failed to save workspace config"})
 	}
 
-	return c.JSON(APIResponse{Error: "Workspace not found"})
+	return c.JSON(APIResponse{Data: newMember})
 }
 
-func removeWorkspaceMember(c *fiber.Ctx) error {
+// updateWorkspaceMember changes a member's permission level. Only the owner
+// may, and the owner's own access can't be changed.
+func updateWorkspaceMember(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	workspaceID := c.Params("id")
 	memberUserID := c.Params("userId")
 
-	config, err := loadWorkspaceConfigObject()
+	var req UpdateMemberRequest
+	if errs := validation.ParseBody(c, &req); errs != nil {
+		return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
+	}
+
+	var updated WorkspaceMember
+	err := updateWorkspaceConfig(func(config *WorkspaceConfig) error {
+		for i, ws := range config.Workspaces {
+			if ws.ID != workspaceID {
+				continue
+			}
+			if ws.Owner != userID {
+				return fiber.NewError(403, "Only workspace owner can change member permissions")
+			}
+			if memberUserID == ws.Owner {
+				return fiber.NewError(400, "Cannot change the workspace owner's permission")
+			}
+
+			member := -1
+			for j, m := range ws.Members {
+				if m.UserID == memberUserID {
+					member = j
+					break
+				}
+			}
+			if _, ok := ws.Permissions[memberUserID]; !ok || member < 0 {
+				return fiber.NewError(404, "Member not found")
+			}
+
+			config.Workspaces[i].Members[member].Permission = req.Permission
+			config.Workspaces[i].Permissions[memberUserID] = req.Permission
+			updated = config.Workspaces[i].Members[member]
+			return nil
+		}
+		return fiber.NewError(404, "Workspace not found")
+	})
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return c.Status(fe.Code).JSON(APIResponse{Error: fe.Message})
+	}
 	if err != nil {
-		return c.JSON(APIResponse{Error: "Failed to load workspace config"})
+		return c.JSON(APIResponse{Error: "Failed to save workspace config"})
 	}
 
-	for i, ws := range config.Workspaces {
-		if ws.ID == workspaceID {
+	return c.JSON(APIResponse{Data: updated})
+}
+
+func removeWorkspaceMember(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	workspaceID := c.Params("id")
+	memberUserID := c.Params("userId")
+
+	err := updateWorkspaceConfig(func(config *WorkspaceConfig) error {
+		for i, ws := range config.Workspaces {
+			if ws.ID != workspaceID {
+				continue
+			}
 			// Only owner can remove members
 			if ws.Owner != userID {
-				return c.JSON(APIResponse{Error: "Only workspace owner can remove members"})
+				return fiber.NewError(403, "Only workspace owner can remove members")
 			}
 
 			// Cannot remove owner
 			if memberUserID == ws.Owner {
-				return c.JSON(APIResponse{Error: "Cannot remove workspace owner"})
+				return fiber.NewError(400, "Cannot remove workspace owner")
 			}
 
 			// Remove member
@@ -962,16 +1549,19 @@ func removeWorkspaceMember(c *fiber.Ctx) error {
 
 			config.Workspaces[i].Members = newMembers
 			delete(config.Workspaces[i].Permissions, memberUserID)
-
-			if err := saveWorkspaceConfig(config); err != nil {
-				return c.JSON(APIResponse{Error: "Failed to save workspace config"})
-			}
-
-			return c.JSON(APIResponse{Data: "Member removed successfully"})
+			return nil
 		}
+		return fiber.NewError(404, "Workspace not found")
+	})
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return c.Status(fe.Code).JSON(APIResponse{Error: fe.Message})
+	}
+	if err != nil {
+		return c.JSON(APIResponse{Error: "Failed to save workspace config"})
 	}
 
-	return c.JSON(APIResponse{Error: "Workspace not found"})
+	return c.JSON(APIResponse{Data: "Member removed successfully"})
 }
 
 // Git repository initialization
@@ -1015,22 +1605,29 @@ func initGitRepo() error {
 		}
 	}
 
-	gitRepo = repo
 	return nil
 }
 
 // Git branch operations
 func getBranches(c *fiber.Ctx) error {
-	if gitRepo == nil {
+	userID := c.Locals("userID").(string)
+
+	ws, err := checkWorkspacePermission(userID, "viewer")
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	repo := repoForWorkspace(ws)
+	if repo == nil {
 		return c.JSON(APIResponse{Data: []GitBranch{}})
 	}
 
-	refs, err := gitRepo.References()
+	refs, err := repo.References()
 	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
-	head, err := gitRepo.Head()
+	head, err := repo.Head()
 	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
@@ -1058,7 +1655,15 @@ func getBranches(c *fiber.Ctx) error {
 }
 
 func createBranch(c *fiber.Ctx) error {
-	if gitRepo == nil {
+	userID := c.Locals("userID").(string)
+
+	ws, err := checkWorkspacePermission(userID, "editor")
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	repo := repoForWorkspace(ws)
+	if repo == nil {
 		return c.JSON(APIResponse{Error: "Git repository not available"})
 	}
 
@@ -1067,7 +1672,7 @@ func createBranch(c *fiber.Ctx) error {
 		return c.JSON(APIResponse{Error: "Invalid request body"})
 	}
 
-	head, err := gitRepo.Head()
+	head, err := repo.Head()
 	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
@@ -1075,16 +1680,30 @@ func createBranch(c *fiber.Ctx) error {
 	branchRef := plumbing.NewBranchReferenceName(req.Name)
 	ref := plumbing.NewHashReference(branchRef, head.Hash())
 
-	err = gitRepo.Storer.SetReference(ref)
+	err = repo.Storer.SetReference(ref)
 	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
+	fireWorkspaceEvent(c, ws, eventBranchCreated, map[string]interface{}{"branch": req.Name, "hash": head.Hash().String()})
 
 	return c.JSON(APIResponse{Data: fmt.Sprintf("Branch %s created successfully", req.Name)})
 }
 
 func checkoutBranch(c *fiber.Ctx) error {
-	if gitRepo == nil {
+	userID := c.Locals("userID").(string)
+
+	ws, err := checkWorkspacePermission(userID, "editor")
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	// Checking out a branch replaces ACL-restricted files as well
+	if !subtreeWritable(ws, userID, "") {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+	}
+
+	repo := repoForWorkspace(ws)
+	if repo == nil {
 		return c.JSON(APIResponse{Error: "Git repository not available"})
 	}
 
@@ -1093,7 +1712,7 @@ func checkoutBranch(c *fiber.Ctx) error {
 		return c.JSON(APIResponse{Error: "Invalid request body"})
 	}
 
-	worktree, err := gitRepo.Worktree()
+	worktree, err := repo.Worktree()
 	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
@@ -1104,12 +1723,26 @@ func checkoutBranch(c *fiber.Ctx) error {
 	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
+	indexFor(ws.Path).Invalidate()
 
 	return c.JSON(APIResponse{Data: fmt.Sprintf("Switched to branch %s", req.Name)})
 }
 
 func mergeBranch(c *fiber.Ctx) error {
-	if gitRepo == nil {
+	userID := c.Locals("userID").(string)
+
+	ws, err := checkWorkspacePermission(userID, "editor")
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	// A merge can bring in changes to ACL-restricted files
+	if !subtreeWritable(ws, userID, "") {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+	}
+
+	repo := repoForWorkspace(ws)
+	if repo == nil {
 		return c.JSON(APIResponse{Error: "Git repository not available"})
 	}
 
@@ -1119,37 +1752,37 @@ func mergeBranch(c *fiber.Ctx) error {
 	}
 
 	// This is a simplified merge - in production you'd want proper merge handling
-	worktree, err := gitRepo.Worktree()
+	worktree, err := repo.Worktree()
 	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
 	// Get the branch reference
-	branchRef, err := gitRepo.Reference(plumbing.NewBranchReferenceName(req.Branch), true)
+	branchRef, err := repo.Reference(plumbing.NewBranchReferenceName(req.Branch), true)
 	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
 	// Get the commit object
-	commit, err := gitRepo.CommitObject(branchRef.Hash())
+	commit, err := repo.CommitObject(branchRef.Hash())
 	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
 	// Simple strategy: create a merge commit
 	// In a real implementation, you'd check for conflicts, etc.
-	head, err := gitRepo.Head()
+	head, err := repo.Head()
 	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
-	headCommit, err := gitRepo.CommitObject(head.Hash())
+	headCommit, err := repo.CommitObject(head.Hash())
 	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
 	// Create merge commit
-	_, err = worktree.Commit(fmt.Sprintf("Merge branch '%s'", req.Branch), &git.CommitOptions{
+	mergeHash, err := worktree.Commit(fmt.Sprintf("Merge branch '%s'", req.Branch), &git.CommitOptions{
 		Author: &object.Signature{
 			Name:  "MD Office",
 			Email: "mdoffice@example.com",
@@ -1160,58 +1793,142 @@ func mergeBranch(c *fiber.Ctx) error {
 	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
+	indexFor(ws.Path).Invalidate()
+	fireWorkspaceEvent(c, ws, eventGitMerged, map[string]interface{}{
+		"branch": req.Branch,
+		"hash":   mergeHash.String(),
+		"into":   head.Name().Short(),
+	})
 
 	return c.JSON(APIResponse{Data: fmt.Sprintf("Branch %s merged successfully", req.Branch)})
 }
 
-// File operations (updated with permission checks)
-func checkWorkspacePermission(userID string, requiredLevel string) error {
-	if currentWorkspace == nil {
-		return fmt.Errorf("no active workspace")
+// deleteBranch removes a local branch. The name is the rest of the path, so
+// names like feature/x work. The checked-out branch can't be deleted; check
+// out another one first.
+func deleteBranch(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	ws, err := checkWorkspacePermission(userID, "editor")
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	repo := repoForWorkspace(ws)
+	if repo == nil {
+		return c.JSON(APIResponse{Error: "Git repository not available"})
+	}
+
+	name, err := url.PathUnescape(c.Params("*"))
+	if err != nil || name == "" {
+		return c.Status(400).JSON(APIResponse{Error: "Invalid branch name"})
+	}
+	branchRef := plumbing.NewBranchReferenceName(name)
+	if _, err := repo.Reference(branchRef, false); err != nil {
+		return c.Status(404).JSON(APIResponse{Error: fmt.Sprintf("Branch %s not found", name)})
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+	if head.Name() == branchRef {
+		return c.Status(409).JSON(APIResponse{Error: fmt.Sprintf("Cannot delete %s: it is the current branch", name)})
+	}
+
+	if err := repo.Storer.RemoveReference(branchRef); err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
-	// Refresh workspace info to ensure we have the latest permissions
+	return c.JSON(APIResponse{Data: fmt.Sprintf("Branch %s deleted successfully", name)})
+}
+
+// workspaceAtPath returns the workspace whose directory is dir, or nil
+func workspaceAtPath(dir string) *Workspace {
 	config, err := loadWorkspaceConfigObject()
-	if err == nil {
-		for i := range config.Workspaces {
-			if config.Workspaces[i].ID == currentWorkspace.ID {
-				currentWorkspace = &config.Workspaces[i]
-				break
-			}
+	if err != nil {
+		return nil
+	}
+	for i := range config.Workspaces {
+		if config.Workspaces[i].Path == dir {
+			return &config.Workspaces[i]
+		}
+	}
+	return nil
+}
+
+// File operations (updated with permission checks)
+// activeWorkspaceFor returns the workspace userID is working in: their own
+// selection if they have one, otherwise the server's default workspace.
+func activeWorkspaceFor(userID string) (*Workspace, error) {
+	config, err := loadWorkspaceConfigObject()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load workspace config")
+	}
+
+	activeID := config.ActiveWorkspace
+	if id, ok := config.UserActive[userID]; ok {
+		activeID = id
+	}
+
+	for i := range config.Workspaces {
+		if config.Workspaces[i].ID == activeID {
+			return &config.Workspaces[i], nil
+		}
+	}
+
+	// The selected workspace was removed; fall back to the default
+	for i := range config.Workspaces {
+		if config.Workspaces[i].ID == config.ActiveWorkspace {
+			return &config.Workspaces[i], nil
 		}
 	}
 
+	return nil, fmt.Errorf("no active workspace")
+}
+
+// checkWorkspacePermission resolves userID's active workspace and verifies
+// they hold at least requiredLevel in it.
+func checkWorkspacePermission(userID string, requiredLevel string) (*Workspace, error) {
+	ws, err := activeWorkspaceFor(userID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Owner has all permissions
-	if currentWorkspace.Owner == userID {
-		return nil
+	if ws.Owner == userID {
+		return ws, nil
 	}
 
-	permission, hasAccess := currentWorkspace.Permissions[userID]
+	permission, hasAccess := ws.Permissions[userID]
 	if !hasAccess {
-		return fmt.Errorf("no access to workspace")
+		return nil, fmt.Errorf("no access to workspace")
 	}
 
 	// Permission levels: owner > editor > viewer
 	switch requiredLevel {
 	case "viewer":
 		// Anyone with access can view
-		return nil
+		return ws, nil
 	case "editor":
 		// Need editor or owner permission
 		if permission == "editor" || permission == "owner" {
-			return nil
+			return ws, nil
 		}
 	case "owner":
 		// Need owner permission
 		if permission == "owner" {
-			return nil
+			return ws, nil
 		}
 	}
 
-	return fmt.Errorf("insufficient permissions")
+	return nil, fmt.Errorf("insufficient permissions")
 }
 
-func buildFileTree(dir string, basePath string) ([]FileSystemItem, error) {
+// buildFileTree lists dir recursively down to depth levels. Deeper
+// directories are returned collapsed with Truncated set. When readable is
+// set, the paths it rejects are left out.
+func buildFileTree(dir string, basePath string, ignored *ignore.Matcher, readable func(string) bool, depth int) ([]FileSystemItem, error) {
 	files, err := ioutil.ReadDir(dir)
 	if err != nil {
 		return nil, err
@@ -1219,8 +1936,8 @@ func buildFileTree(dir string, basePath string) ([]FileSystemItem, error) {
 
 	var items []FileSystemItem
 	for _, file := range files {
-		// Skip .git directory
-		if file.Name() == ".git" {
+		// Skip .git, the API archive folder and the trash
+		if file.Name() == ".git" || (basePath == "" && (file.Name() == apiPkg.ArchiveDir || file.Name() == apiPkg.TrashDir)) {
 			continue
 		}
 
@@ -1229,14 +1946,38 @@ func buildFileTree(dir string, basePath string) ([]FileSystemItem, error) {
 			relativePath = filepath.Join(basePath, file.Name())
 		}
 
+		if ignored.Match(relativePath, file.IsDir()) {
+			continue
+		}
+		if readable != nil && !readable(relativePath) {
+			continue
+		}
+
 		item := FileSystemItem{
 			Name:        file.Name(),
 			Path:        relativePath,
 			IsDirectory: file.IsDir(),
 		}
 
-		if file.IsDir() {
-			children, err := buildFileTree(filepath.Join(dir, file.Name()), relativePath)
+		// ReadDir lstats entries, so links are only ever described here and
+		// never descended into (no duplicates, no cycles)
+		if file.Mode()&os.ModeSymlink != 0 {
+			// dir is always the workspace root joined with basePath
+			root := filepath.Clean(strings.TrimSuffix(dir, basePath))
+			link := storage.InspectLink(root, filepath.Join(dir, file.Name()))
+			if !link.Inside {
+				continue
+			}
+			item.Symlink = true
+			item.IsDirectory = link.IsDir
+			items = append(items, item)
+			continue
+		}
+
+		if file.IsDir() && depth <= 1 {
+			item.Truncated = true
+		} else if file.IsDir() {
+			children, err := buildFileTree(filepath.Join(dir, file.Name()), relativePath, ignored, readable, depth-1)
 			if err != nil {
 				continue // Skip directories we can't read
 			}
@@ -1252,11 +1993,17 @@ func buildFileTree(dir string, basePath string) ([]FileSystemItem, error) {
 func getFiles(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	
-	if err := checkWorkspacePermission(userID, "viewer"); err != nil {
+	ws, err := checkWorkspacePermission(userID, "viewer")
+	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
-	files, err := buildFileTree(workspaceDir, "")
+	depth := fileTreeMaxDepth
+	if d := c.QueryInt("depth"); d > 0 && d < depth {
+		depth = d
+	}
+
+	files, err := buildFileTree(ws.Path, "", ignore.ForRequest(c, ws.Path), readableBy(ws, userID), depth)
 	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
@@ -1266,7 +2013,8 @@ func getFiles(c *fiber.Ctx) error {
 func getFile(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	
-	if err := checkWorkspacePermission(userID, "viewer"); err != nil {
+	ws, err := checkWorkspacePermission(userID, "viewer")
+	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
@@ -1275,49 +2023,121 @@ func getFile(c *fiber.Ctx) error {
 		return c.JSON(APIResponse{Error: "Path is required"})
 	}
 
-	fullPath := filepath.Join(workspaceDir, path)
-
 	// Security check: ensure path is within workspace
-	if !strings.HasPrefix(fullPath, workspaceDir) {
-		return c.JSON(APIResponse{Error: "Access denied"})
+	fullPath, err := resolveWithinWorkspace(ws, path)
+	if err != nil || !pathAllowed(ws, userID, path, false) {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
 	}
 
-	content, err := ioutil.ReadFile(fullPath)
+	stat, err := os.Stat(fullPath)
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+	size, err := storage.Size(fullPath)
 	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
-	stat, err := os.Stat(fullPath)
+	// Large files are only previewed on request (?preview=true)
+	truncated := size > fileContentMaxBytes
+	if truncated && !c.QueryBool("preview") {
+		return c.Status(413).JSON(APIResponse{
+			Error: fmt.Sprintf("File is %d bytes, over the %d byte limit; download it or pass preview=true", size, fileContentMaxBytes),
+			Data:  fiber.Map{"size": size, "url": uploadURL(path)},
+		})
+	}
+
+	content, err := readFileHead(fullPath, fileContentMaxBytes)
 	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
+	if truncated {
+		content = trimPartialRune(content)
+	}
+	if !utf8.Valid(content) {
+		return c.Status(415).JSON(APIResponse{
+			Error: "File is binary; download it instead",
+			Data:  fiber.Map{"size": size, "url": uploadURL(path)},
+		})
+	}
 
 	fileContent := FileContent{
 		Path:         path,
 		Content:      string(content),
 		LastModified: stat.ModTime().Format(time.RFC3339),
 	}
+	if truncated {
+		fileContent.Size = size
+		fileContent.Truncated = true
+	} else {
+		fileContent.Hash = contentHash(content)
+	}
 
 	return c.JSON(APIResponse{Data: fileContent})
 }
 
+// readFileHead returns at most limit bytes from the start of a stored file.
+// Compressed documents are decompressed whole, as they are by ReadFile.
+func readFileHead(fullPath string, limit int64) ([]byte, error) {
+	if storage.Compressible(fullPath) {
+		content, err := storage.ReadFile(fullPath)
+		if err == nil && int64(len(content)) > limit {
+			content = content[:limit]
+		}
+		return content, err
+	}
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(io.LimitReader(f, limit))
+}
+
+// trimPartialRune drops a UTF-8 sequence cut off at the end of b.
+func trimPartialRune(b []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(b); i++ {
+		if r := b[len(b)-i]; utf8.RuneStart(r) {
+			if !utf8.FullRune(b[len(b)-i:]) {
+				return b[:len(b)-i]
+			}
+			break
+		}
+	}
+	return b
+}
+
 func saveFile(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	
-	if err := checkWorkspacePermission(userID, "editor"); err != nil {
+	ws, err := checkWorkspacePermission(userID, "editor")
+	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
 	var req SaveFileRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.JSON(APIResponse{Error: "Invalid request body"})
+	if errs := validation.ParseBody(c, &req); errs != nil {
+		return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
 	}
 
-	fullPath := filepath.Join(workspaceDir, req.Path)
-
 	// Security check
-	if !strings.HasPrefix(fullPath, workspaceDir) {
-		return c.JSON(APIResponse{Error: "Access denied"})
+	fullPath, err := resolveWithinWorkspace(ws, req.Path)
+	if err != nil || !pathAllowed(ws, userID, req.Path, true) {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+	}
+
+	unlock := storage.LockPath(fullPath)
+	defer unlock()
+
+	// Refuse to overwrite changes made since the edit started
+	if req.BaseHash != "" {
+		conflict, err := saveConflict(fullPath, req.BaseHash, req.Content)
+		if err != nil {
+			return c.JSON(APIResponse{Error: err.Error()})
+		}
+		if conflict != nil {
+			return c.Status(409).JSON(APIResponse{Error: "File has changed since it was loaded", Data: conflict})
+		}
 	}
 
 	// Create directory if it doesn't exist
@@ -1327,37 +2147,48 @@ func saveFile(c *fiber.Ctx) error {
 	}
 
 	// Write file
-	if err := ioutil.WriteFile(fullPath, []byte(req.Content), 0644); err != nil {
+	if err := storage.WriteFile(fullPath, []byte(req.Content), shouldCompress(ws, len(req.Content)), 0644); err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
+	unlock()
+
+	indexFor(ws.Path).Update(req.Path)
+	fireWorkspaceEvent(c, ws, eventFileSaved, map[string]interface{}{"path": req.Path, "size": len(req.Content)})
 
 	// Git commit
 	username := c.Locals("username").(string)
-	if err := commitChangesWithAuthor(fmt.Sprintf("Update %s", req.Path), username); err != nil {
+	if err := commitAndNotify(c, ws, fmt.Sprintf("Update %s", req.Path), username); err != nil {
 		log.Printf("Failed to commit changes: %v", err)
 		// Don't fail the request if git commit fails
 	}
 
-	return c.JSON(APIResponse{Data: "File saved successfully"})
+	return c.JSON(APIResponse{Data: fiber.Map{"path": req.Path, "hash": contentHash([]byte(req.Content))}})
 }
 
 func createFile(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	
-	if err := checkWorkspacePermission(userID, "editor"); err != nil {
+	ws, err := checkWorkspacePermission(userID, "editor")
+	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
 	var req CreateFileRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.JSON(APIResponse{Error: "Invalid request body"})
+	if errs := validation.ParseBody(c, &req); errs != nil {
+		return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
+	}
+	if req.Path = storage.NormalizePath(req.Path); req.Path == "" {
+		return c.Status(400).JSON(APIResponse{Error: "Path is required"})
 	}
-
-	fullPath := filepath.Join(workspaceDir, req.Path)
 
 	// Security check
-	if !strings.HasPrefix(fullPath, workspaceDir) {
-		return c.JSON(APIResponse{Error: "Access denied"})
+	fullPath, err := resolveWithinWorkspace(ws, req.Path)
+	if err != nil || !pathAllowed(ws, userID, req.Path, true) {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+	}
+
+	if err := nameCollision(ws, req.Path); err != nil {
+		return collisionResponse(c, err)
 	}
 
 	// Check if file already exists
@@ -1372,13 +2203,16 @@ func createFile(c *fiber.Ctx) error {
 	}
 
 	// Create file
-	if err := ioutil.WriteFile(fullPath, []byte(req.Content), 0644); err != nil {
+	if err := storage.WriteFile(fullPath, []byte(req.Content), shouldCompress(ws, len(req.Content)), 0644); err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
+	indexFor(ws.Path).Update(req.Path)
+	fireWorkspaceEvent(c, ws, eventFileCreated, map[string]interface{}{"path": req.Path, "size": len(req.Content)})
+
 	// Git commit
 	username := c.Locals("username").(string)
-	if err := commitChangesWithAuthor(fmt.Sprintf("Create %s", req.Path), username); err != nil {
+	if err := commitAndNotify(c, ws, fmt.Sprintf("Create %s", req.Path), username); err != nil {
 		log.Printf("Failed to commit changes: %v", err)
 	}
 
@@ -1388,20 +2222,27 @@ func createFile(c *fiber.Ctx) error {
 func createDirectory(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	
-	if err := checkWorkspacePermission(userID, "editor"); err != nil {
+	ws, err := checkWorkspacePermission(userID, "editor")
+	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
 	var req CreateDirRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.JSON(APIResponse{Error: "Invalid request body"})
+	if errs := validation.ParseBody(c, &req); errs != nil {
+		return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
+	}
+	if req.Path = storage.NormalizePath(req.Path); req.Path == "" {
+		return c.Status(400).JSON(APIResponse{Error: "Path is required"})
 	}
-
-	fullPath := filepath.Join(workspaceDir, req.Path)
 
 	// Security check
-	if !strings.HasPrefix(fullPath, workspaceDir) {
-		return c.JSON(APIResponse{Error: "Access denied"})
+	fullPath, err := resolveWithinWorkspace(ws, req.Path)
+	if err != nil || !pathAllowed(ws, userID, req.Path, true) {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+	}
+
+	if err := nameCollision(ws, req.Path); err != nil {
+		return collisionResponse(c, err)
 	}
 
 	if err := os.MkdirAll(fullPath, 0755); err != nil {
@@ -1414,29 +2255,66 @@ func createDirectory(c *fiber.Ctx) error {
 func deleteItem(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	
-	if err := checkWorkspacePermission(userID, "editor"); err != nil {
+	ws, err := checkWorkspacePermission(userID, "editor")
+	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
-	path := c.Params("path")
-	if path == "" {
+	// The client encodes the whole path into one segment (assets%2Fa.png)
+	path, err := url.PathUnescape(c.Params("path"))
+	if err != nil || path == "" {
 		return c.JSON(APIResponse{Error: "Path is required"})
 	}
 
-	fullPath := filepath.Join(workspaceDir, path)
+	if inTrash(path) {
+		return c.Status(400).JSON(APIResponse{Error: "Use /api/files/trash to manage deleted items"})
+	}
 
 	// Security check
-	if !strings.HasPrefix(fullPath, workspaceDir) {
-		return c.JSON(APIResponse{Error: "Access denied"})
+	fullPath, err := resolveWithinWorkspace(ws, path)
+	if err != nil || !subtreeWritable(ws, userID, path) {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+	}
+
+	// Deletes go to the trash unless ?permanent=true, which skips the undo
+	// step and so is kept to the owner and admins. Editors purge from the
+	// trash instead.
+	permanent := c.QueryBool("permanent")
+	if permanent && ws.Owner != userID && !isAdmin(userID) {
+		return c.Status(403).JSON(APIResponse{Error: "Only the workspace owner can delete permanently"})
+	}
+
+	// Deduplicated uploads are shared; keep them while documents link to them
+	dedupedAsset := isDedupedAsset(ws.ID, path)
+	if dedupedAsset && !c.QueryBool("force") {
+		if refs := assetReferences(ws, path); len(refs) > 0 {
+			return c.Status(409).JSON(APIResponse{
+				Error: "Asset is still referenced by other documents",
+				Data:  fiber.Map{"references": refs},
+			})
+		}
 	}
 
-	if err := os.RemoveAll(fullPath); err != nil {
+	username := c.Locals("username").(string)
+	if permanent {
+		err = os.RemoveAll(fullPath)
+	} else {
+		_, err = moveToTrash(ws, path, fullPath, username)
+	}
+	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
+	indexFor(ws.Path).Remove(path)
+	if dedupedAsset {
+		if err := forgetDedupedAsset(ws.ID, path); err != nil {
+			log.Printf("Failed to update deduplicated assets: %v", err)
+		}
+	}
+
+	fireWorkspaceEvent(c, ws, eventFileDeleted, map[string]interface{}{"path": path})
 
 	// Git commit
-	username := c.Locals("username").(string)
-	if err := commitChangesWithAuthor(fmt.Sprintf("Delete %s", path), username); err != nil {
+	if err := commitAndNotify(c, ws, fmt.Sprintf("Delete %s", path), username); err != nil {
 		log.Printf("Failed to commit changes: %v", err)
 	}
 
@@ -1446,122 +2324,187 @@ func deleteItem(c *fiber.Ctx) error {
 func renameItem(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	
-	if err := checkWorkspacePermission(userID, "editor"); err != nil {
+	ws, err := checkWorkspacePermission(userID, "editor")
+	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
 	var req RenameRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.JSON(APIResponse{Error: "Invalid request body"})
+	if errs := validation.ParseBody(c, &req); errs != nil {
+		return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
+	}
+	if req.NewPath = storage.NormalizePath(req.NewPath); req.NewPath == "" {
+		return c.Status(400).JSON(APIResponse{Error: "New path is required"})
 	}
-
-	oldPath := filepath.Join(workspaceDir, req.OldPath)
-	newPath := filepath.Join(workspaceDir, req.NewPath)
 
 	// Security checks
-	if !strings.HasPrefix(oldPath, workspaceDir) || !strings.HasPrefix(newPath, workspaceDir) {
-		return c.JSON(APIResponse{Error: "Access denied"})
+	oldPath, err := resolveWithinWorkspace(ws, req.OldPath)
+	if err != nil || !subtreeWritable(ws, userID, req.OldPath) {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+	}
+	newPath, err := resolveWithinWorkspace(ws, req.NewPath)
+	if err != nil || !subtreeWritable(ws, userID, req.NewPath) {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+	}
+
+	// Renaming a file to another spelling of its own name is fine
+	if err := nameCollision(ws, req.NewPath); err != nil {
+		if ce, ok := err.(*storage.CollisionError); !ok || ce.Existing != filepath.Clean(req.OldPath) {
+			return collisionResponse(c, err)
+		}
 	}
 
 	if err := os.Rename(oldPath, newPath); err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
+	idx := indexFor(ws.Path)
+	idx.Remove(req.OldPath)
+	idx.Update(req.NewPath)
+	fireWorkspaceEvent(c, ws, eventFileRenamed, map[string]interface{}{"path": req.NewPath, "previousPath": req.OldPath})
 
 	// Git commit
 	username := c.Locals("username").(string)
-	if err := commitChangesWithAuthor(fmt.Sprintf("Rename %s to %s", req.OldPath, req.NewPath), username); err != nil {
+	if err := commitAndNotify(c, ws, fmt.Sprintf("Rename %s to %s", req.OldPath, req.NewPath), username); err != nil {
 		log.Printf("Failed to commit changes: %v", err)
 	}
 
 	return c.JSON(APIResponse{Data: "Item renamed successfully"})
 }
 
-func commitChangesWithAuthor(message, authorName string) error {
-	if gitRepo == nil {
-		return nil // No git repository available
+// resolveWithinWorkspace returns the full path of the workspace-relative
+// path, or an error if it lies outside the workspace directory or in its
+// trash, which is only reached through the trash endpoints. File handlers
+// answer 403 when it fails.
+func resolveWithinWorkspace(ws *Workspace, path string) (string, error) {
+	if inTrash(path) {
+		return "", errTrashPath
+	}
+	return storage.ResolveInRoot(ws.Path, path)
+}
+
+// nameCollision reports an existing entry that relPath would be
+// indistinguishable from (see storage.FindCollision).
+func nameCollision(ws *Workspace, relPath string) error {
+	return storage.FindCollision(ws.Path, relPath, ws.Settings.FoldNameCase || storage.CaseInsensitive(ws.Path))
+}
+
+func collisionResponse(c *fiber.Ctx, err error) error {
+	resp := APIResponse{Error: err.Error()}
+	if ce, ok := err.(*storage.CollisionError); ok {
+		resp.Data = fiber.Map{"existing": ce.Existing}
+	}
+	return c.Status(409).JSON(resp)
+}
+
+func commitChangesWithAuthor(repo *git.Repository, message, authorName string) error {
+	_, err := commitWithAuthor(repo, message, authorName)
+	return err
+}
+
+// commitWithAuthor stages and commits every change in repo, returning the
+// new commit's hash (zero when repo is nil).
+func commitWithAuthor(repo *git.Repository, message, authorName string) (plumbing.Hash, error) {
+	if repo == nil {
+		return plumbing.ZeroHash, nil // No git repository available
 	}
 	
-	worktree, err := gitRepo.Worktree()
+	worktree, err := repo.Worktree()
 	if err != nil {
-		return err
+		return plumbing.ZeroHash, err
 	}
 
 	// Add all changes
 	err = worktree.AddGlob(".")
 	if err != nil {
-		return err
+		return plumbing.ZeroHash, err
 	}
 
 	// Commit changes
-	_, err = worktree.Commit(message, &git.CommitOptions{
+	return worktree.Commit(message, &git.CommitOptions{
 		Author: &object.Signature{
 			Name:  authorName,
 			Email: fmt.Sprintf("%s@mdoffice.local", authorName),
 			When:  time.Now(),
 		},
 	})
-	return err
 }
 
 func getGitHistory(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	
-	if err := checkWorkspacePermission(userID, "viewer"); err != nil {
+	ws, err := checkWorkspacePermission(userID, "viewer")
+	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
-	if gitRepo == nil {
+	repo := repoForWorkspace(ws)
+	if repo == nil {
 		return c.JSON(APIResponse{Data: GitHistory{Commits: []GitCommit{}}})
 	}
 	
-	pathFilter := c.Query("path")
+	q, err := gitops.ParseHistoryQuery(c)
+	if err != nil {
+		return c.Status(400).JSON(APIResponse{Error: err.Error()})
+	}
+	if q.Path != "" && !pathAllowed(ws, userID, q.Path, false) {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+	}
 
 	// Get commit history
-	logs, err := gitRepo.Log(&git.LogOptions{})
+	logs, err := repo.Log(&git.LogOptions{})
 	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
-	var commits []GitCommit
-	err = logs.ForEach(func(commit *object.Commit) error {
-		// If path filter is specified, check if this commit touches the file
-		if pathFilter != "" {
-			tree, tErr := commit.Tree()
-			if tErr != nil {
-				return nil
-			}
-			// Check if the file exists in this commit's tree
-			_, fErr := tree.File(pathFilter)
-			if fErr != nil {
-				return nil // File doesn't exist at this commit, skip
-			}
+	// ?stream=true writes one JSON commit per line as the log is walked, so
+	// large histories are never held in memory. Streams are unbounded unless
+	// ?limit= is given.
+	if c.QueryBool("stream") {
+		if c.QueryInt("limit") == 0 {
+			q.Limit = 0
 		}
-
-		commits = append(commits, GitCommit{
-			Hash:    commit.Hash.String(),
-			Message: commit.Message,
-			Author:  commit.Author.Name,
-			Date:    commit.Author.When.Format(time.RFC3339),
+		c.Set(fiber.HeaderContentType, "application/x-ndjson")
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			enc := json.NewEncoder(w)
+			_, err := gitops.WalkCommits(logs, q, func(commit GitCommit) error {
+				if err := enc.Encode(commit); err != nil {
+					return err
+				}
+				return w.Flush()
+			})
+			if err != nil {
+				enc.Encode(APIResponse{Error: err.Error()})
+				w.Flush()
+			}
 		})
 		return nil
-	})
+	}
 
+	history, err := gitops.PageCommits(logs, q)
+	if err == gitops.ErrUnknownCursor {
+		return c.Status(400).JSON(APIResponse{Error: err.Error()})
+	}
 	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
-
-	history := GitHistory{Commits: commits}
 	return c.JSON(APIResponse{Data: history})
 }
 
 func revertToCommit(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	
-	if err := checkWorkspacePermission(userID, "editor"); err != nil {
+	ws, err := checkWorkspacePermission(userID, "editor")
+	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
-	if gitRepo == nil {
+	// The hard reset rewrites ACL-restricted files as well
+	if !subtreeWritable(ws, userID, "") {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+	}
+
+	repo := repoForWorkspace(ws)
+	if repo == nil {
 		return c.JSON(APIResponse{Error: "Git repository not available"})
 	}
 	
@@ -1571,12 +2514,12 @@ func revertToCommit(c *fiber.Ctx) error {
 	}
 
 	hash := plumbing.NewHash(req.Hash)
-	commit, err := gitRepo.CommitObject(hash)
+	commit, err := repo.CommitObject(hash)
 	if err != nil {
 		return c.JSON(APIResponse{Error: "Invalid commit hash"})
 	}
 
-	worktree, err := gitRepo.Worktree()
+	worktree, err := repo.Worktree()
 	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
@@ -1589,10 +2532,11 @@ func revertToCommit(c *fiber.Ctx) error {
 	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
+	indexFor(ws.Path).Invalidate()
 
 	// Create a new commit for this revert
 	username := c.Locals("username").(string)
-	if err := commitChangesWithAuthor(fmt.Sprintf("Revert to %s", req.Hash[:7]), username); err != nil {
+	if err := commitAndNotify(c, ws, fmt.Sprintf("Revert to %s", req.Hash[:7]), username); err != nil {
 		log.Printf("Failed to commit revert: %v", err)
 	}
 
@@ -1602,11 +2546,13 @@ func revertToCommit(c *fiber.Ctx) error {
 func getGitDiff(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	
-	if err := checkWorkspacePermission(userID, "viewer"); err != nil {
+	ws, err := checkWorkspacePermission(userID, "viewer")
+	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
-	if gitRepo == nil {
+	repo := repoForWorkspace(ws)
+	if repo == nil {
 		return c.JSON(APIResponse{Error: "Git repository not available"})
 	}
 
@@ -1615,90 +2561,504 @@ func getGitDiff(c *fiber.Ctx) error {
 	toCommit := c.Query("to", "HEAD")
 	filePath := c.Query("file", "")
 
+	if filePath != "" {
+		filePath = filepath.ToSlash(filepath.Clean(filePath))
+		if !pathAllowed(ws, userID, filePath, false) {
+			return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+		}
+	}
+
 	// If no from commit specified, show working directory changes
 	if fromCommit == "" {
-		worktree, err := gitRepo.Worktree()
+		changes, err := worktreeDiff(repo, filePath)
 		if err != nil {
 			return c.JSON(APIResponse{Error: err.Error()})
 		}
 
-		status, err := worktree.Status()
-		if err != nil {
-			return c.JSON(APIResponse{Error: err.Error()})
+		diff := GitDiff{
+			From:    "working-directory",
+			To:      "HEAD",
+			Changes: readableChanges(ws, userID, changes),
 		}
-
-		var changes []GitDiffChange
-		for file, fileStatus := range status {
-			if filePath != "" && file != filePath {
-				continue
-			}
-
-			var changeType string
-			switch {
-			case fileStatus.Staging == git.Added:
-				changeType = "added"
-			case fileStatus.Staging == git.Modified:
-				changeType = "modified"
-			case fileStatus.Staging == git.Deleted:
-				changeType = "deleted"
-			case fileStatus.Worktree == git.Modified:
-				changeType = "modified"
-			case fileStatus.Worktree == git.Deleted:
-				changeType = "deleted"
-			default:
-				changeType = "unknown"
-			}
-
-			changes = append(changes, GitDiffChange{
-				File:       file,
-				Type:       changeType,
-				Additions:  0, // Would need file content comparison
-				Deletions:  0, // Would need file content comparison
-				Content:    "", // Could implement unified diff format
-			})
-		}
-
-		diff := GitDiff{
-			From:    "working-directory",
-			To:      "HEAD",
-			Changes: changes,
-		}
-		return c.JSON(APIResponse{Data: diff})
-	}
+		return c.JSON(APIResponse{Data: diff})
+	}
 
 	// Compare two commits
-	fromHash := plumbing.NewHash(fromCommit)
-	toHash := plumbing.NewHash(toCommit)
+	fromHash, err := repo.ResolveRevision(plumbing.Revision(fromCommit))
+	if err != nil {
+		return c.JSON(APIResponse{Error: "Invalid from commit: " + err.Error()})
+	}
+	toHash, err := repo.ResolveRevision(plumbing.Revision(toCommit))
+	if err != nil {
+		return c.JSON(APIResponse{Error: "Invalid to commit: " + err.Error()})
+	}
 
-	fromCommitObj, err := gitRepo.CommitObject(fromHash)
+	fromCommitObj, err := repo.CommitObject(*fromHash)
 	if err != nil {
 		return c.JSON(APIResponse{Error: "Invalid from commit: " + err.Error()})
 	}
 
-	toCommitObj, err := gitRepo.CommitObject(toHash)
+	toCommitObj, err := repo.CommitObject(*toHash)
 	if err != nil {
 		return c.JSON(APIResponse{Error: "Invalid to commit: " + err.Error()})
 	}
 
-	// Basic diff implementation - in production you'd use git.PlainDiff
+	changes, err := commitDiff(fromCommitObj, toCommitObj, filePath)
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
 	diff := GitDiff{
 		From:    fromCommit,
 		To:      toCommit,
-		Changes: []GitDiffChange{}, // Placeholder for now
+		Changes: readableChanges(ws, userID, changes),
 		Summary: fmt.Sprintf("Comparing %s to %s", fromCommitObj.Hash.String()[:7], toCommitObj.Hash.String()[:7]),
 	}
 
 	return c.JSON(APIResponse{Data: diff})
 }
 
+// getGitFileStatus maps every changed file in the worktree to "modified",
+// "added" (staged), "new" (untracked), "deleted", "renamed" or "conflicted",
+// so the file explorer can badge the tree from one Status call. Files not
+// listed are clean. ?path= limits the result to a file or folder.
+func getGitFileStatus(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	ws, err := checkWorkspacePermission(userID, "viewer")
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	repo := repoForWorkspace(ws)
+	if repo == nil {
+		return c.JSON(APIResponse{Error: "Git repository not available"})
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	scope := filepath.ToSlash(filepath.Clean(c.Query("path", ".")))
+	readable := readableBy(ws, userID)
+	files := make(map[string]string)
+	for file, fileStatus := range status {
+		if scope != "." && file != scope && !strings.HasPrefix(file, scope+"/") {
+			continue
+		}
+		if readable != nil && !readable(file) {
+			continue
+		}
+		if state := fileStatusName(fileStatus); state != "" {
+			files[file] = state
+		}
+	}
+
+	return c.JSON(APIResponse{Data: files})
+}
+
+func fileStatusName(s *git.FileStatus) string {
+	switch {
+	case s.Staging == git.UpdatedButUnmerged || s.Worktree == git.UpdatedButUnmerged:
+		return "conflicted"
+	case s.Staging == git.Untracked && s.Worktree == git.Untracked:
+		return "new"
+	case s.Staging == git.Deleted || s.Worktree == git.Deleted:
+		return "deleted"
+	case s.Staging == git.Renamed:
+		return "renamed"
+	case s.Staging == git.Added || s.Staging == git.Copied:
+		return "added"
+	case s.Staging == git.Modified || s.Worktree == git.Modified:
+		return "modified"
+	}
+	return ""
+}
+
+// getGitDiffStat sums per-commit patch stats over the commits reachable from
+// ?to= (default HEAD) but not from ?from=. Without from, the range starts at
+// the first commit. Merge commits are skipped: the changes they bring in are
+// already counted in the merged commits, so including them would count those
+// lines twice.
+func getGitDiffStat(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	ws, err := checkWorkspacePermission(userID, "viewer")
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	repo := repoForWorkspace(ws)
+	if repo == nil {
+		return c.JSON(APIResponse{Error: "Git repository not available"})
+	}
+
+	fromRev := c.Query("from", "")
+	toRev := c.Query("to", "HEAD")
+
+	toHash, err := repo.ResolveRevision(plumbing.Revision(toRev))
+	if err != nil {
+		return c.JSON(APIResponse{Error: "Invalid to commit: " + err.Error()})
+	}
+
+	excluded, err := reachableFrom(repo, fromRev)
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	logs, err := repo.Log(&git.LogOptions{From: *toHash})
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	result := GitDiffStat{From: fromRev, To: toRev, Files: []GitFileStat{}}
+	perFile := map[string]*GitFileStat{}
+	readable := readableBy(ws, userID)
+	err = logs.ForEach(func(commit *object.Commit) error {
+		if excluded[commit.Hash] || commit.NumParents() > 1 {
+			return nil
+		}
+		changes, err := commitChanges(commit)
+		if err != nil {
+			return err
+		}
+		result.Commits++
+		for _, change := range changes {
+			if readable != nil && !readable(change.File) {
+				continue
+			}
+			f, ok := perFile[change.File]
+			if !ok {
+				f = &GitFileStat{File: change.File}
+				perFile[change.File] = f
+			}
+			f.Insertions += change.Additions
+			f.Deletions += change.Deletions
+			result.Insertions += change.Additions
+			result.Deletions += change.Deletions
+		}
+		return nil
+	})
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	for _, f := range perFile {
+		result.Files = append(result.Files, *f)
+	}
+	sort.Slice(result.Files, func(i, j int) bool { return result.Files[i].File < result.Files[j].File })
+	result.FilesChanged = len(result.Files)
+
+	return c.JSON(APIResponse{Data: result})
+}
+
+// reachableFrom returns every commit reachable from rev, i.e. the commits a
+// from..to range leaves out. An empty rev excludes nothing.
+func reachableFrom(repo *git.Repository, rev string) (map[plumbing.Hash]bool, error) {
+	excluded := map[plumbing.Hash]bool{}
+	if rev == "" {
+		return excluded, nil
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid from commit: %v", err)
+	}
+	logs, err := repo.Log(&git.LogOptions{From: *hash})
+	if err != nil {
+		return nil, err
+	}
+	err = logs.ForEach(func(commit *object.Commit) error {
+		excluded[commit.Hash] = true
+		return nil
+	})
+	return excluded, err
+}
+
+// getGitMergeBase returns the common ancestor commit of ?a= and ?b=.
+// Unrelated histories get a 409 so clients can tell them from bad refs.
+func getGitMergeBase(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	ws, err := checkWorkspacePermission(userID, "viewer")
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	repo := repoForWorkspace(ws)
+	if repo == nil {
+		return c.JSON(APIResponse{Error: "Git repository not available"})
+	}
+
+	a, b := c.Query("a"), c.Query("b")
+	if a == "" || b == "" {
+		return c.Status(400).JSON(APIResponse{Error: "a and b are required"})
+	}
+
+	base, err := gitops.MergeBase(repo, a, b)
+	if err == gitops.ErrUnrelatedHistories {
+		return c.Status(409).JSON(APIResponse{
+			Error: err.Error(),
+			Data:  fiber.Map{"code": "unrelated_histories"},
+		})
+	}
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	return c.JSON(APIResponse{Data: base})
+}
+
+// remoteFetchTimeout bounds the fetch getRemoteDiff makes, so a slow or
+// unresponsive remote can't hold the request open.
+var remoteFetchTimeout = 30 * time.Second
+
+// getRemoteDiff fetches the workspace's remote and diffs the current branch
+// against its upstream tracking ref. Fetching writes the remote-tracking refs
+// and reaches out to the network, so it takes editor access.
+func getRemoteDiff(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	ws, err := checkWorkspacePermission(userID, "editor")
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	repo := repoForWorkspace(ws)
+	if repo == nil {
+		return c.JSON(APIResponse{Error: "Git repository not available"})
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+	if !head.Name().IsBranch() {
+		return c.JSON(APIResponse{Error: "HEAD is detached; check out a branch to compare with its remote"})
+	}
+	branch := head.Name().Short()
+
+	// Prefer the branch's configured upstream, fall back to origin/<branch>
+	cfg, err := repo.Config()
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+	remoteName := ""
+	mergeRef := plumbing.NewBranchReferenceName(branch)
+	if b, ok := cfg.Branches[branch]; ok && b.Remote != "" {
+		remoteName = b.Remote
+		if b.Merge != "" {
+			mergeRef = b.Merge
+		}
+	} else if _, ok := cfg.Remotes["origin"]; ok {
+		remoteName = "origin"
+	}
+	if remoteName == "" {
+		return c.JSON(APIResponse{Error: "No remote configured for this workspace"})
+	}
+	if _, ok := cfg.Remotes[remoteName]; !ok {
+		return c.JSON(APIResponse{Error: fmt.Sprintf("Upstream remote %s is not configured", remoteName)})
+	}
+
+	result := GitRemoteDiff{
+		Remote:    remoteName,
+		Branch:    branch,
+		Upstream:  remoteName + "/" + mergeRef.Short(),
+		LocalHash: head.Hash().String(),
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), remoteFetchTimeout)
+	defer cancel()
+	if err := repo.FetchContext(ctx, &git.FetchOptions{RemoteName: remoteName}); err != nil && err != git.NoErrAlreadyUpToDate {
+		log.Printf("Failed to fetch %s: %v", remoteName, err)
+		result.FetchError = err.Error()
+	}
+
+	trackingRef, err := repo.Reference(plumbing.NewRemoteReferenceName(remoteName, mergeRef.Short()), true)
+	if err != nil {
+		return c.JSON(APIResponse{Error: fmt.Sprintf("No upstream branch %s found", result.Upstream)})
+	}
+	result.RemoteHash = trackingRef.Hash().String()
+
+	localCommit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+	remoteCommit, err := repo.CommitObject(trackingRef.Hash())
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	result.Ahead, result.Behind, err = gitops.CountAheadBehind(localCommit, remoteCommit)
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	changes, err := commitDiff(remoteCommit, localCommit, "")
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+	// Per-file counts only; /api/git/diff has the patches
+	for i := range changes {
+		changes[i].Content = ""
+	}
+	result.Changes = readableChanges(ws, userID, changes)
+
+	return c.JSON(APIResponse{Data: result})
+}
+
+// getLastCommit returns the most recent commit that touched a path.
+func getLastCommit(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	ws, err := checkWorkspacePermission(userID, "viewer")
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	path := c.Query("path", "")
+	if path == "" {
+		return c.JSON(APIResponse{Error: "path query parameter required"})
+	}
+	if !pathAllowed(ws, userID, path, false) {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+	}
+
+	repo := repoForWorkspace(ws)
+	if repo == nil {
+		return c.JSON(APIResponse{Error: "Git repository not available"})
+	}
+
+	found, err := lastCommitsForPaths(repo, []string{path})
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	commit, ok := found[path]
+	if !ok {
+		return c.JSON(APIResponse{Error: "No commits found for this path"})
+	}
+	return c.JSON(APIResponse{Data: commit})
+}
+
+// getLastCommits is the batched form of getLastCommit for list rendering.
+// Paths with no history are omitted from the result map.
+func getLastCommits(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	ws, err := checkWorkspacePermission(userID, "viewer")
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	var req LastCommitsRequest
+	if errs := validation.ParseBody(c, &req); errs != nil {
+		return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
+	}
+
+	repo := repoForWorkspace(ws)
+	if repo == nil {
+		return c.JSON(APIResponse{Data: map[string]GitCommit{}})
+	}
+
+	paths := req.Paths
+	if readable := readableBy(ws, userID); readable != nil {
+		paths = nil
+		for _, p := range req.Paths {
+			if readable(p) {
+				paths = append(paths, p)
+			}
+		}
+	}
+
+	found, err := lastCommitsForPaths(repo, paths)
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+	return c.JSON(APIResponse{Data: found})
+}
+
+// lastCommitsForPaths walks history once from HEAD, diffing each commit
+// against its first parent, and records the first (newest) commit that
+// changed each requested path. The walk stops as soon as every path is found.
+func lastCommitsForPaths(repo *git.Repository, paths []string) (map[string]GitCommit, error) {
+	pending := make(map[string]string) // normalized git path -> requested path
+	for _, p := range paths {
+		pending[filepath.ToSlash(filepath.Clean(p))] = p
+	}
+	found := make(map[string]GitCommit)
+
+	head, err := repo.Head()
+	if err != nil {
+		return found, nil // empty repo: nothing has history yet
+	}
+
+	logs, err := repo.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return nil, err
+	}
+	defer logs.Close()
+
+	err = logs.ForEach(func(commit *object.Commit) error {
+		tree, err := commit.Tree()
+		if err != nil {
+			return err
+		}
+		var parentTree *object.Tree
+		if commit.NumParents() > 0 {
+			parent, err := commit.Parent(0)
+			if err != nil {
+				return err
+			}
+			if parentTree, err = parent.Tree(); err != nil {
+				return err
+			}
+		}
+
+		changes, err := object.DiffTree(parentTree, tree)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			for _, name := range []string{change.From.Name, change.To.Name} {
+				requested, ok := pending[name]
+				if !ok {
+					continue
+				}
+				found[requested] = GitCommit{
+					Hash:    commit.Hash.String(),
+					Message: commit.Message,
+					Author:  commit.Author.Name,
+					Date:    commit.Author.When.Format(time.RFC3339),
+				}
+				delete(pending, name)
+			}
+		}
+
+		if len(pending) == 0 {
+			return storer.ErrStop
+		}
+		return nil
+	})
+	if err != nil && err != storer.ErrStop {
+		return nil, err
+	}
+	return found, nil
+}
+
 func getFileAtCommit(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 
-	if err := checkWorkspacePermission(userID, "viewer"); err != nil {
+	ws, err := checkWorkspacePermission(userID, "viewer")
+	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
-	if gitRepo == nil {
+	repo := repoForWorkspace(ws)
+	if repo == nil {
 		return c.JSON(APIResponse{Error: "Git repository not available"})
 	}
 
@@ -1707,35 +3067,54 @@ func getFileAtCommit(c *fiber.Ctx) error {
 	if hashStr == "" || filePath == "" {
 		return c.JSON(APIResponse{Error: "hash and path query parameters required"})
 	}
+	if !pathAllowed(ws, userID, filePath, false) {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+	}
 
+	content, err := fileAtCommit(repo, hashStr, filePath)
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+	return c.JSON(APIResponse{Data: string(content)})
+}
+
+// fileAtCommit returns the logical content of filePath (slash-separated) as
+// of the commit hashStr.
+func fileAtCommit(repo *git.Repository, hashStr, filePath string) ([]byte, error) {
 	hash := plumbing.NewHash(hashStr)
-	commitObj, err := gitRepo.CommitObject(hash)
+	commitObj, err := repo.CommitObject(hash)
 	if err != nil {
-		return c.JSON(APIResponse{Error: "Invalid commit hash: " + err.Error()})
+		return nil, fmt.Errorf("Invalid commit hash: %w", err)
 	}
 
 	tree, err := commitObj.Tree()
 	if err != nil {
-		return c.JSON(APIResponse{Error: "Failed to get tree: " + err.Error()})
+		return nil, fmt.Errorf("Failed to get tree: %w", err)
 	}
 
 	file, err := tree.File(filePath)
 	if err != nil {
-		return c.JSON(APIResponse{Error: "File not found at this commit: " + err.Error()})
+		return nil, fmt.Errorf("File not found at this commit: %w", err)
 	}
 
 	content, err := file.Contents()
 	if err != nil {
-		return c.JSON(APIResponse{Error: "Failed to read file: " + err.Error()})
+		return nil, fmt.Errorf("Failed to read file: %w", err)
 	}
 
-	return c.JSON(APIResponse{Data: content})
+	// Compressed documents are committed as stored; return the logical text
+	decoded, err := storage.Decode(filePath, []byte(content))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decompress file: %w", err)
+	}
+	return decoded, nil
 }
 
 func uploadFile(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	
-	if err := checkWorkspacePermission(userID, "editor"); err != nil {
+	ws, err := checkWorkspacePermission(userID, "editor")
+	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
@@ -1751,29 +3130,38 @@ func uploadFile(c *fiber.Ctx) error {
 		uploadDir = "assets"
 	}
 
+	uploadPath, err := resolveUploadDir(ws.Path, uploadDir)
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+	if !pathAllowed(ws, userID, uploadDir, true) {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+	}
+
 	// Ensure upload directory exists
-	uploadPath := filepath.Join(workspaceDir, uploadDir)
 	if err := os.MkdirAll(uploadPath, 0755); err != nil {
 		return c.JSON(APIResponse{Error: "Failed to create upload directory"})
 	}
 
-	// Generate safe filename
-	safeFilename := generateSafeFilename(file.Filename)
-	filePath := filepath.Join(uploadPath, safeFilename)
-
-	// Check if file already exists and generate unique name if needed
-	counter := 1
-	for {
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			break
+	if wantDedupe(c, ws) {
+		sum, err := hashUpload(file)
+		if err != nil {
+			return c.JSON(APIResponse{Error: "Failed to read file"})
+		}
+		if existing := findDuplicateAsset(uploadPath, file.Size, sum); existing != "" {
+			relativePath, _ := filepath.Rel(ws.Path, existing)
+			if err := markDedupedAsset(ws.ID, relativePath); err != nil {
+				log.Printf("Failed to record deduplicated upload: %v", err)
+			}
+			resp := newUploadResponse(relativePath, file.Size)
+			resp.Deduplicated = true
+			return c.JSON(APIResponse{Data: resp})
 		}
-		// File exists, generate new name
-		ext := filepath.Ext(safeFilename)
-		nameWithoutExt := strings.TrimSuffix(safeFilename, ext)
-		filePath = filepath.Join(uploadPath, fmt.Sprintf("%s_%d%s", nameWithoutExt, counter, ext))
-		counter++
 	}
 
+	// Generate safe, unique filename
+	filePath := uniqueUploadPath(uploadPath, file.Filename)
+
 	// Save the file
 	if err := c.SaveFile(file, filePath); err != nil {
 		return c.JSON(APIResponse{Error: "Failed to save file"})
@@ -1786,30 +3174,179 @@ func uploadFile(c *fiber.Ctx) error {
 	}
 
 	// Generate relative path and URL
-	relativePath := strings.TrimPrefix(filePath, workspaceDir)
+	relativePath := strings.TrimPrefix(filePath, ws.Path)
 	relativePath = strings.TrimPrefix(relativePath, string(filepath.Separator))
-	fileURL := fmt.Sprintf("/files/%s", relativePath)
+	indexFor(ws.Path).Update(relativePath)
+	fireWorkspaceEvent(c, ws, eventFileUploaded, map[string]interface{}{"path": filepath.ToSlash(relativePath), "size": fileInfo.Size()})
 
 	// Commit the upload to git
 	username := c.Locals("username").(string)
 	commitMessage := fmt.Sprintf("Upload file: %s", relativePath)
-	if err := commitChangesWithAuthor(commitMessage, username); err != nil {
+	if err := commitAndNotify(c, ws, commitMessage, username); err != nil {
 		log.Printf("Failed to commit file upload: %v", err)
 	}
 
-	response := UploadResponse{
-		Filename: filepath.Base(filePath),
+	return c.JSON(APIResponse{Data: newUploadResponse(relativePath, fileInfo.Size())})
+}
+
+// uniqueUploadPath returns a path in dir for filename, made safe and suffixed
+// with _1, _2, ... if a file with that name already exists.
+func uniqueUploadPath(dir, filename string) string {
+	safeFilename := generateSafeFilename(filename)
+	filePath := filepath.Join(dir, safeFilename)
+
+	counter := 1
+	for {
+		_, err := os.Stat(filePath)
+		if os.IsNotExist(err) && storage.FindCollision(dir, filepath.Base(filePath), storage.CaseInsensitive(dir)) == nil {
+			return filePath
+		}
+		// File exists, generate new name
+		ext := filepath.Ext(safeFilename)
+		nameWithoutExt := strings.TrimSuffix(safeFilename, ext)
+		filePath = filepath.Join(dir, fmt.Sprintf("%s_%d%s", nameWithoutExt, counter, ext))
+		counter++
+	}
+}
+
+func newUploadResponse(relativePath string, size int64) UploadResponse {
+	fileURL := uploadURL(relativePath)
+	return UploadResponse{
+		Filename: filepath.Base(relativePath),
 		Path:     relativePath,
-		Size:     fileInfo.Size(),
+		Size:     size,
 		URL:      fileURL,
+		Markdown: markdownLink(filepath.Base(relativePath), fileURL),
 	}
+}
 
-	return c.JSON(APIResponse{Data: response})
+// resolveUploadDir validates a client-supplied upload directory and returns
+// its absolute path. The directory must stay inside the workspace, must not
+// be hidden (e.g. .git), and must be under UPLOAD_ALLOWED_DIRS when set.
+func resolveUploadDir(root, dir string) (string, error) {
+	cleaned := filepath.Clean(dir)
+	if filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("upload directory must be inside the workspace")
+	}
+	for _, part := range strings.Split(filepath.ToSlash(cleaned), "/") {
+		if strings.HasPrefix(part, ".") && part != "." {
+			return "", fmt.Errorf("upload directory must not be hidden")
+		}
+	}
+
+	if len(uploadAllowedDirs) > 0 {
+		allowed := false
+		for _, a := range uploadAllowedDirs {
+			if cleaned == a || strings.HasPrefix(cleaned, a+string(filepath.Separator)) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return "", fmt.Errorf("uploads are not allowed in %s", cleaned)
+		}
+	}
+
+	fullPath, err := storage.ResolveInRoot(root, cleaned)
+	if err != nil {
+		return "", fmt.Errorf("access denied")
+	}
+	return fullPath, nil
+}
+
+// uploadURL builds the download URL for a workspace-relative path.
+func uploadURL(relativePath string) string {
+	parts := strings.Split(filepath.ToSlash(relativePath), "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return uploadURLPrefix + "/" + strings.Join(parts, "/")
+}
+
+// markdownLink returns an image embed for images and a plain link otherwise.
+func markdownLink(name, link string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".svg", ".bmp":
+		return fmt.Sprintf("![%s](%s)", name, link)
+	}
+	return fmt.Sprintf("[%s](%s)", name, link)
+}
+
+// getRawFile serves the raw bytes of a workspace file (used for uploaded assets).
+func getRawFile(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	ws, err := checkWorkspacePermission(userID, "viewer")
+	if err != nil {
+		return c.Status(403).JSON(APIResponse{Error: err.Error()})
+	}
+
+	path, err := url.PathUnescape(c.Params("*"))
+	if err != nil || path == "" {
+		return c.Status(400).JSON(APIResponse{Error: "Path is required"})
+	}
+
+	// Security check
+	fullPath, err := resolveWithinWorkspace(ws, path)
+	if err != nil || !pathAllowed(ws, userID, path, false) {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+	}
+
+	info, err := os.Stat(fullPath)
+	if err != nil || info.IsDir() {
+		return c.Status(404).JSON(APIResponse{Error: "File not found"})
+	}
+
+	return sendStoredFile(c, fullPath)
+}
+
+// inlineImageExts are the file types served for display in the browser; the
+// rest are downloads, so uploaded HTML or SVG can't run script on our origin.
+var inlineImageExts = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".bmp": true,
+}
+
+// sendStoredFile streams a workspace file, decompressing documents stored
+// gzip-compressed. HEAD requests get the headers from a stat, without a body.
+func sendStoredFile(c *fiber.Ctx, fullPath string) error {
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderContentSecurityPolicy, "sandbox")
+	if !inlineImageExts[strings.ToLower(filepath.Ext(fullPath))] {
+		c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(fullPath)}))
+	}
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return c.Status(404).JSON(APIResponse{Error: "File not found"})
+	}
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	c.Set(fiber.HeaderLastModified, info.ModTime().UTC().Format(http.TimeFormat))
+
+	if c.Method() == fiber.MethodHead {
+		size, err := storage.Size(fullPath)
+		if err != nil {
+			return c.Status(500).JSON(APIResponse{Error: err.Error()})
+		}
+		c.Type(strings.TrimPrefix(filepath.Ext(fullPath), "."))
+		c.Response().Header.SetContentLength(int(size))
+		return nil
+	}
+
+	if storage.Compressible(fullPath) {
+		content, err := storage.ReadFile(fullPath)
+		if err != nil {
+			return c.Status(500).JSON(APIResponse{Error: err.Error()})
+		}
+		c.Type(strings.TrimPrefix(filepath.Ext(fullPath), "."))
+		return c.Send(content)
+	}
+
+	return c.SendFile(fullPath)
 }
 
 func generateSafeFilename(filename string) string {
 	// Remove/replace unsafe characters
-	safe := strings.ReplaceAll(filename, " ", "_")
+	safe := strings.ReplaceAll(storage.NormalizeName(filename), " ", "_")
 	safe = strings.ReplaceAll(safe, "..", "")
 	safe = strings.ReplaceAll(safe, "/", "_")
 	safe = strings.ReplaceAll(safe, "\\", "_")
@@ -1823,10 +3360,14 @@ func generateSafeFilename(filename string) string {
 	return safe
 }
 
+// maxSearchContext bounds ?context=, the lines shown around each match
+const maxSearchContext = 10
+
 func searchFiles(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	
-	if err := checkWorkspacePermission(userID, "viewer"); err != nil {
+	ws, err := checkWorkspacePermission(userID, "viewer")
+	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
@@ -1842,72 +3383,53 @@ func searchFiles(c *fiber.Ctx) error {
 		limit = 50
 	}
 
-	var results []SearchResult
-	
-	// Walk through workspace directory
-	err := filepath.Walk(workspaceDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil // Continue on errors
-		}
-
-		// Skip hidden files and directories
-		if strings.HasPrefix(info.Name(), ".") {
-			if info.IsDir() {
-				return filepath.SkipDir
-			}
-			return nil
-		}
+	matcher, err := newSearchMatcher(query, c.QueryBool("regex"), c.QueryBool("word"), c.QueryBool("case"))
+	if err != nil {
+		return c.Status(400).JSON(APIResponse{Error: err.Error()})
+	}
 
-		// Skip directories
-		if info.IsDir() {
-			return nil
-		}
+	context := c.QueryInt("context", 0)
+	if context < 0 {
+		context = 0
+	} else if context > maxSearchContext {
+		context = maxSearchContext
+	}
 
-		// Filter by file type if specified
-		if fileType != "" {
-			ext := strings.TrimPrefix(filepath.Ext(path), ".")
-			if ext != fileType {
-				return nil
-			}
-		}
+	results := indexFor(ws.Path).Search(query, matcher, fileType, limit, context, ignore.ForRequest(c, ws.Path), readableBy(ws, userID))
 
-		// Only search text files (basic check)
-		if !isTextFile(path) {
-			return nil
-		}
+	response := SearchResponse{
+		Results: results,
+		Total:   len(results),
+		Query:   query,
+	}
 
-		// Search within file
-		matches, score := searchInFile(path, query)
-		if len(matches) > 0 {
-			relativePath := strings.TrimPrefix(path, workspaceDir)
-			relativePath = strings.TrimPrefix(relativePath, string(filepath.Separator))
-			
-			results = append(results, SearchResult{
-				File:    relativePath,
-				Matches: matches,
-				Score:   score,
-			})
-		}
+	return c.JSON(APIResponse{Data: response})
+}
 
-		// Limit total results
-		if len(results) >= limit {
-			return filepath.SkipAll
-		}
+// Type-ahead suggestions returned by default and at most
+const (
+	defaultSuggestLimit = 8
+	maxSuggestLimit     = 20
+)
 
-		return nil
-	})
+// suggestFiles returns documents whose title or path matches ?q= for an
+// autocomplete dropdown; use searchFiles for content matches.
+func suggestFiles(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
 
+	ws, err := checkWorkspacePermission(userID, "viewer")
 	if err != nil {
 		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
-	response := SearchResponse{
-		Results: results,
-		Total:   len(results),
-		Query:   query,
+	limit := c.QueryInt("limit", defaultSuggestLimit)
+	if limit <= 0 {
+		limit = defaultSuggestLimit
+	} else if limit > maxSuggestLimit {
+		limit = maxSuggestLimit
 	}
 
-	return c.JSON(APIResponse{Data: response})
+	return c.JSON(APIResponse{Data: indexFor(ws.Path).Suggest(c.Query("q"), limit, ignore.ForRequest(c, ws.Path), readableBy(ws, userID))})
 }
 
 func isTextFile(path string) bool {
@@ -1922,23 +3444,25 @@ func isTextFile(path string) bool {
 	return false
 }
 
-func searchInFile(path, query string) ([]SearchMatch, float64) {
-	content, err := ioutil.ReadFile(path)
+// reindexSearch rebuilds the search index for the current workspace, picking
+// up changes made outside the app (external edits, git pulls).
+func reindexSearch(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	ws, err := checkWorkspacePermission(userID, "editor")
 	if err != nil {
-		return nil, 0
+		return c.JSON(APIResponse{Error: err.Error()})
 	}
 
-	lines := strings.Split(string(content), "\n")
+	return c.JSON(APIResponse{Data: indexFor(ws.Path).Rebuild()})
+}
+
+func searchInLines(lines []string, query string, m *searchMatcher) ([]SearchMatch, float64) {
 	var matches []SearchMatch
 	score := 0.0
-	queryLower := strings.ToLower(query)
 
 	for lineNum, line := range lines {
-		lineLower := strings.ToLower(line)
-		if strings.Contains(lineLower, queryLower) {
-			start := strings.Index(lineLower, queryLower)
-			end := start + len(query)
-			
+		if start, end, ok := m.find(line); ok {
 			matches = append(matches, SearchMatch{
 				Line:    lineNum + 1, // 1-indexed
 				Content: line,
@@ -1957,4 +3481,38 @@ func searchInFile(path, query string) ([]SearchMatch, float64) {
 	}
 
 	return matches, score
+}
+
+// addSearchContext fills in up to n lines of context around each match.
+// Context is clamped to the file and never overlaps: a match's Before starts
+// below the previous match's After, and its After stops above the next
+// match, whose line is shown as that match instead.
+func addSearchContext(matches []SearchMatch, lines []string, n int) {
+	if n <= 0 {
+		return
+	}
+	shown := 0 // lines[:shown] are already part of an earlier match
+	for i := range matches {
+		line := matches[i].Line - 1
+
+		from := line - n
+		if from < shown {
+			from = shown
+		}
+		to := line + 1 + n
+		if to > len(lines) {
+			to = len(lines)
+		}
+		if i+1 < len(matches) && to > matches[i+1].Line-1 {
+			to = matches[i+1].Line - 1
+		}
+
+		if from < line {
+			matches[i].Before = append([]string(nil), lines[from:line]...)
+		}
+		if line+1 < to {
+			matches[i].After = append([]string(nil), lines[line+1:to]...)
+		}
+		shown = to
+	}
 }
\ No newline at end of file
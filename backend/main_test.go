@@ -0,0 +1,652 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/text/unicode/norm"
+
+	"md-office-backend/storage"
+	"md-office-backend/validation"
+)
+
+func TestActiveWorkspacePerUser(t *testing.T) {
+	useTestConfig(t)
+	a, b := t.TempDir(), t.TempDir()
+	writeTestFiles(t, a, map[string]string{"notes.md": "from a"})
+	writeTestFiles(t, b, map[string]string{"notes.md": "from b"})
+	members := map[string]string{"alice": "editor", "bob": "viewer"}
+	config := WorkspaceConfig{
+		ActiveWorkspace: "a",
+		Workspaces: []Workspace{
+			{ID: "a", Path: a, Owner: "owner", Permissions: members},
+			{ID: "b", Path: b, Owner: "owner", Permissions: members},
+		},
+		UserActive: map[string]string{"bob": "b"},
+	}
+	setTestConfig(t, config)
+
+	user := ""
+	app := newTestApp(&user)
+	app.Get("/files/:path", getFile)
+	app.Post("/files", saveFile)
+
+	read := func(u string) string {
+		user = u
+		status, resp := doJSON(t, app, "GET", "/files/notes.md", nil)
+		if status != 200 || resp.Data == nil {
+			t.Fatalf("%s: GET notes.md = %d %q", u, status, resp.Error)
+		}
+		return resp.Data.(map[string]interface{})["content"].(string)
+	}
+	if got := read("alice"); got != "from a" {
+		t.Errorf("alice reads %q, want the default workspace's file", got)
+	}
+	if got := read("bob"); got != "from b" {
+		t.Errorf("bob reads %q, want the selected workspace's file", got)
+	}
+
+	// Roles apply per workspace: bob is a viewer
+	user = "bob"
+	if _, resp := doJSON(t, app, "POST", "/files", SaveFileRequest{Path: "notes.md", Content: "x"}); resp.Error == "" {
+		t.Error("viewer saved a file")
+	}
+}
+
+func TestRemoteDiffAgainstBareRemote(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "alice"}, map[string]string{"a.md": "one\n", "b.md": "bee\n"})
+	user := "alice"
+	app := newTestApp(&user)
+	app.Get("/git/remote-diff", getRemoteDiff)
+
+	if _, resp := doJSON(t, app, "GET", "/git/remote-diff", nil); resp.Error != "No remote configured for this workspace" {
+		t.Errorf("without a remote: error %q", resp.Error)
+	}
+
+	// A bare remote holding the workspace's commit, then one more from
+	// another clone
+	bare := t.TempDir()
+	if _, err := git.PlainInit(bare, true); err != nil {
+		t.Fatal(err)
+	}
+	repo := repoForWorkspace(ws)
+	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{bare}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Push(&git.PushOptions{RemoteName: "origin"}); err != nil {
+		t.Fatal(err)
+	}
+	other := t.TempDir()
+	if _, err := git.PlainClone(other, false, &git.CloneOptions{URL: bare}); err != nil {
+		t.Fatal(err)
+	}
+	commitTestFiles(t, other, map[string]string{"a.md": "one\ntwo\n", "c.md": "new\n"})
+	otherRepo, err := git.PlainOpen(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := otherRepo.Push(&git.PushOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	status, resp := doJSON(t, app, "GET", "/git/remote-diff", nil)
+	if status != 200 || resp.Error != "" {
+		t.Fatalf("remote diff: %d %s", status, resp.Error)
+	}
+	data, _ := json.Marshal(resp.Data)
+	var diff GitRemoteDiff
+	if err := json.Unmarshal(data, &diff); err != nil {
+		t.Fatal(err)
+	}
+	if diff.Ahead != 0 || diff.Behind != 1 || diff.Upstream != "origin/master" {
+		t.Errorf("ahead %d, behind %d of %s; want 0 behind 1 of origin/master", diff.Ahead, diff.Behind, diff.Upstream)
+	}
+	got := map[string]string{}
+	for _, change := range diff.Changes {
+		got[change.File] = change.Type
+	}
+	// The local side is "to": what the remote has and the workspace lacks
+	// shows as deleted
+	want := map[string]string{"a.md": "modified", "c.md": "deleted"}
+	if len(got) != len(want) || got["a.md"] != want["a.md"] || got["c.md"] != want["c.md"] {
+		t.Errorf("changes = %v, want %v", got, want)
+	}
+}
+
+func TestRemoteDiffFetchIsBounded(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{
+		Owner:       "alice",
+		Permissions: map[string]string{"alice": "owner", "bob": "viewer"},
+	}, map[string]string{"a.md": "one\n"})
+
+	// a remote that accepts connections and never answers
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conns []net.Conn
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	t.Cleanup(func() {
+		ln.Close()
+		<-done
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+	repo := repoForWorkspace(ws)
+	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{"http://" + ln.Addr().String() + "/repo.git"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	user := "bob"
+	app := newTestApp(&user)
+	app.Get("/git/remote-diff", getRemoteDiff)
+	if _, resp := doJSON(t, app, "GET", "/git/remote-diff", nil); resp.Error == "" {
+		t.Error("viewer fetched the remote")
+	}
+
+	old := remoteFetchTimeout
+	remoteFetchTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { remoteFetchTimeout = old })
+	user = "alice"
+	start := time.Now()
+	doJSON(t, app, "GET", "/git/remote-diff", nil)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("remote diff against a hung remote took %v", elapsed)
+	}
+}
+
+func TestRegisterReportsFieldErrors(t *testing.T) {
+	useTestConfig(t)
+	app := fiber.New()
+	app.Post("/register", register)
+
+	status, resp := doJSON(t, app, "POST", "/register", RegisterRequest{Username: "alice"})
+	if status != 400 {
+		t.Fatalf("register without a password = %d, want 400", status)
+	}
+	want := validation.Errors{{Field: "password", Rule: "required", Message: "password is required"}}
+	if !reflect.DeepEqual(resp.Fields, want) {
+		t.Errorf("fields = %+v, want %+v", resp.Fields, want)
+	}
+	if users, err := loadUsers(); err != nil || len(users.Users) != 0 {
+		t.Errorf("users = %v, %v; want none registered", users, err)
+	}
+}
+
+func TestLastCommitFollowsSaves(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "alice", Permissions: map[string]string{"bob": "editor"}}, map[string]string{"a.md": "a", "b.md": "b"})
+	user := "alice"
+	app := newTestApp(&user)
+	app.Post("/files", saveFile)
+	app.Get("/files/last-commit", getLastCommit)
+	app.Post("/files/last-commits", getLastCommits)
+
+	save := func(u, path, content string) string {
+		t.Helper()
+		user = u
+		if status, resp := doJSON(t, app, "POST", "/files", SaveFileRequest{Path: path, Content: content}); status != 200 || resp.Error != "" {
+			t.Fatalf("%s saving %s: %d %s", u, path, status, resp.Error)
+		}
+		head, err := repoForWorkspace(ws).Head()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return head.Hash().String()
+	}
+	save("alice", "a.md", "a1")
+	bobSave := save("bob", "b.md", "b1")
+	aliceSave := save("alice", "a.md", "a2")
+
+	_, resp := doJSON(t, app, "GET", "/files/last-commit?path=a.md", nil)
+	commit, _ := resp.Data.(map[string]interface{})
+	if commit["hash"] != aliceSave || commit["author"] != "alice" || commit["message"] != "Update a.md" {
+		t.Errorf("last commit of a.md = %v, want alice's second save %s", commit, aliceSave)
+	}
+
+	_, resp = doJSON(t, app, "POST", "/files/last-commits", LastCommitsRequest{Paths: []string{"a.md", "b.md", "missing.md"}})
+	found, _ := resp.Data.(map[string]interface{})
+	if len(found) != 2 {
+		t.Fatalf("last commits = %v, want a.md and b.md", found)
+	}
+	if b := found["b.md"].(map[string]interface{}); b["hash"] != bobSave || b["author"] != "bob" {
+		t.Errorf("last commit of b.md = %v, want bob's save %s", b, bobSave)
+	}
+	if a := found["a.md"].(map[string]interface{}); a["hash"] != aliceSave {
+		t.Errorf("batched last commit of a.md = %v, want %s", a, aliceSave)
+	}
+
+	if _, resp := doJSON(t, app, "GET", "/files/last-commit?path=missing.md", nil); resp.Error != "No commits found for this path" {
+		t.Errorf("untracked path: error %q", resp.Error)
+	}
+}
+
+func TestUploadURLServesTheFile(t *testing.T) {
+	newTestWorkspace(t, Workspace{Owner: "alice"}, nil)
+	user := "alice"
+	app := newTestApp(&user)
+	app.Post("/files/upload", uploadFile)
+	app.Get(assetPathPrefix+"/*", getRawFile)
+
+	status, resp := uploadTestFile(t, app, "/files/upload", "images/2024", "logo.png", "PNG bytes")
+	if status != 200 || resp.Error != "" {
+		t.Fatalf("upload: %d %s", status, resp.Error)
+	}
+	upload := resp.Data.(map[string]interface{})
+	link := upload["url"].(string)
+	if link != uploadURLPrefix+"/images/2024/logo.png" {
+		t.Errorf("url = %q", link)
+	}
+	if md := upload["markdown"]; md != "![logo.png]("+link+")" {
+		t.Errorf("markdown = %q", md)
+	}
+
+	res, err := app.Test(httptest.NewRequest("GET", link, nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if body, _ := io.ReadAll(res.Body); res.StatusCode != 200 || string(body) != "PNG bytes" {
+		t.Errorf("GET %s = %d %q", link, res.StatusCode, body)
+	}
+}
+
+func TestUploadDirMustStayInWorkspace(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "alice"}, nil)
+	user := "alice"
+	app := newTestApp(&user)
+	app.Post("/files/upload", uploadFile)
+
+	for _, dir := range []string{"../outside", "images/../../outside", "/tmp", ".git", "images/.hidden"} {
+		if _, resp := uploadTestFile(t, app, "/files/upload", dir, "a.png", "PNG"); resp.Error == "" {
+			t.Errorf("upload into %q accepted", dir)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(ws.Path), "outside")); err == nil {
+		t.Error("upload directory created outside the workspace")
+	}
+
+	old := uploadAllowedDirs
+	uploadAllowedDirs = []string{"assets"}
+	t.Cleanup(func() { uploadAllowedDirs = old })
+	if _, resp := uploadTestFile(t, app, "/files/upload", "docs", "a.png", "PNG"); resp.Error == "" {
+		t.Error("upload outside UPLOAD_ALLOWED_DIRS accepted")
+	}
+	if _, resp := uploadTestFile(t, app, "/files/upload", "assets/img", "a.png", "PNG"); resp.Error != "" {
+		t.Errorf("upload under UPLOAD_ALLOWED_DIRS: %s", resp.Error)
+	}
+}
+
+func TestCompressedDocumentsReadAsPlaintext(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "alice", Settings: WorkspaceSettings{CompressDocuments: true, CompressMinBytes: 1}}, nil)
+	t.Cleanup(func() { indexFor(ws.Path).Invalidate() })
+	user := "alice"
+	app := newTestApp(&user)
+	app.Post("/files", saveFile)
+	app.Get("/files/:path", getFile)
+	app.Get("/search", searchFiles)
+
+	content := "# Report\n\nquarterly figures\n"
+	if status, resp := doJSON(t, app, "POST", "/files", SaveFileRequest{Path: "report.md", Content: content}); status != 200 || resp.Error != "" {
+		t.Fatalf("save: %d %s", status, resp.Error)
+	}
+	raw, err := os.ReadFile(filepath.Join(ws.Path, "report.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !storage.IsCompressed(raw) {
+		t.Errorf("stored bytes are not gzip: %q", raw)
+	}
+
+	_, resp := doJSON(t, app, "GET", "/files/report.md", nil)
+	if got := resp.Data.(map[string]interface{})["content"]; got != content {
+		t.Errorf("read back %q, want %q", got, content)
+	}
+	if got := searchHits(t, app, "quarterly"); len(got) != 1 || got[0] != "report.md" {
+		t.Errorf("search quarterly = %v, want report.md", got)
+	}
+}
+
+func TestMissingWorkspaceDirectory(t *testing.T) {
+	useTestConfig(t)
+	a, b := t.TempDir(), t.TempDir()
+	writeTestFiles(t, a, map[string]string{"a.md": "from a"})
+	writeTestFiles(t, b, map[string]string{"b.md": "from b"})
+	config := WorkspaceConfig{
+		ActiveWorkspace: "a",
+		Workspaces: []Workspace{
+			{ID: "a", Path: a, Owner: "alice"},
+			{ID: "b", Path: b, Owner: "alice"},
+		},
+	}
+	setTestConfig(t, config)
+
+	user := "alice"
+	app := newTestApp(&user)
+	app.Get("/files", requireWorkspace, getFiles)
+	app.Post("/workspaces/switch", switchWorkspace)
+
+	if err := os.RemoveAll(a); err != nil {
+		t.Fatal(err)
+	}
+	status, resp := doJSON(t, app, "GET", "/files", nil)
+	if status != 503 {
+		t.Fatalf("listing a removed workspace = %d %q, want 503", status, resp.Error)
+	}
+	if code := resp.Data.(map[string]interface{})["code"]; code != "workspace_unavailable" {
+		t.Errorf("code = %v, want workspace_unavailable", code)
+	}
+	if _, err := os.Stat(a); err == nil {
+		t.Error("a workspace other than the default was recreated")
+	}
+
+	if status, resp := doJSON(t, app, "POST", "/workspaces/switch", SwitchWorkspaceRequest{WorkspaceID: "b"}); status != 200 || resp.Error != "" {
+		t.Fatalf("switch to b: %d %s", status, resp.Error)
+	}
+	status, resp = doJSON(t, app, "GET", "/files", nil)
+	if status != 200 || len(resp.Data.([]interface{})) != 1 {
+		t.Errorf("after switching: %d %v", status, resp.Data)
+	}
+	if status, _ := doJSON(t, app, "POST", "/workspaces/switch", SwitchWorkspaceRequest{WorkspaceID: "a"}); status != 503 {
+		t.Errorf("switch to the removed workspace = %d, want 503", status)
+	}
+}
+
+func TestMissingDefaultWorkspaceIsRecreated(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "default")
+	old := defaultWorkspaceDir
+	defaultWorkspaceDir = dir
+	t.Cleanup(func() { defaultWorkspaceDir = old })
+
+	if err := checkWorkspaceAvailable(dir); err != nil {
+		t.Fatalf("checkWorkspaceAvailable: %v", err)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Errorf("default workspace not recreated: %v", err)
+	}
+	if err := checkWorkspaceAvailable(filepath.Join(t.TempDir(), "other")); err == nil {
+		t.Error("a missing non-default workspace was reported available")
+	}
+}
+
+// treePaths flattens a getFiles tree into its paths, sorted
+func treePaths(items []interface{}) []string {
+	var paths []string
+	for _, item := range items {
+		entry := item.(map[string]interface{})
+		paths = append(paths, entry["path"].(string))
+		if children, ok := entry["children"].([]interface{}); ok {
+			paths = append(paths, treePaths(children)...)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestIgnoreFileHidesPaths(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "alice"}, map[string]string{
+		".mdofficeignore": "build/\n",
+		"notes.md":        "release output",
+		"build/out.md":    "generated output",
+	})
+	t.Cleanup(func() { indexFor(ws.Path).Invalidate() })
+	user := "alice"
+	app := newTestApp(&user)
+	app.Get("/files", getFiles)
+	app.Get("/search", searchFiles)
+
+	_, resp := doJSON(t, app, "GET", "/files", nil)
+	if got := treePaths(resp.Data.([]interface{})); !reflect.DeepEqual(got, []string{".mdofficeignore", "notes.md"}) {
+		t.Errorf("listing = %v, want build/ left out", got)
+	}
+	_, resp = doJSON(t, app, "GET", "/files?includeIgnored=true", nil)
+	if got := treePaths(resp.Data.([]interface{})); !reflect.DeepEqual(got, []string{".mdofficeignore", "build", "build/out.md", "notes.md"}) {
+		t.Errorf("listing with ignored paths = %v", got)
+	}
+
+	if got := searchHits(t, app, "output"); !reflect.DeepEqual(got, []string{"notes.md"}) {
+		t.Errorf("search = %v, want notes.md only", got)
+	}
+	if got := searchHits(t, app, "output&includeIgnored=true"); !reflect.DeepEqual(got, []string{"build/out.md", "notes.md"}) {
+		t.Errorf("search with ignored paths = %v", got)
+	}
+}
+
+func TestFileTreeDepthLimit(t *testing.T) {
+	newTestWorkspace(t, Workspace{Owner: "alice"}, map[string]string{"a/b/c/d/e/deep.md": "deep", "top.md": "top"})
+	oldDepth := fileTreeMaxDepth
+	fileTreeMaxDepth = 3
+	t.Cleanup(func() { fileTreeMaxDepth = oldDepth })
+	user := "alice"
+	app := newTestApp(&user)
+	app.Get("/files", getFiles)
+
+	_, resp := doJSON(t, app, "GET", "/files", nil)
+	items := resp.Data.([]interface{})
+	if got := treePaths(items); !reflect.DeepEqual(got, []string{"a", "a/b", "a/b/c", "top.md"}) {
+		t.Fatalf("listing = %v, want it cut off below three levels", got)
+	}
+	a := items[0].(map[string]interface{})
+	c := a["children"].([]interface{})[0].(map[string]interface{})["children"].([]interface{})[0].(map[string]interface{})
+	if c["truncated"] != true || c["children"] != nil {
+		t.Errorf("a/b/c = %v, want a collapsed node marked truncated", c)
+	}
+
+	_, resp = doJSON(t, app, "GET", "/files?depth=1", nil)
+	if got := treePaths(resp.Data.([]interface{})); !reflect.DeepEqual(got, []string{"a", "top.md"}) {
+		t.Errorf("listing with depth=1 = %v", got)
+	}
+}
+
+func TestFileTreeSymlinkLoop(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "alice"}, map[string]string{"docs/a.md": "a"})
+	if err := os.Symlink(ws.Path, filepath.Join(ws.Path, "docs", "loop")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	oldDepth := fileTreeMaxDepth
+	fileTreeMaxDepth = 1000
+	t.Cleanup(func() { fileTreeMaxDepth = oldDepth })
+	user := "alice"
+	app := newTestApp(&user)
+	app.Get("/files", getFiles)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/files", nil), 5000)
+	if err != nil {
+		t.Fatalf("listing a tree with a symlink loop: %v", err)
+	}
+	defer resp.Body.Close()
+	var out APIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if got := treePaths(out.Data.([]interface{})); !reflect.DeepEqual(got, []string{"docs", "docs/a.md", "docs/loop"}) {
+		t.Errorf("listing = %v, want the loop listed once and not followed", got)
+	}
+}
+
+func TestRawFileHead(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "alice"}, map[string]string{"images/logo.png": "PNG bytes"})
+	content := "# Plan\n\nship it\n"
+	if err := storage.WriteFile(filepath.Join(ws.Path, "plan.md"), []byte(content), true, 0644); err != nil {
+		t.Fatal(err)
+	}
+	user := "alice"
+	app := newTestApp(&user)
+	app.Get("/files/raw/*", getRawFile)
+
+	for path, want := range map[string]string{"images/logo.png": "PNG bytes", "plan.md": content} {
+		res, err := app.Test(httptest.NewRequest("HEAD", "/files/raw/"+path, nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != 200 || len(body) != 0 {
+			t.Errorf("HEAD %s = %d with %d body bytes, want 200 and no body", path, res.StatusCode, len(body))
+		}
+		if got := res.Header.Get("Content-Length"); got != strconv.Itoa(len(want)) {
+			t.Errorf("HEAD %s Content-Length = %s, want %d", path, got, len(want))
+		}
+		if res.Header.Get("Content-Type") == "" || res.Header.Get("Last-Modified") == "" || res.Header.Get("Cache-Control") == "" {
+			t.Errorf("HEAD %s headers = %v, want type, caching and modification time", path, res.Header)
+		}
+
+		res, err = app.Test(httptest.NewRequest("GET", "/files/raw/"+path, nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ = io.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != 200 || string(body) != want {
+			t.Errorf("GET %s = %d %q, want %q", path, res.StatusCode, body, want)
+		}
+	}
+
+	res, err := app.Test(httptest.NewRequest("HEAD", "/files/raw/missing.png", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 404 {
+		t.Errorf("HEAD of a missing file = %d, want 404", res.StatusCode)
+	}
+}
+
+func TestRawFileIsolationHeaders(t *testing.T) {
+	newTestWorkspace(t, Workspace{Owner: "alice"}, map[string]string{
+		"images/logo.png": "PNG bytes",
+		"page.html":       "<script>alert(1)</script>",
+		"icon.svg":        "<svg><script>alert(1)</script></svg>",
+	})
+	user := "alice"
+	app := newTestApp(&user)
+	app.Get("/files/raw/*", getRawFile)
+
+	for path, download := range map[string]bool{"images/logo.png": false, "page.html": true, "icon.svg": true} {
+		res, err := app.Test(httptest.NewRequest("GET", "/files/raw/"+path, nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.Header.Get("X-Content-Type-Options") != "nosniff" || res.Header.Get("Content-Security-Policy") != "sandbox" {
+			t.Errorf("GET %s headers = %v, want nosniff and a sandbox CSP", path, res.Header)
+		}
+		if got := strings.HasPrefix(res.Header.Get("Content-Disposition"), "attachment"); got != download {
+			t.Errorf("GET %s Content-Disposition = %q, want attachment %v", path, res.Header.Get("Content-Disposition"), download)
+		}
+	}
+}
+
+func TestSymlinksInsideAndOutsideWorkspace(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "alice"}, map[string]string{"docs/a.md": "inside words"})
+	t.Cleanup(func() { indexFor(ws.Path).Invalidate() })
+	outside := t.TempDir()
+	writeTestFiles(t, outside, map[string]string{"secret.md": "outside words"})
+	for link, target := range map[string]string{
+		"in.md":     filepath.Join(ws.Path, "docs", "a.md"),
+		"docs-link": filepath.Join(ws.Path, "docs"),
+		"out.md":    filepath.Join(outside, "secret.md"),
+		"outdir":    outside,
+	} {
+		if err := os.Symlink(target, filepath.Join(ws.Path, link)); err != nil {
+			t.Skip("symlinks not supported:", err)
+		}
+	}
+	indexFor(ws.Path).Invalidate()
+	user := "alice"
+	app := newTestApp(&user)
+	app.Get("/files", getFiles)
+	app.Get("/search", searchFiles)
+	app.Get("/files/:path", getFile)
+
+	_, resp := doJSON(t, app, "GET", "/files", nil)
+	items := resp.Data.([]interface{})
+	if got := treePaths(items); !reflect.DeepEqual(got, []string{"docs", "docs-link", "docs/a.md", "in.md"}) {
+		t.Errorf("listing = %v, want the outside links left out", got)
+	}
+	for _, item := range items {
+		entry := item.(map[string]interface{})
+		if link := entry["path"] == "in.md" || entry["path"] == "docs-link"; link != (entry["symlink"] == true) {
+			t.Errorf("%v: symlink = %v", entry["path"], entry["symlink"])
+		}
+		if entry["path"] == "docs-link" && (entry["isDirectory"] != true || entry["children"] != nil) {
+			t.Errorf("docs-link = %v, want a directory without children", entry)
+		}
+	}
+
+	if got := searchHits(t, app, "inside"); !reflect.DeepEqual(got, []string{"docs/a.md", "in.md"}) {
+		t.Errorf("search for inside content = %v", got)
+	}
+	if got := searchHits(t, app, "outside"); len(got) != 0 {
+		t.Errorf("search reached outside the workspace: %v", got)
+	}
+	if _, resp := doJSON(t, app, "GET", "/files/in.md", nil); resp.Error != "" {
+		t.Errorf("reading in.md: %s", resp.Error)
+	}
+	if _, resp := doJSON(t, app, "GET", "/files/out.md", nil); resp.Error == "" {
+		t.Errorf("out.md was read: %v", resp.Data)
+	}
+}
+
+func TestNameCollisions(t *testing.T) {
+	nfd := norm.NFD.String("Café.md")
+	ws := newTestWorkspace(t, Workspace{Owner: "alice"}, map[string]string{nfd: "x", "Notes.md": "x"})
+	if storage.CaseInsensitive(ws.Path) {
+		t.Skip("filesystem ignores case")
+	}
+	user := "alice"
+	app := newTestApp(&user)
+	app.Post("/files", createFile)
+	app.Put("/rename", renameItem)
+
+	status, resp := doJSON(t, app, "POST", "/files", CreateFileRequest{Path: "  Café.md "})
+	if existing, _ := resp.Data.(map[string]interface{}); status != 409 || existing["existing"] != nfd {
+		t.Errorf("NFC create next to an NFD file = %d %+v, want 409", status, resp)
+	}
+	if status, resp := doJSON(t, app, "POST", "/files", CreateFileRequest{Path: "notes.md"}); status != 200 || resp.Error != "" {
+		t.Errorf("case-only create without folding = %d %s, want it allowed", status, resp.Error)
+	}
+	if status, resp := doJSON(t, app, "POST", "/files", CreateFileRequest{Path: "  weekly   plan.md"}); status != 200 || resp.Error != "" {
+		t.Errorf("create = %d %s", status, resp.Error)
+	}
+	if _, err := os.Stat(filepath.Join(ws.Path, "weekly plan.md")); err != nil {
+		t.Errorf("created name was not normalized: %v", err)
+	}
+
+	ws.Settings.FoldNameCase = true
+	config := WorkspaceConfig{ActiveWorkspace: ws.ID, Workspaces: []Workspace{*ws}}
+	setTestConfig(t, config)
+	if status, _ := doJSON(t, app, "POST", "/files", CreateFileRequest{Path: "WEEKLY PLAN.md"}); status != 409 {
+		t.Errorf("case-only create with folding = %d, want 409", status)
+	}
+	if status, _ := doJSON(t, app, "PUT", "/rename", RenameRequest{OldPath: "Notes.md", NewPath: "CAFÉ.md"}); status != 409 {
+		t.Errorf("rename onto a case and normalization variant = %d, want 409", status)
+	}
+	// Changing only the case of a file's own name is a rename, not a collision
+	if status, resp := doJSON(t, app, "PUT", "/rename", RenameRequest{OldPath: "weekly plan.md", NewPath: "Weekly plan.md"}); status != 200 || resp.Error != "" {
+		t.Errorf("case-only rename of the same file = %d %s", status, resp.Error)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"md-office-backend/validation"
+)
+
+const defaultMaintenanceMessage = "MD Office is in read-only maintenance mode; changes are temporarily disabled"
+
+// Maintenance mode blocks every mutating request with 503 while reads,
+// search and export keep working. It starts from MAINTENANCE_MODE /
+// MAINTENANCE_MESSAGE and admins can toggle it at runtime.
+var maintenance struct {
+	mu      sync.RWMutex
+	enabled bool
+	message string
+	since   time.Time
+}
+
+// Non-GET routes that don't change anything and stay available. Login,
+// refresh and logout only touch session state.
+var maintenanceAllowed = map[string]bool{
+	"/api/auth/login":         true,
+	"/api/auth/refresh":       true,
+	"/api/auth/logout":        true,
+	"/api/files/last-commits": true,
+	"/api/files/sign":         true,
+	"/api/search/reindex":     true,
+	"/api/admin/maintenance":  true,
+}
+
+type MaintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message" validate:"max=500"`
+}
+
+func initMaintenanceMode() {
+	if on, _ := strconv.ParseBool(os.Getenv("MAINTENANCE_MODE")); on {
+		setMaintenance(true, os.Getenv("MAINTENANCE_MESSAGE"))
+	}
+}
+
+func setMaintenance(enabled bool, message string) {
+	maintenance.mu.Lock()
+	defer maintenance.mu.Unlock()
+
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+	if enabled && !maintenance.enabled {
+		maintenance.since = time.Now()
+	}
+	maintenance.enabled = enabled
+	maintenance.message = message
+}
+
+// maintenanceStatus returns the current state for responses and /health
+func maintenanceStatus() fiber.Map {
+	maintenance.mu.RLock()
+	defer maintenance.mu.RUnlock()
+
+	status := fiber.Map{"enabled": maintenance.enabled}
+	if maintenance.enabled {
+		status["message"] = maintenance.message
+		status["since"] = maintenance.since.Format(time.RFC3339)
+	}
+	return status
+}
+
+// maintenanceGuard rejects mutating requests while maintenance mode is on
+func maintenanceGuard(c *fiber.Ctx) error {
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return c.Next()
+	}
+	if maintenanceAllowed[c.Path()] {
+		return c.Next()
+	}
+
+	maintenance.mu.RLock()
+	enabled, message := maintenance.enabled, maintenance.message
+	maintenance.mu.RUnlock()
+	if !enabled {
+		return c.Next()
+	}
+
+	return c.Status(503).JSON(APIResponse{
+		Error: message,
+		Data:  fiber.Map{"code": "maintenance"},
+	})
+}
+
+func getMaintenanceMode(c *fiber.Ctx) error {
+	return c.JSON(APIResponse{Data: maintenanceStatus()})
+}
+
+func updateMaintenanceMode(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	if !isAdmin(userID) {
+		return c.Status(403).JSON(APIResponse{Error: "Admin access required"})
+	}
+
+	var req MaintenanceRequest
+	if errs := validation.ParseBody(c, &req); errs != nil {
+		return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
+	}
+
+	setMaintenance(req.Enabled, req.Message)
+	return c.JSON(APIResponse{Data: maintenanceStatus()})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMaintenanceModeBlocksWrites(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "alice"}, map[string]string{"notes.md": "quarterly plan"})
+	t.Cleanup(func() {
+		setMaintenance(false, "")
+		indexFor(ws.Path).Invalidate()
+	})
+	admins := adminUsers
+	adminUsers = map[string]bool{"root": true}
+	t.Cleanup(func() { adminUsers = admins })
+	if err := saveUsers(&UserStorage{Users: []User{{ID: "admin-id", Username: "root"}, {ID: "alice", Username: "alice"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	user := "alice"
+	app := newTestApp(&user)
+	app.Use(maintenanceGuard)
+	app.Get("/api/files", getFiles)
+	app.Post("/api/files", saveFile)
+	app.Get("/search", searchFiles)
+	app.Put("/api/admin/maintenance", updateMaintenanceMode)
+
+	if status, _ := doJSON(t, app, "PUT", "/api/admin/maintenance", MaintenanceRequest{Enabled: true}); status != 403 {
+		t.Errorf("non-admin turning on maintenance = %d, want 403", status)
+	}
+	user = "admin-id"
+	status, resp := doJSON(t, app, "PUT", "/api/admin/maintenance", MaintenanceRequest{Enabled: true, Message: "Backing up"})
+	if status != 200 || resp.Data.(map[string]interface{})["enabled"] != true {
+		t.Fatalf("admin turning on maintenance = %d %v", status, resp.Data)
+	}
+
+	user = "alice"
+	status, resp = doJSON(t, app, "POST", "/api/files", SaveFileRequest{Path: "notes.md", Content: "changed"})
+	if status != 503 || resp.Error != "Backing up" {
+		t.Errorf("save during maintenance = %d %q, want 503 with the message", status, resp.Error)
+	}
+	if status, resp := doJSON(t, app, "GET", "/api/files", nil); status != 200 || resp.Error != "" {
+		t.Errorf("listing during maintenance = %d %q, want it to work", status, resp.Error)
+	}
+	if got := searchHits(t, app, "quarterly"); len(got) != 1 {
+		t.Errorf("search during maintenance = %v, want notes.md", got)
+	}
+	if status := maintenanceStatus(); status["enabled"] != true || status["since"] == nil {
+		t.Errorf("status = %v, want enabled with a start time", status)
+	}
+
+	user = "admin-id"
+	if status, _ := doJSON(t, app, "PUT", "/api/admin/maintenance", MaintenanceRequest{Enabled: false}); status != 200 {
+		t.Fatalf("admin turning off maintenance = %d", status)
+	}
+	user = "alice"
+	if status, resp := doJSON(t, app, "POST", "/api/files", SaveFileRequest{Path: "notes.md", Content: "changed"}); status != 200 || resp.Error != "" {
+		t.Errorf("save after maintenance = %d %q", status, resp.Error)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"strconv"
+	"strings"
+	"time"
+
+	"md-office-backend/metrics"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GET /metrics serves Prometheus metrics when METRICS_ENABLED is set, to
+// scrapers presenting METRICS_TOKEN as a bearer token. Route patterns and
+// user counts aren't for the public.
+var (
+	httpRequests = metrics.NewCounterVec("md_office_http_requests_total",
+		"HTTP requests by route and status", "method", "route", "status")
+	httpDuration = metrics.NewHistogramVec("md_office_http_request_duration_seconds",
+		"HTTP request latencies by route", metrics.DefaultBuckets, "method", "route")
+)
+
+func initMetrics() {
+	metrics.NewGaugeFunc("md_office_workspaces", "Workspaces configured", func() float64 {
+		config, err := loadWorkspaceConfigObject()
+		if err != nil {
+			return 0
+		}
+		return float64(len(config.Workspaces))
+	})
+	metrics.NewGaugeFunc("md_office_users", "Registered users", func() float64 {
+		userStorage, err := loadUsers()
+		if err != nil {
+			return 0
+		}
+		return float64(len(userStorage.Users))
+	})
+}
+
+// metricsMiddleware counts requests and their latencies by matched route
+// pattern, so IDs in paths don't create a series each.
+func metricsMiddleware(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+	status := c.Response().StatusCode()
+	if fe, ok := err.(*fiber.Error); ok {
+		status = fe.Code
+	}
+	route := c.Route().Path
+	httpRequests.Inc(c.Method(), route, strconv.Itoa(status))
+	httpDuration.Observe(time.Since(start).Seconds(), c.Method(), route)
+	return err
+}
+
+// requireMetricsToken rejects requests that don't carry
+// "Authorization: Bearer <token>".
+func requireMetricsToken(token string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		given, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			return c.Status(401).JSON(APIResponse{Error: "Invalid metrics token"})
+		}
+		return c.Next()
+	}
+}
+
+func metricsHandler(c *fiber.Ctx) error {
+	var buf bytes.Buffer
+	metrics.WriteTo(&buf)
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	return c.Send(buf.Bytes())
+}
@@ -0,0 +1,208 @@
+// Package metrics keeps counters, histograms and gauges and writes them in
+// the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram bucket bounds, in seconds, for request
+// latencies.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metric is anything that can write its samples
+type metric interface {
+	write(w io.Writer)
+}
+
+var (
+	registry   []metric
+	registryMu sync.Mutex
+)
+
+func register(m metric) {
+	registryMu.Lock()
+	registry = append(registry, m)
+	registryMu.Unlock()
+}
+
+// WriteTo writes every registered metric, in registration order.
+func WriteTo(w io.Writer) {
+	registryMu.Lock()
+	metrics := append([]metric(nil), registry...)
+	registryMu.Unlock()
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// series holds the label values of one sample set, keyed by their joined
+// values so samples can be written in a stable order.
+type series struct {
+	labels []string
+	values []string
+}
+
+func (s series) key() string {
+	return strings.Join(s.values, "\xff")
+}
+
+// format renders the labels, plus any extra name="value" pairs, as {...}
+func (s series) format(extra ...string) string {
+	var pairs []string
+	for i, name := range s.labels {
+		pairs = append(pairs, name+`="`+escapeLabel(s.values[i])+`"`)
+	}
+	pairs = append(pairs, extra...)
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// CounterVec is a counter per combination of label values
+type CounterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	counts map[string]*counterValue
+}
+
+type counterValue struct {
+	series
+	n float64
+}
+
+// NewCounterVec registers a counter with the given label names
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, counts: map[string]*counterValue{}}
+	register(c)
+	return c
+}
+
+// Inc adds one to the counter for the label values, given in the order of
+// the label names.
+func (c *CounterVec) Inc(values ...string) {
+	s := series{labels: c.labels, values: values}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.counts[s.key()]
+	if !ok {
+		v = &counterValue{series: s}
+		c.counts[s.key()] = v
+	}
+	v.n++
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.counts) {
+		v := c.counts[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, v.format(), formatFloat(v.n))
+	}
+}
+
+// HistogramVec is a histogram per combination of label values
+type HistogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramValue
+}
+
+type histogramValue struct {
+	series
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec registers a histogram with the given bucket upper bounds,
+// in ascending order, and label names.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, series: map[string]*histogramValue{}}
+	register(h)
+	return h
+}
+
+// Observe records v for the label values
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	s := series{labels: h.labels, values: values}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hv, ok := h.series[s.key()]
+	if !ok {
+		hv = &histogramValue{series: s, counts: make([]uint64, len(h.buckets))}
+		h.series[s.key()] = hv
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		hv.counts[i]++
+	}
+	hv.count++
+	hv.sum += v
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, key := range sortedKeys(h.series) {
+		hv := h.series[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += hv.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, hv.format(`le="`+formatFloat(bound)+`"`), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, hv.format(`le="+Inf"`), hv.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, hv.format(), formatFloat(hv.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, hv.format(), hv.count)
+	}
+}
+
+// GaugeFunc is a gauge whose value is read when the metrics are written
+type GaugeFunc struct {
+	name, help string
+	fn         func() float64
+}
+
+// NewGaugeFunc registers a gauge that reports fn()
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, fn: fn}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, g.help, g.name, g.name, formatFloat(g.fn()))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMetricsRequireToken(t *testing.T) {
+	app := fiber.New()
+	app.Get("/metrics", requireMetricsToken("scrape-secret"), metricsHandler)
+
+	for auth, want := range map[string]int{
+		"":                         401,
+		"Bearer wrong":             401,
+		"scrape-secret":            401,
+		"Bearer scrape-secret":     200,
+		"Bearer scrape-secret-not": 401,
+	} {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		res, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != want {
+			t.Errorf("Authorization %q = %d, want %d", auth, res.StatusCode, want)
+		}
+	}
+}
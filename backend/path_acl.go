@@ -0,0 +1,123 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	apiPkg "md-office-backend/api"
+	"md-office-backend/storage"
+)
+
+// PathACL limits a folder or file to some of the workspace's members, e.g.
+// an HR folder. It narrows workspace permissions and never widens them: a
+// writer still needs editor access to the workspace. The owner is never
+// restricted.
+type PathACL struct {
+	Path    string   `json:"path"`              // workspace-relative file or folder
+	Readers []string `json:"readers,omitempty"` // user IDs that may read
+	Writers []string `json:"writers,omitempty"` // user IDs that may read and write
+}
+
+// matchPathACL returns the ACL with the longest path covering relPath, or
+// nil if none does.
+func matchPathACL(acls []PathACL, relPath string) *PathACL {
+	rel := cleanACLPath(relPath)
+	var best *PathACL
+	bestLen := -1
+	for i := range acls {
+		p := cleanACLPath(acls[i].Path)
+		if p == "" {
+			continue
+		}
+		if (rel == p || strings.HasPrefix(rel, p+"/")) && len(p) > bestLen {
+			best, bestLen = &acls[i], len(p)
+		}
+	}
+	return best
+}
+
+func cleanACLPath(p string) string {
+	return strings.Trim(filepath.ToSlash(filepath.Clean("/"+p)), "/")
+}
+
+// pathAllowed reports whether userID may read relPath, or change it when
+// write is set. Paths no ACL covers inherit the workspace permissions.
+// Archived documents keep the ACL of the path they were archived from, and
+// a path reached through a symlink must also pass the ACL of its target.
+func pathAllowed(ws *Workspace, userID, relPath string, write bool) bool {
+	if ws.Owner == userID {
+		return true
+	}
+	if len(ws.Settings.PathACLs) == 0 {
+		return true
+	}
+	real, err := storage.RealRel(ws.Path, relPath)
+	if err != nil {
+		return false
+	}
+	return aclAllows(ws, userID, relPath, write) && aclAllows(ws, userID, real, write)
+}
+
+func aclAllows(ws *Workspace, userID, relPath string, write bool) bool {
+	relPath = strings.TrimPrefix(cleanACLPath(relPath), apiPkg.ArchiveDir+"/")
+	acl := matchPathACL(ws.Settings.PathACLs, relPath)
+	if acl == nil {
+		return true
+	}
+	if containsString(acl.Writers, userID) {
+		return true
+	}
+	return !write && containsString(acl.Readers, userID)
+}
+
+// subtreeWritable reports whether userID may change relPath and everything
+// under it, so renaming or deleting a folder can't carry along a file whose
+// ACL the user doesn't pass. An empty relPath is the whole workspace.
+func subtreeWritable(ws *Workspace, userID, relPath string) bool {
+	if !pathAllowed(ws, userID, relPath, true) {
+		return false
+	}
+	root := cleanACLPath(relPath)
+	for _, acl := range ws.Settings.PathACLs {
+		p := cleanACLPath(acl.Path)
+		if (root == "" || strings.HasPrefix(p, root+"/")) && !pathAllowed(ws, userID, p, true) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// readableBy returns a filter passing the paths userID may read, or nil when
+// the workspace has no ACLs.
+func readableBy(ws *Workspace, userID string) func(relPath string) bool {
+	if len(ws.Settings.PathACLs) == 0 || ws.Owner == userID {
+		return nil
+	}
+	return func(relPath string) bool {
+		return pathAllowed(ws, userID, relPath, false)
+	}
+}
+
+// readableChanges drops the diff entries for files userID can't read.
+func readableChanges(ws *Workspace, userID string, changes []GitDiffChange) []GitDiffChange {
+	readable := readableBy(ws, userID)
+	if readable == nil {
+		return changes
+	}
+	kept := []GitDiffChange{}
+	for _, change := range changes {
+		if readable(change.File) {
+			kept = append(kept, change)
+		}
+	}
+	return kept
+}
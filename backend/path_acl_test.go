@@ -0,0 +1,290 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// hrWorkspace restricts hr/ and budget.md to alice as a reader; bob is an
+// editor who can't see them, and hr/shared is writable by both.
+func hrWorkspace(t *testing.T) *Workspace {
+	return newTestWorkspace(t, Workspace{
+		Owner:       "owner",
+		Permissions: map[string]string{"owner": "owner", "alice": "editor", "bob": "editor"},
+		Settings: WorkspaceSettings{PathACLs: []PathACL{
+			{Path: "hr/", Readers: []string{"alice"}},
+			{Path: "hr/shared", Writers: []string{"alice", "bob"}},
+			{Path: "budget.md", Readers: []string{"alice"}},
+		}},
+	}, map[string]string{
+		"readme.md":           "public notes",
+		"budget.md":           "secret budget",
+		"hr/salaries.md":      "secret salaries",
+		"hr/shared/policy.md": "leave policy",
+	})
+}
+
+func TestPathAllowed(t *testing.T) {
+	ws := &Workspace{Owner: "owner", Settings: WorkspaceSettings{PathACLs: []PathACL{
+		{Path: "hr/", Readers: []string{"alice"}},
+		{Path: "hr/shared", Writers: []string{"alice", "bob"}},
+	}}}
+	tests := []struct {
+		user, path  string
+		write, want bool
+	}{
+		{"alice", "hr/salaries.md", false, true},
+		{"alice", "hr/salaries.md", true, false},
+		{"bob", "hr/salaries.md", false, false},
+		{"bob", "./hr/../hr/salaries.md", false, false},
+		{"bob", "hr/shared/policy.md", true, true},
+		{"bob", "hrx/notes.md", false, true},
+		{"bob", ".archive/hr/salaries.md", false, false},
+		{"owner", "hr/salaries.md", true, true},
+	}
+	for _, tt := range tests {
+		if got := pathAllowed(ws, tt.user, tt.path, tt.write); got != tt.want {
+			t.Errorf("pathAllowed(%s, %q, write=%v) = %v, want %v", tt.user, tt.path, tt.write, got, tt.want)
+		}
+	}
+}
+
+func TestPathACLDeniesContentEndpoints(t *testing.T) {
+	ws := hrWorkspace(t)
+	head, err := repoForWorkspace(ws).Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := head.Hash().String()
+
+	user := ""
+	app := newTestApp(&user)
+	app.Get("/files/last-commit", getLastCommit)
+	app.Get("/files/raw/*", getRawFile)
+	app.Post("/files/sign", signFileURL)
+	app.Get("/files/:path", getFile)
+	app.Post("/files", saveFile)
+	app.Post("/files/create", createFile)
+	app.Post("/files/mkdir", createDirectory)
+	app.Post("/files/batch", batchFiles)
+	app.Delete("/files/:path", deleteItem)
+	app.Put("/files/rename", renameItem)
+	app.Post("/files/upload/init", initResumableUpload)
+	app.Get("/git/history", getGitHistory)
+	app.Get("/git/diff", getGitDiff)
+	app.Get("/git/file", getFileAtCommit)
+
+	reads := []struct{ method, url string }{
+		{"GET", "/files/budget.md"},
+		{"GET", "/files/raw/hr/salaries.md"},
+		{"POST", "/files/sign?path=hr/salaries.md"},
+		{"GET", "/files/last-commit?path=hr/salaries.md"},
+		{"GET", "/git/history?path=hr/salaries.md"},
+		{"GET", "/git/diff?file=hr/salaries.md"},
+		{"GET", "/git/file?hash=" + hash + "&path=hr/salaries.md"},
+	}
+	for _, r := range reads {
+		user = "bob"
+		if status, resp := doJSON(t, app, r.method, r.url, nil); status != 403 {
+			t.Errorf("bob: %s %s = %d %q, want 403", r.method, r.url, status, resp.Error)
+		}
+		user = "alice"
+		if status, resp := doJSON(t, app, r.method, r.url, nil); status != 200 {
+			t.Errorf("alice: %s %s = %d %q, want 200", r.method, r.url, status, resp.Error)
+		}
+	}
+
+	user = "alice"
+	writes := []struct {
+		method, url string
+		body        interface{}
+	}{
+		{"POST", "/files", SaveFileRequest{Path: "hr/salaries.md", Content: "changed"}},
+		{"POST", "/files/create", CreateFileRequest{Path: "hr/new.md"}},
+		{"POST", "/files/mkdir", CreateDirRequest{Path: "hr/new"}},
+		{"DELETE", "/files/hr%2Fsalaries.md", nil},
+		{"PUT", "/files/rename", RenameRequest{OldPath: "hr/salaries.md", NewPath: "salaries.md"}},
+		{"PUT", "/files/rename", RenameRequest{OldPath: "readme.md", NewPath: "hr/readme.md"}},
+		{"POST", "/files/upload/init", InitUploadRequest{Filename: "a.png", Dir: "hr", Size: 10}},
+	}
+	for _, w := range writes {
+		if status, resp := doJSON(t, app, w.method, w.url, w.body); status != 403 {
+			t.Errorf("alice: %s %s %+v = %d %q, want 403", w.method, w.url, w.body, status, resp.Error)
+		}
+	}
+	status, resp := doJSON(t, app, "POST", "/files/batch", BatchRequest{
+		Atomic:     true,
+		Operations: []BatchOperation{{Op: "save", Path: "hr/salaries.md", Content: "changed"}},
+	})
+	if status != 409 || !strings.Contains(resp.Error, "Access denied") {
+		t.Errorf("alice: batch save = %d %q, want an access denied failure", status, resp.Error)
+	}
+
+	data, err := os.ReadFile(filepath.Join(ws.Path, "hr", "salaries.md"))
+	if err != nil || string(data) != "secret salaries" {
+		t.Errorf("hr/salaries.md = %q, %v after denied writes", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(ws.Path, "hr", "readme.md")); err == nil {
+		t.Error("readme.md was moved into hr/")
+	}
+
+	user = "bob"
+	if status, resp := doJSON(t, app, "POST", "/files", SaveFileRequest{Path: "hr/shared/policy.md", Content: "new policy"}); status != 200 {
+		t.Errorf("bob: save hr/shared/policy.md = %d %q, want 200", status, resp.Error)
+	}
+}
+
+func TestPathACLProtectsDescendants(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{
+		Owner:       "owner",
+		Permissions: map[string]string{"owner": "owner", "alice": "editor", "bob": "editor"},
+		Settings: WorkspaceSettings{PathACLs: []PathACL{
+			{Path: "hr/salaries.md", Writers: []string{"alice"}},
+		}},
+	}, map[string]string{"hr/salaries.md": "secret salaries", "hr/notes.md": "notes"})
+	head, err := repoForWorkspace(ws).Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := "bob"
+	app := newTestApp(&user)
+	app.Delete("/files/:path", deleteItem)
+	app.Put("/files/rename", renameItem)
+	app.Post("/files/batch", batchFiles)
+	app.Post("/git/revert", revertToCommit)
+	app.Post("/git/checkout", checkoutBranch)
+	app.Post("/git/merge", mergeBranch)
+
+	denied := []struct {
+		method, url string
+		body        interface{}
+	}{
+		{"DELETE", "/files/hr", nil},
+		{"PUT", "/files/rename", RenameRequest{OldPath: "hr", NewPath: "people"}},
+		{"POST", "/git/revert", RevertRequest{Hash: head.Hash().String()}},
+		{"POST", "/git/checkout", CheckoutBranchRequest{Name: "master"}},
+		{"POST", "/git/merge", MergeBranchRequest{Branch: "master"}},
+	}
+	for _, d := range denied {
+		if status, resp := doJSON(t, app, d.method, d.url, d.body); status != 403 {
+			t.Errorf("bob: %s %s %+v = %d %q, want 403", d.method, d.url, d.body, status, resp.Error)
+		}
+	}
+	if status, _ := doJSON(t, app, "POST", "/files/batch", BatchRequest{
+		Atomic:     true,
+		Operations: []BatchOperation{{Op: "delete", Path: "hr"}},
+	}); status != 409 {
+		t.Errorf("bob: batch delete of hr = %d, want 409", status)
+	}
+	if data, err := os.ReadFile(filepath.Join(ws.Path, "hr", "salaries.md")); err != nil || string(data) != "secret salaries" {
+		t.Errorf("hr/salaries.md = %q, %v after denied folder operations", data, err)
+	}
+
+	if status, resp := doJSON(t, app, "PUT", "/files/rename", RenameRequest{OldPath: "hr/notes.md", NewPath: "notes.md"}); status != 200 {
+		t.Errorf("bob: rename of an unrestricted file = %d %q, want 200", status, resp.Error)
+	}
+	user = "alice"
+	if status, resp := doJSON(t, app, "PUT", "/files/rename", RenameRequest{OldPath: "hr", NewPath: "people"}); status != 200 {
+		t.Errorf("alice: rename of hr = %d %q, want 200", status, resp.Error)
+	}
+}
+
+func TestPathACLUploadDir(t *testing.T) {
+	hrWorkspace(t)
+	user := "alice"
+	app := newTestApp(&user)
+	app.Post("/files/upload", uploadFile)
+
+	if status, _ := uploadTestFile(t, app, "/files/upload", "hr", "a.png", "PNG"); status != 403 {
+		t.Errorf("upload into hr/ = %d, want 403", status)
+	}
+}
+
+func TestPathACLFiltersListings(t *testing.T) {
+	ws := hrWorkspace(t)
+	writeTestFiles(t, ws.Path, map[string]string{"hr/salaries.md": "raised salaries"})
+	if err := commitWorkspaceDir(ws.Path, "Raise salaries", "owner"); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFiles(t, ws.Path, map[string]string{"hr/salaries.md": "draft", "readme.md": "edited notes"})
+
+	user := "bob"
+	app := newTestApp(&user)
+	app.Get("/files", getFiles)
+	app.Post("/files/last-commits", getLastCommits)
+	app.Get("/git/diff", getGitDiff)
+	app.Get("/git/changelog", getGitChangelog)
+
+	_, resp := doJSON(t, app, "GET", "/files", nil)
+	for _, item := range resp.Data.([]interface{}) {
+		if name := item.(map[string]interface{})["name"]; name == "hr" {
+			t.Error("file tree lists hr/ for bob")
+		}
+	}
+
+	_, resp = doJSON(t, app, "POST", "/files/last-commits", LastCommitsRequest{Paths: []string{"readme.md", "hr/salaries.md"}})
+	found := resp.Data.(map[string]interface{})
+	if _, ok := found["hr/salaries.md"]; ok || found["readme.md"] == nil {
+		t.Errorf("last commits = %v, want readme.md only", found)
+	}
+
+	_, resp = doJSON(t, app, "GET", "/git/diff", nil)
+	changes := resp.Data.(map[string]interface{})["changes"].([]interface{})
+	if len(changes) != 1 || changes[0].(map[string]interface{})["file"] != "readme.md" {
+		t.Errorf("worktree diff = %v, want readme.md only", changes)
+	}
+
+	_, resp = doJSON(t, app, "GET", "/git/changelog?format=json", nil)
+	if n := resp.Data.(map[string]interface{})["commits"]; n != float64(1) {
+		t.Errorf("changelog has %v commits for bob, want 1 (the hr-only commit left out)", n)
+	}
+	user = "alice"
+	_, resp = doJSON(t, app, "GET", "/git/changelog?format=json", nil)
+	if n := resp.Data.(map[string]interface{})["commits"]; n != float64(2) {
+		t.Errorf("changelog has %v commits for alice, want 2", n)
+	}
+}
+
+func TestPathACLFollowsSymlinks(t *testing.T) {
+	ws := hrWorkspace(t)
+	if err := os.MkdirAll(filepath.Join(ws.Path, "public"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{"public/hr": "../hr", "public/budget.md": "../budget.md"} {
+		if err := os.Symlink(target, filepath.Join(ws.Path, filepath.FromSlash(link))); err != nil {
+			t.Skipf("symlinks unsupported: %v", err)
+		}
+	}
+
+	user := "bob"
+	app := newTestApp(&user)
+	app.Get("/files/raw/*", getRawFile)
+	app.Post("/files", saveFile)
+
+	for _, path := range []string{"public/hr/salaries.md", "public/budget.md"} {
+		if status, resp := doJSON(t, app, "GET", "/files/raw/"+path, nil); status != 403 {
+			t.Errorf("bob: read %s = %d %q, want 403", path, status, resp.Error)
+		}
+	}
+	if status, resp := doJSON(t, app, "POST", "/files", SaveFileRequest{Path: "public/hr/salaries.md", Content: "changed"}); status != 403 {
+		t.Errorf("bob: save through public/hr = %d %q, want 403", status, resp.Error)
+	}
+	if pathAllowed(ws, "bob", "public/hr/new.md", true) {
+		t.Error("bob may create a file under hr/ through public/hr")
+	}
+	if status, resp := doJSON(t, app, "POST", "/files", SaveFileRequest{Path: "public/hr/shared/policy.md", Content: "new policy"}); status != 200 {
+		t.Errorf("bob: save through public/hr into hr/shared = %d %q, want 200", status, resp.Error)
+	}
+
+	user = "alice"
+	if status, resp := doJSON(t, app, "GET", "/files/raw/public/budget.md", nil); status != 200 {
+		t.Errorf("alice: read public/budget.md = %d %q, want 200", status, resp.Error)
+	}
+	data, err := os.ReadFile(filepath.Join(ws.Path, "hr", "salaries.md"))
+	if err != nil || string(data) != "secret salaries" {
+		t.Errorf("hr/salaries.md = %q, %v after denied writes", data, err)
+	}
+}
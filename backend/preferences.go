@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Limits on the per-user preferences blob
+const (
+	maxPreferencesBytes = 16 << 10
+	maxPreferenceKeys   = 100
+)
+
+// Preferences are stored as raw JSON objects per user in preferences.json
+// so the frontend can add settings (theme, editor width, default doc type)
+// without backend changes.
+type preferencesFile struct {
+	Users map[string]json.RawMessage `json:"users"`
+}
+
+var preferencesMu sync.Mutex
+
+func preferencesPath() string {
+	return filepath.Join(configDir, "preferences.json")
+}
+
+func loadPreferencesFile() (*preferencesFile, error) {
+	data, err := os.ReadFile(preferencesPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &preferencesFile{Users: map[string]json.RawMessage{}}, nil
+		}
+		return nil, err
+	}
+
+	var f preferencesFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	if f.Users == nil {
+		f.Users = map[string]json.RawMessage{}
+	}
+	return &f, nil
+}
+
+// loadPreferences returns the stored preferences for userID, or an empty
+// object if they have none.
+func loadPreferences(userID string) (json.RawMessage, error) {
+	preferencesMu.Lock()
+	defer preferencesMu.Unlock()
+
+	f, err := loadPreferencesFile()
+	if err != nil {
+		return nil, err
+	}
+	if prefs, ok := f.Users[userID]; ok {
+		return prefs, nil
+	}
+	return json.RawMessage("{}"), nil
+}
+
+// validatePreferences checks that data is a size-capped JSON object and
+// returns it compacted.
+func validatePreferences(data []byte) (json.RawMessage, error) {
+	if len(data) > maxPreferencesBytes {
+		return nil, fmt.Errorf("preferences must be at most %d bytes", maxPreferencesBytes)
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil || obj == nil {
+		return nil, fmt.Errorf("preferences must be a JSON object")
+	}
+	if len(obj) > maxPreferenceKeys {
+		return nil, fmt.Errorf("preferences may have at most %d keys", maxPreferenceKeys)
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return nil, err
+	}
+	return json.RawMessage(buf.Bytes()), nil
+}
+
+func savePreferences(userID string, prefs json.RawMessage) error {
+	preferencesMu.Lock()
+	defer preferencesMu.Unlock()
+
+	f, err := loadPreferencesFile()
+	if err != nil {
+		return err
+	}
+	f.Users[userID] = prefs
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(preferencesPath(), data, 0644)
+}
+
+func getPreferences(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	prefs, err := loadPreferences(userID)
+	if err != nil {
+		return c.JSON(APIResponse{Error: "Failed to load preferences"})
+	}
+	return c.JSON(APIResponse{Data: prefs})
+}
+
+func updatePreferences(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	prefs, err := validatePreferences(c.Body())
+	if err != nil {
+		return c.Status(400).JSON(APIResponse{Error: err.Error()})
+	}
+
+	if err := savePreferences(userID, prefs); err != nil {
+		return c.JSON(APIResponse{Error: "Failed to save preferences"})
+	}
+	return c.JSON(APIResponse{Data: prefs})
+}
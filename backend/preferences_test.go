@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestPreferencesArePerUser(t *testing.T) {
+	useTestConfig(t)
+	user := "alice"
+	app := newTestApp(&user)
+	app.Get("/preferences", getPreferences)
+	app.Put("/preferences", updatePreferences)
+
+	prefs := map[string]interface{}{"theme": "dark", "editorWidth": 80}
+	if status, resp := doJSON(t, app, "PUT", "/preferences", prefs); status != 200 || resp.Error != "" {
+		t.Fatalf("saving preferences: %d %s", status, resp.Error)
+	}
+	if _, resp := doJSON(t, app, "GET", "/preferences", nil); resp.Data == nil || resp.Data.(map[string]interface{})["theme"] != "dark" {
+		t.Errorf("alice's preferences = %v, want what she saved", resp.Data)
+	}
+
+	user = "bob"
+	if _, resp := doJSON(t, app, "GET", "/preferences", nil); len(resp.Data.(map[string]interface{})) != 0 {
+		t.Errorf("bob's preferences = %v, want none", resp.Data)
+	}
+	if status, _ := doJSON(t, app, "PUT", "/preferences", map[string]string{"theme": "light"}); status != 200 {
+		t.Fatalf("bob saving preferences: %d", status)
+	}
+	user = "alice"
+	if _, resp := doJSON(t, app, "GET", "/preferences", nil); resp.Data.(map[string]interface{})["theme"] != "dark" {
+		t.Errorf("alice's theme = %v after bob saved his", resp.Data)
+	}
+}
+
+func TestPreferencesAreValidated(t *testing.T) {
+	useTestConfig(t)
+	user := "alice"
+	app := newTestApp(&user)
+	app.Put("/preferences", updatePreferences)
+
+	for name, body := range map[string]interface{}{
+		"array":     []string{"dark"},
+		"string":    "dark",
+		"too large": map[string]string{"note": strings.Repeat("x", maxPreferencesBytes)},
+	} {
+		if status, _ := doJSON(t, app, "PUT", "/preferences", body); status != 400 {
+			t.Errorf("saving %s preferences = %d, want 400", name, status)
+		}
+	}
+	if prefs, err := loadPreferences("alice"); err != nil || string(prefs) != "{}" {
+		t.Errorf("stored preferences = %s, %v; want none", prefs, err)
+	}
+}
+
+func TestLoginReturnsPreferences(t *testing.T) {
+	useTestConfig(t)
+	app := fiber.New()
+	app.Post("/register", register)
+	app.Post("/login", login)
+
+	creds := RegisterRequest{Username: "alice", Password: "secret"}
+	status, resp := doJSON(t, app, "POST", "/register", creds)
+	if status != 200 || resp.Error != "" {
+		t.Fatalf("register: %d %s", status, resp.Error)
+	}
+	userID := resp.Data.(map[string]interface{})["user"].(map[string]interface{})["id"].(string)
+	if err := savePreferences(userID, json.RawMessage(`{"theme":"dark"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, resp = doJSON(t, app, "POST", "/login", LoginRequest{Username: "alice", Password: "secret"})
+	prefs, _ := resp.Data.(map[string]interface{})["preferences"].(map[string]interface{})
+	if prefs["theme"] != "dark" {
+		t.Errorf("login preferences = %v, want the stored ones", resp.Data)
+	}
+}
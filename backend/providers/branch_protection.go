@@ -0,0 +1,47 @@
+package providers
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// BranchProtection summarizes the rules a provider enforces on a branch.
+// RequiredApprovals is only known for Gitea; other providers need admin
+// access to read it.
+type BranchProtection struct {
+	Protected         bool `json:"protected"`
+	RequiredApprovals int  `json:"requiredApprovals,omitempty"`
+}
+
+// GetBranchProtection returns the protection summary for a branch. Bitbucket
+// only exposes branch restrictions to admins, so it always reports none.
+func (c *Client) GetBranchProtection(owner, repo, branch string) (*BranchProtection, error) {
+	var data map[string]interface{}
+	switch c.Provider {
+	case "github":
+		u := fmt.Sprintf("https://api.github.com/repos/%s/%s/branches/%s", owner, repo, url.PathEscape(branch))
+		if err := c.get(u, &data); err != nil {
+			return nil, err
+		}
+		return &BranchProtection{Protected: boolVal(data["protected"])}, nil
+	case "gitlab":
+		encoded := url.PathEscape(owner + "/" + repo)
+		u := fmt.Sprintf("https://gitlab.com/api/v4/projects/%s/repository/branches/%s", encoded, url.PathEscape(branch))
+		if err := c.get(u, &data); err != nil {
+			return nil, err
+		}
+		return &BranchProtection{Protected: boolVal(data["protected"])}, nil
+	case "gitea":
+		u := fmt.Sprintf("%s/api/v1/repos/%s/%s/branches/%s", c.GiteaURL, owner, repo, url.PathEscape(branch))
+		if err := c.get(u, &data); err != nil {
+			return nil, err
+		}
+		return &BranchProtection{
+			Protected:         boolVal(data["protected"]),
+			RequiredApprovals: intVal(data["required_approvals"]),
+		}, nil
+	case "bitbucket":
+		return &BranchProtection{}, nil
+	}
+	return nil, fmt.Errorf("unsupported provider: %s", c.Provider)
+}
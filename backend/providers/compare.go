@@ -0,0 +1,191 @@
+package providers
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// CompareResult is the change set of head relative to base, as the
+// provider's compare view shows it.
+type CompareResult struct {
+	Base      string        `json:"base"`
+	Head      string        `json:"head"`
+	Commits   int           `json:"commits"` // commits on head not on base; 0 when the provider doesn't say
+	Additions int           `json:"additions"`
+	Deletions int           `json:"deletions"`
+	Files     []CompareFile `json:"files"`
+}
+
+// CompareFile is one changed file. Patch is the unified diff hunks when the
+// provider includes them (GitHub, GitLab); GitHub omits it for large or
+// binary files.
+type CompareFile struct {
+	Path         string `json:"path"`
+	PreviousPath string `json:"previousPath,omitempty"` // for renames
+	Status       string `json:"status"`                 // added, modified, deleted, renamed
+	Additions    int    `json:"additions"`
+	Deletions    int    `json:"deletions"`
+	Patch        string `json:"patch,omitempty"`
+}
+
+// Compare returns what head changes relative to base, i.e. what a pull
+// request from head into base would contain.
+func (c *Client) Compare(owner, repo, base, head string) (*CompareResult, error) {
+	var result *CompareResult
+	var err error
+	switch c.Provider {
+	case "github":
+		u := fmt.Sprintf("https://api.github.com/repos/%s/%s/compare/%s...%s", owner, repo, url.PathEscape(base), url.PathEscape(head))
+		result, err = c.githubStyleCompare(u)
+	case "gitlab":
+		result, err = c.gitlabCompare(owner+"/"+repo, base, head)
+	case "bitbucket":
+		result, err = c.bitbucketCompare(owner, repo, base, head)
+	case "gitea":
+		u := fmt.Sprintf("%s/api/v1/repos/%s/%s/compare/%s...%s", c.GiteaURL, owner, repo, url.PathEscape(base), url.PathEscape(head))
+		result, err = c.githubStyleCompare(u)
+	default:
+		return nil, fmt.Errorf("unsupported provider: %s", c.Provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result.Base, result.Head = base, head
+	for _, f := range result.Files {
+		result.Additions += f.Additions
+		result.Deletions += f.Deletions
+	}
+	return result, nil
+}
+
+// githubStyleCompare reads a GitHub or Gitea compare response; Gitea's
+// mirrors GitHub's.
+func (c *Client) githubStyleCompare(u string) (*CompareResult, error) {
+	var resp map[string]interface{}
+	if err := c.get(u, &resp); err != nil {
+		return nil, err
+	}
+	result := &CompareResult{Commits: intVal(resp["total_commits"]), Files: []CompareFile{}}
+	if result.Commits == 0 {
+		// Older Gitea versions only list the commits
+		if commits, ok := resp["commits"].([]interface{}); ok {
+			result.Commits = len(commits)
+		}
+	}
+	files, _ := resp["files"].([]interface{})
+	for _, raw := range files {
+		item, _ := raw.(map[string]interface{})
+		if item == nil {
+			continue
+		}
+		status := str(item["status"])
+		switch status {
+		case "removed":
+			status = "deleted"
+		case "changed":
+			status = "modified"
+		}
+		result.Files = append(result.Files, CompareFile{
+			Path:         str(item["filename"]),
+			PreviousPath: str(item["previous_filename"]),
+			Status:       status,
+			Additions:    intVal(item["additions"]),
+			Deletions:    intVal(item["deletions"]),
+			Patch:        str(item["patch"]),
+		})
+	}
+	return result, nil
+}
+
+func (c *Client) gitlabCompare(projectPath, base, head string) (*CompareResult, error) {
+	u := fmt.Sprintf("https://gitlab.com/api/v4/projects/%s/repository/compare?from=%s&to=%s&straight=false",
+		url.PathEscape(projectPath), url.QueryEscape(base), url.QueryEscape(head))
+	var resp map[string]interface{}
+	if err := c.get(u, &resp); err != nil {
+		return nil, err
+	}
+	result := &CompareResult{Files: []CompareFile{}}
+	if commits, ok := resp["commits"].([]interface{}); ok {
+		result.Commits = len(commits)
+	}
+	diffs, _ := resp["diffs"].([]interface{})
+	for _, raw := range diffs {
+		item, _ := raw.(map[string]interface{})
+		if item == nil {
+			continue
+		}
+		f := CompareFile{Path: str(item["new_path"]), Status: "modified", Patch: str(item["diff"])}
+		switch {
+		case boolVal(item["new_file"]):
+			f.Status = "added"
+		case boolVal(item["deleted_file"]):
+			f.Status = "deleted"
+			f.Path = str(item["old_path"])
+		case boolVal(item["renamed_file"]):
+			f.Status = "renamed"
+			f.PreviousPath = str(item["old_path"])
+		}
+		// GitLab doesn't count lines; take them from the hunks
+		f.Additions, f.Deletions = countPatchLines(f.Patch)
+		result.Files = append(result.Files, f)
+	}
+	return result, nil
+}
+
+// maxComparePages bounds how many diffstat pages Bitbucket is asked for.
+const maxComparePages = 10
+
+// bitbucketCompare uses the diffstat of head..base, which Bitbucket computes
+// from their merge base like a pull request. It has no patches.
+func (c *Client) bitbucketCompare(owner, repo, base, head string) (*CompareResult, error) {
+	u := fmt.Sprintf("https://api.bitbucket.org/2.0/repositories/%s/%s/diffstat/%s..%s?pagelen=500",
+		owner, repo, url.PathEscape(head), url.PathEscape(base))
+	result := &CompareResult{Files: []CompareFile{}}
+	for page := 0; u != "" && page < maxComparePages; page++ {
+		var resp map[string]interface{}
+		if err := c.get(u, &resp); err != nil {
+			return nil, err
+		}
+		values, _ := resp["values"].([]interface{})
+		for _, raw := range values {
+			item, _ := raw.(map[string]interface{})
+			if item == nil {
+				continue
+			}
+			oldPath := str(mapVal(item["old"], "path"))
+			newPath := str(mapVal(item["new"], "path"))
+			f := CompareFile{
+				Path:      newPath,
+				Status:    str(item["status"]),
+				Additions: intVal(item["lines_added"]),
+				Deletions: intVal(item["lines_removed"]),
+			}
+			switch f.Status {
+			case "removed":
+				f.Status = "deleted"
+				f.Path = oldPath
+			case "renamed":
+				f.PreviousPath = oldPath
+			}
+			result.Files = append(result.Files, f)
+		}
+		u = str(resp["next"])
+	}
+	return result, nil
+}
+
+// countPatchLines counts added and removed lines in unified diff hunks
+// without file headers.
+func countPatchLines(patch string) (additions, deletions int) {
+	for _, line := range strings.Split(patch, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+"):
+			additions++
+		case strings.HasPrefix(line, "-"):
+			deletions++
+		}
+	}
+	return additions, deletions
+}
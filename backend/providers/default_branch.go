@@ -0,0 +1,89 @@
+package providers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DefaultBranchTTL is how long a repo's default branch is cached. Branch
+// listings, PR creation and the UI all need it, and it rarely changes.
+var DefaultBranchTTL = 5 * time.Minute
+
+type cachedBranch struct {
+	name      string
+	fetchedAt time.Time
+}
+
+var (
+	defaultBranchMu    sync.Mutex
+	defaultBranchCache = map[string]cachedBranch{}
+)
+
+// defaultBranchKey scopes cache entries to the access token as well as the
+// repo, so one user's lookup never answers for a user who can't see the repo.
+func (c *Client) defaultBranchKey(owner, repo string) string {
+	h := sha256.Sum256([]byte(c.AccessToken))
+	return c.Provider + "|" + c.GiteaURL + "|" + owner + "/" + repo + "|" + hex.EncodeToString(h[:8])
+}
+
+func (c *Client) cacheDefaultBranch(owner, repo, branch string) {
+	if branch == "" {
+		return
+	}
+	defaultBranchMu.Lock()
+	defaultBranchCache[c.defaultBranchKey(owner, repo)] = cachedBranch{name: branch, fetchedAt: time.Now()}
+	defaultBranchMu.Unlock()
+}
+
+// DefaultBranch returns a repo's default branch, fetching the repo metadata
+// only when there is no cache entry younger than DefaultBranchTTL.
+func (c *Client) DefaultBranch(owner, repo string) (string, error) {
+	key := c.defaultBranchKey(owner, repo)
+
+	defaultBranchMu.Lock()
+	cached, ok := defaultBranchCache[key]
+	defaultBranchMu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < DefaultBranchTTL {
+		return cached.name, nil
+	}
+
+	branch, err := c.fetchDefaultBranch(owner, repo)
+	if err != nil {
+		return "", err
+	}
+	c.cacheDefaultBranch(owner, repo, branch)
+	return branch, nil
+}
+
+func (c *Client) fetchDefaultBranch(owner, repo string) (string, error) {
+	var repoData map[string]interface{}
+	switch c.Provider {
+	case "github":
+		if err := c.get(fmt.Sprintf("https://api.github.com/repos/%s/%s", owner, repo), &repoData); err != nil {
+			return "", err
+		}
+		return str(repoData["default_branch"]), nil
+	case "gitlab":
+		encoded := url.PathEscape(owner + "/" + repo)
+		if err := c.get(fmt.Sprintf("https://gitlab.com/api/v4/projects/%s", encoded), &repoData); err != nil {
+			return "", err
+		}
+		return str(repoData["default_branch"]), nil
+	case "bitbucket":
+		if err := c.get(fmt.Sprintf("https://api.bitbucket.org/2.0/repositories/%s/%s", owner, repo), &repoData); err != nil {
+			return "", err
+		}
+		mainBranch, _ := repoData["mainbranch"].(map[string]interface{})
+		return str(mainBranch["name"]), nil
+	case "gitea":
+		if err := c.get(fmt.Sprintf("%s/api/v1/repos/%s/%s", c.GiteaURL, owner, repo), &repoData); err != nil {
+			return "", err
+		}
+		return str(repoData["default_branch"]), nil
+	}
+	return "", fmt.Errorf("unsupported provider: %s", c.Provider)
+}
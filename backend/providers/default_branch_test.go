@@ -0,0 +1,63 @@
+package providers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDefaultBranchIsCached(t *testing.T) {
+	var metadataFetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/repos/test/notes":
+			metadataFetches.Add(1)
+			fmt.Fprint(w, `{"default_branch": "main"}`)
+		case "/api/v1/repos/test/notes/branches":
+			fmt.Fprint(w, `[{"name": "main"}, {"name": "draft"}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	alice := &Client{Provider: "gitea", GiteaURL: srv.URL, AccessToken: "alice-token"}
+	for i := 0; i < 2; i++ {
+		branches, err := alice.ListBranches("test", "notes")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(branches) != 2 || !branches[0].IsDefault || branches[1].IsDefault {
+			t.Errorf("branches = %+v, want main marked as the default", branches)
+		}
+	}
+	if branch, err := alice.DefaultBranch("test", "notes"); err != nil || branch != "main" {
+		t.Errorf("DefaultBranch = %q, %v; want main", branch, err)
+	}
+	if n := metadataFetches.Load(); n != 1 {
+		t.Errorf("repo metadata fetched %d times within the TTL, want once", n)
+	}
+
+	// Another token gets its own entry
+	bob := &Client{Provider: "gitea", GiteaURL: srv.URL, AccessToken: "bob-token"}
+	if _, err := bob.DefaultBranch("test", "notes"); err != nil {
+		t.Fatal(err)
+	}
+	if n := metadataFetches.Load(); n != 2 {
+		t.Errorf("repo metadata fetched %d times after a second user asked, want twice", n)
+	}
+
+	ttl := DefaultBranchTTL
+	DefaultBranchTTL = 0
+	t.Cleanup(func() { DefaultBranchTTL = ttl })
+	time.Sleep(time.Millisecond)
+	if _, err := alice.DefaultBranch("test", "notes"); err != nil {
+		t.Fatal(err)
+	}
+	if n := metadataFetches.Load(); n != 3 {
+		t.Errorf("repo metadata fetched %d times after the entry expired, want 3", n)
+	}
+}
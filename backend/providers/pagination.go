@@ -0,0 +1,76 @@
+package providers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// maxPerPage is the largest page size each provider's repo listing accepts.
+// Larger requests are served from several provider pages.
+var maxPerPage = map[string]int{
+	"github":    100,
+	"gitlab":    100,
+	"bitbucket": 100,
+	"gitea":     50,
+}
+
+// maxRepoPages bounds how many provider pages one ListRepos call fetches.
+const maxRepoPages = 10
+
+// repoPageFunc fetches one provider page of repos and reports whether the
+// provider has more after it.
+type repoPageFunc func(page, perPage int) ([]Repo, bool, error)
+
+// listReposPaged returns page of the listing in pages of perPage repos.
+// When perPage is within the provider's limit (size) that is a single
+// request; otherwise the window is collected from consecutive provider
+// pages of size until it is full, the provider runs out, or maxRepoPages
+// were fetched. On error the repos collected so far are returned with it.
+func listReposPaged(fetch repoPageFunc, page, perPage, size int) ([]Repo, error) {
+	if size <= 0 || perPage <= size {
+		repos, _, err := fetch(page, perPage)
+		return repos, err
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	start := (page - 1) * perPage
+	skip := start % size
+	var repos []Repo
+	for p := start/size + 1; len(repos) < perPage && p <= start/size+maxRepoPages; p++ {
+		items, more, err := fetch(p, size)
+		if err != nil {
+			return repos, err
+		}
+		if skip > 0 {
+			if skip >= len(items) {
+				items = nil
+			} else {
+				items = items[skip:]
+			}
+			skip = 0
+		}
+		if rest := perPage - len(repos); len(items) > rest {
+			items = items[:rest]
+		}
+		repos = append(repos, items...)
+		if !more {
+			break
+		}
+	}
+	return repos, nil
+}
+
+// hasNextLink reports whether a GitHub or Gitea response's Link header
+// points at a next page.
+func hasNextLink(header http.Header) bool {
+	for _, link := range header.Values("Link") {
+		for _, part := range strings.Split(link, ",") {
+			if strings.Contains(part, `rel="next"`) {
+				return true
+			}
+		}
+	}
+	return false
+}
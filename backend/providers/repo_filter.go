@@ -0,0 +1,104 @@
+package providers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// filterRepos keeps the repos matching filter's language and topic. Data a
+// listing doesn't include is fetched per repo, and only when that filter is
+// set: GitHub and Gitea topics, GitLab languages.
+func (c *Client) filterRepos(repos []Repo, filter RepoFilter) []Repo {
+	if filter.Language == "" && filter.Topic == "" {
+		return repos
+	}
+
+	var filtered []Repo
+	for _, r := range repos {
+		if filter.Language != "" {
+			if r.Language == "" && c.Provider == "gitlab" {
+				r.Language = c.gitlabPrimaryLanguage(r.ID)
+			}
+			if !strings.EqualFold(r.Language, filter.Language) {
+				continue
+			}
+		}
+		if filter.Topic != "" {
+			if r.Topics == nil {
+				r.Topics = c.repoTopics(r)
+			}
+			if !containsFold(r.Topics, filter.Topic) {
+				continue
+			}
+		}
+		filtered = append(filtered, r)
+	}
+	return filtered
+}
+
+// repoTopics fetches the topics of a repo whose listing didn't include
+// them. Failures count as no topics.
+func (c *Client) repoTopics(r Repo) []string {
+	var resp map[string]interface{}
+	switch c.Provider {
+	case "github":
+		if err := c.get(fmt.Sprintf("https://api.github.com/repos/%s/topics", r.FullName), &resp); err == nil {
+			return strList(resp["names"])
+		}
+	case "gitea":
+		if err := c.get(fmt.Sprintf("%s/api/v1/repos/%s/topics", c.GiteaURL, r.FullName), &resp); err == nil {
+			return strList(resp["topics"])
+		}
+	}
+	return []string{}
+}
+
+// gitlabPrimaryLanguage returns the language with the largest share of a
+// project, or "" if it can't be determined.
+func (c *Client) gitlabPrimaryLanguage(projectID string) string {
+	var shares map[string]float64
+	if err := c.get(fmt.Sprintf("https://gitlab.com/api/v4/projects/%s/languages", projectID), &shares); err != nil {
+		return ""
+	}
+	primary, best := "", 0.0
+	for lang, share := range shares {
+		if share > best || (share == best && lang < primary) {
+			primary, best = lang, share
+		}
+	}
+	return primary
+}
+
+// gitlabTopics reads "topics", falling back to "tag_list" on older GitLab
+// versions.
+func gitlabTopics(item map[string]interface{}) []string {
+	if topics := strList(item["topics"]); topics != nil {
+		return topics
+	}
+	return strList(item["tag_list"])
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// searchRepos keeps the repos whose name or full name contains search, for
+// providers whose list API can't search.
+func searchRepos(repos []Repo, search string) []Repo {
+	if search == "" {
+		return repos
+	}
+	search = strings.ToLower(search)
+	var found []Repo
+	for _, r := range repos {
+		if strings.Contains(strings.ToLower(r.Name), search) || strings.Contains(strings.ToLower(r.FullName), search) {
+			found = append(found, r)
+		}
+	}
+	return found
+}
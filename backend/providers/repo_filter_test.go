@@ -0,0 +1,120 @@
+package providers
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeProvider answers requests by URL path and records the paths asked for.
+type fakeProvider struct {
+	responses map[string]string
+	mu        sync.Mutex
+	requested []string
+}
+
+func (f *fakeProvider) RoundTrip(r *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	f.requested = append(f.requested, r.URL.Path)
+	f.mu.Unlock()
+	body, ok := f.responses[r.URL.Path]
+	status := 200
+	if !ok {
+		status, body = 404, "{}"
+	}
+	return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}, Request: r}, nil
+}
+
+func (f *fakeProvider) asked(path string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, p := range f.requested {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// useFakeProvider sends every provider request to responses for the rest of
+// the test.
+func useFakeProvider(t *testing.T, responses map[string]string) *fakeProvider {
+	t.Helper()
+	fake := &fakeProvider{responses: responses}
+	old := http.DefaultClient.Transport
+	http.DefaultClient.Transport = fake
+	t.Cleanup(func() { http.DefaultClient.Transport = old })
+	return fake
+}
+
+func repoNames(repos []Repo) []string {
+	names := []string{}
+	for _, r := range repos {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+func TestGitHubRepoLanguageAndTopics(t *testing.T) {
+	fake := useFakeProvider(t, map[string]string{
+		"/user/repos": `[
+			{"id": 1, "name": "cli", "full_name": "octo/cli", "language": "Go", "owner": {"login": "octo"}},
+			{"id": 2, "name": "site", "full_name": "octo/site", "language": "Python", "topics": ["docs"], "owner": {"login": "octo"}}
+		]`,
+		"/repos/octo/cli/topics": `{"names": ["Docs", "tools"]}`,
+	})
+	c := &Client{Provider: "github", AccessToken: "token"}
+
+	repos, err := c.ListRepos(1, 20, RepoFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 2 || repos[0].Language != "Go" || !reflect.DeepEqual(repos[1].Topics, []string{"docs"}) {
+		t.Errorf("repos = %+v, want languages and listed topics filled in", repos)
+	}
+	if repos, _ := c.ListRepos(1, 20, RepoFilter{Language: "go"}); !reflect.DeepEqual(repoNames(repos), []string{"cli"}) {
+		t.Errorf("language=go = %v, want cli", repoNames(repos))
+	}
+	if fake.asked("/repos/octo/cli/topics") {
+		t.Error("topics fetched without a topic filter")
+	}
+
+	if repos, _ := c.ListRepos(1, 20, RepoFilter{Topic: "DOCS"}); !reflect.DeepEqual(repoNames(repos), []string{"cli", "site"}) {
+		t.Errorf("topic=DOCS = %v, want both repos", repoNames(repos))
+	}
+	if !fake.asked("/repos/octo/cli/topics") {
+		t.Error("topics of a repo listed without them weren't fetched")
+	}
+	if repos, _ := c.ListRepos(1, 20, RepoFilter{Language: "python", Topic: "tools"}); len(repos) != 0 {
+		t.Errorf("language=python&topic=tools = %v, want none", repoNames(repos))
+	}
+}
+
+func TestGitLabRepoLanguageAndTopics(t *testing.T) {
+	useFakeProvider(t, map[string]string{
+		"/api/v4/projects": `[
+			{"id": 5, "name": "wiki", "path_with_namespace": "team/wiki", "namespace": {"path": "team"}, "topics": ["Notes"]},
+			{"id": 6, "name": "old", "path_with_namespace": "team/old", "namespace": {"path": "team"}, "tag_list": ["archive"]}
+		]`,
+		"/api/v4/projects/5/languages": `{"Go": 20.5, "Markdown": 79.5}`,
+		"/api/v4/projects/6/languages": `{"Go": 100}`,
+	})
+	c := &Client{Provider: "gitlab", AccessToken: "token"}
+
+	repos, err := c.ListRepos(1, 20, RepoFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 2 || !reflect.DeepEqual(repos[0].Topics, []string{"Notes"}) || !reflect.DeepEqual(repos[1].Topics, []string{"archive"}) {
+		t.Errorf("repos = %+v, want topics from topics and tag_list", repos)
+	}
+	if repos, _ := c.ListRepos(1, 20, RepoFilter{Language: "markdown"}); len(repos) != 1 || repos[0].Name != "wiki" || repos[0].Language != "Markdown" {
+		t.Errorf("language=markdown = %+v, want wiki with its primary language", repos)
+	}
+	if repos, _ := c.ListRepos(1, 20, RepoFilter{Language: "go", Topic: "notes"}); len(repos) != 0 {
+		t.Errorf("language=go&topic=notes = %v, want none", repoNames(repos))
+	}
+}
@@ -7,20 +7,22 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"strings"
+	"time"
 )
 
 // Repo represents a git repository from any provider.
 type Repo struct {
-	ID            string `json:"id"`
-	Name          string `json:"name"`
-	FullName      string `json:"fullName"`
-	Description   string `json:"description"`
-	Private       bool   `json:"private"`
-	DefaultBranch string `json:"defaultBranch"`
-	CloneURL      string `json:"cloneUrl"`
-	HTMLURL       string `json:"htmlUrl"`
-	Owner         string `json:"owner"`
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	FullName      string   `json:"fullName"`
+	Description   string   `json:"description"`
+	Private       bool     `json:"private"`
+	DefaultBranch string   `json:"defaultBranch"`
+	CloneURL      string   `json:"cloneUrl"`
+	HTMLURL       string   `json:"htmlUrl"`
+	Owner         string   `json:"owner"`
+	Language      string   `json:"language,omitempty"` // primary language
+	Topics        []string `json:"topics,omitempty"`   // nil when the listing didn't include them
 }
 
 // Branch represents a branch on the remote.
@@ -40,14 +42,25 @@ type PRRequest struct {
 	RepoName   string `json:"repoName"`
 }
 
-// PRResponse returned after creating a PR.
+// PRResponse describes a pull/merge request, as created, fetched or listed.
 type PRResponse struct {
 	ID      int    `json:"id"`
 	Number  int    `json:"number"`
 	HTMLURL string `json:"htmlUrl"`
 	Title   string `json:"title"`
+	State   string `json:"state,omitempty"`  // open, merged, closed
+	Author  string `json:"author,omitempty"` // username of who opened it
+	Head    string `json:"head,omitempty"`   // source branch
+	Base    string `json:"base,omitempty"`   // target branch
 }
 
+// Normalized PR states
+const (
+	PRStateOpen   = "open"
+	PRStateMerged = "merged"
+	PRStateClosed = "closed"
+)
+
 // CreateRepoRequest for creating new repos.
 type CreateRepoRequest struct {
 	Name        string `json:"name"`
@@ -61,21 +74,60 @@ type Client struct {
 	Provider    string
 	GiteaURL    string
 	AccessToken string
+
+	// Rate-limited (403/429) and 502/503/504 responses are retried up to
+	// MaxRetries times, backing off from RetryBaseDelay. Zero values use
+	// DefaultMaxRetries and DefaultRetryBaseDelay; a negative MaxRetries
+	// disables retries.
+	MaxRetries     int
+	RetryBaseDelay time.Duration
 }
 
-// ListRepos returns repos for the authenticated user.
-func (c *Client) ListRepos(page, perPage int, search string) ([]Repo, error) {
+// RepoFilter narrows a repo listing. Empty fields match everything.
+type RepoFilter struct {
+	Search   string // substring of the name
+	Language string // primary language, case-insensitive
+	Topic    string // topic or tag, case-insensitive
+}
+
+// ListRepos returns repos for the authenticated user. The listing carries
+// each repo's default branch, so it also primes the default branch cache.
+// Pages larger than the provider allows are assembled from several provider
+// pages (see listReposPaged). Search, language and topic filters apply to
+// the requested page, so a filtered page can hold fewer than perPage repos.
+func (c *Client) ListRepos(page, perPage int, filter RepoFilter) ([]Repo, error) {
+	var fetch repoPageFunc
 	switch c.Provider {
 	case "github":
-		return c.githubListRepos(page, perPage, search)
+		fetch = c.githubListRepos
 	case "gitlab":
-		return c.gitlabListRepos(page, perPage, search)
+		fetch = func(page, perPage int) ([]Repo, bool, error) {
+			return c.gitlabListRepos(page, perPage, filter.Search, filter.Topic)
+		}
 	case "bitbucket":
-		return c.bitbucketListRepos(page, perPage, search)
+		fetch = func(page, perPage int) ([]Repo, bool, error) {
+			return c.bitbucketListRepos(page, perPage, filter.Search)
+		}
 	case "gitea":
-		return c.giteaListRepos(page, perPage, search)
+		fetch = c.giteaListRepos
+	default:
+		return nil, fmt.Errorf("unsupported provider: %s", c.Provider)
 	}
-	return nil, fmt.Errorf("unsupported provider: %s", c.Provider)
+
+	repos, err := listReposPaged(fetch, page, perPage, maxPerPage[c.Provider])
+	for _, r := range repos {
+		if r.FullName == r.Owner+"/"+r.Name {
+			c.cacheDefaultBranch(r.Owner, r.Name, r.DefaultBranch)
+		}
+	}
+	if err != nil {
+		return repos, err
+	}
+	if c.Provider == "github" || c.Provider == "gitea" {
+		// These list APIs can't search, so match names here
+		repos = searchRepos(repos, filter.Search)
+	}
+	return c.filterRepos(repos, filter), nil
 }
 
 // ListBranches returns branches for a repo.
@@ -84,7 +136,7 @@ func (c *Client) ListBranches(owner, repo string) ([]Branch, error) {
 	case "github":
 		return c.githubListBranches(owner, repo)
 	case "gitlab":
-		return c.gitlabListBranches(owner + "/" + repo)
+		return c.gitlabListBranches(owner, repo)
 	case "bitbucket":
 		return c.bitbucketListBranches(owner, repo)
 	case "gitea":
@@ -123,25 +175,74 @@ func (c *Client) CreatePR(req PRRequest) (*PRResponse, error) {
 	return nil, fmt.Errorf("unsupported provider: %s", c.Provider)
 }
 
+// GetPR fetches a single pull/merge request, including its current state.
+func (c *Client) GetPR(owner, repo string, number int) (*PRResponse, error) {
+	switch c.Provider {
+	case "github":
+		return c.githubGetPR(owner, repo, number)
+	case "gitlab":
+		return c.gitlabGetPR(owner+"/"+repo, number)
+	case "bitbucket":
+		return c.bitbucketGetPR(owner, repo, number)
+	case "gitea":
+		return c.giteaGetPR(owner, repo, number)
+	}
+	return nil, fmt.Errorf("unsupported provider: %s", c.Provider)
+}
+
+// ListPRs lists a repo's pull/merge requests in state: open (the default),
+// closed, merged or all. Only the first page, most recently updated first,
+// is returned.
+func (c *Client) ListPRs(owner, repo, state string) ([]PRResponse, error) {
+	if state == "" {
+		state = PRStateOpen
+	}
+	if state != PRStateOpen && state != PRStateClosed && state != PRStateMerged && state != "all" {
+		return nil, fmt.Errorf("invalid state %q: use open, closed, merged or all", state)
+	}
+	var prs []PRResponse
+	var err error
+	switch c.Provider {
+	case "github":
+		prs, err = c.githubListPRs(owner, repo, state)
+	case "gitlab":
+		prs, err = c.gitlabListPRs(owner+"/"+repo, state)
+	case "bitbucket":
+		prs, err = c.bitbucketListPRs(owner, repo, state)
+	case "gitea":
+		prs, err = c.giteaListPRs(owner, repo, state)
+	default:
+		return nil, fmt.Errorf("unsupported provider: %s", c.Provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// GitHub and Gitea only know open and closed; merged PRs are closed ones
+	filtered := []PRResponse{}
+	for _, pr := range prs {
+		if state == "all" || pr.State == state {
+			filtered = append(filtered, pr)
+		}
+	}
+	return filtered, nil
+}
+
 // --- GitHub ---
 
-func (c *Client) githubListRepos(page, perPage int, search string) ([]Repo, error) {
+func (c *Client) githubListRepos(page, perPage int) ([]Repo, bool, error) {
 	u := fmt.Sprintf("https://api.github.com/user/repos?page=%d&per_page=%d&sort=updated&affiliation=owner,collaborator", page, perPage)
 	var items []map[string]interface{}
-	if err := c.get(u, &items); err != nil {
-		return nil, err
+	header, err := c.getWithHeader(u, &items)
+	if err != nil {
+		return nil, false, err
 	}
 
 	var repos []Repo
 	for _, item := range items {
-		name := str(item["name"])
-		if search != "" && !strings.Contains(strings.ToLower(name), strings.ToLower(search)) &&
-			!strings.Contains(strings.ToLower(str(item["full_name"])), strings.ToLower(search)) {
-			continue
-		}
 		repos = append(repos, Repo{
 			ID:            fmt.Sprintf("%v", item["id"]),
-			Name:          name,
+			Name:          str(item["name"]),
 			FullName:      str(item["full_name"]),
 			Description:   str(item["description"]),
 			Private:       boolVal(item["private"]),
@@ -149,9 +250,11 @@ func (c *Client) githubListRepos(page, perPage int, search string) ([]Repo, erro
 			CloneURL:      str(item["clone_url"]),
 			HTMLURL:       str(item["html_url"]),
 			Owner:         str(mapVal(item["owner"], "login")),
+			Language:      str(item["language"]),
+			Topics:        strList(item["topics"]),
 		})
 	}
-	return repos, nil
+	return repos, hasNextLink(header), nil
 }
 
 func (c *Client) githubListBranches(owner, repo string) ([]Branch, error) {
@@ -161,11 +264,7 @@ func (c *Client) githubListBranches(owner, repo string) ([]Branch, error) {
 		return nil, err
 	}
 
-	// Get default branch
-	repoURL := fmt.Sprintf("https://api.github.com/repos/%s/%s", owner, repo)
-	var repoData map[string]interface{}
-	_ = c.get(repoURL, &repoData)
-	defaultBranch := str(repoData["default_branch"])
+	defaultBranch, _ := c.DefaultBranch(owner, repo)
 
 	var branches []Branch
 	for _, item := range items {
@@ -221,16 +320,71 @@ func (c *Client) githubCreatePR(req PRRequest) (*PRResponse, error) {
 	}, nil
 }
 
+func (c *Client) githubGetPR(owner, repo string, number int) (*PRResponse, error) {
+	u := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls/%d", owner, repo, number)
+	var resp map[string]interface{}
+	if err := c.get(u, &resp); err != nil {
+		return nil, err
+	}
+	return &PRResponse{
+		Number:  intVal(resp["number"]),
+		HTMLURL: str(resp["html_url"]),
+		Title:   str(resp["title"]),
+		State:   githubPRState(str(resp["state"]), boolVal(resp["merged"]) || resp["merged_at"] != nil),
+	}, nil
+}
+
+func (c *Client) githubListPRs(owner, repo, state string) ([]PRResponse, error) {
+	apiState := state
+	if state == PRStateMerged {
+		apiState = "closed"
+	}
+	u := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls?state=%s&per_page=100&sort=updated&direction=desc", owner, repo, apiState)
+	var items []map[string]interface{}
+	if err := c.get(u, &items); err != nil {
+		return nil, err
+	}
+	var prs []PRResponse
+	for _, item := range items {
+		prs = append(prs, PRResponse{
+			ID:      intVal(item["id"]),
+			Number:  intVal(item["number"]),
+			HTMLURL: str(item["html_url"]),
+			Title:   str(item["title"]),
+			State:   githubPRState(str(item["state"]), item["merged_at"] != nil),
+			Author:  str(mapVal(item["user"], "login")),
+			Head:    str(mapVal(item["head"], "ref")),
+			Base:    str(mapVal(item["base"], "ref")),
+		})
+	}
+	return prs, nil
+}
+
+// githubPRState maps GitHub/Gitea "open"/"closed" plus the merged flag
+func githubPRState(state string, merged bool) string {
+	switch {
+	case merged:
+		return PRStateMerged
+	case state == "closed":
+		return PRStateClosed
+	}
+	return PRStateOpen
+}
+
 // --- GitLab ---
 
-func (c *Client) gitlabListRepos(page, perPage int, search string) ([]Repo, error) {
+func (c *Client) gitlabListRepos(page, perPage int, search, topic string) ([]Repo, bool, error) {
 	u := fmt.Sprintf("https://gitlab.com/api/v4/projects?membership=true&page=%d&per_page=%d&order_by=updated_at", page, perPage)
 	if search != "" {
 		u += "&search=" + url.QueryEscape(search)
 	}
+	if topic != "" {
+		u += "&topic=" + url.QueryEscape(topic)
+	}
 	var items []map[string]interface{}
-	if err := c.get(u, &items); err != nil {
-		return nil, err
+	header, err := c.getWithHeader(u, &items)
+	if err != nil {
+		return nil, false, err
 	}
 	var repos []Repo
 	for _, item := range items {
@@ -245,24 +399,21 @@ func (c *Client) gitlabListRepos(page, perPage int, search string) ([]Repo, erro
 			CloneURL:      str(item["http_url_to_repo"]),
 			HTMLURL:       str(item["web_url"]),
 			Owner:         str(ns["path"]),
+			Topics:        gitlabTopics(item),
 		})
 	}
-	return repos, nil
+	return repos, header.Get("X-Next-Page") != "", nil
 }
 
-func (c *Client) gitlabListBranches(projectPath string) ([]Branch, error) {
-	encoded := url.PathEscape(projectPath)
+func (c *Client) gitlabListBranches(owner, repo string) ([]Branch, error) {
+	encoded := url.PathEscape(owner + "/" + repo)
 	u := fmt.Sprintf("https://gitlab.com/api/v4/projects/%s/repository/branches?per_page=100", encoded)
 	var items []map[string]interface{}
 	if err := c.get(u, &items); err != nil {
 		return nil, err
 	}
 
-	// Get default branch
-	pu := fmt.Sprintf("https://gitlab.com/api/v4/projects/%s", encoded)
-	var proj map[string]interface{}
-	_ = c.get(pu, &proj)
-	defaultBranch := str(proj["default_branch"])
+	defaultBranch, _ := c.DefaultBranch(owner, repo)
 
 	var branches []Branch
 	for _, item := range items {
@@ -324,16 +475,68 @@ func (c *Client) gitlabCreatePR(req PRRequest) (*PRResponse, error) {
 	}, nil
 }
 
+func (c *Client) gitlabGetPR(projectPath string, iid int) (*PRResponse, error) {
+	u := fmt.Sprintf("https://gitlab.com/api/v4/projects/%s/merge_requests/%d", url.PathEscape(projectPath), iid)
+	var resp map[string]interface{}
+	if err := c.get(u, &resp); err != nil {
+		return nil, err
+	}
+	return &PRResponse{
+		ID:      intVal(resp["iid"]),
+		Number:  intVal(resp["iid"]),
+		HTMLURL: str(resp["web_url"]),
+		Title:   str(resp["title"]),
+		State:   gitlabPRState(str(resp["state"])),
+	}, nil
+}
+
+func (c *Client) gitlabListPRs(projectPath, state string) ([]PRResponse, error) {
+	apiState := state
+	if state == PRStateOpen {
+		apiState = "opened"
+	}
+	u := fmt.Sprintf("https://gitlab.com/api/v4/projects/%s/merge_requests?state=%s&per_page=100&order_by=updated_at", url.PathEscape(projectPath), apiState)
+	var items []map[string]interface{}
+	if err := c.get(u, &items); err != nil {
+		return nil, err
+	}
+	var prs []PRResponse
+	for _, item := range items {
+		prs = append(prs, PRResponse{
+			ID:      intVal(item["iid"]),
+			Number:  intVal(item["iid"]),
+			HTMLURL: str(item["web_url"]),
+			Title:   str(item["title"]),
+			State:   gitlabPRState(str(item["state"])),
+			Author:  str(mapVal(item["author"], "username")),
+			Head:    str(item["source_branch"]),
+			Base:    str(item["target_branch"]),
+		})
+	}
+	return prs, nil
+}
+
+// gitlabPRState maps a merge request state; "locked" ones are still open.
+func gitlabPRState(state string) string {
+	switch state {
+	case "merged":
+		return PRStateMerged
+	case "closed":
+		return PRStateClosed
+	}
+	return PRStateOpen
+}
+
 // --- Bitbucket ---
 
-func (c *Client) bitbucketListRepos(page, perPage int, search string) ([]Repo, error) {
+func (c *Client) bitbucketListRepos(page, perPage int, search string) ([]Repo, bool, error) {
 	u := fmt.Sprintf("https://api.bitbucket.org/2.0/repositories?role=member&page=%d&pagelen=%d", page, perPage)
 	if search != "" {
 		u += "&q=name~%22" + url.QueryEscape(search) + "%22"
 	}
 	var resp map[string]interface{}
 	if err := c.get(u, &resp); err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	items, _ := resp["values"].([]interface{})
 	var repos []Repo
@@ -365,9 +568,10 @@ func (c *Client) bitbucketListRepos(page, perPage int, search string) ([]Repo, e
 			CloneURL:      cloneURL,
 			HTMLURL:       str(mapVal(item["links"], "html", "href")),
 			Owner:         str(owner["username"]),
+			Language:      str(item["language"]),
 		})
 	}
-	return repos, nil
+	return repos, str(resp["next"]) != "", nil
 }
 
 func (c *Client) bitbucketListBranches(owner, repo string) ([]Branch, error) {
@@ -376,12 +580,7 @@ func (c *Client) bitbucketListBranches(owner, repo string) ([]Branch, error) {
 	if err := c.get(u, &resp); err != nil {
 		return nil, err
 	}
-	// Get default branch
-	ru := fmt.Sprintf("https://api.bitbucket.org/2.0/repositories/%s/%s", owner, repo)
-	var repoData map[string]interface{}
-	_ = c.get(ru, &repoData)
-	mainBranch, _ := repoData["mainbranch"].(map[string]interface{})
-	defaultBranch := str(mainBranch["name"])
+	defaultBranch, _ := c.DefaultBranch(owner, repo)
 
 	items, _ := resp["values"].([]interface{})
 	var branches []Branch
@@ -450,24 +649,83 @@ func (c *Client) bitbucketCreatePR(req PRRequest) (*PRResponse, error) {
 	}, nil
 }
 
+func (c *Client) bitbucketGetPR(owner, repo string, id int) (*PRResponse, error) {
+	u := fmt.Sprintf("https://api.bitbucket.org/2.0/repositories/%s/%s/pullrequests/%d", owner, repo, id)
+	var resp map[string]interface{}
+	if err := c.get(u, &resp); err != nil {
+		return nil, err
+	}
+	return &PRResponse{
+		ID:      intVal(resp["id"]),
+		Number:  intVal(resp["id"]),
+		HTMLURL: str(mapVal(resp["links"], "html", "href")),
+		Title:   str(resp["title"]),
+		State:   bitbucketPRState(str(resp["state"])),
+	}, nil
+}
+
+func (c *Client) bitbucketListPRs(owner, repo, state string) ([]PRResponse, error) {
+	states := map[string]string{
+		PRStateOpen:   "state=OPEN",
+		PRStateMerged: "state=MERGED",
+		PRStateClosed: "state=DECLINED&state=SUPERSEDED",
+		"all":         "state=OPEN&state=MERGED&state=DECLINED&state=SUPERSEDED",
+	}
+	u := fmt.Sprintf("https://api.bitbucket.org/2.0/repositories/%s/%s/pullrequests?%s&pagelen=50", owner, repo, states[state])
+	var resp map[string]interface{}
+	if err := c.get(u, &resp); err != nil {
+		return nil, err
+	}
+	values, _ := resp["values"].([]interface{})
+	var prs []PRResponse
+	for _, raw := range values {
+		item, _ := raw.(map[string]interface{})
+		if item == nil {
+			continue
+		}
+		author := str(mapVal(item["author"], "nickname"))
+		if author == "" {
+			author = str(mapVal(item["author"], "display_name"))
+		}
+		prs = append(prs, PRResponse{
+			ID:      intVal(item["id"]),
+			Number:  intVal(item["id"]),
+			HTMLURL: str(mapVal(item["links"], "html", "href")),
+			Title:   str(item["title"]),
+			State:   bitbucketPRState(str(item["state"])),
+			Author:  author,
+			Head:    str(mapVal(item["source"], "branch", "name")),
+			Base:    str(mapVal(item["destination"], "branch", "name")),
+		})
+	}
+	return prs, nil
+}
+
+func bitbucketPRState(state string) string {
+	switch state {
+	case "MERGED":
+		return PRStateMerged
+	case "DECLINED", "SUPERSEDED":
+		return PRStateClosed
+	}
+	return PRStateOpen
+}
+
 // --- Gitea ---
 
-func (c *Client) giteaListRepos(page, perPage int, search string) ([]Repo, error) {
+func (c *Client) giteaListRepos(page, perPage int) ([]Repo, bool, error) {
 	u := fmt.Sprintf("%s/api/v1/user/repos?page=%d&limit=%d", c.GiteaURL, page, perPage)
 	var items []map[string]interface{}
-	if err := c.get(u, &items); err != nil {
-		return nil, err
+	header, err := c.getWithHeader(u, &items)
+	if err != nil {
+		return nil, false, err
 	}
 	var repos []Repo
 	for _, item := range items {
-		name := str(item["name"])
-		if search != "" && !strings.Contains(strings.ToLower(name), strings.ToLower(search)) {
-			continue
-		}
 		owner, _ := item["owner"].(map[string]interface{})
 		repos = append(repos, Repo{
 			ID:            fmt.Sprintf("%v", item["id"]),
-			Name:          name,
+			Name:          str(item["name"]),
 			FullName:      str(item["full_name"]),
 			Description:   str(item["description"]),
 			Private:       boolVal(item["private"]),
@@ -475,9 +733,11 @@ func (c *Client) giteaListRepos(page, perPage int, search string) ([]Repo, error
 			CloneURL:      str(item["clone_url"]),
 			HTMLURL:       str(item["html_url"]),
 			Owner:         str(owner["login"]),
+			Language:      str(item["language"]),
+			Topics:        strList(item["topics"]),
 		})
 	}
-	return repos, nil
+	return repos, hasNextLink(header), nil
 }
 
 func (c *Client) giteaListBranches(owner, repo string) ([]Branch, error) {
@@ -487,10 +747,7 @@ func (c *Client) giteaListBranches(owner, repo string) ([]Branch, error) {
 		return nil, err
 	}
 
-	ru := fmt.Sprintf("%s/api/v1/repos/%s/%s", c.GiteaURL, owner, repo)
-	var repoData map[string]interface{}
-	_ = c.get(ru, &repoData)
-	defaultBranch := str(repoData["default_branch"])
+	defaultBranch, _ := c.DefaultBranch(owner, repo)
 
 	var branches []Branch
 	for _, item := range items {
@@ -546,46 +803,98 @@ func (c *Client) giteaCreatePR(req PRRequest) (*PRResponse, error) {
 	}, nil
 }
 
-// --- Helpers ---
+func (c *Client) giteaGetPR(owner, repo string, number int) (*PRResponse, error) {
+	u := fmt.Sprintf("%s/api/v1/repos/%s/%s/pulls/%d", c.GiteaURL, owner, repo, number)
+	var resp map[string]interface{}
+	if err := c.get(u, &resp); err != nil {
+		return nil, err
+	}
+	return &PRResponse{
+		Number:  intVal(resp["number"]),
+		HTMLURL: str(resp["html_url"]),
+		Title:   str(resp["title"]),
+		State:   githubPRState(str(resp["state"]), boolVal(resp["merged"])),
+	}, nil
+}
 
-func (c *Client) get(u string, result interface{}) error {
-	req, err := http.NewRequest("GET", u, nil)
-	if err != nil {
-		return err
+func (c *Client) giteaListPRs(owner, repo, state string) ([]PRResponse, error) {
+	apiState := state
+	if state == PRStateMerged {
+		apiState = "closed"
 	}
-	req.Header.Set("Authorization", "Bearer "+c.AccessToken)
-	req.Header.Set("Accept", "application/json")
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
+	u := fmt.Sprintf("%s/api/v1/repos/%s/%s/pulls?state=%s&limit=50&sort=recentupdate", c.GiteaURL, owner, repo, apiState)
+	var items []map[string]interface{}
+	if err := c.get(u, &items); err != nil {
+		return nil, err
 	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode >= 400 {
-		return fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+	var prs []PRResponse
+	for _, item := range items {
+		prs = append(prs, PRResponse{
+			ID:      intVal(item["id"]),
+			Number:  intVal(item["number"]),
+			HTMLURL: str(item["html_url"]),
+			Title:   str(item["title"]),
+			State:   githubPRState(str(item["state"]), boolVal(item["merged"])),
+			Author:  str(mapVal(item["user"], "login")),
+			Head:    str(mapVal(item["head"], "ref")),
+			Base:    str(mapVal(item["base"], "ref")),
+		})
 	}
-	return json.Unmarshal(body, result)
+	return prs, nil
+}
+
+// --- Helpers ---
+
+func (c *Client) get(u string, result interface{}) error {
+	_, err := c.getWithHeader(u, result)
+	return err
+}
+
+// getWithHeader is get, also returning the response headers (for paging).
+func (c *Client) getWithHeader(u string, result interface{}) (http.Header, error) {
+	return c.do("GET", u, nil, result)
 }
 
 func (c *Client) post(u string, payload interface{}, result interface{}) error {
 	data, _ := json.Marshal(payload)
-	req, err := http.NewRequest("POST", u, bytes.NewReader(data))
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Authorization", "Bearer "+c.AccessToken)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode >= 400 {
-		return fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+	_, err := c.do("POST", u, data, result)
+	return err
+}
+
+// do sends a request, retrying rate limits and gateway errors (see
+// retryDelay), and decodes the JSON response into result.
+func (c *Client) do(method, u string, payload []byte, result interface{}) (http.Header, error) {
+	for attempt := 0; ; attempt++ {
+		var body io.Reader
+		if payload != nil {
+			body = bytes.NewReader(payload)
+		}
+		req, err := http.NewRequest(method, u, body)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+c.AccessToken)
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Accept", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode < 400 {
+			return resp.Header, json.Unmarshal(data, result)
+		}
+		if attempt < c.maxRetries() {
+			if wait, ok := c.retryDelay(resp, attempt); ok {
+				sleep(wait)
+				continue
+			}
+		}
+		return nil, fmt.Errorf("API error %d: %s", resp.StatusCode, string(data))
 	}
-	return json.Unmarshal(body, result)
 }
 
 func str(v interface{}) string {
@@ -612,6 +921,20 @@ func intVal(v interface{}) int {
 	return 0
 }
 
+// strList converts a JSON array of strings, returning nil when v isn't an
+// array (e.g. the field was absent).
+func strList(v interface{}) []string {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		list = append(list, str(item))
+	}
+	return list
+}
+
 func mapVal(v interface{}, keys ...string) interface{} {
 	current := v
 	for _, key := range keys {
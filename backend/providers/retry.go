@@ -0,0 +1,104 @@
+package providers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Retry defaults for a Client whose MaxRetries / RetryBaseDelay are zero.
+const (
+	DefaultMaxRetries     = 2
+	DefaultRetryBaseDelay = 500 * time.Millisecond
+)
+
+// maxRetryWait is the longest a rate-limited request waits for its reset.
+// Beyond that the error is returned rather than holding the request open.
+const maxRetryWait = 60 * time.Second
+
+// sleep is replaced in tests.
+var sleep = time.Sleep
+
+func (c *Client) maxRetries() int {
+	switch {
+	case c.MaxRetries < 0:
+		return 0
+	case c.MaxRetries == 0:
+		return DefaultMaxRetries
+	}
+	return c.MaxRetries
+}
+
+func (c *Client) retryBaseDelay() time.Duration {
+	if c.RetryBaseDelay <= 0 {
+		return DefaultRetryBaseDelay
+	}
+	return c.RetryBaseDelay
+}
+
+// retryDelay reports whether a response is worth retrying and how long to
+// wait first. Rate limits (429, or 403 with the limit exhausted) wait for
+// Retry-After or the X-RateLimit-Reset time when the provider sends one;
+// 502/503/504 and rate limits without a hint back off exponentially from the
+// base delay.
+func (c *Client) retryDelay(resp *http.Response, attempt int) (time.Duration, bool) {
+	backoff := c.retryBaseDelay() << attempt
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		if wait, ok := retryAfter(resp.Header); ok {
+			return wait, wait <= maxRetryWait
+		}
+		return backoff, true
+	case http.StatusTooManyRequests, http.StatusForbidden:
+		if wait, ok := retryAfter(resp.Header); ok {
+			return wait, wait <= maxRetryWait
+		}
+		if wait, ok := rateLimitReset(resp.Header); ok {
+			return wait, wait <= maxRetryWait
+		}
+		// A 403 without rate limit headers is a permission error
+		return backoff, resp.StatusCode == http.StatusTooManyRequests
+	}
+	return 0, false
+}
+
+// retryAfter parses a Retry-After header in seconds or as an HTTP date.
+func retryAfter(header http.Header) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return untilOrZero(at), true
+	}
+	return 0, false
+}
+
+// rateLimitReset reads the reset time of an exhausted rate limit: GitHub and
+// Gitea send X-RateLimit-Reset, GitLab RateLimit-Reset, both in Unix seconds.
+func rateLimitReset(header http.Header) (time.Duration, bool) {
+	remaining := header.Get("X-RateLimit-Remaining")
+	reset := header.Get("X-RateLimit-Reset")
+	if remaining == "" && reset == "" {
+		remaining = header.Get("RateLimit-Remaining")
+		reset = header.Get("RateLimit-Reset")
+	}
+	if remaining != "0" || reset == "" {
+		return 0, false
+	}
+	secs, err := strconv.ParseInt(reset, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return untilOrZero(time.Unix(secs, 0)), true
+}
+
+func untilOrZero(t time.Time) time.Duration {
+	if d := time.Until(t); d > 0 {
+		return d
+	}
+	return 0
+}
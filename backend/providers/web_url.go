@@ -0,0 +1,37 @@
+package providers
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// WebFileURL returns the link to view a file in the provider's web UI, or
+// "" for an unsupported provider. path is relative to the repo root.
+// Each path segment is escaped; slashes in owner (GitLab groups), branch and
+// path are kept as separators.
+func (c *Client) WebFileURL(owner, repo, branch, path string) string {
+	base := escapeSegments(owner) + "/" + url.PathEscape(repo)
+	ref := escapeSegments(branch)
+	file := escapeSegments(strings.TrimPrefix(path, "/"))
+
+	switch c.Provider {
+	case "github":
+		return fmt.Sprintf("https://github.com/%s/blob/%s/%s", base, ref, file)
+	case "gitlab":
+		return fmt.Sprintf("https://gitlab.com/%s/-/blob/%s/%s", base, ref, file)
+	case "bitbucket":
+		return fmt.Sprintf("https://bitbucket.org/%s/src/%s/%s", base, ref, file)
+	case "gitea":
+		return fmt.Sprintf("%s/%s/src/branch/%s/%s", strings.TrimRight(c.GiteaURL, "/"), base, ref, file)
+	}
+	return ""
+}
+
+func escapeSegments(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,20 @@
+package providers
+
+import "testing"
+
+func TestWebFileURL(t *testing.T) {
+	for _, tc := range []struct {
+		provider, want string
+	}{
+		{"github", "https://github.com/grp/sub/notes/blob/feature/x/docs/my%20file%231.md"},
+		{"gitlab", "https://gitlab.com/grp/sub/notes/-/blob/feature/x/docs/my%20file%231.md"},
+		{"bitbucket", "https://bitbucket.org/grp/sub/notes/src/feature/x/docs/my%20file%231.md"},
+		{"gitea", "https://git.example.com/grp/sub/notes/src/branch/feature/x/docs/my%20file%231.md"},
+		{"svn", ""},
+	} {
+		c := &Client{Provider: tc.provider, GiteaURL: "https://git.example.com/"}
+		if got := c.WebFileURL("grp/sub", "notes", "feature/x", "/docs/my file#1.md"); got != tc.want {
+			t.Errorf("%s: WebFileURL = %q, want %q", tc.provider, got, tc.want)
+		}
+	}
+}
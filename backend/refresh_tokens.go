@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"md-office-backend/validation"
+)
+
+// Access tokens are short-lived; clients renew them with the refresh token
+// returned by login and register.
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// Refresh tokens are opaque and single-use: each refresh replaces the token
+// it was given. refresh-tokens.json stores their SHA-256 hashes only.
+type refreshTokenRecord struct {
+	UserID    string    `json:"userId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+var refreshTokensMu sync.Mutex
+
+func refreshTokensPath() string {
+	return filepath.Join(configDir, "refresh-tokens.json")
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// updateRefreshTokens loads the stored tokens without expired ones, applies
+// fn and saves the result. Callers hold refreshTokensMu.
+func updateRefreshTokens(fn func(tokens map[string]refreshTokenRecord)) error {
+	tokens := map[string]refreshTokenRecord{}
+	if data, err := os.ReadFile(refreshTokensPath()); err == nil {
+		if err := json.Unmarshal(data, &tokens); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	now := time.Now()
+	for hash, rec := range tokens {
+		if rec.ExpiresAt.Before(now) {
+			delete(tokens, hash)
+		}
+	}
+	fn(tokens)
+
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(refreshTokensPath(), data, 0600)
+}
+
+func issueRefreshToken(userID string) (string, error) {
+	token := generateID() + generateID()
+
+	refreshTokensMu.Lock()
+	defer refreshTokensMu.Unlock()
+	err := updateRefreshTokens(func(tokens map[string]refreshTokenRecord) {
+		tokens[hashRefreshToken(token)] = refreshTokenRecord{UserID: userID, ExpiresAt: time.Now().Add(refreshTokenTTL)}
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeRefreshToken removes token and returns its user, or "" if it is
+// unknown or expired.
+func consumeRefreshToken(token string) (string, error) {
+	refreshTokensMu.Lock()
+	defer refreshTokensMu.Unlock()
+
+	var userID string
+	err := updateRefreshTokens(func(tokens map[string]refreshTokenRecord) {
+		hash := hashRefreshToken(token)
+		userID = tokens[hash].UserID
+		delete(tokens, hash)
+	})
+	return userID, err
+}
+
+// revokeRefreshToken removes token if it belongs to userID. It reports false,
+// leaving the token in place, when another user's token was given; unknown
+// and expired tokens count as revoked.
+func revokeRefreshToken(token, userID string) (bool, error) {
+	refreshTokensMu.Lock()
+	defer refreshTokensMu.Unlock()
+
+	owned := true
+	err := updateRefreshTokens(func(tokens map[string]refreshTokenRecord) {
+		hash := hashRefreshToken(token)
+		if rec, ok := tokens[hash]; ok && rec.UserID != userID {
+			owned = false
+			return
+		}
+		delete(tokens, hash)
+	})
+	return owned, err
+}
+
+// refreshAccessToken exchanges a refresh token for a new access token and a
+// new refresh token.
+func refreshAccessToken(c *fiber.Ctx) error {
+	var req RefreshRequest
+	if errs := validation.ParseBody(c, &req); errs != nil {
+		return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
+	}
+
+	userID, err := consumeRefreshToken(req.RefreshToken)
+	if err != nil {
+		return c.Status(500).JSON(APIResponse{Error: "Failed to load refresh tokens"})
+	}
+	if userID == "" {
+		return c.Status(401).JSON(APIResponse{Error: "Invalid refresh token"})
+	}
+
+	userStorage, err := loadUsers()
+	if err != nil {
+		return c.JSON(APIResponse{Error: "Failed to load user data"})
+	}
+	for _, user := range userStorage.Users {
+		if user.ID != userID {
+			continue
+		}
+		token, err := generateJWT(user.ID, user.Username)
+		if err != nil {
+			return c.JSON(APIResponse{Error: "Failed to generate token"})
+		}
+		refresh, err := issueRefreshToken(user.ID)
+		if err != nil {
+			return c.JSON(APIResponse{Error: "Failed to generate token"})
+		}
+		setAssetCookie(c, token)
+		return c.JSON(APIResponse{Data: AuthResponse{
+			Token:        token,
+			RefreshToken: refresh,
+			User:         SafeUser{ID: user.ID, Username: user.Username, CreatedAt: user.CreatedAt},
+		}})
+	}
+	return c.Status(401).JSON(APIResponse{Error: "Invalid refresh token"})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	useTestSessions(t)
+	app := authApp()
+	first, err := issueRefreshToken("u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, resp := doJSON(t, app, "POST", "/auth/refresh", RefreshRequest{RefreshToken: first})
+	if status != 200 {
+		t.Fatalf("refresh = %d %q", status, resp.Error)
+	}
+	pair, _ := resp.Data.(map[string]interface{})
+	access, _ := pair["token"].(string)
+	second, _ := pair["refreshToken"].(string)
+	if access == "" || second == "" || second == first {
+		t.Fatalf("refresh returned %v, want a new access and refresh token", pair)
+	}
+	if status, _ := doAuthed(t, app, "GET", "/me", access, nil); status != 200 {
+		t.Errorf("new access token = %d, want 200", status)
+	}
+
+	// replaying the used token fails; its replacement still works
+	if status, _ := doJSON(t, app, "POST", "/auth/refresh", RefreshRequest{RefreshToken: first}); status != 401 {
+		t.Errorf("replayed refresh token = %d, want 401", status)
+	}
+	if status, resp := doJSON(t, app, "POST", "/auth/refresh", RefreshRequest{RefreshToken: second}); status != 200 {
+		t.Errorf("rotated refresh token = %d %q, want 200", status, resp.Error)
+	}
+}
+
+func TestExpiredRefreshTokenRejected(t *testing.T) {
+	useTestSessions(t)
+	app := authApp()
+	token := "expired-token"
+	refreshTokensMu.Lock()
+	err := updateRefreshTokens(func(tokens map[string]refreshTokenRecord) {
+		tokens[hashRefreshToken(token)] = refreshTokenRecord{UserID: "u1", ExpiresAt: time.Now().Add(-time.Minute)}
+	})
+	refreshTokensMu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status, _ := doJSON(t, app, "POST", "/auth/refresh", RefreshRequest{RefreshToken: token}); status != 401 {
+		t.Errorf("expired refresh token = %d, want 401", status)
+	}
+	if status, _ := doJSON(t, app, "POST", "/auth/refresh", RefreshRequest{RefreshToken: "unknown"}); status != 401 {
+		t.Errorf("unknown refresh token = %d, want 401", status)
+	}
+}
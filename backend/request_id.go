@@ -0,0 +1,36 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Client-supplied request IDs are kept when they look like IDs, so a proxy
+// or caller can correlate its own logs; anything else is replaced.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestIDMiddleware gives every request an X-Request-ID, stored in Locals
+// as "requestID" and echoed in the response. Webhooks fired by the request
+// carry it, and the request's log line records it.
+func requestIDMiddleware(c *fiber.Ctx) error {
+	id := c.Get(fiber.HeaderXRequestID)
+	if !requestIDPattern.MatchString(id) {
+		id = generateID()
+	}
+	c.Locals("requestID", id)
+	c.Set(fiber.HeaderXRequestID, id)
+
+	start := time.Now()
+	err := c.Next()
+	status := c.Response().StatusCode()
+	if fe, ok := err.(*fiber.Error); ok {
+		status = fe.Code
+	}
+	userID, _ := c.Locals("userID").(string)
+	log.Printf("request_id=%s method=%s path=%q status=%d duration=%s user=%s",
+		id, c.Method(), c.Path(), status, time.Since(start).Round(time.Millisecond), userID)
+	return err
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"md-office-backend/webhooks"
+)
+
+// syncBuffer is a bytes.Buffer safe to log to from several goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRequestIDReachesLogsAndWebhooks(t *testing.T) {
+	newTestWorkspace(t, Workspace{Owner: "alice"}, nil)
+	var logs syncBuffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	type delivery struct {
+		header string
+		body   map[string]interface{}
+	}
+	deliveries := make(chan delivery, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		deliveries <- delivery{header: r.Header.Get("X-Request-ID"), body: body}
+	}))
+	t.Cleanup(srv.Close)
+	if err := webhooks.Init(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := webhooks.Create("alice", srv.URL, "", []string{eventFileCreated}, webhooks.RetryPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { webhooks.Delete(sub.ID, "alice") })
+
+	app := fiber.New()
+	app.Use(requestIDMiddleware)
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userID", "alice")
+		c.Locals("username", "alice")
+		return c.Next()
+	})
+	app.Post("/files", createFile)
+	create := func(path, requestID string) string {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/files", strings.NewReader(`{"path": "`+path+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if requestID != "" {
+			req.Header.Set("X-Request-ID", requestID)
+		}
+		res, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		if res.StatusCode != 200 {
+			t.Fatalf("create %s = %d", path, res.StatusCode)
+		}
+		return res.Header.Get("X-Request-ID")
+	}
+	checkTraced := func(id string) {
+		t.Helper()
+		select {
+		case d := <-deliveries:
+			if d.header != id || d.body["requestId"] != id {
+				t.Errorf("webhook carried %q (body %v), want %q", d.header, d.body["requestId"], id)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("webhook never delivered")
+		}
+		if !strings.Contains(logs.String(), "request_id="+id+" method=POST path=\"/files\" status=200") {
+			t.Errorf("no log line for %s in:\n%s", id, logs.String())
+		}
+	}
+
+	if id := create("a.md", "trace-123"); id != "trace-123" {
+		t.Errorf("response X-Request-ID = %q, want the caller's", id)
+	}
+	checkTraced("trace-123")
+
+	id := create("b.md", "")
+	if id == "" {
+		t.Fatal("no X-Request-ID generated")
+	}
+	checkTraced(id)
+
+	if id := create("c.md", "not an id\t"); id == "not an id\t" || id == "" {
+		t.Errorf("malformed X-Request-ID kept as %q", id)
+	}
+	<-deliveries
+
+	for deadline := time.Now().Add(2 * time.Second); len(webhooks.GetLogs("alice", 100)) < 3; {
+		if time.Now().After(deadline) {
+			t.Fatal("deliveries were never logged")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Tokens revoked by logout are kept in revoked-tokens.json until they would
+// have expired anyway, keyed by their jti (or a hash of the token for ones
+// issued without one). authMiddleware consults the in-memory copy.
+var (
+	revokedTokens   map[string]time.Time // key -> token expiry
+	revokedTokensMu sync.Mutex
+)
+
+func revokedTokensPath() string {
+	return filepath.Join(configDir, "revoked-tokens.json")
+}
+
+// revocationKey identifies a token in the revocation list.
+func revocationKey(claims *JWTClaims, raw string) string {
+	if claims.ID != "" {
+		return claims.ID
+	}
+	sum := sha256.Sum256([]byte(raw))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// loadRevokedTokens reads the list on first use. Callers hold revokedTokensMu.
+func loadRevokedTokens() {
+	if revokedTokens != nil {
+		return
+	}
+	revokedTokens = map[string]time.Time{}
+	if data, err := os.ReadFile(revokedTokensPath()); err == nil {
+		json.Unmarshal(data, &revokedTokens)
+	}
+}
+
+func isTokenRevoked(key string) bool {
+	revokedTokensMu.Lock()
+	defer revokedTokensMu.Unlock()
+	loadRevokedTokens()
+	_, ok := revokedTokens[key]
+	return ok
+}
+
+// revokeToken adds a token to the list and drops entries that have expired.
+func revokeToken(key string, expiry time.Time) error {
+	revokedTokensMu.Lock()
+	defer revokedTokensMu.Unlock()
+	loadRevokedTokens()
+
+	now := time.Now()
+	for k, exp := range revokedTokens {
+		if exp.Before(now) {
+			delete(revokedTokens, k)
+		}
+	}
+	revokedTokens[key] = expiry
+
+	data, err := json.MarshalIndent(revokedTokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(revokedTokensPath(), data, 0600)
+}
+
+// logout revokes the token the request was authenticated with, and the
+// refresh token if the body includes it.
+func logout(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if c.BodyParser(&req) == nil && req.RefreshToken != "" {
+		owned, err := revokeRefreshToken(req.RefreshToken, userID)
+		if err != nil {
+			return c.Status(500).JSON(APIResponse{Error: "Failed to revoke refresh token"})
+		}
+		if !owned {
+			return c.Status(403).JSON(APIResponse{Error: "Refresh token belongs to another user"})
+		}
+	}
+
+	key, _ := c.Locals("tokenKey").(string)
+	expiry, _ := c.Locals("tokenExpiry").(time.Time)
+	if expiry.IsZero() {
+		expiry = time.Now().Add(accessTokenTTL)
+	}
+	if err := revokeToken(key, expiry); err != nil {
+		return c.Status(500).JSON(APIResponse{Error: "Failed to revoke token"})
+	}
+	clearAssetCookie(c)
+	return c.JSON(APIResponse{Data: "Logged out"})
+}
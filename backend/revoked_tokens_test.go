@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// useTestSessions gives the test a fresh user store holding alice and bob,
+// and empty revocation and refresh token lists.
+func useTestSessions(t *testing.T) {
+	t.Helper()
+	useTestConfig(t)
+	revokedTokensMu.Lock()
+	old := revokedTokens
+	revokedTokens = nil
+	revokedTokensMu.Unlock()
+	t.Cleanup(func() {
+		revokedTokensMu.Lock()
+		revokedTokens = old
+		revokedTokensMu.Unlock()
+	})
+
+	users := UserStorage{Users: []User{
+		{ID: "u1", Username: "alice", CreatedAt: time.Now()},
+		{ID: "u2", Username: "bob", CreatedAt: time.Now()},
+	}}
+	if err := saveUsers(&users); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// authApp serves the session endpoints with the real auth middleware.
+func authApp() *fiber.App {
+	app := fiber.New()
+	app.Post("/auth/refresh", refreshAccessToken)
+	app.Post("/auth/logout", authMiddleware, logout)
+	app.Get("/me", authMiddleware, func(c *fiber.Ctx) error { return c.SendString(c.Locals("userID").(string)) })
+	return app
+}
+
+// doAuthed is doJSON with the request authenticated by token.
+func doAuthed(t *testing.T, app *fiber.App, method, url, token string, body interface{}) (int, APIResponse) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, url, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var out APIResponse
+	json.NewDecoder(res.Body).Decode(&out)
+	return res.StatusCode, out
+}
+
+func TestLogoutRevokesAccessAndRefreshTokens(t *testing.T) {
+	useTestSessions(t)
+	app := authApp()
+	access, err := generateJWT("u1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresh, err := issueRefreshToken("u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status, resp := doAuthed(t, app, "POST", "/auth/logout", access, RefreshRequest{RefreshToken: refresh}); status != 200 {
+		t.Fatalf("logout = %d %q", status, resp.Error)
+	}
+	if status, resp := doAuthed(t, app, "GET", "/me", access, nil); status != 401 {
+		t.Errorf("revoked access token = %d %q, want 401", status, resp.Error)
+	}
+	if status, resp := doJSON(t, app, "POST", "/auth/refresh", RefreshRequest{RefreshToken: refresh}); status != 401 {
+		t.Errorf("refresh after logout = %d %q, want 401", status, resp.Error)
+	}
+
+	// the revocation outlives the in-memory list
+	revokedTokensMu.Lock()
+	revokedTokens = nil
+	revokedTokensMu.Unlock()
+	if status, _ := doAuthed(t, app, "GET", "/me", access, nil); status != 401 {
+		t.Errorf("revoked access token after reload = %d, want 401", status)
+	}
+}
+
+func TestLogoutKeepsOtherUsersRefreshToken(t *testing.T) {
+	useTestSessions(t)
+	app := authApp()
+	bobs, err := generateJWT("u2", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alices, err := issueRefreshToken("u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status, _ := doAuthed(t, app, "POST", "/auth/logout", bobs, RefreshRequest{RefreshToken: alices}); status != 403 {
+		t.Errorf("logout with another user's refresh token = %d, want 403", status)
+	}
+	if status, resp := doJSON(t, app, "POST", "/auth/refresh", RefreshRequest{RefreshToken: alices}); status != 200 {
+		t.Errorf("alice's refresh = %d %q, want it still valid", status, resp.Error)
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	apiPkg "md-office-backend/api"
+	"md-office-backend/ignore"
+	"md-office-backend/storage"
+)
+
+// Files larger than this are not indexed (they are almost never prose)
+const maxIndexedFileSize = 5 << 20
+
+// searchIndex caches the text content of a workspace so searches don't
+// re-read the whole tree on every query. It is kept up to date by the file
+// handlers and rebuilt lazily after it has been invalidated (e.g. by a git
+// checkout or revert that rewrites the worktree behind our back).
+type searchIndex struct {
+	mu      sync.RWMutex
+	root    string
+	docs    map[string]*indexedDoc // storage.NameKey of the path -> doc
+	builtAt time.Time
+	stale   bool
+}
+
+type indexedDoc struct {
+	Path    string // workspace-relative path as it is on disk
+	Lines   []string
+	ModTime time.Time
+	Size    int64
+}
+
+// IndexStats describes the state of a workspace search index.
+type IndexStats struct {
+	Workspace string    `json:"workspace"`
+	Documents int       `json:"documents"`
+	LastBuilt time.Time `json:"lastBuilt"`
+}
+
+var (
+	searchIndexes   = make(map[string]*searchIndex) // workspace root -> index
+	searchIndexesMu sync.Mutex
+)
+
+// indexFor returns the search index for a workspace root, creating it on first use.
+func indexFor(root string) *searchIndex {
+	searchIndexesMu.Lock()
+	defer searchIndexesMu.Unlock()
+
+	idx, ok := searchIndexes[root]
+	if !ok {
+		idx = &searchIndex{root: root, stale: true}
+		searchIndexes[root] = idx
+	}
+	return idx
+}
+
+// warmSearchIndexes builds the index of every configured workspace in the
+// background, so the first search after startup doesn't pay for it.
+func warmSearchIndexes() {
+	config, err := loadWorkspaceConfigObject()
+	if err != nil {
+		log.Printf("Warning: search index warm-up failed: %v", err)
+		return
+	}
+	for _, ws := range config.Workspaces {
+		go indexFor(ws.Path).Rebuild()
+	}
+}
+
+// Rebuild re-reads every indexable file under the workspace root.
+func (idx *searchIndex) Rebuild() IndexStats {
+	docs := make(map[string]*indexedDoc)
+	filepath.Walk(idx.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // Continue on errors
+		}
+		if path != idx.root && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			// Walk doesn't follow links; index linked files only when
+			// they stay inside the workspace
+			if !storage.InspectLink(idx.root, path).Inside {
+				return nil
+			}
+			if info, err = os.Stat(path); err != nil || info.IsDir() {
+				return nil
+			}
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if doc := loadIndexedDoc(path, info); doc != nil {
+			doc.Path = idx.relPath(path)
+			docs[storage.NameKey(idx.root, doc.Path)] = doc
+		}
+		return nil
+	})
+
+	idx.mu.Lock()
+	idx.docs = docs
+	idx.builtAt = time.Now()
+	idx.stale = false
+	idx.mu.Unlock()
+
+	return idx.Stats()
+}
+
+// Invalidate marks the index stale so the next query rebuilds it.
+func (idx *searchIndex) Invalidate() {
+	idx.mu.Lock()
+	idx.stale = true
+	idx.mu.Unlock()
+}
+
+// Update re-indexes a file, or every file below a directory.
+func (idx *searchIndex) Update(relPath string) {
+	fullPath := filepath.Join(idx.root, relPath)
+	info, err := os.Stat(fullPath)
+	if err != nil || storage.CheckInRoot(idx.root, fullPath) != nil {
+		idx.Remove(relPath)
+		return
+	}
+
+	if info.IsDir() {
+		// Cheaper to rebuild lazily than to reconcile a whole subtree
+		idx.Invalidate()
+		return
+	}
+
+	doc := loadIndexedDoc(fullPath, info)
+	key := storage.NameKey(idx.root, relPath)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.docs == nil {
+		return // not built yet; the first query will pick the file up
+	}
+	if doc == nil {
+		delete(idx.docs, key)
+		return
+	}
+	doc.Path = filepath.Clean(relPath)
+	if old, ok := idx.docs[key]; ok {
+		doc.Path = old.Path // same file under another spelling; keep the on-disk one
+	}
+	idx.docs[key] = doc
+}
+
+// Remove drops a file, or every file below a directory, from the index.
+func (idx *searchIndex) Remove(relPath string) {
+	relPath = storage.NameKey(idx.root, relPath)
+	prefix := relPath + string(filepath.Separator)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for p := range idx.docs {
+		if p == relPath || strings.HasPrefix(p, prefix) {
+			delete(idx.docs, p)
+		}
+	}
+}
+
+// Stats returns the current document count and build time.
+func (idx *searchIndex) Stats() IndexStats {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return IndexStats{
+		Workspace: idx.root,
+		Documents: len(idx.docs),
+		LastBuilt: idx.builtAt,
+	}
+}
+
+// Search returns the files in which matcher finds query, in path order,
+// limited to limit results, with context lines around each match. Paths
+// matched by ignored, or rejected by a non-nil visible, are skipped.
+func (idx *searchIndex) Search(query string, matcher *searchMatcher, fileType string, limit, context int, ignored *ignore.Matcher, visible func(string) bool) []SearchResult {
+	idx.mu.RLock()
+	stale := idx.stale
+	idx.mu.RUnlock()
+	if stale {
+		idx.Rebuild()
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	docs := make([]*indexedDoc, 0, len(idx.docs))
+	for _, doc := range idx.docs {
+		docs = append(docs, doc)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Path < docs[j].Path })
+
+	var results []SearchResult
+	for _, doc := range docs {
+		p := doc.Path
+		if fileType != "" && strings.TrimPrefix(filepath.Ext(p), ".") != fileType {
+			continue
+		}
+		if ignored.Match(p, false) || (visible != nil && !visible(p)) {
+			continue
+		}
+		matches, score := searchInLines(doc.Lines, query, matcher)
+		if len(matches) == 0 {
+			continue
+		}
+		addSearchContext(matches, doc.Lines, context)
+		results = append(results, SearchResult{
+			File:    p,
+			Matches: matches,
+			Score:   score,
+		})
+		if len(results) >= limit {
+			break
+		}
+	}
+	return results
+}
+
+// Files lists every indexed file, in path order, marking those whose
+// content contains the lowercase query.
+func (idx *searchIndex) Files(query string) []apiPkg.IndexedFile {
+	idx.mu.RLock()
+	stale := idx.stale
+	idx.mu.RUnlock()
+	if stale {
+		idx.Rebuild()
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	files := make([]apiPkg.IndexedFile, 0, len(idx.docs))
+	for _, doc := range idx.docs {
+		f := apiPkg.IndexedFile{Path: doc.Path, ModTime: doc.ModTime, Size: doc.Size}
+		for _, line := range doc.Lines {
+			if strings.Contains(strings.ToLower(line), query) {
+				f.ContentMatch = true
+				break
+			}
+		}
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+// SearchSuggestion is a document whose title matches a type-ahead query.
+type SearchSuggestion struct {
+	Path  string  `json:"path"`
+	Title string  `json:"title"`
+	Score float64 `json:"score"`
+}
+
+// Suggest matches query against document titles and paths only, never
+// content, so it stays cheap enough to run on every keystroke. Title
+// prefixes rank first, then word prefixes, then substrings of the path.
+// Filtering works as in Search.
+func (idx *searchIndex) Suggest(query string, limit int, ignored *ignore.Matcher, visible func(string) bool) []SearchSuggestion {
+	idx.mu.RLock()
+	stale := idx.stale
+	idx.mu.RUnlock()
+	if stale {
+		idx.Rebuild()
+	}
+
+	q := strings.ToLower(strings.TrimSpace(query))
+	suggestions := []SearchSuggestion{}
+	if q == "" {
+		return suggestions
+	}
+
+	idx.mu.RLock()
+	for _, doc := range idx.docs {
+		title := docTitle(doc.Path)
+		score := suggestScore(strings.ToLower(title), strings.ToLower(doc.Path), q)
+		if score == 0 || ignored.Match(doc.Path, false) || (visible != nil && !visible(doc.Path)) {
+			continue
+		}
+		suggestions = append(suggestions, SearchSuggestion{Path: doc.Path, Title: title, Score: score})
+	}
+	idx.mu.RUnlock()
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if len(a.Title) != len(b.Title) {
+			return len(a.Title) < len(b.Title) // closer to the query
+		}
+		return a.Path < b.Path
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+func suggestScore(title, path, q string) float64 {
+	switch {
+	case title == q:
+		return 1
+	case strings.HasPrefix(title, q):
+		return 0.9
+	}
+	for _, word := range strings.FieldsFunc(title, func(r rune) bool {
+		return r == ' ' || r == '-' || r == '_' || r == '.'
+	}) {
+		if strings.HasPrefix(word, q) {
+			return 0.7
+		}
+	}
+	switch {
+	case strings.Contains(title, q):
+		return 0.5
+	case strings.Contains(path, q):
+		return 0.3
+	}
+	return 0
+}
+
+// docTitle is a file's name without its document extension
+func docTitle(path string) string {
+	name := filepath.Base(path)
+	for _, ext := range []string{".sheet.json", ".slides.json", ".db.json"} {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// Referencing returns the indexed files, in path order, whose content
+// contains any of needles.
+func (idx *searchIndex) Referencing(needles ...string) []string {
+	idx.mu.RLock()
+	stale := idx.stale
+	idx.mu.RUnlock()
+	if stale {
+		idx.Rebuild()
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var files []string
+	for _, doc := range idx.docs {
+	lines:
+		for _, line := range doc.Lines {
+			for _, needle := range needles {
+				if strings.Contains(line, needle) {
+					files = append(files, doc.Path)
+					break lines
+				}
+			}
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+func (idx *searchIndex) relPath(fullPath string) string {
+	rel, err := filepath.Rel(idx.root, fullPath)
+	if err != nil {
+		return fullPath
+	}
+	return rel
+}
+
+func loadIndexedDoc(fullPath string, info os.FileInfo) *indexedDoc {
+	if !isTextFile(fullPath) || info.Size() > maxIndexedFileSize {
+		return nil
+	}
+	content, err := storage.ReadFile(fullPath)
+	if err != nil {
+		return nil
+	}
+	return &indexedDoc{
+		Lines:   strings.Split(string(content), "\n"),
+		ModTime: info.ModTime(),
+		Size:    int64(len(content)),
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// searchHits returns the files a search for q matches, sorted
+func searchHits(t *testing.T, app *fiber.App, q string) []string {
+	t.Helper()
+	status, resp := doJSON(t, app, "GET", "/search?q="+q, nil)
+	if status != 200 || resp.Error != "" {
+		t.Fatalf("search %q: %d %s", q, status, resp.Error)
+	}
+	var files []string
+	results, _ := resp.Data.(map[string]interface{})["results"].([]interface{})
+	for _, r := range results {
+		files = append(files, r.(map[string]interface{})["file"].(string))
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestReindexPicksUpExternalChanges(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "alice", Permissions: map[string]string{"bob": "viewer"}}, map[string]string{
+		"fruit.md": "apples and pears",
+		"veg.md":   "leeks",
+	})
+	t.Cleanup(func() { indexFor(ws.Path).Invalidate() })
+	user := "alice"
+	app := newTestApp(&user)
+	app.Get("/search", searchFiles)
+	app.Post("/search/reindex", reindexSearch)
+
+	if got := searchHits(t, app, "apples"); len(got) != 1 || got[0] != "fruit.md" {
+		t.Fatalf("search apples = %v", got)
+	}
+
+	// Edited behind the server's back, as a git pull would
+	writeTestFiles(t, ws.Path, map[string]string{
+		"fruit.md":     "bananas and pears",
+		"notes/new.md": "more bananas",
+	})
+
+	user = "bob"
+	if _, resp := doJSON(t, app, "POST", "/search/reindex", nil); resp.Error == "" {
+		t.Error("a viewer rebuilt the index")
+	}
+	user = "alice"
+	status, resp := doJSON(t, app, "POST", "/search/reindex", nil)
+	if status != 200 || resp.Error != "" {
+		t.Fatalf("reindex: %d %s", status, resp.Error)
+	}
+	if n := resp.Data.(map[string]interface{})["documents"]; n != float64(3) {
+		t.Errorf("reindexed %v documents, want 3", n)
+	}
+
+	if got := searchHits(t, app, "bananas"); len(got) != 2 || got[0] != "fruit.md" || got[1] != "notes/new.md" {
+		t.Errorf("search bananas = %v, want fruit.md and notes/new.md", got)
+	}
+	if got := searchHits(t, app, "apples"); len(got) != 0 {
+		t.Errorf("search apples after the edit = %v, want nothing", got)
+	}
+}
+
+func TestSuggestFiles(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "alice"}, map[string]string{
+		"planning.md":       "x",
+		"plan.md":           "x",
+		"q3 plan-notes.md":  "x",
+		"explanation.md":    "x",
+		"plans/x.md":        "x",
+		"other.md":          "plan is only in the content",
+		"budget.sheet.json": "{}",
+	})
+	t.Cleanup(func() { indexFor(ws.Path).Invalidate() })
+	user := "alice"
+	app := newTestApp(&user)
+	app.Get("/search/suggest", suggestFiles)
+	suggest := func(query string) []string {
+		t.Helper()
+		_, resp := doJSON(t, app, "GET", "/search/suggest?"+query, nil)
+		if resp.Error != "" {
+			t.Fatalf("suggest %s: %s", query, resp.Error)
+		}
+		var paths []string
+		for _, s := range resp.Data.([]interface{}) {
+			paths = append(paths, s.(map[string]interface{})["path"].(string))
+		}
+		return paths
+	}
+
+	want := []string{"plan.md", "planning.md", "q3 plan-notes.md", "explanation.md", filepath.Join("plans", "x.md")}
+	if got := suggest("q=Plan"); !reflect.DeepEqual(got, want) {
+		t.Errorf("suggestions for Plan = %v, want %v", got, want)
+	}
+	if got := suggest("q=budg"); !reflect.DeepEqual(got, []string{"budget.sheet.json"}) {
+		t.Errorf("suggestions for budg = %v", got)
+	}
+	if got := suggest("q=plan&limit=2"); !reflect.DeepEqual(got, want[:2]) {
+		t.Errorf("suggestions for plan with limit=2 = %v", got)
+	}
+	if got := suggest("q=+"); len(got) != 0 {
+		t.Errorf("suggestions for a blank query = %v", got)
+	}
+
+	for i := 0; i < 30; i++ {
+		writeTestFiles(t, ws.Path, map[string]string{fmt.Sprintf("plan %02d.md", i): "x"})
+	}
+	indexFor(ws.Path).Invalidate()
+	if got := suggest("q=plan"); len(got) != defaultSuggestLimit || got[0] != "plan.md" {
+		t.Errorf("%d default suggestions starting %v, want %d", len(got), got, defaultSuggestLimit)
+	}
+	if got := suggest("q=plan&limit=100"); len(got) != maxSuggestLimit {
+		t.Errorf("%d suggestions with limit=100, want at most %d", len(got), maxSuggestLimit)
+	}
+}
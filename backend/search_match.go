@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// searchMatcher finds a query in a line of text. Plain queries match as
+// case-insensitive substrings; ?regex=, ?word= and ?case= refine that.
+type searchMatcher struct {
+	query string
+	re    *regexp.Regexp // nil for plain substring matching
+	fold  bool           // compare case-insensitively
+}
+
+// newSearchMatcher builds the matcher for query. With regex the query is a
+// Go regular expression, with word it must start and end on word boundaries,
+// and with caseSensitive letters must match exactly.
+func newSearchMatcher(query string, regex, word, caseSensitive bool) (*searchMatcher, error) {
+	m := &searchMatcher{query: query, fold: !caseSensitive}
+	if !regex && !word {
+		if m.fold {
+			m.query = strings.ToLower(query)
+		}
+		return m, nil
+	}
+
+	pattern := query
+	if !regex {
+		pattern = regexp.QuoteMeta(query)
+	}
+	if word {
+		pattern = `\b(?:` + pattern + `)\b`
+	}
+	if m.fold {
+		pattern = `(?i)` + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	var syntaxErr *syntax.Error
+	if errors.As(err, &syntaxErr) {
+		return nil, fmt.Errorf("invalid regular expression: %s: `%s`", syntaxErr.Code, syntaxErr.Expr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %v", err)
+	}
+	m.re = re
+	return m, nil
+}
+
+// find returns the byte offsets of the first match in line.
+func (m *searchMatcher) find(line string) (start, end int, ok bool) {
+	if m.re != nil {
+		for _, loc := range m.re.FindAllStringIndex(line, -1) {
+			if loc[0] < loc[1] { // empty matches highlight nothing
+				return loc[0], loc[1], true
+			}
+		}
+		return 0, 0, false
+	}
+	if m.fold {
+		line = strings.ToLower(line)
+	}
+	start = strings.Index(line, m.query)
+	if start < 0 {
+		return 0, 0, false
+	}
+	return start, start + len(m.query), true
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Lifetime of signed download URLs (override per request with ?ttl=seconds)
+const (
+	defaultSignedURLTTL = 15 * time.Minute
+	maxSignedURLTTL     = 24 * time.Hour
+)
+
+// signedURLClaims is the payload of a signed download token. The signature
+// covers the workspace, the single path and the expiry.
+type signedURLClaims struct {
+	Workspace string `json:"w"`
+	Path      string `json:"p"`
+	Expires   int64  `json:"e"`
+}
+
+type SignedURLResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func signDownload(claims signedURLClaims) (string, error) {
+	return signToken("signed-url", claims)
+}
+
+// verifyDownload checks a token's signature and expiry and returns its claims
+func verifyDownload(token string) (*signedURLClaims, error) {
+	var claims signedURLClaims
+	if err := verifyToken("signed-url", token, &claims); err != nil {
+		return nil, err
+	}
+	if time.Now().Unix() > claims.Expires {
+		return nil, fmt.Errorf("link expired")
+	}
+	return &claims, nil
+}
+
+func signFileURL(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	ws, err := checkWorkspacePermission(userID, "viewer")
+	if err != nil {
+		return c.Status(403).JSON(APIResponse{Error: err.Error()})
+	}
+
+	path := c.Query("path")
+	if path == "" {
+		return c.Status(400).JSON(APIResponse{Error: "Path is required"})
+	}
+
+	// Security check
+	fullPath, err := resolveWithinWorkspace(ws, path)
+	if err != nil || !pathAllowed(ws, userID, path, false) {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+	}
+
+	info, err := os.Stat(fullPath)
+	if err != nil || info.IsDir() {
+		return c.Status(404).JSON(APIResponse{Error: "File not found"})
+	}
+
+	ttl := defaultSignedURLTTL
+	if secs := c.QueryInt("ttl"); secs > 0 {
+		ttl = time.Duration(secs) * time.Second
+		if ttl > maxSignedURLTTL {
+			ttl = maxSignedURLTTL
+		}
+	}
+	expiresAt := time.Now().Add(ttl)
+
+	rel, _ := filepath.Rel(ws.Path, fullPath)
+	token, err := signDownload(signedURLClaims{
+		Workspace: ws.ID,
+		Path:      filepath.ToSlash(rel),
+		Expires:   expiresAt.Unix(),
+	})
+	if err != nil {
+		return c.Status(500).JSON(APIResponse{Error: err.Error()})
+	}
+
+	return c.JSON(APIResponse{Data: SignedURLResponse{
+		URL:       "/api/files/signed/" + token,
+		ExpiresAt: expiresAt,
+	}})
+}
+
+// getSignedFile serves a file named by a signed token. It is mounted
+// outside the auth middleware: the token is the credential.
+func getSignedFile(c *fiber.Ctx) error {
+	claims, err := verifyDownload(c.Params("token"))
+	if err != nil {
+		return c.Status(403).JSON(APIResponse{Error: err.Error()})
+	}
+
+	config, err := loadWorkspaceConfigObject()
+	if err != nil {
+		return c.Status(500).JSON(APIResponse{Error: "Failed to load workspace config"})
+	}
+	var ws *Workspace
+	for i := range config.Workspaces {
+		if config.Workspaces[i].ID == claims.Workspace {
+			ws = &config.Workspaces[i]
+			break
+		}
+	}
+	if ws == nil {
+		return c.Status(404).JSON(APIResponse{Error: "File not found"})
+	}
+
+	// Security check
+	fullPath, err := resolveWithinWorkspace(ws, claims.Path)
+	if err != nil {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+	}
+
+	info, err := os.Stat(fullPath)
+	if err != nil || info.IsDir() {
+		return c.Status(404).JSON(APIResponse{Error: "File not found"})
+	}
+
+	return sendStoredFile(c, fullPath)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignedURLs(t *testing.T) {
+	newTestWorkspace(t, Workspace{Owner: "alice"}, map[string]string{
+		"images/logo.png": "logo bytes",
+		"notes.md":        "private notes",
+	})
+	user := "alice"
+	app := newTestApp(&user)
+	app.Post("/files/sign", signFileURL)
+	app.Get("/files/signed/:token", getSignedFile)
+
+	status, resp := doJSON(t, app, "POST", "/files/sign?path=images/logo.png", nil)
+	if status != 200 || resp.Error != "" {
+		t.Fatalf("sign: %d %s", status, resp.Error)
+	}
+	url := resp.Data.(map[string]interface{})["url"].(string)
+	token := strings.TrimPrefix(url, "/api/files/signed/")
+
+	get := func(token string) (int, string) {
+		t.Helper()
+		res, err := app.Test(httptest.NewRequest("GET", "/files/signed/"+token, nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(body)
+	}
+
+	if status, body := get(token); status != 200 || body != "logo bytes" {
+		t.Errorf("valid token: got %d %q", status, body)
+	}
+
+	expired, err := signDownload(signedURLClaims{Workspace: "ws", Path: "images/logo.png", Expires: time.Now().Add(-time.Second).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := get(expired); status != 403 {
+		t.Errorf("expired token: got %d, want 403", status)
+	}
+
+	// The signature of logo.png's token on a payload naming notes.md
+	other, err := signDownload(signedURLClaims{Workspace: "ws", Path: "notes.md", Expires: time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _, _ := strings.Cut(other, ".")
+	_, sig, _ := strings.Cut(token, ".")
+	if status, body := get(payload + "." + sig); status != 403 || strings.Contains(body, "private notes") {
+		t.Errorf("tampered path: got %d %q, want 403", status, body)
+	}
+
+	if status, _ := get("not-a-token"); status != 403 {
+		t.Errorf("malformed token: got %d, want 403", status)
+	}
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Writers that check a file's version before replacing or removing it (the
+// web UI's BaseHash, batches and the REST API's If-Match) hold the file's
+// lock across the check and the write, so two writers holding the same
+// version can't both succeed. Locks are per file and taken always, whether
+// or not the request carries a version.
+
+var (
+	pathLocks   = map[string]*pathLock{}
+	pathLocksMu sync.Mutex
+)
+
+type pathLock struct {
+	mu   sync.Mutex
+	refs int // holders and waiters; the entry is dropped at zero
+}
+
+// LockPath locks the file at fullPath and returns the function that
+// unlocks it.
+func LockPath(fullPath string) (unlock func()) {
+	return LockPaths([]string{fullPath})
+}
+
+// LockPaths locks several files at once, in a fixed order so that callers
+// locking overlapping sets can't deadlock, and returns the function that
+// unlocks them all.
+func LockPaths(fullPaths []string) (unlock func()) {
+	keys := make([]string, 0, len(fullPaths))
+	seen := map[string]bool{}
+	for _, p := range fullPaths {
+		key := filepath.Clean(p)
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	locks := make([]*pathLock, len(keys))
+	pathLocksMu.Lock()
+	for i, key := range keys {
+		l, ok := pathLocks[key]
+		if !ok {
+			l = &pathLock{}
+			pathLocks[key] = l
+		}
+		l.refs++
+		locks[i] = l
+	}
+	pathLocksMu.Unlock()
+
+	for _, l := range locks {
+		l.mu.Lock()
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			pathLocksMu.Lock()
+			defer pathLocksMu.Unlock()
+			for i, l := range locks {
+				l.mu.Unlock()
+				if l.refs--; l.refs == 0 {
+					delete(pathLocks, keys[i])
+				}
+			}
+		})
+	}
+}
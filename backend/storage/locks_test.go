@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockPathsExcludesOverlappingHolders(t *testing.T) {
+	unlock := LockPaths([]string{"/ws/b.md", "/ws/a.md"})
+
+	acquired := make(chan struct{})
+	go func() {
+		defer LockPath("/ws/./a.md")()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("a.md was locked twice")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Other files stay available
+	LockPath("/ws/c.md")()
+
+	unlock()
+	unlock() // unlocking twice is harmless
+	<-acquired
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer LockPaths([]string{"/ws/a.md", "/ws/b.md"})()
+		}()
+	}
+	wg.Wait()
+	pathLocksMu.Lock()
+	defer pathLocksMu.Unlock()
+	if len(pathLocks) != 0 {
+		t.Errorf("%d lock entries left after every holder unlocked", len(pathLocks))
+	}
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Names of documents and folders are normalized before they reach the disk
+// so the same title always maps to the same path: Unicode NFC (macOS hands
+// out NFD, browsers mostly send NFC), no leading or trailing whitespace, and
+// runs of whitespace collapsed to one space.
+
+// NormalizeName normalizes a single file or folder name.
+func NormalizeName(name string) string {
+	return strings.Join(strings.Fields(norm.NFC.String(name)), " ")
+}
+
+// NormalizePath normalizes every segment of a slash- or separator-separated
+// relative path. Empty segments are dropped.
+func NormalizePath(path string) string {
+	segments := strings.FieldsFunc(filepath.ToSlash(path), func(r rune) bool { return r == '/' })
+	for i, s := range segments {
+		segments[i] = NormalizeName(s)
+	}
+	return filepath.Join(segments...)
+}
+
+// CollisionError reports an existing entry that a new name would be
+// indistinguishable from.
+type CollisionError struct {
+	Path     string // requested workspace-relative path
+	Existing string // path that is already on disk
+}
+
+func (e *CollisionError) Error() string {
+	return fmt.Sprintf("%s conflicts with existing %s", e.Path, e.Existing)
+}
+
+// FindCollision walks relPath below root and returns a *CollisionError if a
+// segment matches an existing entry that differs only in Unicode
+// normalization, or only in case when foldCase is set. Entries with the
+// exact same name are not collisions.
+func FindCollision(root, relPath string, foldCase bool) error {
+	dir := root
+	segments := strings.FieldsFunc(filepath.ToSlash(relPath), func(r rune) bool { return r == '/' })
+	for i, segment := range segments {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil // the rest of the path doesn't exist yet
+		}
+		want := norm.NFC.String(segment)
+		exact := false
+		for _, entry := range entries {
+			if entry.Name() == segment {
+				exact = true
+				break
+			}
+		}
+		if !exact {
+			for _, entry := range entries {
+				have := norm.NFC.String(entry.Name())
+				if have == want || (foldCase && strings.EqualFold(have, want)) {
+					existing := append(append([]string{}, segments[:i]...), entry.Name())
+					return &CollisionError{Path: relPath, Existing: filepath.Join(existing...)}
+				}
+			}
+			return nil
+		}
+		dir = filepath.Join(dir, segment)
+	}
+	return nil
+}
+
+// nameFolding records how a filesystem compares names
+type nameFolding struct {
+	Case          bool // "a" and "A" are the same name
+	Normalization bool // NFC and NFD spellings are the same name
+}
+
+var foldings sync.Map // dir -> nameFolding
+
+// probeFolding finds out how the filesystem holding dir compares names by
+// creating a temporary file and looking it up under other spellings. The
+// answer is cached per directory.
+func probeFolding(dir string) nameFolding {
+	if v, ok := foldings.Load(dir); ok {
+		return v.(nameFolding)
+	}
+	f, err := os.CreateTemp(dir, ".name-probe-\u00e9-")
+	if err != nil {
+		return nameFolding{}
+	}
+	name := f.Name()
+	f.Close()
+	defer os.Remove(name)
+
+	base := filepath.Base(name)
+	_, errCase := os.Stat(filepath.Join(dir, strings.ToUpper(base)))
+	_, errNorm := os.Stat(filepath.Join(dir, norm.NFD.String(base)))
+	folding := nameFolding{Case: errCase == nil, Normalization: errNorm == nil}
+	foldings.Store(dir, folding)
+	return folding
+}
+
+// CaseInsensitive reports whether the filesystem holding dir treats names
+// that differ only by case as the same file.
+func CaseInsensitive(dir string) bool {
+	return probeFolding(dir).Case
+}
+
+// NameKey returns the key under which the filesystem holding root compares
+// relPath, so two spellings of one file get the same key and two distinct
+// files never do.
+func NameKey(root, relPath string) string {
+	key := filepath.Clean(relPath)
+	folding := probeFolding(root)
+	if folding.Normalization {
+		key = norm.NFC.String(key)
+	}
+	if folding.Case {
+		key = strings.ToLower(key)
+	}
+	return key
+}
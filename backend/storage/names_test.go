@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestNormalizeName(t *testing.T) {
+	nfd := norm.NFD.String("Café")
+	if nfd == "Café" {
+		t.Fatal("test string is not decomposed")
+	}
+	for in, want := range map[string]string{
+		nfd:                "Café",
+		"  Plan  ":         "Plan",
+		"weekly \t  notes": "weekly notes",
+		"   ":              "",
+	} {
+		if got := NormalizeName(in); got != want {
+			t.Errorf("NormalizeName(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := NormalizePath("docs// " + nfd + "  /a  b.md"); got != filepath.Join("docs", "Café", "a b.md") {
+		t.Errorf("NormalizePath = %q", got)
+	}
+}
+
+func TestFindCollision(t *testing.T) {
+	root := t.TempDir()
+	nfd := norm.NFD.String("Café")
+	if err := os.MkdirAll(filepath.Join(root, nfd), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "Notes.md"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if CaseInsensitive(root) {
+		t.Skip("filesystem ignores case; the case-sensitive cases don't apply")
+	}
+
+	var collision *CollisionError
+	if err := FindCollision(root, filepath.Join("Café", "a.md"), false); !errors.As(err, &collision) || collision.Existing != nfd {
+		t.Errorf("NFC spelling of an NFD folder: %v, want a collision with it", err)
+	}
+	if err := FindCollision(root, filepath.Join(nfd, "a.md"), false); err != nil {
+		t.Errorf("exact spelling: %v", err)
+	}
+	if err := FindCollision(root, "notes.md", false); err != nil {
+		t.Errorf("case-only difference without folding: %v", err)
+	}
+	if err := FindCollision(root, "notes.md", true); !errors.As(err, &collision) || collision.Existing != "Notes.md" {
+		t.Errorf("case-only difference with folding: %v, want a collision with Notes.md", err)
+	}
+	if err := FindCollision(root, filepath.Join("new", "notes.md"), true); err != nil {
+		t.Errorf("path in a new folder: %v", err)
+	}
+}
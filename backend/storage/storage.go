@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Default minimum size before a document is compressed at rest
+const DefaultCompressMinBytes = 64 << 10
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Compressible reports whether a path is a text document that may be stored
+// gzip-compressed. Binary assets are always stored (and served) as-is.
+func Compressible(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".txt", ".json":
+		return true
+	}
+	return false
+}
+
+// IsCompressed reports whether data starts with the gzip magic bytes.
+// Plain-text documents never start with these control characters.
+func IsCompressed(data []byte) bool {
+	return bytes.HasPrefix(data, gzipMagic)
+}
+
+// Decode returns the logical content of a stored document, decompressing it
+// if it was written compressed.
+func Decode(path string, data []byte) ([]byte, error) {
+	if !Compressible(path) || !IsCompressed(data) {
+		return data, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// Encode gzip-compresses content.
+func Encode(content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(content); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ReadFile reads a document and returns its logical (decompressed) content.
+func ReadFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(path, data)
+}
+
+// WriteFile writes a document, compressing it when compress is true and the
+// path is a compressible document type.
+func WriteFile(path string, content []byte, compress bool, perm os.FileMode) error {
+	if compress && Compressible(path) {
+		encoded, err := Encode(content)
+		if err != nil {
+			return err
+		}
+		content = encoded
+	}
+	return writeAtomic(path, content, perm)
+}
+
+// writeAtomic replaces the file at path with content by writing a temporary
+// file next to it, syncing it and renaming it over the original, so a crash
+// or a concurrent reader never sees a partly written file. An existing
+// file's mode is kept, and a symlink is written through to its target.
+func writeAtomic(path string, content []byte, perm os.FileMode) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	// Hidden, so a temporary file left by a crash stays out of listings
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // fails harmlessly once renamed
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	// Persist the rename itself; not every platform can sync a directory
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// Size returns the logical (decompressed) size of a stored document without
+// reading it. For compressed documents it uses the gzip ISIZE trailer, which
+// is exact for documents under 4 GiB.
+func Size(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	if !Compressible(path) || info.Size() < 18 {
+		return info.Size(), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	head := make([]byte, len(gzipMagic))
+	if _, err := io.ReadFull(f, head); err != nil || !IsCompressed(head) {
+		return info.Size(), nil
+	}
+	trailer := make([]byte, 4)
+	if _, err := f.ReadAt(trailer, info.Size()-4); err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint32(trailer)), nil
+}
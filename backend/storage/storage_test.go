@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileCompression(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("# Notes\n\nplain text\n")
+	tests := []struct {
+		name     string
+		compress bool
+		want     bool // stored compressed
+	}{
+		{"doc.md", true, true},
+		{"plain.md", false, false},
+		{"image.png", true, false}, // assets are never compressed
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := WriteFile(path, content, tt.compress, 0644); err != nil {
+			t.Fatal(err)
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if IsCompressed(raw) != tt.want {
+			t.Errorf("%s: stored compressed = %v, want %v", tt.name, IsCompressed(raw), tt.want)
+		}
+		got, err := ReadFile(path)
+		if err != nil || string(got) != string(content) {
+			t.Errorf("%s: ReadFile = %q, %v", tt.name, got, err)
+		}
+		if size, err := Size(path); err != nil || size != int64(len(content)) {
+			t.Errorf("%s: Size = %d, %v; want %d", tt.name, size, err, len(content))
+		}
+	}
+}
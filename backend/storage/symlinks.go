@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Symlink policy, shared by the file tree, search and document listings:
+//
+//   - Symlinked directories are never descended into, so a link can't list a
+//     folder twice or loop. They're shown as symlinked directories without
+//     children; the target is listed at its real location.
+//   - Symlinked files are followed only when the target is inside the
+//     workspace. Links that point outside it (or nowhere) are left out of
+//     listings and search, and their content is never read or served.
+
+// ErrLinkOutside is returned for paths that resolve outside the workspace
+// through a symlink.
+var ErrLinkOutside = errors.New("path resolves outside the workspace")
+
+// ErrOutsideRoot is returned for relative paths that climb out of the
+// workspace with "..".
+var ErrOutsideRoot = errors.New("path is outside the workspace")
+
+// LinkInfo describes a symlink found while walking a workspace.
+type LinkInfo struct {
+	IsDir  bool // the target is a directory
+	Inside bool // the target exists and is inside the workspace
+}
+
+// InspectLink resolves the symlink at path and reports where it points
+// relative to root.
+func InspectLink(root, path string) LinkInfo {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return LinkInfo{}
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return LinkInfo{}
+	}
+	return LinkInfo{IsDir: info.IsDir(), Inside: within(realRoot(root), target)}
+}
+
+// CheckInRoot returns ErrLinkOutside if any existing symlink on fullPath
+// makes it resolve outside root. Paths that don't exist yet are checked up
+// to their deepest existing parent.
+func CheckInRoot(root, fullPath string) error {
+	resolved, err := resolveExisting(fullPath)
+	if err != nil {
+		return err
+	}
+	if !within(realRoot(root), resolved) {
+		return ErrLinkOutside
+	}
+	return nil
+}
+
+// ResolveInRoot joins the workspace-relative rel onto root and returns the
+// full path. It fails if the result is not root or below it, whether through
+// ".." or an existing symlink; a sibling such as root+"-evil" doesn't count
+// as inside.
+func ResolveInRoot(root, rel string) (string, error) {
+	root = filepath.Clean(root)
+	full := filepath.Join(root, filepath.FromSlash(rel))
+	if !within(root, full) {
+		return "", ErrOutsideRoot
+	}
+	if err := CheckInRoot(root, full); err != nil {
+		return "", err
+	}
+	return full, nil
+}
+
+// RealRel returns the workspace-relative rel with its existing symlinks
+// resolved, in slash form, so a link can't be used to reach a path under a
+// different name. It fails like ResolveInRoot for paths outside root.
+func RealRel(root, rel string) (string, error) {
+	full, err := ResolveInRoot(root, rel)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := resolveExisting(full)
+	if err != nil {
+		return "", err
+	}
+	real, err := filepath.Rel(realRoot(root), resolved)
+	if err != nil {
+		return "", ErrLinkOutside
+	}
+	if real == "." {
+		return "", nil
+	}
+	return filepath.ToSlash(real), nil
+}
+
+func realRoot(root string) string {
+	if r, err := filepath.EvalSymlinks(root); err == nil {
+		return r
+	}
+	return filepath.Clean(root)
+}
+
+// resolveExisting evaluates symlinks on the longest existing prefix of path
+// and appends the remaining (not yet created) components.
+func resolveExisting(path string) (string, error) {
+	path = filepath.Clean(path)
+	var rest []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", ErrLinkOutside
+		}
+		if fi, lerr := os.Lstat(path); lerr == nil && fi.Mode()&os.ModeSymlink != 0 {
+			// Dangling link: writing through it would create its target
+			return "", ErrLinkOutside
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		rest = append([]string{filepath.Base(path)}, rest...)
+		path = parent
+	}
+}
+
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
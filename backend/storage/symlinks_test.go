@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveInRoot(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "ws")
+	evil := root + "-evil"
+	for _, dir := range []string{root, evil} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(evil, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		rel  string
+		want string
+		err  error
+	}{
+		{rel: "a.md", want: filepath.Join(root, "a.md")},
+		{rel: "dir/../a.md", want: filepath.Join(root, "a.md")},
+		{rel: "", want: root},
+		// Absolute paths are taken as relative to the root, as with Join
+		{rel: "/etc/passwd", want: filepath.Join(root, "etc", "passwd")},
+		{rel: "..", err: ErrOutsideRoot},
+		{rel: "../ws-evil/x", err: ErrOutsideRoot},
+		{rel: "a/../../ws-evil/x", err: ErrOutsideRoot},
+		{rel: "link/x", err: ErrLinkOutside},
+	}
+	for _, tt := range tests {
+		full, err := ResolveInRoot(root, tt.rel)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("ResolveInRoot(%q) = %q, %v; want error %v", tt.rel, full, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || full != tt.want {
+			t.Errorf("ResolveInRoot(%q) = %q, %v; want %q", tt.rel, full, err, tt.want)
+		}
+	}
+}
+
+// linkLayout makes a workspace with links pointing inside it, outside it and
+// nowhere, and returns the workspace root.
+func linkLayout(t *testing.T) string {
+	t.Helper()
+	root, outside := t.TempDir(), t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(root, "docs", "a.md"), []byte("inside"), 0644)
+	os.WriteFile(filepath.Join(outside, "secret.md"), []byte("outside"), 0644)
+	for link, target := range map[string]string{
+		"in.md":       filepath.Join(root, "docs", "a.md"),
+		"docs-link":   filepath.Join(root, "docs"),
+		"out.md":      filepath.Join(outside, "secret.md"),
+		"outdir":      outside,
+		"dangling.md": filepath.Join(outside, "missing.md"),
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skip("symlinks not supported:", err)
+		}
+	}
+	return root
+}
+
+func TestInspectLink(t *testing.T) {
+	root := linkLayout(t)
+	for link, want := range map[string]LinkInfo{
+		"in.md":       {Inside: true},
+		"docs-link":   {IsDir: true, Inside: true},
+		"out.md":      {},
+		"outdir":      {},
+		"dangling.md": {},
+	} {
+		if got := InspectLink(root, filepath.Join(root, link)); got.Inside != want.Inside || (want.Inside && got.IsDir != want.IsDir) {
+			t.Errorf("InspectLink(%s) = %+v, want %+v", link, got, want)
+		}
+	}
+}
+
+func TestCheckInRoot(t *testing.T) {
+	root := linkLayout(t)
+	for rel, want := range map[string]error{
+		"in.md":           nil,
+		"docs-link/a.md":  nil,
+		"new/dir/file.md": nil,
+		"out.md":          ErrLinkOutside,
+		"outdir/new.md":   ErrLinkOutside,
+		"dangling.md":     ErrLinkOutside,
+	} {
+		if err := CheckInRoot(root, filepath.Join(root, rel)); !errors.Is(err, want) && err != want {
+			t.Errorf("CheckInRoot(%s) = %v, want %v", rel, err, want)
+		}
+	}
+}
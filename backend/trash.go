@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	apiPkg "md-office-backend/api"
+	"md-office-backend/storage"
+	"md-office-backend/validation"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Deleted files and folders are moved into the workspace's apiPkg.TrashDir
+// rather than removed, since git history can't bring back files that were
+// never committed. Each item lives at .trash/<id>/<name> next to a
+// .trash/<id>.json record of where it came from. The folder ignores itself
+// in git, so trashed files are never committed.
+
+// TrashItem is a deleted file or folder that can still be restored.
+type TrashItem struct {
+	ID          string    `json:"id"`
+	Path        string    `json:"path"` // where it was deleted from
+	IsDirectory bool      `json:"isDirectory"`
+	DeletedAt   time.Time `json:"deletedAt"`
+	DeletedBy   string    `json:"deletedBy"`
+}
+
+type RestoreTrashRequest struct {
+	ID string `json:"id" validate:"required,max=64"`
+	// Where to restore to instead of the original path, e.g. when a new
+	// file has taken its place
+	Path string `json:"path,omitempty" validate:"max=1024"`
+}
+
+func trashRoot(ws *Workspace) string {
+	return filepath.Join(ws.Path, apiPkg.TrashDir)
+}
+
+var errTrashPath = errors.New("path is in the trash")
+
+// inTrash reports whether a workspace-relative path is the trash or below it.
+// The name is compared case-insensitively for case-folding filesystems.
+func inTrash(relPath string) bool {
+	top := strings.SplitN(cleanACLPath(relPath), "/", 2)[0]
+	return strings.EqualFold(top, apiPkg.TrashDir)
+}
+
+// moveToTrash moves the item at relPath (resolved to fullPath) into the
+// trash and returns its record.
+func moveToTrash(ws *Workspace, relPath, fullPath, username string) (*TrashItem, error) {
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	root := trashRoot(ws)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	gitignore := filepath.Join(root, ".gitignore")
+	if _, err := os.Stat(gitignore); os.IsNotExist(err) {
+		if err := ioutil.WriteFile(gitignore, []byte("*\n"), 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	item := &TrashItem{
+		ID:          generateID(),
+		Path:        filepath.Clean(relPath),
+		IsDirectory: info.IsDir(),
+		DeletedAt:   time.Now(),
+		DeletedBy:   username,
+	}
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(root, item.ID)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(fullPath, filepath.Join(dir, filepath.Base(fullPath))); err != nil {
+		os.Remove(dir)
+		return nil, err
+	}
+	if err := ioutil.WriteFile(dir+".json", data, 0644); err != nil {
+		// Without its record the item can't be listed; put it back
+		os.Rename(filepath.Join(dir, filepath.Base(fullPath)), fullPath)
+		os.Remove(dir)
+		return nil, err
+	}
+	return item, nil
+}
+
+// trashItems returns the workspace's trash, most recently deleted first.
+// Records whose item is gone are skipped.
+func trashItems(ws *Workspace) ([]TrashItem, error) {
+	root := trashRoot(ws)
+	entries, err := ioutil.ReadDir(root)
+	if os.IsNotExist(err) {
+		return []TrashItem{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items := []TrashItem{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		item, err := readTrashItem(ws, strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			continue
+		}
+		items = append(items, *item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].DeletedAt.After(items[j].DeletedAt) })
+	return items, nil
+}
+
+func readTrashItem(ws *Workspace, id string) (*TrashItem, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return nil, os.ErrNotExist
+	}
+	data, err := ioutil.ReadFile(filepath.Join(trashRoot(ws), id+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var item TrashItem
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, err
+	}
+	if _, err := os.Lstat(trashedPath(ws, &item)); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// trashedPath is where a trash item's content is stored
+func trashedPath(ws *Workspace, item *TrashItem) string {
+	return filepath.Join(trashRoot(ws), item.ID, filepath.Base(item.Path))
+}
+
+// purgeTrashItem removes a trash item and its record for good
+func purgeTrashItem(ws *Workspace, item *TrashItem) error {
+	if err := os.RemoveAll(filepath.Join(trashRoot(ws), item.ID)); err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(trashRoot(ws), item.ID+".json"))
+}
+
+// listTrash returns the deleted items the caller may read.
+func listTrash(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	ws, err := checkWorkspacePermission(userID, "viewer")
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	items, err := trashItems(ws)
+	if err != nil {
+		return c.Status(500).JSON(APIResponse{Error: err.Error()})
+	}
+	visible := []TrashItem{}
+	for _, item := range items {
+		if pathAllowed(ws, userID, item.Path, false) {
+			visible = append(visible, item)
+		}
+	}
+	return c.JSON(APIResponse{Data: visible})
+}
+
+// restoreTrash moves a trash item back to where it was deleted from, or to
+// the request's path, and commits it.
+func restoreTrash(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	ws, err := checkWorkspacePermission(userID, "editor")
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	var req RestoreTrashRequest
+	if errs := validation.ParseBody(c, &req); errs != nil {
+		return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
+	}
+
+	item, err := readTrashItem(ws, req.ID)
+	if err != nil {
+		return c.Status(404).JSON(APIResponse{Error: "Trash item not found"})
+	}
+
+	target := item.Path
+	if req.Path != "" {
+		target = storage.NormalizePath(req.Path)
+	}
+	fullPath, err := resolveWithinWorkspace(ws, target)
+	if err != nil || inTrash(target) || !pathAllowed(ws, userID, item.Path, true) || !pathAllowed(ws, userID, target, true) {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+	}
+	if _, err := os.Lstat(fullPath); err == nil {
+		return c.Status(409).JSON(APIResponse{Error: fmt.Sprintf("%s already exists; restore it to another path", filepath.ToSlash(target))})
+	}
+	if err := nameCollision(ws, target); err != nil {
+		return collisionResponse(c, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+	if err := os.Rename(trashedPath(ws, item), fullPath); err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+	if err := purgeTrashItem(ws, item); err != nil {
+		log.Printf("Failed to remove trash record %s: %v", item.ID, err)
+	}
+	indexFor(ws.Path).Update(target)
+
+	fireWorkspaceEvent(c, ws, eventFileCreated, map[string]interface{}{"path": target})
+
+	username := c.Locals("username").(string)
+	if err := commitAndNotify(c, ws, fmt.Sprintf("Restore %s", target), username); err != nil {
+		log.Printf("Failed to commit changes: %v", err)
+	}
+
+	item.Path = target
+	return c.JSON(APIResponse{Data: item})
+}
+
+// emptyTrash permanently deletes the trash items the caller may write, or
+// only the one given by ?id=.
+func emptyTrash(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	ws, err := checkWorkspacePermission(userID, "editor")
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	var items []TrashItem
+	if id := c.Query("id"); id != "" {
+		item, err := readTrashItem(ws, id)
+		if err != nil {
+			return c.Status(404).JSON(APIResponse{Error: "Trash item not found"})
+		}
+		if !pathAllowed(ws, userID, item.Path, true) {
+			return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+		}
+		items = []TrashItem{*item}
+	} else if items, err = trashItems(ws); err != nil {
+		return c.Status(500).JSON(APIResponse{Error: err.Error()})
+	}
+
+	purged := 0
+	for i := range items {
+		if !pathAllowed(ws, userID, items[i].Path, true) {
+			continue
+		}
+		if err := purgeTrashItem(ws, &items[i]); err != nil {
+			return c.Status(500).JSON(APIResponse{Error: err.Error()})
+		}
+		purged++
+	}
+	return c.JSON(APIResponse{Data: fiber.Map{"deleted": purged}})
+}
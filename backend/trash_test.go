@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInTrash(t *testing.T) {
+	for path, want := range map[string]bool{
+		".trash":              true,
+		".trash/abc/a.md":     true,
+		"/.trash/abc/a.md":    true,
+		"docs/../.trash/a.md": true,
+		".Trash/abc/a.md":     true,
+		".trashy/a.md":        false,
+		"docs/.trash/a.md":    false,
+	} {
+		if got := inTrash(path); got != want {
+			t.Errorf("inTrash(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestTrashedFilesOnlyThroughTrashEndpoints(t *testing.T) {
+	ws := hrWorkspace(t)
+	item, err := moveToTrash(ws, "hr/salaries.md", filepath.Join(ws.Path, "hr", "salaries.md"), "owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trashed := ".trash/" + item.ID + "/salaries.md"
+
+	user := "bob"
+	app := newTestApp(&user)
+	app.Get("/files/trash", listTrash)
+	app.Get("/files/raw/*", getRawFile)
+	app.Get("/files/:path", getFile)
+	app.Post("/files", saveFile)
+	app.Post("/files/batch", batchFiles)
+	app.Delete("/files/:path", deleteItem)
+	app.Put("/files/rename", renameItem)
+
+	requests := []struct {
+		method, url string
+		body        interface{}
+	}{
+		{"GET", "/files/.trash", nil},
+		{"GET", "/files/raw/" + trashed, nil},
+		{"POST", "/files", SaveFileRequest{Path: trashed, Content: "changed"}},
+		{"PUT", "/files/rename", RenameRequest{OldPath: ".trash/" + item.ID, NewPath: "x"}},
+		{"PUT", "/files/rename", RenameRequest{OldPath: "readme.md", NewPath: ".trash/readme.md"}},
+	}
+	for _, r := range requests {
+		if status, resp := doJSON(t, app, r.method, r.url, r.body); status != 403 {
+			t.Errorf("%s %s %+v = %d %q, want 403", r.method, r.url, r.body, status, resp.Error)
+		}
+	}
+	if status, _ := doJSON(t, app, "DELETE", "/files/"+url.PathEscape(trashed), nil); status != 400 {
+		t.Errorf("deleting from the trash = %d, want 400", status)
+	}
+	if status, _ := doJSON(t, app, "POST", "/files/batch", BatchRequest{
+		Atomic:     true,
+		Operations: []BatchOperation{{Op: "save", Path: trashed, Content: "changed"}},
+	}); status != 409 {
+		t.Errorf("batch save into the trash = %d, want 409", status)
+	}
+	if _, resp := doJSON(t, app, "GET", "/files/trash", nil); len(resp.Data.([]interface{})) != 0 {
+		t.Errorf("bob's trash listing = %v, want the restricted item hidden", resp.Data)
+	}
+
+	if data, err := os.ReadFile(filepath.Join(ws.Path, filepath.FromSlash(trashed))); err != nil || string(data) != "secret salaries" {
+		t.Errorf("trashed file = %q, %v; want it untouched", data, err)
+	}
+}
+
+func TestPermanentDeleteOwnerOnly(t *testing.T) {
+	ws := hrWorkspace(t)
+	user := "bob"
+	app := newTestApp(&user)
+	app.Delete("/files/trash", emptyTrash)
+	app.Delete("/files/:path", deleteItem)
+
+	if status, resp := doJSON(t, app, "DELETE", "/files/readme.md?permanent=true", nil); status != 403 {
+		t.Errorf("bob: permanent delete = %d %q, want 403", status, resp.Error)
+	}
+	if _, err := os.Stat(filepath.Join(ws.Path, "readme.md")); err != nil {
+		t.Fatalf("readme.md after a denied permanent delete: %v", err)
+	}
+
+	// an editor deletes to the trash and may purge from there
+	if status, resp := doJSON(t, app, "DELETE", "/files/readme.md", nil); status != 200 {
+		t.Fatalf("bob: delete = %d %q", status, resp.Error)
+	}
+	items, err := trashItems(ws)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("trash = %v, %v; want readme.md", items, err)
+	}
+	if status, resp := doJSON(t, app, "DELETE", "/files/trash?id="+items[0].ID, nil); status != 200 {
+		t.Errorf("bob: purge from the trash = %d %q, want 200", status, resp.Error)
+	}
+	if _, err := os.Stat(trashedPath(ws, &items[0])); !os.IsNotExist(err) {
+		t.Errorf("purged item still in the trash: %v", err)
+	}
+
+	user = "owner"
+	if status, resp := doJSON(t, app, "DELETE", "/files/budget.md?permanent=true", nil); status != 200 {
+		t.Errorf("owner: permanent delete = %d %q, want 200", status, resp.Error)
+	}
+	if _, err := os.Stat(filepath.Join(ws.Path, "budget.md")); !os.IsNotExist(err) {
+		t.Errorf("budget.md after a permanent delete: %v", err)
+	}
+	if items, _ := trashItems(ws); len(items) != 0 {
+		t.Errorf("trash = %v, want the permanent delete to skip it", items)
+	}
+}
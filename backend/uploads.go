@@ -0,0 +1,347 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"md-office-backend/validation"
+)
+
+// Resumable uploads let clients send a large file in chunks and pick up
+// where they left off after a dropped connection. Chunks are appended to a
+// temp file under configDir/uploads and only moved into the workspace (and
+// committed) on completion. Each chunk must fit the server's request body
+// limit (4 MB by default).
+const (
+	maxResumableUploadSize = 2 << 30
+	resumableUploadTTL     = 24 * time.Hour
+)
+
+type InitUploadRequest struct {
+	Filename string `json:"filename" validate:"required,max=255"`
+	Dir      string `json:"dir" validate:"max=1024"`
+	Size     int64  `json:"size"`
+}
+
+type resumableUpload struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"-"`
+	WorkspaceID string    `json:"-"`
+	Filename    string    `json:"filename"`
+	Dir         string    `json:"dir"`
+	Size        int64     `json:"size"`
+	Offset      int64     `json:"offset"` // bytes received so far
+	UpdatedAt   time.Time `json:"updatedAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+
+	mu sync.Mutex // serializes chunks and completion
+}
+
+var (
+	resumableUploads   = map[string]*resumableUpload{}
+	resumableUploadsMu sync.Mutex
+	uploadJanitorOnce  sync.Once
+)
+
+func resumableUploadDir() string {
+	return filepath.Join(configDir, "uploads")
+}
+
+func (u *resumableUpload) partPath() string {
+	return filepath.Join(resumableUploadDir(), u.ID+".part")
+}
+
+func (u *resumableUpload) touch() {
+	u.UpdatedAt = time.Now()
+	u.ExpiresAt = u.UpdatedAt.Add(resumableUploadTTL)
+}
+
+// startUploadJanitor removes uploads that haven't received data within
+// resumableUploadTTL.
+func startUploadJanitor() {
+	uploadJanitorOnce.Do(func() {
+		go func() {
+			for range time.Tick(10 * time.Minute) {
+				expireResumableUploads(time.Now())
+			}
+		}()
+	})
+}
+
+func expireResumableUploads(now time.Time) {
+	resumableUploadsMu.Lock()
+	defer resumableUploadsMu.Unlock()
+
+	for id, u := range resumableUploads {
+		u.mu.Lock()
+		expired := now.After(u.ExpiresAt)
+		u.mu.Unlock()
+		if expired {
+			os.Remove(u.partPath())
+			delete(resumableUploads, id)
+		}
+	}
+}
+
+// lookupUpload returns the caller's upload, or nil if it doesn't exist, has
+// expired, or belongs to someone else.
+func lookupUpload(c *fiber.Ctx) *resumableUpload {
+	userID := c.Locals("userID").(string)
+
+	resumableUploadsMu.Lock()
+	defer resumableUploadsMu.Unlock()
+
+	u, ok := resumableUploads[c.Params("id")]
+	if !ok || u.UserID != userID {
+		return nil
+	}
+	return u
+}
+
+func initResumableUpload(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	ws, err := checkWorkspacePermission(userID, "editor")
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	var req InitUploadRequest
+	if errs := validation.ParseBody(c, &req); errs != nil {
+		return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
+	}
+	if req.Size <= 0 || req.Size > maxResumableUploadSize {
+		return c.Status(400).JSON(APIResponse{Error: fmt.Sprintf("size must be between 1 and %d bytes", int64(maxResumableUploadSize))})
+	}
+	if req.Dir == "" {
+		req.Dir = "assets"
+	}
+	// Fail early on a bad directory rather than after the whole upload
+	if _, err := resolveUploadDir(ws.Path, req.Dir); err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+	if !pathAllowed(ws, userID, req.Dir, true) {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+	}
+
+	if err := os.MkdirAll(resumableUploadDir(), 0755); err != nil {
+		return c.JSON(APIResponse{Error: "Failed to create upload directory"})
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return c.JSON(APIResponse{Error: "Failed to create upload"})
+	}
+	u := &resumableUpload{
+		ID:          hex.EncodeToString(idBytes),
+		UserID:      userID,
+		WorkspaceID: ws.ID,
+		Filename:    req.Filename,
+		Dir:         req.Dir,
+		Size:        req.Size,
+	}
+	u.touch()
+
+	f, err := os.OpenFile(u.partPath(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return c.JSON(APIResponse{Error: "Failed to create upload"})
+	}
+	f.Close()
+
+	resumableUploadsMu.Lock()
+	resumableUploads[u.ID] = u
+	resumableUploadsMu.Unlock()
+	startUploadJanitor()
+
+	return c.JSON(APIResponse{Data: u})
+}
+
+// getResumableUpload reports how many bytes have been received, so a client
+// can resume after an interruption.
+func getResumableUpload(c *fiber.Ctx) error {
+	u := lookupUpload(c)
+	if u == nil {
+		return c.Status(404).JSON(APIResponse{Error: "Upload not found"})
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return c.JSON(APIResponse{Data: u})
+}
+
+// appendResumableUpload writes the request body at ?offset=, which must
+// equal the bytes received so far. Anything else would leave a gap or
+// overwrite data and is rejected with the current offset.
+func appendResumableUpload(c *fiber.Ctx) error {
+	u := lookupUpload(c)
+	if u == nil {
+		return c.Status(404).JSON(APIResponse{Error: "Upload not found"})
+	}
+
+	offset, err := parseOffset(c.Query("offset"))
+	if err != nil {
+		return c.Status(400).JSON(APIResponse{Error: err.Error()})
+	}
+	chunk := c.Body()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if offset != u.Offset {
+		return c.Status(409).JSON(APIResponse{
+			Error: fmt.Sprintf("offset %d does not match received size %d", offset, u.Offset),
+			Data:  u,
+		})
+	}
+	if u.Offset+int64(len(chunk)) > u.Size {
+		return c.Status(400).JSON(APIResponse{Error: "chunk exceeds declared upload size"})
+	}
+
+	f, err := os.OpenFile(u.partPath(), os.O_WRONLY, 0644)
+	if err != nil {
+		return c.Status(404).JSON(APIResponse{Error: "Upload not found"})
+	}
+	n, err := f.WriteAt(chunk, offset)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		// Roll back a partial write so the chunk can be resent at the same offset
+		os.Truncate(u.partPath(), u.Offset)
+		return c.JSON(APIResponse{Error: "Failed to write chunk"})
+	}
+
+	u.Offset += int64(n)
+	u.touch()
+	return c.JSON(APIResponse{Data: u})
+}
+
+func parseOffset(s string) (int64, error) {
+	offset, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("offset must be a non-negative integer")
+	}
+	return offset, nil
+}
+
+// completeResumableUpload checks the upload is whole, moves it into the
+// workspace it was started in, and commits it.
+func completeResumableUpload(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	u := lookupUpload(c)
+	if u == nil {
+		return c.Status(404).JSON(APIResponse{Error: "Upload not found"})
+	}
+
+	ws, err := checkWorkspacePermission(userID, "editor")
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if ws.ID != u.WorkspaceID {
+		return c.Status(409).JSON(APIResponse{Error: "Upload was started in a different workspace"})
+	}
+	info, err := os.Stat(u.partPath())
+	if err != nil {
+		return c.Status(404).JSON(APIResponse{Error: "Upload not found"})
+	}
+	if u.Offset != u.Size || info.Size() != u.Size {
+		return c.Status(409).JSON(APIResponse{
+			Error: fmt.Sprintf("upload incomplete: received %d of %d bytes", u.Offset, u.Size),
+			Data:  u,
+		})
+	}
+
+	uploadPath, err := resolveUploadDir(ws.Path, u.Dir)
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+	if !pathAllowed(ws, userID, u.Dir, true) {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied"})
+	}
+	if err := os.MkdirAll(uploadPath, 0755); err != nil {
+		return c.JSON(APIResponse{Error: "Failed to create upload directory"})
+	}
+
+	filePath := uniqueUploadPath(uploadPath, u.Filename)
+	if err := moveFile(u.partPath(), filePath); err != nil {
+		return c.JSON(APIResponse{Error: "Failed to save file"})
+	}
+
+	resumableUploadsMu.Lock()
+	delete(resumableUploads, u.ID)
+	resumableUploadsMu.Unlock()
+
+	relativePath := strings.TrimPrefix(filePath, ws.Path)
+	relativePath = strings.TrimPrefix(relativePath, string(filepath.Separator))
+	indexFor(ws.Path).Update(relativePath)
+
+	username := c.Locals("username").(string)
+	commitMessage := fmt.Sprintf("Upload file: %s", relativePath)
+	if err := commitChangesWithAuthor(repoForWorkspace(ws), commitMessage, username); err != nil {
+		log.Printf("Failed to commit file upload: %v", err)
+	}
+
+	return c.JSON(APIResponse{Data: newUploadResponse(relativePath, u.Size)})
+}
+
+func abortResumableUpload(c *fiber.Ctx) error {
+	u := lookupUpload(c)
+	if u == nil {
+		return c.Status(404).JSON(APIResponse{Error: "Upload not found"})
+	}
+
+	resumableUploadsMu.Lock()
+	delete(resumableUploads, u.ID)
+	resumableUploadsMu.Unlock()
+
+	u.mu.Lock()
+	os.Remove(u.partPath())
+	u.mu.Unlock()
+
+	return c.JSON(APIResponse{Data: "Upload aborted"})
+}
+
+// moveFile renames src to dst, copying when they're on different
+// filesystems (configDir and the workspace often are in containers).
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// putChunk sends chunk as the raw body of PUT /files/upload/:id?offset=.
+func putChunk(t *testing.T, app *fiber.App, id string, offset int, chunk string) (int, APIResponse) {
+	t.Helper()
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/files/upload/%s?offset=%d", id, offset), bytes.NewReader([]byte(chunk)))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out APIResponse
+	data, _ := io.ReadAll(resp.Body)
+	json.Unmarshal(data, &out)
+	return resp.StatusCode, out
+}
+
+func newUploadTestApp(user *string) *fiber.App {
+	app := newTestApp(user)
+	app.Post("/files/upload/init", initResumableUpload)
+	app.Get("/files/upload/:id", getResumableUpload)
+	app.Put("/files/upload/:id", appendResumableUpload)
+	app.Post("/files/upload/:id/complete", completeResumableUpload)
+	return app
+}
+
+func TestResumableUpload(t *testing.T) {
+	ws := newTestWorkspace(t, Workspace{Owner: "alice"}, nil)
+	user := "alice"
+	app := newUploadTestApp(&user)
+
+	content := "first half|second half"
+	first, second := content[:11], content[11:]
+	_, resp := doJSON(t, app, "POST", "/files/upload/init", InitUploadRequest{Filename: "video.bin", Dir: "media", Size: int64(len(content))})
+	if resp.Error != "" {
+		t.Fatalf("init: %s", resp.Error)
+	}
+	id := resp.Data.(map[string]interface{})["id"].(string)
+
+	if status, resp := putChunk(t, app, id, 0, first); status != 200 || resp.Error != "" {
+		t.Fatalf("first chunk: %d %s", status, resp.Error)
+	}
+	if status, _ := doJSON(t, app, "POST", "/files/upload/"+id+"/complete", nil); status != 409 {
+		t.Errorf("completing a partial upload = %d, want 409", status)
+	}
+
+	// The connection drops; the client asks where to resume from
+	_, resp = doJSON(t, app, "GET", "/files/upload/"+id, nil)
+	offset := int(resp.Data.(map[string]interface{})["offset"].(float64))
+	if offset != len(first) {
+		t.Fatalf("resume offset = %d, want %d", offset, len(first))
+	}
+	if status, _ := putChunk(t, app, id, 0, first); status != 409 {
+		t.Errorf("resending at offset 0 = %d, want 409", status)
+	}
+	if status, _ := putChunk(t, app, id, offset+1, second); status != 409 {
+		t.Errorf("chunk leaving a gap = %d, want 409", status)
+	}
+	if status, _ := putChunk(t, app, id, offset, second+"extra"); status != 400 {
+		t.Errorf("chunk past the declared size = %d, want 400", status)
+	}
+	if status, resp := putChunk(t, app, id, offset, second); status != 200 || resp.Error != "" {
+		t.Fatalf("second chunk: %d %s", status, resp.Error)
+	}
+
+	user = "bob"
+	if status, _ := doJSON(t, app, "POST", "/files/upload/"+id+"/complete", nil); status != 404 {
+		t.Errorf("another user completing the upload = %d, want 404", status)
+	}
+	user = "alice"
+	status, resp := doJSON(t, app, "POST", "/files/upload/"+id+"/complete", nil)
+	if status != 200 || resp.Error != "" {
+		t.Fatalf("complete: %d %s", status, resp.Error)
+	}
+	if got, err := os.ReadFile(filepath.Join(ws.Path, "media", "video.bin")); err != nil || string(got) != content {
+		t.Errorf("uploaded file = %q, %v; want %q", got, err, content)
+	}
+	head, err := repoForWorkspace(ws).Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repoForWorkspace(ws).CommitObject(head.Hash())
+	if err != nil || commit.Message != "Upload file: "+filepath.Join("media", "video.bin") {
+		t.Errorf("last commit = %v, %v; want the upload", commit, err)
+	}
+	if status, _ := doJSON(t, app, "GET", "/files/upload/"+id, nil); status != 404 {
+		t.Errorf("completed upload still listed: %d", status)
+	}
+}
+
+func TestAbandonedUploadsExpire(t *testing.T) {
+	newTestWorkspace(t, Workspace{Owner: "alice"}, nil)
+	user := "alice"
+	app := newUploadTestApp(&user)
+
+	_, resp := doJSON(t, app, "POST", "/files/upload/init", InitUploadRequest{Filename: "a.bin", Size: 10})
+	id := resp.Data.(map[string]interface{})["id"].(string)
+	putChunk(t, app, id, 0, "12345")
+	part := filepath.Join(resumableUploadDir(), id+".part")
+	if _, err := os.Stat(part); err != nil {
+		t.Fatal(err)
+	}
+
+	expireResumableUploads(time.Now())
+	if status, _ := doJSON(t, app, "GET", "/files/upload/"+id, nil); status != 200 {
+		t.Errorf("fresh upload expired: %d", status)
+	}
+	expireResumableUploads(time.Now().Add(resumableUploadTTL + time.Minute))
+	if status, _ := doJSON(t, app, "GET", "/files/upload/"+id, nil); status != 404 {
+		t.Errorf("abandoned upload = %d, want 404", status)
+	}
+	if _, err := os.Stat(part); !os.IsNotExist(err) {
+		t.Errorf("abandoned upload's data left behind: %v", err)
+	}
+}
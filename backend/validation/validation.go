@@ -0,0 +1,154 @@
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// FieldError describes a single invalid field in a request body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"` // required, format, min, max, oneof
+	Message string `json:"message"`
+}
+
+// Errors is a list of field-level validation failures.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ParseBody decodes the request body into req and validates it.
+// Returns nil when the body is well-formed and every field passes its rules.
+func ParseBody(c *fiber.Ctx, req interface{}) Errors {
+	if err := c.BodyParser(req); err != nil {
+		return Errors{{Field: "body", Rule: "format", Message: "Invalid request body"}}
+	}
+	return Struct(req)
+}
+
+// Struct validates a struct (or pointer to struct) against its `validate` tags.
+//
+// Supported rules, comma separated:
+//
+//	required    non-empty (strings are trimmed first)
+//	min=N       minimum length (strings, slices) or value (ints)
+//	max=N       maximum length (strings, slices) or value (ints)
+//	oneof=a b   value must be one of the space-separated options
+func Struct(v interface{}) Errors {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs Errors
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		tag := sf.Tag.Get("validate")
+		if tag == "" || !sf.IsExported() {
+			continue
+		}
+		name := fieldName(sf)
+		fv := rv.Field(i)
+		for _, rule := range strings.Split(tag, ",") {
+			if fe := checkRule(name, fv, rule); fe != nil {
+				errs = append(errs, *fe)
+				break // one error per field is enough
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func fieldName(sf reflect.StructField) string {
+	if tag := sf.Tag.Get("json"); tag != "" {
+		if name := strings.Split(tag, ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+	return sf.Name
+}
+
+func checkRule(field string, fv reflect.Value, rule string) *FieldError {
+	name, arg, _ := strings.Cut(rule, "=")
+
+	switch name {
+	case "required":
+		if isEmpty(fv) {
+			return &FieldError{Field: field, Rule: "required", Message: fmt.Sprintf("%s is required", field)}
+		}
+	case "min", "max":
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil
+		}
+		size, unit, ok := measure(fv)
+		if !ok || (isEmpty(fv) && name == "min") {
+			// Empty optional fields are handled by "required"
+			return nil
+		}
+		if name == "min" && size < n {
+			return &FieldError{Field: field, Rule: "min", Message: fmt.Sprintf("%s must be at least %d%s", field, n, unit)}
+		}
+		if name == "max" && size > n {
+			return &FieldError{Field: field, Rule: "max", Message: fmt.Sprintf("%s must be at most %d%s", field, n, unit)}
+		}
+	case "oneof":
+		if fv.Kind() != reflect.String || fv.String() == "" {
+			return nil
+		}
+		options := strings.Fields(arg)
+		for _, opt := range options {
+			if fv.String() == opt {
+				return nil
+			}
+		}
+		return &FieldError{Field: field, Rule: "oneof", Message: fmt.Sprintf("%s must be one of: %s", field, strings.Join(options, ", "))}
+	}
+	return nil
+}
+
+func isEmpty(fv reflect.Value) bool {
+	switch fv.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(fv.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return fv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return fv.IsNil()
+	}
+	return fv.IsZero()
+}
+
+// measure returns the comparable size of a field and the unit used in messages.
+func measure(fv reflect.Value) (int, string, bool) {
+	switch fv.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(fv.String()), " characters", true
+	case reflect.Slice, reflect.Map:
+		return fv.Len(), " items", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(fv.Int()), "", true
+	}
+	return 0, "", false
+}
@@ -0,0 +1,51 @@
+package validation
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testRequest struct {
+	Name  string   `json:"name" validate:"required,min=3,max=5"`
+	Role  string   `json:"role,omitempty" validate:"oneof=editor viewer"`
+	Tags  []string `json:"tags" validate:"max=2"`
+	Limit int      `json:"limit" validate:"min=0,max=10"`
+	Note  string   `validate:"max=3"`
+}
+
+func TestStruct(t *testing.T) {
+	tests := []struct {
+		name string
+		req  testRequest
+		want []FieldError
+	}{
+		{"valid", testRequest{Name: "abc", Role: "viewer"}, nil},
+		{"blank required", testRequest{Name: "   "}, []FieldError{{"name", "required", "name is required"}}},
+		{"too short", testRequest{Name: "ab"}, []FieldError{{"name", "min", "name must be at least 3 characters"}}},
+		{"runes counted", testRequest{Name: "ééééé"}, nil},
+		{"not an option", testRequest{Name: "abc", Role: "owner"}, []FieldError{{"role", "oneof", "role must be one of: editor, viewer"}}},
+		{"several fields", testRequest{Name: "abcdef", Tags: []string{"a", "b", "c"}, Limit: 11, Note: "long"}, []FieldError{
+			{"name", "max", "name must be at most 5 characters"},
+			{"tags", "max", "tags must be at most 2 items"},
+			{"limit", "max", "limit must be at most 10"},
+			{"Note", "max", "Note must be at most 3 characters"},
+		}},
+	}
+	for _, tt := range tests {
+		errs := Struct(&tt.req)
+		if len(errs) == 0 && len(tt.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual([]FieldError(errs), tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, errs, tt.want)
+		}
+	}
+}
+
+func TestErrorsMessage(t *testing.T) {
+	errs := Struct(&testRequest{Name: "", Role: "x"})
+	if got := errs.Error(); !strings.Contains(got, "name is required; role must be one of") {
+		t.Errorf("Error() = %q", got)
+	}
+}
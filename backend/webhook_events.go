@@ -0,0 +1,93 @@
+package main
+
+import (
+	"log"
+
+	"md-office-backend/webhooks"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Webhook events for changes made through the web UI's file and git
+// endpoints. The v1 API fires its own doc.* events.
+const (
+	eventFileSaved     = "file.saved"
+	eventFileCreated   = "file.created"
+	eventFileDeleted   = "file.deleted"
+	eventFileRenamed   = "file.renamed"
+	eventFileUploaded  = "file.uploaded"
+	eventGitCommitted  = "git.committed"
+	eventBranchCreated = "git.branch.created"
+	eventGitMerged     = "git.merged"
+)
+
+// fireWorkspaceEvent sends event to matching webhooks with payload plus the
+// workspace and the acting user. It returns at once; deliveries are queued.
+// The payload's path and previousPath decide which subscribers may see it.
+func fireWorkspaceEvent(c *fiber.Ctx, ws *Workspace, event string, payload map[string]interface{}) {
+	var paths []string
+	for _, key := range []string{"path", "previousPath"} {
+		if path, ok := payload[key].(string); ok {
+			paths = append(paths, path)
+		}
+	}
+	fireScopedEvent(c, ws, paths, event, payload)
+}
+
+func fireScopedEvent(c *fiber.Ctx, ws *Workspace, paths []string, event string, payload map[string]interface{}) {
+	payload["workspaceId"] = ws.ID
+	payload["author"], _ = c.Locals("username").(string)
+	requestID, _ := c.Locals("requestID").(string)
+	go webhooks.FireEvent(requestID, webhooks.Scope{WorkspaceID: ws.ID, Paths: paths}, event, payload)
+}
+
+// webhookVisible lets a subscription receive a workspace's events only when
+// its owner is a member of the workspace and may read every path named.
+func webhookVisible(userID string, scope webhooks.Scope) bool {
+	config, err := loadWorkspaceConfigObject()
+	if err != nil {
+		return false
+	}
+	for i := range config.Workspaces {
+		ws := &config.Workspaces[i]
+		if ws.ID != scope.WorkspaceID {
+			continue
+		}
+		if _, member := ws.Permissions[userID]; !member && ws.Owner != userID {
+			return false
+		}
+		for _, path := range scope.Paths {
+			if !pathAllowed(ws, userID, path, false) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// commitAndNotify commits all changes in ws like commitChangesWithAuthor and
+// fires git.committed with the new commit's hash, to the subscribers who may
+// read every file it changes.
+func commitAndNotify(c *fiber.Ctx, ws *Workspace, message, authorName string) error {
+	repo := repoForWorkspace(ws)
+	hash, err := commitWithAuthor(repo, message, authorName)
+	if err != nil || repo == nil {
+		return err
+	}
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		log.Printf("Not firing %s for %s: %v", eventGitCommitted, hash, err)
+		return nil
+	}
+	files, err := commitFiles(commit)
+	if err != nil {
+		log.Printf("Not firing %s for %s: %v", eventGitCommitted, hash, err)
+		return nil
+	}
+	fireScopedEvent(c, ws, files, eventGitCommitted, map[string]interface{}{
+		"hash":    hash.String(),
+		"message": message,
+	})
+	return nil
+}
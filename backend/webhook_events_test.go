@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"md-office-backend/webhooks"
+)
+
+func TestWebhooksOnlyReachMembersWhoCanRead(t *testing.T) {
+	hrWorkspace(t)
+	webhooks.Visible = webhookVisible
+	t.Cleanup(func() { webhooks.Visible = nil })
+
+	var mu sync.Mutex
+	received := map[string][]string{} // user -> "event path"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Event   string                 `json:"event"`
+			Payload map[string]interface{} `json:"payload"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		path, _ := body.Payload["path"].(string)
+		mu.Lock()
+		user := strings.TrimPrefix(r.URL.Path, "/")
+		received[user] = append(received[user], body.Event+" "+path)
+		mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+	if err := webhooks.Init(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []string{"alice", "bob", "mallory"} {
+		sub, err := webhooks.Create(user, srv.URL+"/"+user, "", []string{"*"}, webhooks.RetryPolicy{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { webhooks.Delete(sub.ID, user) })
+	}
+
+	user := "owner"
+	app := newTestApp(&user)
+	app.Post("/files/create", createFile)
+	for _, path := range []string{"notes.md", "hr/bonus.md"} {
+		if status, resp := doJSON(t, app, "POST", "/files/create", CreateFileRequest{Path: path}); status != 200 {
+			t.Fatalf("create %s = %d %q", path, status, resp.Error)
+		}
+	}
+
+	// alice reads hr/ and gets both files' events; bob only notes.md's
+	// and mallory, who isn't a member, nothing
+	want := map[string]int{"alice": 4, "bob": 2}
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received["alice"]) + len(received["bob"]) + len(received["mallory"])
+	}
+	for deadline := time.Now().Add(2 * time.Second); count() < 6; {
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d deliveries arrived: %v", count(), received)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond) // room for deliveries that shouldn't come
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, user := range []string{"alice", "bob", "mallory"} {
+		if len(received[user]) != want[user] {
+			t.Errorf("%s received %v, want %d events", user, received[user], want[user])
+		}
+	}
+	for _, event := range received["bob"] {
+		if strings.Contains(event, "hr/") {
+			t.Errorf("bob received %q", event)
+		}
+	}
+}
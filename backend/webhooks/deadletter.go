@@ -0,0 +1,130 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// DeadLetter is a delivery that failed every retry attempt, or that found
+// the delivery queue full
+type DeadLetter struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscriptionId"`
+	UserID         string          `json:"userId"`
+	Event          string          `json:"event"`
+	URL            string          `json:"url"`
+	Body           json.RawMessage `json:"body"` // the full signed payload
+	Attempts       int             `json:"attempts"`
+	StatusCode     int             `json:"statusCode"`
+	Error          string          `json:"error,omitempty"`
+	RequestID      string          `json:"requestId,omitempty"`
+	FailedAt       time.Time       `json:"failedAt"`
+}
+
+type deadLetterFile struct {
+	Entries []DeadLetter `json:"entries"`
+}
+
+func (s *Store) loadDeadLetters() error {
+	data, err := os.ReadFile(s.deadPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.dead = []DeadLetter{}
+			return nil
+		}
+		return err
+	}
+	var f deadLetterFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	s.dead = f.Entries
+	return nil
+}
+
+func (s *Store) saveDeadLetters() error {
+	// Keep only the newest maxDead entries
+	if len(s.dead) > s.maxDead {
+		s.dead = s.dead[len(s.dead)-s.maxDead:]
+	}
+	data, err := json.MarshalIndent(deadLetterFile{Entries: s.dead}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.deadPath, data, 0644)
+}
+
+// addDeadLetter records a delivery that exhausted its retries or couldn't
+// be queued
+func addDeadLetter(job deliveryJob, last DeliveryLog) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.dead = append(store.dead, DeadLetter{
+		ID:             genID(),
+		SubscriptionID: job.sub.ID,
+		UserID:         job.sub.UserID,
+		Event:          job.event,
+		URL:            job.sub.URL,
+		Body:           json.RawMessage(job.body),
+		Attempts:       last.Attempt,
+		StatusCode:     last.StatusCode,
+		Error:          last.Error,
+		RequestID:      job.requestID,
+		FailedAt:       last.Timestamp,
+	})
+	_ = store.saveDeadLetters()
+}
+
+// ListDeadLetters returns a user's dead-lettered deliveries, newest first
+func ListDeadLetters(userID string) []DeadLetter {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	var result []DeadLetter
+	for i := len(store.dead) - 1; i >= 0; i-- {
+		if store.dead[i].UserID == userID {
+			result = append(result, store.dead[i])
+		}
+	}
+	return result
+}
+
+// RetryDeadLetter removes an entry from the dead-letter queue and queues it
+// for delivery again with a fresh set of retries, using the subscription's
+// current URL and secret.
+func RetryDeadLetter(id, userID string) error {
+	store.mu.Lock()
+	idx := -1
+	for i, d := range store.dead {
+		if d.ID == id && d.UserID == userID {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		store.mu.Unlock()
+		return fmt.Errorf("dead letter not found")
+	}
+	entry := store.dead[idx]
+
+	var sub *Subscription
+	for i := range store.subs {
+		if store.subs[i].ID == entry.SubscriptionID {
+			sub = &store.subs[i]
+			break
+		}
+	}
+	if sub == nil {
+		store.mu.Unlock()
+		return fmt.Errorf("subscription no longer exists")
+	}
+	job := deliveryJob{sub: *sub, event: entry.Event, body: []byte(entry.Body), requestID: entry.RequestID}
+
+	store.dead = append(store.dead[:idx], store.dead[idx+1:]...)
+	_ = store.saveDeadLetters()
+	store.mu.Unlock()
+
+	enqueue(job)
+	return nil
+}
@@ -0,0 +1,56 @@
+package webhooks
+
+import (
+	"fmt"
+	"time"
+)
+
+// Limits on a subscription's retry policy
+const (
+	maxAttemptsLimit  = 10
+	maxBackoffSeconds = 3600
+)
+
+// RetryPolicy is how a subscription's failed deliveries are retried. Zero
+// values mean the defaults of retryDelays: 3 attempts, waiting 5s and then
+// 30s. BackoffSeconds[i] is the wait before attempt i+2; attempts past its
+// end wait as long as the last entry. MaxAttempts 1 is fire-and-forget.
+type RetryPolicy struct {
+	MaxAttempts    int   `json:"maxAttempts,omitempty"`
+	BackoffSeconds []int `json:"backoffSeconds,omitempty"`
+}
+
+// Validate checks the policy is within the limits
+func (p RetryPolicy) Validate() error {
+	if p.MaxAttempts < 0 || p.MaxAttempts > maxAttemptsLimit {
+		return fmt.Errorf("maxAttempts must be between 1 and %d", maxAttemptsLimit)
+	}
+	for _, s := range p.BackoffSeconds {
+		if s < 0 || s > maxBackoffSeconds {
+			return fmt.Errorf("backoffSeconds must be between 0 and %d", maxBackoffSeconds)
+		}
+	}
+	return nil
+}
+
+// attempts returns how many times a delivery is tried in all
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts > 0 {
+		return p.MaxAttempts
+	}
+	return len(retryDelays)
+}
+
+// delay returns the wait before the zero-based attempt n (n >= 1)
+func (p RetryPolicy) delay(n int) time.Duration {
+	if len(p.BackoffSeconds) == 0 {
+		if n < len(retryDelays) {
+			return retryDelays[n]
+		}
+		return retryDelays[len(retryDelays)-1]
+	}
+	if n-1 < len(p.BackoffSeconds) {
+		return time.Duration(p.BackoffSeconds[n-1]) * time.Second
+	}
+	return time.Duration(p.BackoffSeconds[len(p.BackoffSeconds)-1]) * time.Second
+}
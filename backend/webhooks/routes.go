@@ -15,6 +15,7 @@ type createSubRequest struct {
 	URL    string   `json:"url"`
 	Events []string `json:"events"`
 	Secret string   `json:"secret"`
+	RetryPolicy
 }
 
 type updateSubRequest struct {
@@ -22,6 +23,9 @@ type updateSubRequest struct {
 	Events []string `json:"events"`
 	Secret string   `json:"secret,omitempty"`
 	Active bool     `json:"active"`
+	// Omitted keeps the current value; an empty list restores the default
+	MaxAttempts    *int  `json:"maxAttempts,omitempty"`
+	BackoffSeconds []int `json:"backoffSeconds,omitempty"`
 }
 
 // RegisterRoutes adds webhook management endpoints
@@ -41,6 +45,29 @@ func RegisterRoutes(group fiber.Router, getUserID func(c *fiber.Ctx) string) {
 		return c.JSON(apiResponse{Data: subs})
 	})
 
+	wh.Get("/dead-letter", func(c *fiber.Ctx) error {
+		userID := getUserID(c)
+		if userID == "" {
+			return c.Status(401).JSON(apiResponse{Error: "Authentication required"})
+		}
+		entries := ListDeadLetters(userID)
+		if entries == nil {
+			entries = []DeadLetter{}
+		}
+		return c.JSON(apiResponse{Data: entries})
+	})
+
+	wh.Post("/dead-letter/:id/retry", func(c *fiber.Ctx) error {
+		userID := getUserID(c)
+		if userID == "" {
+			return c.Status(401).JSON(apiResponse{Error: "Authentication required"})
+		}
+		if err := RetryDeadLetter(c.Params("id"), userID); err != nil {
+			return c.Status(404).JSON(apiResponse{Error: err.Error()})
+		}
+		return c.JSON(apiResponse{Data: "Requeued"})
+	})
+
 	wh.Get("/:id", func(c *fiber.Ctx) error {
 		userID := getUserID(c)
 		if userID == "" {
@@ -62,13 +89,30 @@ func RegisterRoutes(group fiber.Router, getUserID func(c *fiber.Ctx) string) {
 		if err := c.BodyParser(&req); err != nil || req.URL == "" || len(req.Events) == 0 {
 			return c.Status(400).JSON(apiResponse{Error: "url and events are required"})
 		}
-		sub, err := Create(userID, req.URL, req.Secret, req.Events)
+		if err := req.RetryPolicy.Validate(); err != nil {
+			return c.Status(400).JSON(apiResponse{Error: err.Error()})
+		}
+		sub, err := Create(userID, req.URL, req.Secret, req.Events, req.RetryPolicy)
 		if err != nil {
 			return c.Status(500).JSON(apiResponse{Error: err.Error()})
 		}
 		return c.Status(201).JSON(apiResponse{Data: sub})
 	})
 
+	// Test delivery: sends a ping now and reports how the endpoint answered
+	wh.Post("/:id/test", func(c *fiber.Ctx) error {
+		userID := getUserID(c)
+		if userID == "" {
+			return c.Status(401).JSON(apiResponse{Error: "Authentication required"})
+		}
+		requestID, _ := c.Locals("requestID").(string)
+		entry, err := TestDelivery(c.Params("id"), userID, requestID)
+		if err != nil {
+			return c.Status(404).JSON(apiResponse{Error: err.Error()})
+		}
+		return c.JSON(apiResponse{Data: entry})
+	})
+
 	wh.Put("/:id", func(c *fiber.Ctx) error {
 		userID := getUserID(c)
 		if userID == "" {
@@ -78,7 +122,14 @@ func RegisterRoutes(group fiber.Router, getUserID func(c *fiber.Ctx) string) {
 		if err := c.BodyParser(&req); err != nil {
 			return c.Status(400).JSON(apiResponse{Error: "Invalid request body"})
 		}
-		sub, err := Update(c.Params("id"), userID, req.URL, req.Secret, req.Events, req.Active)
+		retry := RetryPolicy{BackoffSeconds: req.BackoffSeconds}
+		if req.MaxAttempts != nil {
+			retry.MaxAttempts = *req.MaxAttempts
+		}
+		if err := retry.Validate(); err != nil {
+			return c.Status(400).JSON(apiResponse{Error: err.Error()})
+		}
+		sub, err := Update(c.Params("id"), userID, req.URL, req.Secret, req.Events, req.Active, req.MaxAttempts, req.BackoffSeconds)
 		if err != nil {
 			return c.Status(404).JSON(apiResponse{Error: err.Error()})
 		}
@@ -96,6 +147,21 @@ func RegisterRoutes(group fiber.Router, getUserID func(c *fiber.Ctx) string) {
 		return c.JSON(apiResponse{Data: "Deleted"})
 	})
 
+	wh.Post("/logs/:logId/redeliver", func(c *fiber.Ctx) error {
+		userID := getUserID(c)
+		if userID == "" {
+			return c.Status(401).JSON(apiResponse{Error: "Authentication required"})
+		}
+		entry, err := Redeliver(c.Params("logId"), userID)
+		if err == ErrNoPayload {
+			return c.Status(409).JSON(apiResponse{Error: err.Error()})
+		}
+		if err != nil {
+			return c.Status(404).JSON(apiResponse{Error: err.Error()})
+		}
+		return c.JSON(apiResponse{Data: entry})
+	})
+
 	wh.Get("/logs/recent", func(c *fiber.Ctx) error {
 		userID := getUserID(c)
 		if userID == "" {
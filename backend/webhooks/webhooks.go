@@ -7,12 +7,17 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
+
+	"md-office-backend/metrics"
 )
 
 // Subscription represents a webhook subscription
@@ -24,19 +29,23 @@ type Subscription struct {
 	UserID    string   `json:"userId"`
 	Active    bool     `json:"active"`
 	CreatedAt time.Time `json:"createdAt"`
+	RetryPolicy
 }
 
 // DeliveryLog represents a webhook delivery attempt
 type DeliveryLog struct {
-	ID             string    `json:"id"`
-	SubscriptionID string    `json:"subscriptionId"`
-	Event          string    `json:"event"`
-	URL            string    `json:"url"`
-	StatusCode     int       `json:"statusCode"`
-	Success        bool      `json:"success"`
-	Attempt        int       `json:"attempt"`
-	Error          string    `json:"error,omitempty"`
-	Timestamp      time.Time `json:"timestamp"`
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscriptionId"`
+	Event          string          `json:"event"`
+	URL            string          `json:"url"`
+	StatusCode     int             `json:"statusCode"`
+	Success        bool            `json:"success"`
+	Attempt        int             `json:"attempt"`
+	Error          string          `json:"error,omitempty"`
+	RequestID      string          `json:"requestId,omitempty"` // request that fired the event
+	Body           json.RawMessage `json:"body,omitempty"`      // the payload sent, for redelivery
+	RedeliveryOf   string          `json:"redeliveryOf,omitempty"`
+	Timestamp      time.Time       `json:"timestamp"`
 }
 
 // Store manages webhook subscriptions and delivery logs
@@ -47,6 +56,9 @@ type Store struct {
 	subs         []Subscription
 	logs         []DeliveryLog
 	maxLogs      int
+	deadPath     string
+	dead         []DeadLetter
+	maxDead      int
 }
 
 type subsFile struct {
@@ -59,17 +71,35 @@ type logsFile struct {
 
 var store *Store
 
+// storeLoaded is set once Init has read every file of the store
+var storeLoaded bool
+
 // Init initializes the webhook store
 func Init(configDir string) error {
 	store = &Store{
 		filePath: filepath.Join(configDir, "webhooks.json"),
 		logPath:  filepath.Join(configDir, "webhook_logs.json"),
 		maxLogs:  500,
+		deadPath: filepath.Join(configDir, "webhook_dead_letter.json"),
+		maxDead:  200,
 	}
 	if err := store.loadSubs(); err != nil {
 		return err
 	}
-	return store.loadLogs()
+	if err := store.loadDeadLetters(); err != nil {
+		return err
+	}
+	StartWorkers(envInt("WEBHOOK_WORKERS"), envInt("WEBHOOK_QUEUE_SIZE"))
+	if err := store.loadLogs(); err != nil {
+		return err
+	}
+	storeLoaded = true
+	return nil
+}
+
+// Loaded reports whether Init loaded the store successfully
+func Loaded() bool {
+	return storeLoaded
 }
 
 func (s *Store) loadSubs() error {
@@ -132,8 +162,9 @@ func genID() string {
 	return hex.EncodeToString(b)
 }
 
-// Create adds a new subscription
-func Create(userID, url, secret string, events []string) (*Subscription, error) {
+// Create adds a new subscription. Callers are responsible for validating
+// the retry policy.
+func Create(userID, url, secret string, events []string, retry RetryPolicy) (*Subscription, error) {
 	store.mu.Lock()
 	defer store.mu.Unlock()
 
@@ -143,8 +174,9 @@ func Create(userID, url, secret string, events []string) (*Subscription, error)
 		Events:    events,
 		Secret:    secret,
 		UserID:    userID,
-		Active:    true,
-		CreatedAt: time.Now(),
+		Active:      true,
+		CreatedAt:   time.Now(),
+		RetryPolicy: retry,
 	}
 
 	store.subs = append(store.subs, sub)
@@ -182,19 +214,28 @@ func Get(id, userID string) (*Subscription, error) {
 	return nil, fmt.Errorf("subscription not found")
 }
 
-// Update modifies a subscription
-func Update(id, userID, url, secret string, events []string, active bool) (*Subscription, error) {
+// Update modifies a subscription. A nil maxAttempts or backoffSeconds keeps
+// that part of the retry policy; callers validate the ones given.
+func Update(id, userID, url, secret string, events []string, active bool, maxAttempts *int, backoffSeconds []int) (*Subscription, error) {
 	store.mu.Lock()
 	defer store.mu.Unlock()
 
 	for i := range store.subs {
 		if store.subs[i].ID == id && store.subs[i].UserID == userID {
+			retry := store.subs[i].RetryPolicy
+			if maxAttempts != nil {
+				retry.MaxAttempts = *maxAttempts
+			}
+			if backoffSeconds != nil {
+				retry.BackoffSeconds = backoffSeconds
+			}
 			store.subs[i].URL = url
 			if secret != "" {
 				store.subs[i].Secret = secret
 			}
 			store.subs[i].Events = events
 			store.subs[i].Active = active
+			store.subs[i].RetryPolicy = retry
 			if err := store.saveSubs(); err != nil {
 				return nil, err
 			}
@@ -246,8 +287,24 @@ func GetLogs(userID string, limit int) []DeliveryLog {
 	return result
 }
 
-// FireEvent dispatches an event to all matching subscriptions
-func FireEvent(event string, payload interface{}) {
+// Scope is what an event is about: the workspace it happened in and the
+// files it names, if any.
+type Scope struct {
+	WorkspaceID string
+	Paths       []string
+}
+
+// Visible reports whether a subscription owned by userID may receive an
+// event in scope, e.g. whether the user is a member of the workspace and can
+// read its paths. The server sets it at startup; while it is nil every
+// matching subscription receives every event.
+var Visible func(userID string, scope Scope) bool
+
+// FireEvent dispatches an event to all matching subscriptions whose owner
+// may see scope. requestID, the X-Request-ID of the request that caused the
+// event, is sent along in the body and the X-Request-ID header; it may be
+// empty.
+func FireEvent(requestID string, scope Scope, event string, payload interface{}) {
 	if store == nil {
 		return
 	}
@@ -267,60 +324,279 @@ func FireEvent(event string, payload interface{}) {
 	}
 	store.mu.RUnlock()
 
-	for _, sub := range matching {
-		go deliverWithRetry(sub, event, payload)
+	if Visible != nil {
+		visible := matching[:0]
+		for _, s := range matching {
+			if Visible(s.UserID, scope) {
+				visible = append(visible, s)
+			}
+		}
+		matching = visible
+	}
+
+	if len(matching) == 0 {
+		return
 	}
-}
 
-func deliverWithRetry(sub Subscription, event string, payload interface{}) {
 	body := map[string]interface{}{
 		"event":     event,
 		"payload":   payload,
 		"timestamp": time.Now().Format(time.RFC3339),
 		"id":        genID(),
 	}
+	if requestID != "" {
+		body["requestId"] = requestID
+	}
 
 	bodyBytes, err := json.Marshal(body)
 	if err != nil {
 		return
 	}
 
-	maxAttempts := 3
-	delays := []time.Duration{0, 5 * time.Second, 30 * time.Second}
+	for _, sub := range matching {
+		enqueue(deliveryJob{sub: sub, event: event, body: bodyBytes, requestID: requestID})
+	}
+}
 
-	for attempt := 0; attempt < maxAttempts; attempt++ {
-		if attempt > 0 {
-			time.Sleep(delays[attempt])
-		}
+// Delivery pool defaults (override with WEBHOOK_WORKERS / WEBHOOK_QUEUE_SIZE)
+const (
+	defaultWorkers   = 8
+	defaultQueueSize = 1000
+)
+
+// Default retry schedule: attempt n waits retryDelays[n] before being
+// re-queued. Subscriptions can set their own with a RetryPolicy.
+var retryDelays = []time.Duration{0, 5 * time.Second, 30 * time.Second}
+
+type deliveryJob struct {
+	sub       Subscription
+	event     string
+	body      []byte
+	requestID string
+	attempt   int // zero-based
+
+	redeliveryOf string // log ID of the delivery being redelivered
+}
+
+var (
+	queueMu sync.Mutex
+	queue   chan deliveryJob
+)
+
+// StartWorkers starts a fixed pool of delivery workers fed by a bounded
+// queue. Calling it again replaces the pool; the old workers drain what is
+// already queued and exit.
+func StartWorkers(workers, queueSize int) {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	startWorkersLocked(workers, queueSize)
+}
+
+func startWorkersLocked(workers, queueSize int) {
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	if queue != nil {
+		close(queue)
+	}
+	queue = make(chan deliveryJob, queueSize)
+	for i := 0; i < workers; i++ {
+		go worker(queue)
+	}
+}
+
+// errQueueFull is recorded for deliveries dead-lettered by enqueue
+var errQueueFull = errors.New("delivery queue full")
+
+// enqueue queues a delivery. When the queue is full the delivery goes to the
+// dead-letter queue instead, so it can still be retried from there.
+func enqueue(job deliveryJob) {
+	queueMu.Lock()
+	if queue == nil {
+		startWorkersLocked(envInt("WEBHOOK_WORKERS"), envInt("WEBHOOK_QUEUE_SIZE"))
+	}
+	select {
+	case queue <- job:
+		queueMu.Unlock()
+		return
+	default:
+	}
+	queueMu.Unlock()
+
+	log.Printf("webhooks: delivery queue full, dead-lettering %s for subscription %s (attempt %d) request_id=%s",
+		job.event, job.sub.ID, job.attempt+1, job.requestID)
+	addDeadLetter(job, DeliveryLog{Attempt: job.attempt, Error: errQueueFull.Error(), Timestamp: time.Now()})
+}
+
+func worker(q <-chan deliveryJob) {
+	for job := range q {
+		attemptDelivery(job)
+	}
+}
+
+// attemptDelivery makes one delivery attempt and schedules a retry on
+// failure. Retries wait off-pool so slow endpoints don't hold workers.
+func attemptDelivery(job deliveryJob) {
+	statusCode, deliveryErr := deliver(job.sub, job.body, job.requestID)
+	entry := recordDelivery(job, statusCode, deliveryErr)
+
+	if entry.Success {
+		return
+	}
+	if job.attempt+1 >= job.sub.attempts() {
+		addDeadLetter(job, entry)
+		return
+	}
+
+	job.attempt++
+	time.AfterFunc(job.sub.delay(job.attempt), func() { enqueue(job) })
+}
+
+// deliveries counts delivery attempts, retries and redeliveries included
+var deliveries = metrics.NewCounterVec("md_office_webhook_deliveries_total",
+	"Webhook delivery attempts by result", "result")
+
+// recordDelivery adds the outcome of a delivery attempt to the logs
+func recordDelivery(job deliveryJob, statusCode int, deliveryErr error) DeliveryLog {
+	entry := DeliveryLog{
+		ID:             genID(),
+		SubscriptionID: job.sub.ID,
+		Event:          job.event,
+		URL:            job.sub.URL,
+		StatusCode:     statusCode,
+		Success:        statusCode >= 200 && statusCode < 300,
+		Attempt:        job.attempt + 1,
+		RequestID:      job.requestID,
+		Body:           json.RawMessage(job.body),
+		RedeliveryOf:   job.redeliveryOf,
+		Timestamp:      time.Now(),
+	}
+	if deliveryErr != nil {
+		entry.Error = deliveryErr.Error()
+	}
+	if entry.Success {
+		deliveries.Inc("success")
+	} else {
+		deliveries.Inc("failure")
+	}
 
-		statusCode, deliveryErr := deliver(sub, bodyBytes)
-
-		log := DeliveryLog{
-			ID:             genID(),
-			SubscriptionID: sub.ID,
-			Event:          event,
-			URL:            sub.URL,
-			StatusCode:     statusCode,
-			Success:        statusCode >= 200 && statusCode < 300,
-			Attempt:        attempt + 1,
-			Timestamp:      time.Now(),
+	store.mu.Lock()
+	store.logs = append(store.logs, entry)
+	_ = store.saveLogs()
+	store.mu.Unlock()
+	return entry
+}
+
+// Errors returned by Redeliver
+var (
+	ErrLogNotFound = errors.New("delivery log not found")
+	ErrNoPayload   = errors.New("delivery has no stored payload to resend")
+)
+
+// Redeliver sends the payload of a logged delivery to its subscription once
+// more, using the subscription's current URL and secret, and waits for the
+// result. The attempt is logged as a new entry pointing at the original; it
+// is not retried. Only the subscription's owner may redeliver.
+func Redeliver(logID, userID string) (*DeliveryLog, error) {
+	store.mu.RLock()
+	var original *DeliveryLog
+	for i := range store.logs {
+		if store.logs[i].ID == logID {
+			found := store.logs[i]
+			original = &found
+			break
 		}
-		if deliveryErr != nil {
-			log.Error = deliveryErr.Error()
+	}
+	var sub *Subscription
+	if original != nil {
+		for i := range store.subs {
+			if store.subs[i].ID == original.SubscriptionID && store.subs[i].UserID == userID {
+				found := store.subs[i]
+				sub = &found
+				break
+			}
 		}
+	}
+	store.mu.RUnlock()
+	if sub == nil {
+		return nil, ErrLogNotFound
+	}
+	if len(original.Body) == 0 {
+		return nil, ErrNoPayload
+	}
+
+	job := deliveryJob{
+		sub:          *sub,
+		event:        original.Event,
+		body:         []byte(original.Body),
+		requestID:    original.RequestID,
+		redeliveryOf: original.ID,
+	}
+	statusCode, deliveryErr := deliver(job.sub, job.body, job.requestID)
+	entry := recordDelivery(job, statusCode, deliveryErr)
+	return &entry, nil
+}
 
-		store.mu.Lock()
-		store.logs = append(store.logs, log)
-		_ = store.saveLogs()
-		store.mu.Unlock()
+// PingEvent is the event of test deliveries
+const PingEvent = "ping"
 
-		if log.Success {
-			return
+// TestDelivery sends a signed ping event to a subscription, active or not,
+// and waits for the result. The attempt is logged like any delivery but
+// never retried or dead-lettered.
+func TestDelivery(id, userID, requestID string) (*DeliveryLog, error) {
+	store.mu.RLock()
+	var sub *Subscription
+	for i := range store.subs {
+		if store.subs[i].ID == id && store.subs[i].UserID == userID {
+			found := store.subs[i]
+			sub = &found
+			break
 		}
 	}
+	store.mu.RUnlock()
+	if sub == nil {
+		return nil, fmt.Errorf("subscription not found")
+	}
+
+	body := map[string]interface{}{
+		"event":     PingEvent,
+		"payload":   map[string]string{"subscriptionId": sub.ID},
+		"timestamp": time.Now().Format(time.RFC3339),
+		"id":        genID(),
+	}
+	if requestID != "" {
+		body["requestId"] = requestID
+	}
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	job := deliveryJob{sub: *sub, event: PingEvent, body: bodyBytes, requestID: requestID}
+	statusCode, deliveryErr := deliver(job.sub, job.body, job.requestID)
+	entry := recordDelivery(job, statusCode, deliveryErr)
+	return &entry, nil
 }
 
-func deliver(sub Subscription, body []byte) (int, error) {
+func envInt(name string) int {
+	n, _ := strconv.Atoi(os.Getenv(name))
+	return n
+}
+
+// sign returns the hex HMAC-SHA256 of the concatenated parts
+func sign(secret string, parts ...[]byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	for _, p := range parts {
+		mac.Write(p)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func deliver(sub Subscription, body []byte, requestID string) (int, error) {
 	req, err := http.NewRequest("POST", sub.URL, bytes.NewReader(body))
 	if err != nil {
 		return 0, err
@@ -328,13 +604,18 @@ func deliver(sub Subscription, body []byte) (int, error) {
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-Webhook-Event", "md-office")
+	if requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
 
-	// HMAC signature
+	// HMAC signatures. X-Webhook-Signature covers the timestamp too, so
+	// receivers can reject old or replayed deliveries; X-Signature-256 signs
+	// the body alone and is kept for existing verifiers.
 	if sub.Secret != "" {
-		mac := hmac.New(sha256.New, []byte(sub.Secret))
-		mac.Write(body)
-		sig := hex.EncodeToString(mac.Sum(nil))
-		req.Header.Set("X-Signature-256", "sha256="+sig)
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Webhook-Timestamp", timestamp)
+		req.Header.Set("X-Webhook-Signature", "v1="+sign(sub.Secret, []byte(timestamp+"."), body))
+		req.Header.Set("X-Signature-256", "sha256="+sign(sub.Secret, body))
 	}
 
 	client := &http.Client{Timeout: 10 * time.Second}
@@ -0,0 +1,187 @@
+package webhooks
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingServer holds every delivery until release is called, tracking how
+// many are in flight at once.
+type blockingServer struct {
+	*httptest.Server
+	mu                sync.Mutex
+	inFlight, maxSeen int
+	arrived           chan struct{}
+	release           chan struct{}
+}
+
+func newBlockingServer(t *testing.T) *blockingServer {
+	s := &blockingServer{arrived: make(chan struct{}, 100), release: make(chan struct{})}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.inFlight++
+		if s.inFlight > s.maxSeen {
+			s.maxSeen = s.inFlight
+		}
+		s.mu.Unlock()
+		s.arrived <- struct{}{}
+		<-s.release
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}))
+	t.Cleanup(func() {
+		s.Close()
+		StartWorkers(0, 0)
+	})
+	return s
+}
+
+func (s *blockingServer) waitArrivals(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-s.arrived:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("only %d of %d deliveries arrived", i, n)
+		}
+	}
+}
+
+// waitLogs waits for n delivery attempts to be logged, so none is still
+// writing to the store when the test's directory is removed.
+func waitLogs(t *testing.T, userID string, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); len(GetLogs(userID, 100)) < n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d of %d deliveries were logged", len(GetLogs(userID, 100)), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWorkerPoolLimitsConcurrentDeliveries(t *testing.T) {
+	srv := newBlockingServer(t)
+	if err := Init(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	StartWorkers(2, 10)
+	if _, err := Create("u", srv.URL, "", []string{"*"}, RetryPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 6; i++ {
+		FireEvent("", Scope{}, "doc.updated", i)
+	}
+	srv.waitArrivals(t, 2)
+	time.Sleep(50 * time.Millisecond) // room for a third worker to show up
+	srv.mu.Lock()
+	inFlight := srv.inFlight
+	srv.mu.Unlock()
+	if inFlight != 2 {
+		t.Errorf("%d deliveries in flight, want the 2 workers' worth", inFlight)
+	}
+
+	close(srv.release)
+	srv.waitArrivals(t, 4)
+	waitLogs(t, "u", 6)
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.maxSeen != 2 {
+		t.Errorf("up to %d deliveries ran at once with 2 workers", srv.maxSeen)
+	}
+}
+
+func TestFullQueueDeadLetters(t *testing.T) {
+	srv := newBlockingServer(t)
+	if err := Init(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	StartWorkers(1, 1)
+	if _, err := Create("u", srv.URL, "", []string{"*"}, RetryPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+
+	FireEvent("r1", Scope{}, "doc.updated", 1) // taken by the worker
+	srv.waitArrivals(t, 1)
+	FireEvent("r2", Scope{}, "doc.updated", 2) // fills the queue
+	FireEvent("r3", Scope{}, "doc.updated", 3) // has nowhere to go
+
+	dead := ListDeadLetters("u")
+	if len(dead) != 1 || dead[0].RequestID != "r3" || dead[0].Error != errQueueFull.Error() {
+		t.Fatalf("dead letters %+v, want r3 with the queue full", dead)
+	}
+	close(srv.release)
+	srv.waitArrivals(t, 1)
+
+	if err := RetryDeadLetter(dead[0].ID, "u"); err != nil {
+		t.Fatal(err)
+	}
+	srv.waitArrivals(t, 1)
+	waitLogs(t, "u", 3)
+}
+
+func TestAlwaysFailingDeliveryDeadLetters(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	arrived := make(chan int, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := int(status.Load())
+		w.WriteHeader(code)
+		arrived <- code
+	}))
+	t.Cleanup(func() {
+		srv.Close()
+		StartWorkers(0, 0)
+	})
+	if err := Init(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	StartWorkers(1, 10)
+	if _, err := Create("u", srv.URL, "", []string{"*"}, RetryPolicy{MaxAttempts: 2, BackoffSeconds: []int{0}}); err != nil {
+		t.Fatal(err)
+	}
+
+	FireEvent("r1", Scope{}, "doc.updated", 1)
+	var dead []DeadLetter
+	for deadline := time.Now().Add(2 * time.Second); len(dead) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("the failing delivery was never dead-lettered")
+		}
+		time.Sleep(10 * time.Millisecond)
+		dead = ListDeadLetters("u")
+	}
+	if len(arrived) != 2 {
+		t.Errorf("%d delivery attempts, want 2", len(arrived))
+	}
+	if len(dead) != 1 || dead[0].Attempts != 2 || dead[0].StatusCode != 500 || dead[0].RequestID != "r1" {
+		t.Fatalf("dead letters %+v, want r1 after 2 attempts with status 500", dead)
+	}
+	for len(arrived) > 0 {
+		<-arrived
+	}
+
+	status.Store(http.StatusOK)
+	if err := RetryDeadLetter(dead[0].ID, "u"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case code := <-arrived:
+		if code != http.StatusOK {
+			t.Errorf("requeued delivery got %d", code)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("requeued delivery never arrived")
+	}
+	waitLogs(t, "u", 3)
+	if dead := ListDeadLetters("u"); len(dead) != 0 {
+		t.Errorf("dead letters %+v left after the retry", dead)
+	}
+	if err := RetryDeadLetter(dead[0].ID, "u"); err == nil {
+		t.Error("retrying an entry twice succeeded")
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// deleteWorkspace removes a workspace the caller owns from the config.
+// Users who had it selected move to another workspace they can access, or
+// back to the server default. ?deleteFiles=true also removes its directory,
+// unless another workspace lives in, under or above it or the directory
+// fails checkDeletableDir.
+func deleteWorkspace(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	workspaceID := c.Params("id")
+	deleteFiles := c.QueryBool("deleteFiles")
+
+	var removed Workspace
+	err := updateWorkspaceConfig(func(config *WorkspaceConfig) error {
+		index := -1
+		for i, ws := range config.Workspaces {
+			if ws.ID == workspaceID {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return fiber.NewError(404, "Workspace not found")
+		}
+		removed = config.Workspaces[index]
+		if removed.Owner != userID {
+			return fiber.NewError(403, "Only workspace owner can delete the workspace")
+		}
+		if len(config.Workspaces) == 1 {
+			return fiber.NewError(409, "Cannot delete the last workspace")
+		}
+
+		remaining := append(config.Workspaces[:index:index], config.Workspaces[index+1:]...)
+		if deleteFiles {
+			if err := checkDeletableDir(removed.Path); err != nil {
+				return fiber.NewError(403, err.Error())
+			}
+			for _, ws := range remaining {
+				if pathsOverlap(ws.Path, removed.Path) {
+					return fiber.NewError(409, fmt.Sprintf("Workspace %q shares this directory; delete without deleteFiles", ws.Name))
+				}
+			}
+		}
+		config.Workspaces = remaining
+
+		if config.ActiveWorkspace == workspaceID {
+			// The server default serves every user without a selection of
+			// their own, so it must not be left empty
+			config.ActiveWorkspace = firstAccessibleWorkspace(remaining, userID)
+			if config.ActiveWorkspace == "" {
+				config.ActiveWorkspace = remaining[0].ID
+			}
+		}
+		for user, id := range config.UserActive {
+			if id != workspaceID {
+				continue
+			}
+			if next := firstAccessibleWorkspace(remaining, user); next != "" {
+				config.UserActive[user] = next
+			} else {
+				delete(config.UserActive, user)
+			}
+		}
+		return nil
+	})
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return c.Status(fe.Code).JSON(APIResponse{Error: fe.Message})
+	}
+	if err != nil {
+		return c.JSON(APIResponse{Error: "Failed to save workspace config"})
+	}
+
+	forgetWorkspaceRepos(removed.Path)
+	forgetCreatedTimes(removed.ID)
+	indexFor(removed.Path).Invalidate()
+	if deleteFiles {
+		if err := os.RemoveAll(removed.Path); err != nil {
+			return c.Status(500).JSON(APIResponse{Error: "Workspace deleted but removing its files failed: " + err.Error()})
+		}
+	}
+
+	return c.JSON(APIResponse{Data: "Workspace deleted successfully"})
+}
+
+// checkDeletableDir refuses to let a workspace deletion remove dir unless it
+// is below WORKSPACES_ROOT and holds neither the server's data and config
+// files nor the server itself.
+func checkDeletableDir(dir string) error {
+	if workspacesRoot == "" {
+		return errors.New("Deleting workspace files is disabled; set WORKSPACES_ROOT to allow it")
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	root := workspacesRoot
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	if rel, err := filepath.Rel(root, dir); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("Only workspaces under %s can have their files deleted", workspacesRoot)
+	}
+
+	protected := []string{configDir, userDataFile, workspaceConfigFile}
+	if exe, err := os.Executable(); err == nil {
+		protected = append(protected, filepath.Dir(exe))
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		protected = append(protected, cwd)
+	}
+	for _, p := range protected {
+		if p == "" {
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(p); err == nil {
+			p = resolved
+		}
+		if rel, err := filepath.Rel(dir, p); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return errors.New("The workspace directory contains server files and can't be deleted")
+		}
+	}
+	return nil
+}
+
+// firstAccessibleWorkspace returns the ID of the first workspace userID owns
+// or is a member of, or "" if there is none.
+func firstAccessibleWorkspace(workspaces []Workspace, userID string) string {
+	for _, ws := range workspaces {
+		if _, hasAccess := ws.Permissions[userID]; hasAccess || ws.Owner == userID {
+			return ws.ID
+		}
+	}
+	return ""
+}
+
+// pathsOverlap reports whether a and b are the same directory or one
+// contains the other.
+func pathsOverlap(a, b string) bool {
+	a, errA := filepath.Abs(a)
+	b, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return true
+	}
+	within := func(dir, path string) bool {
+		rel, err := filepath.Rel(dir, path)
+		return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+	}
+	return within(a, b) || within(b, a)
+}
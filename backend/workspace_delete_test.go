@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeleteWorkspaceFiles(t *testing.T) {
+	useTestConfig(t)
+	root := t.TempDir()
+	inside := filepath.Join(root, "team")
+	outside := t.TempDir()
+	withConfig := filepath.Join(root, "config")
+	configDir = filepath.Join(withConfig, ".md-office")
+	workspaceConfigFile = filepath.Join(configDir, "workspaces.json")
+	for _, dir := range []string{inside, configDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ws := func(id, path string) Workspace { return Workspace{ID: id, Name: id, Path: path, Owner: "owner"} }
+	config := WorkspaceConfig{ActiveWorkspace: "default", Workspaces: []Workspace{
+		ws("default", t.TempDir()),
+		ws("inside", inside),
+		ws("outside", outside),
+		ws("config", withConfig),
+		ws("root", root),
+	}}
+	setTestConfig(t, config)
+
+	user := "owner"
+	app := newTestApp(&user)
+	app.Delete("/workspaces/:id", deleteWorkspace)
+
+	old := workspacesRoot
+	t.Cleanup(func() { workspacesRoot = old })
+	workspacesRoot = ""
+	if status, _ := doJSON(t, app, "DELETE", "/workspaces/inside?deleteFiles=true", nil); status != 403 {
+		t.Errorf("deleting files without WORKSPACES_ROOT = %d, want 403", status)
+	}
+
+	workspacesRoot = root
+	for _, id := range []string{"outside", "config", "root"} {
+		if status, resp := doJSON(t, app, "DELETE", "/workspaces/"+id+"?deleteFiles=true", nil); status != 403 {
+			t.Errorf("deleting %s files = %d %q, want 403", id, status, resp.Error)
+		}
+	}
+	for _, dir := range []string{outside, configDir, root, inside} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("%s was removed: %v", dir, err)
+		}
+	}
+
+	// The root workspace contains the others; drop it, keeping its files
+	if status, resp := doJSON(t, app, "DELETE", "/workspaces/root", nil); status != 200 {
+		t.Fatalf("deleting root = %d %q, want 200", status, resp.Error)
+	}
+	if status, resp := doJSON(t, app, "DELETE", "/workspaces/inside?deleteFiles=true", nil); status != 200 {
+		t.Fatalf("deleting inside files = %d %q, want 200", status, resp.Error)
+	}
+	if _, err := os.Stat(inside); !os.IsNotExist(err) {
+		t.Errorf("%s still exists: %v", inside, err)
+	}
+	if ws, _ := loadWorkspaceConfigObject(); len(ws.Workspaces) != 3 {
+		t.Errorf("%d workspaces left, want 3 (refused deletions keep theirs)", len(ws.Workspaces))
+	}
+}
+
+func TestDeleteActiveWorkspaceKeepsADefault(t *testing.T) {
+	useTestConfig(t)
+	setTestConfig(t, WorkspaceConfig{ActiveWorkspace: "mine", Workspaces: []Workspace{
+		{ID: "mine", Name: "mine", Path: t.TempDir(), Owner: "alice"},
+		{ID: "theirs", Name: "theirs", Path: t.TempDir(), Owner: "bob"},
+	}})
+
+	user := "alice"
+	app := newTestApp(&user)
+	app.Delete("/workspaces/:id", deleteWorkspace)
+	if status, resp := doJSON(t, app, "DELETE", "/workspaces/mine", nil); status != 200 {
+		t.Fatalf("delete = %d %q, want 200", status, resp.Error)
+	}
+
+	config, err := loadWorkspaceConfigObject()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ActiveWorkspace != "theirs" {
+		t.Errorf("server default = %q, want the remaining workspace", config.ActiveWorkspace)
+	}
+	if ws, err := activeWorkspaceFor("bob"); err != nil || ws.ID != "theirs" {
+		t.Errorf("bob's active workspace = %v, %v; want theirs", ws, err)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"md-office-backend/storage"
+	"md-office-backend/validation"
+)
+
+type DuplicateWorkspaceRequest struct {
+	Name    string `json:"name" validate:"required,max=100"`
+	Path    string `json:"path" validate:"required,max=1024"`
+	History bool   `json:"history"` // copy .git too instead of starting a fresh repo
+}
+
+// duplicateWorkspace copies a workspace the caller can view into a new
+// workspace they own. Members aren't copied; settings are, since compressed
+// files are copied as they are stored. Files the caller can't read are left
+// out, and so is the history when there are any.
+func duplicateWorkspace(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	username := c.Locals("username").(string)
+
+	var req DuplicateWorkspaceRequest
+	if errs := validation.ParseBody(c, &req); errs != nil {
+		return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
+	}
+
+	config, err := loadWorkspaceConfigObject()
+	if err != nil {
+		return c.JSON(APIResponse{Error: "Failed to load workspace config"})
+	}
+
+	var source *Workspace
+	for i := range config.Workspaces {
+		if config.Workspaces[i].ID == c.Params("id") {
+			source = &config.Workspaces[i]
+			break
+		}
+	}
+	if source == nil {
+		return c.Status(404).JSON(APIResponse{Error: "Workspace not found"})
+	}
+	if _, hasAccess := source.Permissions[userID]; !hasAccess && source.Owner != userID {
+		return c.Status(403).JSON(APIResponse{Error: "Access denied to workspace"})
+	}
+
+	srcPath, err := filepath.Abs(source.Path)
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+	dstPath, err := filepath.Abs(req.Path)
+	if err != nil {
+		return c.Status(400).JSON(APIResponse{Error: "Invalid path"})
+	}
+	if isWithinDir(srcPath, dstPath) || isWithinDir(dstPath, srcPath) {
+		return c.Status(400).JSON(APIResponse{Error: "The copy must not be inside the source workspace or contain it"})
+	}
+	if entries, err := os.ReadDir(dstPath); err == nil && len(entries) > 0 {
+		return c.Status(409).JSON(APIResponse{Error: "Target directory is not empty"})
+	}
+	readable := readableBy(source, userID)
+	if req.History && readable != nil {
+		// The history holds every file's past versions
+		return c.Status(403).JSON(APIResponse{Error: "History can't be copied from a workspace with restricted folders"})
+	}
+
+	if err := copyWorkspaceFiles(srcPath, dstPath, req.History, readable); err != nil {
+		os.RemoveAll(dstPath)
+		return c.JSON(APIResponse{Error: "Failed to copy workspace: " + err.Error()})
+	}
+	if !req.History {
+		if err := commitWorkspaceDir(dstPath, fmt.Sprintf("Duplicate workspace %s", source.Name), username); err != nil {
+			os.RemoveAll(dstPath)
+			return c.JSON(APIResponse{Error: "Failed to initialize git repository: " + err.Error()})
+		}
+	}
+
+	workspace := Workspace{
+		ID:        generateID(),
+		Name:      req.Name,
+		Path:      req.Path,
+		Owner:     userID,
+		CreatedAt: time.Now(),
+		Members: []WorkspaceMember{
+			{
+				UserID:     userID,
+				Username:   username,
+				Permission: "owner",
+				JoinedAt:   time.Now(),
+			},
+		},
+		Permissions: map[string]string{
+			userID: "owner",
+		},
+		Settings: source.Settings,
+	}
+
+	err = updateWorkspaceConfig(func(config *WorkspaceConfig) error {
+		config.Workspaces = append(config.Workspaces, workspace)
+		return nil
+	})
+	if err != nil {
+		return c.JSON(APIResponse{Error: "Failed to save workspace config"})
+	}
+
+	return c.JSON(APIResponse{Data: workspace})
+}
+
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// copyWorkspaceFiles copies src into dst, skipping .git unless withGit is
+// set and, when readable is set, the paths it rejects. Symlinks follow the
+// workspace symlink policy: relative links that stay inside the workspace
+// are recreated, anything else is left out.
+func copyWorkspaceFiles(src, dst string, withGit bool, readable func(string) bool) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" && path != src && !withGit {
+			return filepath.SkipDir
+		}
+		if readable != nil && path != src && !readable(filepath.ToSlash(rel)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0755)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil || filepath.IsAbs(link) || !storage.InspectLink(src, path).Inside {
+				return nil
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			return copyRegularFile(path, target)
+		}
+		return nil // sockets, devices and the like
+	})
+}
+
+func copyRegularFile(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
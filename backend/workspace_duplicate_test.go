@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+func TestDuplicateWorkspace(t *testing.T) {
+	source := newTestWorkspace(t, Workspace{Name: "Notes", Owner: "alice", Permissions: map[string]string{"alice": "owner", "bob": "viewer"}},
+		map[string]string{"a.md": "a", "docs/b.md": "b"})
+	user := "bob"
+	app := newTestApp(&user)
+	app.Post("/workspaces/:id/duplicate", duplicateWorkspace)
+
+	dir := filepath.Join(t.TempDir(), "copy")
+	status, resp := doJSON(t, app, "POST", "/workspaces/ws/duplicate", DuplicateWorkspaceRequest{Name: "Copy", Path: dir})
+	if status != 200 || resp.Error != "" {
+		t.Fatalf("duplicate: %d %s", status, resp.Error)
+	}
+	t.Cleanup(func() { forgetWorkspaceRepos(dir) })
+
+	if got := committedFiles(t, dir); !reflect.DeepEqual(got, []string{"a.md", "docs/b.md"}) {
+		t.Errorf("committed files in the copy = %v", got)
+	}
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, _ := repo.Head()
+	if commit, err := repo.CommitObject(head.Hash()); err != nil || commit.NumParents() != 0 || !strings.HasPrefix(commit.Message, "Duplicate workspace Notes") {
+		t.Errorf("copy's history = %v, %v; want a single fresh commit", commit, err)
+	}
+
+	config, err := loadWorkspaceConfigObject()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Workspaces) != 2 {
+		t.Fatalf("workspaces = %+v, want the source and the copy", config.Workspaces)
+	}
+	copied := config.Workspaces[1]
+	if copied.ID == source.ID || copied.Owner != "bob" || copied.Path != dir || len(copied.Permissions) != 1 {
+		t.Errorf("copy = %+v, want a new workspace owned by bob alone", copied)
+	}
+
+	// The copy is independent of the source
+	writeTestFiles(t, dir, map[string]string{"a.md": "changed"})
+	if content, _ := os.ReadFile(filepath.Join(source.Path, "a.md")); string(content) != "a" {
+		t.Errorf("source a.md = %q after editing the copy", content)
+	}
+}
+
+func TestDuplicateWorkspaceChecks(t *testing.T) {
+	source := newTestWorkspace(t, Workspace{Name: "Notes", Owner: "alice"}, map[string]string{"a.md": "a"})
+	user := "alice"
+	app := newTestApp(&user)
+	app.Post("/workspaces/:id/duplicate", duplicateWorkspace)
+
+	dir := filepath.Join(t.TempDir(), "copy")
+	if status, resp := doJSON(t, app, "POST", "/workspaces/ws/duplicate", DuplicateWorkspaceRequest{Name: "Copy", Path: dir, History: true}); status != 200 || resp.Error != "" {
+		t.Fatalf("duplicate with history: %d %s", status, resp.Error)
+	}
+	t.Cleanup(func() { forgetWorkspaceRepos(dir) })
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, _ := repo.Head()
+	if commit, err := repo.CommitObject(head.Hash()); err != nil || commit.Message != "Initial commit" {
+		t.Errorf("copied history ends at %v, %v; want the source's commit", commit, err)
+	}
+
+	if status, _ := doJSON(t, app, "POST", "/workspaces/ws/duplicate", DuplicateWorkspaceRequest{Name: "Nested", Path: filepath.Join(source.Path, "nested")}); status != 400 {
+		t.Errorf("copy inside the source = %d, want 400", status)
+	}
+	if status, _ := doJSON(t, app, "POST", "/workspaces/ws/duplicate", DuplicateWorkspaceRequest{Name: "Again", Path: dir}); status != 409 {
+		t.Errorf("copy into a non-empty directory = %d, want 409", status)
+	}
+	if status, _ := doJSON(t, app, "POST", "/workspaces/missing/duplicate", DuplicateWorkspaceRequest{Name: "X", Path: t.TempDir()}); status != 404 {
+		t.Errorf("copy of an unknown workspace = %d, want 404", status)
+	}
+	user = "carol"
+	if status, _ := doJSON(t, app, "POST", "/workspaces/ws/duplicate", DuplicateWorkspaceRequest{Name: "X", Path: t.TempDir()}); status != 403 {
+		t.Errorf("copy by a non-member = %d, want 403", status)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"md-office-backend/validation"
+)
+
+const defaultInviteLinkTTL = 7 * 24 * time.Hour
+
+// InviteLink is a shareable link that adds whoever accepts it to the
+// workspace at Permission. The token given out is signed and carries the same
+// terms; the workspace keeps the link to count its uses.
+type InviteLink struct {
+	ID         string    `json:"id"`
+	Permission string    `json:"permission"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	MaxUses    int       `json:"maxUses,omitempty"` // 0 means unlimited
+	Uses       int       `json:"uses"`
+	CreatedBy  string    `json:"createdBy"`
+}
+
+type InviteLinkRequest struct {
+	Permission string `json:"permission" validate:"required,oneof=editor viewer"`
+	ExpiresIn  int    `json:"expiresIn" validate:"min=0,max=2592000"` // seconds, default 7 days
+	MaxUses    int    `json:"maxUses" validate:"min=0,max=10000"`     // 0 means unlimited
+}
+
+type InviteLinkResponse struct {
+	Token string     `json:"token"`
+	Link  InviteLink `json:"link"`
+}
+
+// inviteClaims is the payload of an invite token.
+type inviteClaims struct {
+	Workspace  string `json:"w"`
+	Link       string `json:"l"`
+	Permission string `json:"p"`
+	Expires    int64  `json:"e"`
+	MaxUses    int    `json:"m,omitempty"`
+}
+
+func signInvite(claims inviteClaims) (string, error) {
+	return signToken("invite", claims)
+}
+
+// verifyInvite checks a token's signature and expiry and returns its claims
+func verifyInvite(token string) (*inviteClaims, error) {
+	var claims inviteClaims
+	if err := verifyToken("invite", token, &claims); err != nil {
+		return nil, fmt.Errorf("invalid invite token: %v", err)
+	}
+	if time.Now().Unix() > claims.Expires {
+		return nil, fmt.Errorf("invite link expired")
+	}
+	return &claims, nil
+}
+
+// createInviteLink mints an invite link for the workspace. Owners and
+// editors may create one, as they may invite by username.
+func createInviteLink(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	workspaceID := c.Params("id")
+
+	var req InviteLinkRequest
+	if errs := validation.ParseBody(c, &req); errs != nil {
+		return c.Status(400).JSON(APIResponse{Error: errs.Error(), Fields: errs})
+	}
+	ttl := defaultInviteLinkTTL
+	if req.ExpiresIn > 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+
+	link := InviteLink{
+		ID:         generateID(),
+		Permission: req.Permission,
+		ExpiresAt:  time.Now().Add(ttl).Truncate(time.Second),
+		MaxUses:    req.MaxUses,
+		CreatedBy:  userID,
+	}
+	err := updateWorkspaceConfig(func(config *WorkspaceConfig) error {
+		for i, ws := range config.Workspaces {
+			if ws.ID != workspaceID {
+				continue
+			}
+			if ws.Owner != userID {
+				if permission, hasAccess := ws.Permissions[userID]; !hasAccess || permission == "viewer" {
+					return fiber.NewError(403, "Insufficient permissions")
+				}
+			}
+
+			// Drop links that can no longer be used
+			links := []InviteLink{link}
+			for _, l := range ws.InviteLinks {
+				if time.Now().Before(l.ExpiresAt) && (l.MaxUses == 0 || l.Uses < l.MaxUses) {
+					links = append(links, l)
+				}
+			}
+			config.Workspaces[i].InviteLinks = links
+			return nil
+		}
+		return fiber.NewError(404, "Workspace not found")
+	})
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return c.Status(fe.Code).JSON(APIResponse{Error: fe.Message})
+	}
+	if err != nil {
+		return c.JSON(APIResponse{Error: "Failed to save workspace config"})
+	}
+
+	token, err := signInvite(inviteClaims{
+		Workspace:  workspaceID,
+		Link:       link.ID,
+		Permission: link.Permission,
+		Expires:    link.ExpiresAt.Unix(),
+		MaxUses:    link.MaxUses,
+	})
+	if err != nil {
+		return c.JSON(APIResponse{Error: "Failed to sign invite link"})
+	}
+	return c.JSON(APIResponse{Data: InviteLinkResponse{Token: token, Link: link}})
+}
+
+// joinWorkspace adds the caller to the workspace of an invite token at the
+// link's permission.
+func joinWorkspace(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	username := c.Locals("username").(string)
+
+	token := c.Query("token")
+	if token == "" {
+		return c.Status(400).JSON(APIResponse{Error: "Invite token is required"})
+	}
+	claims, err := verifyInvite(token)
+	if err != nil {
+		return c.Status(403).JSON(APIResponse{Error: err.Error()})
+	}
+
+	var newMember WorkspaceMember
+	err = updateWorkspaceConfig(func(config *WorkspaceConfig) error {
+		for i, ws := range config.Workspaces {
+			if ws.ID != claims.Workspace {
+				continue
+			}
+			link := -1
+			for j, l := range ws.InviteLinks {
+				if l.ID == claims.Link {
+					link = j
+					break
+				}
+			}
+			if link < 0 {
+				return fiber.NewError(403, "Invite link is no longer valid")
+			}
+			if l := ws.InviteLinks[link]; l.MaxUses > 0 && l.Uses >= l.MaxUses {
+				return fiber.NewError(403, "Invite link has been used up")
+			}
+
+			if ws.Owner == userID {
+				return fiber.NewError(409, "You already own this workspace")
+			}
+			if _, ok := ws.Permissions[userID]; ok {
+				return fiber.NewError(409, "You are already a member")
+			}
+
+			newMember = WorkspaceMember{
+				UserID:     userID,
+				Username:   username,
+				Permission: claims.Permission,
+				JoinedAt:   time.Now(),
+			}
+			config.Workspaces[i].Members = append(config.Workspaces[i].Members, newMember)
+			if config.Workspaces[i].Permissions == nil {
+				config.Workspaces[i].Permissions = map[string]string{}
+			}
+			config.Workspaces[i].Permissions[userID] = claims.Permission
+			config.Workspaces[i].InviteLinks[link].Uses++
+			return nil
+		}
+		return fiber.NewError(404, "Workspace not found")
+	})
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return c.Status(fe.Code).JSON(APIResponse{Error: fe.Message})
+	}
+	if err != nil {
+		return c.JSON(APIResponse{Error: "Failed to save workspace config"})
+	}
+
+	return c.JSON(APIResponse{Data: fiber.Map{"workspaceId": claims.Workspace, "member": newMember}})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// inviteWorkspace is owned by alice, with no other members.
+func inviteWorkspace(t *testing.T) *Workspace {
+	return newTestWorkspace(t, Workspace{Owner: "alice", Permissions: map[string]string{}}, nil)
+}
+
+func createTestInvite(t *testing.T, user *string, req InviteLinkRequest) InviteLinkResponse {
+	t.Helper()
+	*user = "alice"
+	app := newTestApp(user)
+	app.Post("/workspaces/:id/invite-link", createInviteLink)
+	status, resp := doJSON(t, app, "POST", "/workspaces/ws/invite-link", req)
+	if status != 200 || resp.Error != "" {
+		t.Fatalf("create invite link: %d %s", status, resp.Error)
+	}
+	data := resp.Data.(map[string]interface{})
+	return InviteLinkResponse{Token: data["token"].(string)}
+}
+
+func TestInviteLinkJoin(t *testing.T) {
+	inviteWorkspace(t)
+	var user string
+	invite := createTestInvite(t, &user, InviteLinkRequest{Permission: "viewer"})
+
+	app := newTestApp(&user)
+	app.Post("/workspaces/join", joinWorkspace)
+	user = "bob"
+	if status, resp := doJSON(t, app, "POST", "/workspaces/join?token="+invite.Token, nil); status != 200 {
+		t.Fatalf("join: %d %s", status, resp.Error)
+	}
+	if status, _ := doJSON(t, app, "POST", "/workspaces/join?token="+invite.Token, nil); status != 409 {
+		t.Errorf("joining twice: got %d, want 409", status)
+	}
+
+	config, err := loadWorkspaceConfigObject()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := config.Workspaces[0]
+	if ws.Permissions["bob"] != "viewer" || len(ws.Members) != 1 {
+		t.Errorf("bob not added as a viewer: %v %v", ws.Permissions, ws.Members)
+	}
+	if ws.InviteLinks[0].Uses != 1 {
+		t.Errorf("link uses = %d, want 1", ws.InviteLinks[0].Uses)
+	}
+}
+
+func TestInviteLinkMaxUses(t *testing.T) {
+	inviteWorkspace(t)
+	var user string
+	invite := createTestInvite(t, &user, InviteLinkRequest{Permission: "editor", MaxUses: 1})
+
+	app := newTestApp(&user)
+	app.Post("/workspaces/join", joinWorkspace)
+	user = "bob"
+	if status, resp := doJSON(t, app, "POST", "/workspaces/join?token="+invite.Token, nil); status != 200 {
+		t.Fatalf("first join: %d %s", status, resp.Error)
+	}
+	user = "carol"
+	status, resp := doJSON(t, app, "POST", "/workspaces/join?token="+invite.Token, nil)
+	if status != 403 || !strings.Contains(resp.Error, "used up") {
+		t.Errorf("join after max uses: got %d %q, want 403", status, resp.Error)
+	}
+}
+
+func TestInviteLinkRejectsExpiredAndTamperedTokens(t *testing.T) {
+	inviteWorkspace(t)
+	var user string
+	invite := createTestInvite(t, &user, InviteLinkRequest{Permission: "viewer"})
+	claims, err := verifyInvite(invite.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiredClaims := *claims
+	expiredClaims.Expires = time.Now().Add(-time.Minute).Unix()
+	expired, err := signInvite(expiredClaims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keep the signature but claim editor access
+	editorClaims := *claims
+	editorClaims.Permission = "editor"
+	forged, err := signInvite(editorClaims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _, _ := strings.Cut(forged, ".")
+	_, sig, _ := strings.Cut(invite.Token, ".")
+	tampered := payload + "." + sig
+
+	// A signed URL token is not an invite
+	download, err := signDownload(signedURLClaims{Workspace: "ws", Path: "x", Expires: claims.Expires})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApp(&user)
+	app.Post("/workspaces/join", joinWorkspace)
+	user = "bob"
+	for name, token := range map[string]string{"expired": expired, "tampered": tampered, "signed URL": download} {
+		if status, _ := doJSON(t, app, "POST", "/workspaces/join?token="+token, nil); status != 403 {
+			t.Errorf("%s token: got %d, want 403", name, status)
+		}
+	}
+
+	config, err := loadWorkspaceConfigObject()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := config.Workspaces[0].Permissions["bob"]; ok {
+		t.Error("bob was added with a rejected token")
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// memberWorkspace is owned by alice, with bob and carol registered but not
+// yet members.
+func memberWorkspace(t *testing.T) {
+	t.Helper()
+	newTestWorkspace(t, Workspace{Owner: "alice", Permissions: map[string]string{}}, nil)
+	users := UserStorage{Users: []User{
+		{ID: "alice", Username: "alice", CreatedAt: time.Now()},
+		{ID: "bob", Username: "bob", CreatedAt: time.Now()},
+		{ID: "carol", Username: "carol", CreatedAt: time.Now()},
+	}}
+	if err := saveUsers(&users); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddWorkspaceMemberRejectsSelfAndOwner(t *testing.T) {
+	memberWorkspace(t)
+	user := "alice"
+	app := newTestApp(&user)
+	app.Post("/workspaces/:id/members", addWorkspaceMember)
+
+	status, resp := doJSON(t, app, "POST", "/workspaces/ws/members", InviteUserRequest{Username: "alice", Permission: "editor"})
+	if status != 400 || resp.Error != "You can't invite yourself" {
+		t.Errorf("self-invite: got %d %q, want 400", status, resp.Error)
+	}
+
+	// bob, an editor, inviting the owner
+	if status, resp := doJSON(t, app, "POST", "/workspaces/ws/members", InviteUserRequest{Username: "bob", Permission: "editor"}); status != 200 {
+		t.Fatalf("invite bob: %d %s", status, resp.Error)
+	}
+	user = "bob"
+	if status, _ := doJSON(t, app, "POST", "/workspaces/ws/members", InviteUserRequest{Username: "alice", Permission: "viewer"}); status != 400 {
+		t.Errorf("inviting the owner: got %d, want 400", status)
+	}
+}
+
+func TestConcurrentDoubleInviteAddsOneMember(t *testing.T) {
+	memberWorkspace(t)
+	user := "alice"
+	app := newTestApp(&user)
+	app.Post("/workspaces/:id/members", addWorkspaceMember)
+
+	const n = 8
+	statuses := make([]int, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i], _ = doJSON(t, app, "POST", "/workspaces/ws/members", InviteUserRequest{Username: "carol", Permission: "viewer"})
+		}(i)
+	}
+	wg.Wait()
+
+	added := 0
+	for _, status := range statuses {
+		switch status {
+		case 200:
+			added++
+		case 409:
+		default:
+			t.Errorf("unexpected status %d", status)
+		}
+	}
+	if added != 1 {
+		t.Errorf("%d invites succeeded, want 1", added)
+	}
+
+	config, err := loadWorkspaceConfigObject()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if members := config.Workspaces[0].Members; len(members) != 1 || members[0].UserID != "carol" {
+		t.Errorf("members = %+v, want carol once", members)
+	}
+}
+
+func TestConcurrentConfigUpdatesKeepEachOther(t *testing.T) {
+	memberWorkspace(t)
+	user := "alice"
+	app := newTestApp(&user)
+	app.Post("/workspaces/switch", switchWorkspace)
+	app.Post("/workspaces/:id/members", addWorkspaceMember)
+	app.Put("/workspaces/:id/settings", updateWorkspaceSettings)
+
+	var wg sync.WaitGroup
+	run := func(method, url string, body interface{}) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if status, resp := doJSON(t, app, method, url, body); status != 200 {
+				t.Errorf("%s %s = %d %q", method, url, status, resp.Error)
+			}
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		run("PUT", "/workspaces/ws/settings", WorkspaceSettings{FoldNameCase: true})
+		run("POST", "/workspaces/switch", SwitchWorkspaceRequest{WorkspaceID: "ws"})
+	}
+	run("POST", "/workspaces/ws/members", InviteUserRequest{Username: "bob", Permission: "editor"})
+	run("POST", "/workspaces/ws/members", InviteUserRequest{Username: "carol", Permission: "viewer"})
+	wg.Wait()
+
+	config, err := loadWorkspaceConfigObject()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := config.Workspaces[0]
+	if len(ws.Members) != 2 || ws.Permissions["bob"] != "editor" || ws.Permissions["carol"] != "viewer" {
+		t.Errorf("members = %+v, permissions = %v; want bob and carol", ws.Members, ws.Permissions)
+	}
+	if !ws.Settings.FoldNameCase || config.UserActive["alice"] != "ws" {
+		t.Errorf("settings = %+v, active = %v; want both updates kept", ws.Settings, config.UserActive)
+	}
+}
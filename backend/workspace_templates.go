@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gofiber/fiber/v2"
+)
+
+// WorkspaceTemplate is a starter layout provisioned into a new workspace.
+// File contents may use {{name}} for the workspace name. Empty directories
+// get a .gitkeep so they survive in git.
+type WorkspaceTemplate struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Dirs        []string          `json:"dirs,omitempty"`
+	Files       map[string]string `json:"files,omitempty"` // relative path -> content
+}
+
+var builtinWorkspaceTemplates = []WorkspaceTemplate{
+	{
+		Name:        "basic",
+		Description: "A README and an assets folder",
+		Dirs:        []string{"assets"},
+		Files: map[string]string{
+			"README.md": "# {{name}}\n\nWelcome to your markdown workspace!\n",
+		},
+	},
+	{
+		Name:        "project",
+		Description: "Docs, meeting notes and assets folders for a team project",
+		Dirs:        []string{"docs", "meetings", "assets"},
+		Files: map[string]string{
+			"README.md":               "# {{name}}\n\n- [Getting started](docs/getting-started.md)\n- Meeting notes live in `meetings/`\n- Images and attachments go in `assets/`\n",
+			"docs/getting-started.md": "# Getting Started\n\nDescribe the project and how to contribute here.\n",
+		},
+	},
+}
+
+// Custom templates live in workspace-templates.json in the config directory
+// ({"templates": [...]}) and replace built-ins of the same name.
+func workspaceTemplatesPath() string {
+	return filepath.Join(configDir, "workspace-templates.json")
+}
+
+func loadWorkspaceTemplates() (map[string]WorkspaceTemplate, error) {
+	templates := make(map[string]WorkspaceTemplate)
+	for _, t := range builtinWorkspaceTemplates {
+		templates[t.Name] = t
+	}
+
+	data, err := os.ReadFile(workspaceTemplatesPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return templates, nil
+		}
+		return nil, err
+	}
+
+	var f struct {
+		Templates []WorkspaceTemplate `json:"templates"`
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", filepath.Base(workspaceTemplatesPath()), err)
+	}
+	for _, t := range f.Templates {
+		if t.Name != "" {
+			templates[t.Name] = t
+		}
+	}
+	return templates, nil
+}
+
+// templatePath validates a template entry and returns it inside root
+func templatePath(root, rel string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(rel))
+	if cleaned == "." || filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("template path %q must be inside the workspace", rel)
+	}
+	if cleaned == ".git" || strings.HasPrefix(cleaned, ".git"+string(filepath.Separator)) {
+		return "", fmt.Errorf("template path %q must not touch .git", rel)
+	}
+	return filepath.Join(root, cleaned), nil
+}
+
+// provisionWorkspace writes a template into dir, initializes git if needed,
+// and commits the result. Existing files are left untouched.
+func provisionWorkspace(dir, workspaceName string, tmpl WorkspaceTemplate, authorName string) error {
+	// Reject bad entries before writing anything
+	for _, d := range tmpl.Dirs {
+		if _, err := templatePath(dir, d); err != nil {
+			return err
+		}
+	}
+	for rel := range tmpl.Files {
+		if _, err := templatePath(dir, rel); err != nil {
+			return err
+		}
+	}
+
+	for _, d := range tmpl.Dirs {
+		full, err := templatePath(dir, d)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(full, 0755); err != nil {
+			return err
+		}
+		if entries, err := os.ReadDir(full); err == nil && len(entries) == 0 {
+			if err := os.WriteFile(filepath.Join(full, ".gitkeep"), nil, 0644); err != nil {
+				return err
+			}
+		}
+	}
+
+	for rel, content := range tmpl.Files {
+		full, err := templatePath(dir, rel)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(full); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			return err
+		}
+		content = strings.ReplaceAll(content, "{{name}}", workspaceName)
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			return err
+		}
+		// A file in a template dir makes its .gitkeep redundant
+		os.Remove(filepath.Join(filepath.Dir(full), ".gitkeep"))
+	}
+
+	return commitWorkspaceDir(dir, fmt.Sprintf("Initialize workspace from %s template", tmpl.Name), authorName)
+}
+
+// commitWorkspaceDir initializes git in dir if needed and commits all of its
+// files. Nothing to commit is not an error.
+func commitWorkspaceDir(dir, message, authorName string) error {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		if repo, err = git.PlainInit(dir, false); err != nil {
+			return fmt.Errorf("failed to initialize git repository: %w", err)
+		}
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if err := worktree.AddGlob("."); err != nil {
+		if err == git.ErrGlobNoMatches {
+			return nil // empty directory
+		}
+		return err
+	}
+	_, err = worktree.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{
+			Name:  authorName,
+			Email: fmt.Sprintf("%s@mdoffice.local", authorName),
+			When:  time.Now(),
+		},
+	})
+	if err == git.ErrEmptyCommit {
+		return nil
+	}
+	return err
+}
+
+func getWorkspaceTemplates(c *fiber.Ctx) error {
+	templates, err := loadWorkspaceTemplates()
+	if err != nil {
+		return c.JSON(APIResponse{Error: err.Error()})
+	}
+
+	list := make([]WorkspaceTemplate, 0, len(templates))
+	for _, t := range templates {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return c.JSON(APIResponse{Data: list})
+}
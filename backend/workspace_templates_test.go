@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// committedFiles returns the paths in the HEAD commit of the repo at dir.
+func committedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	iter, err := commit.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	iter.ForEach(func(f *object.File) error {
+		files = append(files, f.Name)
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
+
+func TestCreateWorkspaceFromTemplate(t *testing.T) {
+	useTestConfig(t)
+	user := "alice"
+	app := newTestApp(&user)
+	app.Post("/workspaces", createWorkspace)
+
+	dir := filepath.Join(t.TempDir(), "launch")
+	status, resp := doJSON(t, app, "POST", "/workspaces", CreateWorkspaceRequest{Name: "Launch", Path: dir, Template: "project"})
+	if status != 200 || resp.Error != "" {
+		t.Fatalf("create: %d %s", status, resp.Error)
+	}
+
+	want := []string{"README.md", "assets/.gitkeep", "docs/getting-started.md", "meetings/.gitkeep"}
+	if got := committedFiles(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("committed files = %v, want %v", got, want)
+	}
+	if readme, _ := os.ReadFile(filepath.Join(dir, "README.md")); !strings.HasPrefix(string(readme), "# Launch\n") {
+		t.Errorf("README.md = %q, want it titled with the workspace name", readme)
+	}
+
+	status, _ = doJSON(t, app, "POST", "/workspaces", CreateWorkspaceRequest{Name: "Other", Path: filepath.Join(t.TempDir(), "other"), Template: "nope"})
+	if status != 400 {
+		t.Errorf("unknown template = %d, want 400", status)
+	}
+}
+
+func TestCustomWorkspaceTemplates(t *testing.T) {
+	useTestConfig(t)
+	writeTestFiles(t, configDir, map[string]string{"workspace-templates.json": `{"templates": [
+		{"name": "basic", "files": {"index.md": "# {{name}} index\n"}},
+		{"name": "escape", "files": {"../outside.md": "x"}}
+	]}`})
+	user := "alice"
+	app := newTestApp(&user)
+	app.Post("/workspaces", createWorkspace)
+
+	dir := filepath.Join(t.TempDir(), "wiki")
+	if status, resp := doJSON(t, app, "POST", "/workspaces", CreateWorkspaceRequest{Name: "Wiki", Path: dir, Template: "basic"}); status != 200 || resp.Error != "" {
+		t.Fatalf("create: %d %s", status, resp.Error)
+	}
+	if got := committedFiles(t, dir); !reflect.DeepEqual(got, []string{"index.md"}) {
+		t.Errorf("committed files = %v, want the custom basic template to replace the built-in", got)
+	}
+
+	parent := t.TempDir()
+	_, resp := doJSON(t, app, "POST", "/workspaces", CreateWorkspaceRequest{Name: "Bad", Path: filepath.Join(parent, "bad"), Template: "escape"})
+	if resp.Error == "" {
+		t.Error("template writing outside the workspace was applied")
+	}
+	if _, err := os.Stat(filepath.Join(parent, "outside.md")); err == nil {
+		t.Error("template wrote outside the workspace")
+	}
+}
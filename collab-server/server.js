@@ -1,6 +1,7 @@
 const { Server } = require('@hocuspocus/server');
 const Y = require('yjs');
 const fs = require('fs').promises;
+const fsSync = require('fs');
 const path = require('path');
 const http = require('http');
 const jwt = require('jsonwebtoken');
@@ -9,7 +10,66 @@ const jwt = require('jsonwebtoken');
 const PORT = process.env.COLLABORATION_PORT || 1234;
 const BACKEND_URL = process.env.BACKEND_URL || 'http://localhost:8080';
 const WORKSPACE_DIR = process.env.WORKSPACE_PATH || './workspace';
-const JWT_SECRET = process.env.JWT_SECRET || 'your-secret-key-change-in-production';
+// Must be the backend's JWT_SECRET, or no token it issues will verify here
+const JWT_SECRET = process.env.JWT_SECRET;
+const MIN_JWT_SECRET_LEN = 32;
+
+if (!JWT_SECRET || JWT_SECRET.length < MIN_JWT_SECRET_LEN) {
+  console.error(`JWT_SECRET must be set to the backend's secret (at least ${MIN_JWT_SECRET_LEN} bytes)`);
+  process.exit(1);
+}
+
+// The backend's verification key set, read from the same variables it uses
+// (see backend/jwt_keys.go): JWT_KEYS kid:secret HS256 keys, JWT_RSA_KEYS
+// kid:path RS256 PEM keys, and JWT_SECRET as the "default" kid, which also
+// verifies tokens without a kid. Tokens are checked against the key their
+// kid header names, so rotating JWT_ACTIVE_KID on the backend keeps working
+// as long as both servers get the same key variables.
+function splitKeyList(value) {
+  return (value || '').split(',').map(s => s.trim()).filter(Boolean);
+}
+
+function loadJWTKeys() {
+  const keys = new Map();
+  for (const entry of splitKeyList(process.env.JWT_KEYS)) {
+    const i = entry.indexOf(':');
+    if (i <= 0 || i === entry.length - 1) {
+      throw new Error(`Invalid JWT_KEYS entry "${entry}" (want kid:secret)`);
+    }
+    keys.set(entry.slice(0, i), { key: entry.slice(i + 1), algorithms: ['HS256'] });
+  }
+  for (const entry of splitKeyList(process.env.JWT_RSA_KEYS)) {
+    const i = entry.indexOf(':');
+    if (i <= 0 || i === entry.length - 1) {
+      throw new Error(`Invalid JWT_RSA_KEYS entry "${entry}" (want kid:path)`);
+    }
+    // A private key PEM verifies too; Node derives the public half
+    keys.set(entry.slice(0, i), { key: fsSync.readFileSync(entry.slice(i + 1)), algorithms: ['RS256'] });
+  }
+  if (!keys.has('default')) {
+    keys.set('default', { key: JWT_SECRET, algorithms: ['HS256'] });
+  }
+  return keys;
+}
+
+let jwtKeys;
+try {
+  jwtKeys = loadJWTKeys();
+} catch (err) {
+  console.error(`Failed to load JWT keys: ${err.message}`);
+  process.exit(1);
+}
+
+// verifyToken checks a backend-issued token against the key its kid names.
+function verifyToken(token) {
+  const decoded = jwt.decode(token, { complete: true });
+  const kid = decoded?.header?.kid || 'default';
+  const entry = jwtKeys.get(kid);
+  if (!entry) {
+    throw new Error(`unknown key id "${kid}"`);
+  }
+  return jwt.verify(token, entry.key, { algorithms: entry.algorithms });
+}
 
 // Store debounce timeouts for document saving
 const saveTimeouts = new Map();
@@ -158,32 +218,22 @@ const server = new Server({
   async onAuthenticate(data) {
     const token = data.token;
 
-    // Allow unauthenticated access in development if no secret override is set
     if (!token) {
-      if (process.env.JWT_SECRET) {
-        throw new Error('Authentication required');
-      }
-      // Dev fallback: anonymous guest
-      const id = data.connection?.remoteAddress || `anon-${Date.now()}`;
-      return {
-        user: {
-          id,
-          name: `Guest ${Math.random().toString(36).substring(2, 6)}`,
-        }
-      };
+      throw new Error('Authentication required');
     }
 
     // Verify JWT
     let claims;
     try {
-      claims = jwt.verify(token, JWT_SECRET);
+      claims = verifyToken(token);
     } catch (err) {
       console.warn(`JWT verification failed: ${err.message}`);
       throw new Error('Invalid or expired token');
     }
 
-    const userId = claims.user_id || claims.sub || claims.id;
-    const userName = claims.email || claims.username || claims.name || `User ${userId}`;
+    // Backend tokens carry userId and username (JWTClaims in backend/main.go)
+    const userId = claims.userId;
+    const userName = claims.username || `User ${userId}`;
 
     console.log(`Authenticated user: ${userName} (${userId})`);
     return {
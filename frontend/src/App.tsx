@@ -9,7 +9,7 @@ import Login from './components/Login';
 import DocsToolbar from './components/DocsToolbar';
 import Ruler from './components/Ruler';
 import { FileSystemItem, FileContent } from './types';
-import { fileAPI, gitAPI } from './utils/api';
+import { fileAPI, gitAPI, SaveConflictError } from './utils/api';
 import { parseFrontmatter, getPageStyles } from './utils/frontmatter';
 import { localFileAPI, initializeLocalStorage } from './utils/localApi';
 import { Template } from './utils/templates';
@@ -308,6 +308,11 @@ function App() {
       } catch (error) {
         console.error('Auto-save failed:', error);
         setSaveStatus('error');
+        if (error instanceof SaveConflictError) {
+          // Retrying can't succeed; the edit has to be reconciled first
+          toast('Someone else changed this document; copy your changes and reopen it', 'error');
+          return;
+        }
         toast('Failed to save document', 'error');
         
         // Retry after 5 seconds
@@ -694,6 +699,7 @@ function App() {
 
   const handleLogout = () => {
     localStorage.removeItem('token');
+    localStorage.removeItem('refreshToken');
     localStorage.removeItem('user');
     setIsAuthenticated(false);
     setIsGuestMode(true);
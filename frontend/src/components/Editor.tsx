@@ -348,6 +348,8 @@ const Editor: React.FC<EditorProps> = ({
         url: collaborationServerUrl,
         name: documentName,
         document: newYdoc,
+        // Read on every (re)connect so refreshed access tokens are used
+        token: () => localStorage.getItem('token') ?? '',
       });
 
       setYdoc(newYdoc);
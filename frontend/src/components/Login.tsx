@@ -27,6 +27,7 @@ function Login({ onAuthSuccess }: LoginProps) {
       
       // Store token and user info
       localStorage.setItem('token', response.token);
+      localStorage.setItem('refreshToken', response.refreshToken);
       localStorage.setItem('user', JSON.stringify(response.user));
       
       onAuthSuccess(response.token);
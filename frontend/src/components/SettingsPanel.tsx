@@ -7,6 +7,9 @@ interface APIKey {
   createdAt: string;
   lastUsed?: string;
   revokedAt?: string;
+  expiresAt?: string;
+  status?: 'active' | 'expired' | 'revoked';
+  scopes?: string[];
 }
 
 interface WebhookSub {
@@ -32,6 +35,8 @@ interface DeliveryLog {
 const EVENTS = [
   'doc.created', 'doc.updated', 'doc.deleted',
   'sheet.updated', 'slide.updated', 'db.updated',
+  'file.saved', 'file.created', 'file.deleted', 'file.renamed', 'file.uploaded',
+  'git.committed', 'git.branch.created', 'git.merged',
 ];
 
 const getHeaders = () => {
@@ -87,6 +92,7 @@ function TabBtn({ active, onClick, children }: { active: boolean; onClick: () =>
 function APIKeysTab() {
   const [keys, setKeys] = useState<APIKey[]>([]);
   const [newName, setNewName] = useState('');
+  const [readOnly, setReadOnly] = useState(false);
   const [newKey, setNewKey] = useState('');
   const [loading, setLoading] = useState(false);
 
@@ -106,7 +112,7 @@ function APIKeysTab() {
     try {
       const res = await fetch('/api/v1/keys', {
         method: 'POST', headers: getHeaders(),
-        body: JSON.stringify({ name: newName }),
+        body: JSON.stringify({ name: newName, scopes: readOnly ? ['read'] : ['read', 'write'] }),
       });
       const data = await res.json();
       if (data.data?.key) {
@@ -142,6 +148,10 @@ function APIKeysTab() {
           style={{ flex: 1, padding: '6px 10px', border: '1px solid #ddd', borderRadius: 4 }}
           onKeyDown={e => e.key === 'Enter' && createKey()}
         />
+        <label style={{ display: 'flex', alignItems: 'center', gap: 4, fontSize: 13 }}>
+          <input type="checkbox" checked={readOnly} onChange={e => setReadOnly(e.target.checked)} />
+          Read-only
+        </label>
         <button onClick={createKey} disabled={loading} style={{
           padding: '6px 16px', background: '#1a73e8', color: '#fff', border: 'none', borderRadius: 4, cursor: 'pointer',
         }}>Generate</button>
@@ -154,23 +164,27 @@ function APIKeysTab() {
             <th style={{ textAlign: 'left', padding: 6 }}>Prefix</th>
             <th style={{ textAlign: 'left', padding: 6 }}>Created</th>
             <th style={{ textAlign: 'left', padding: 6 }}>Last Used</th>
+            <th style={{ textAlign: 'left', padding: 6 }}>Expires</th>
             <th style={{ padding: 6 }}></th>
           </tr>
         </thead>
         <tbody>
           {keys.filter(k => !k.revokedAt).map(k => (
             <tr key={k.id} style={{ borderBottom: '1px solid #eee' }}>
-              <td style={{ padding: 6 }}>{k.name}</td>
+              <td style={{ padding: 6 }}>{k.name}{k.scopes && !k.scopes.includes('write') && <span style={{ color: '#666' }}> (read-only)</span>}</td>
               <td style={{ padding: 6 }}><code>{k.prefix}...</code></td>
               <td style={{ padding: 6 }}>{new Date(k.createdAt).toLocaleDateString()}</td>
               <td style={{ padding: 6 }}>{k.lastUsed ? new Date(k.lastUsed).toLocaleDateString() : '—'}</td>
+              <td style={{ padding: 6, color: k.status === 'expired' ? 'red' : undefined }}>
+                {k.status === 'expired' ? 'Expired' : k.expiresAt ? new Date(k.expiresAt).toLocaleDateString() : 'Never'}
+              </td>
               <td style={{ padding: 6 }}>
                 <button onClick={() => revokeKey(k.id)} style={{ color: 'red', border: 'none', background: 'none', cursor: 'pointer' }}>Revoke</button>
               </td>
             </tr>
           ))}
           {keys.filter(k => !k.revokedAt).length === 0 && (
-            <tr><td colSpan={5} style={{ padding: 12, textAlign: 'center', color: '#999' }}>No API keys yet</td></tr>
+            <tr><td colSpan={6} style={{ padding: 12, textAlign: 'center', color: '#999' }}>No API keys yet</td></tr>
           )}
         </tbody>
       </table>
@@ -186,6 +200,7 @@ function WebhooksTab() {
   const [formUrl, setFormUrl] = useState('');
   const [formSecret, setFormSecret] = useState('');
   const [formEvents, setFormEvents] = useState<string[]>([]);
+  const [testResults, setTestResults] = useState<Record<string, DeliveryLog>>({});
 
   const loadSubs = useCallback(async () => {
     try {
@@ -223,6 +238,18 @@ function WebhooksTab() {
     loadSubs();
   };
 
+  const testSub = async (id: string) => {
+    const res = await fetch(`/api/webhooks/${id}/test`, { method: 'POST', headers: getHeaders() });
+    const data = await res.json();
+    if (data.data) setTestResults(prev => ({ ...prev, [id]: data.data }));
+    if (showLogs) loadLogs();
+  };
+
+  const redeliver = async (logId: string) => {
+    await fetch(`/api/webhooks/logs/${logId}/redeliver`, { method: 'POST', headers: getHeaders() });
+    loadLogs();
+  };
+
   const toggleEvent = (e: string) => {
     setFormEvents(prev => prev.includes(e) ? prev.filter(x => x !== e) : [...prev, e]);
   };
@@ -281,7 +308,13 @@ function WebhooksTab() {
               <td style={{ padding: 6, maxWidth: 200, overflow: 'hidden', textOverflow: 'ellipsis' }}>{s.url}</td>
               <td style={{ padding: 6, fontSize: 11 }}>{s.events.join(', ')}</td>
               <td style={{ padding: 6 }}>{s.active ? '✅' : '❌'}</td>
-              <td style={{ padding: 6 }}>
+              <td style={{ padding: 6, whiteSpace: 'nowrap' }}>
+                {testResults[s.id] && (
+                  <span style={{ fontSize: 11, color: testResults[s.id].success ? 'green' : 'red' }}>
+                    {testResults[s.id].success ? 'Delivered' : `Failed: ${testResults[s.id].statusCode || testResults[s.id].error}`}
+                  </span>
+                )}
+                <button onClick={() => testSub(s.id)} style={{ border: 'none', background: 'none', cursor: 'pointer' }}>Test</button>
                 <button onClick={() => deleteSub(s.id)} style={{ color: 'red', border: 'none', background: 'none', cursor: 'pointer' }}>Delete</button>
               </td>
             </tr>
@@ -302,6 +335,7 @@ function WebhooksTab() {
                 <th style={{ textAlign: 'left', padding: 4 }}>Event</th>
                 <th style={{ textAlign: 'left', padding: 4 }}>Status</th>
                 <th style={{ textAlign: 'left', padding: 4 }}>Attempt</th>
+                <th style={{ padding: 4 }}></th>
               </tr>
             </thead>
             <tbody>
@@ -310,11 +344,16 @@ function WebhooksTab() {
                   <td style={{ padding: 4 }}>{new Date(l.timestamp).toLocaleString()}</td>
                   <td style={{ padding: 4 }}>{l.event}</td>
                   <td style={{ padding: 4 }}>{l.statusCode || l.error}</td>
-                  <td style={{ padding: 4 }}>{l.attempt}/3</td>
+                  <td style={{ padding: 4 }}>{l.attempt}</td>
+                  <td style={{ padding: 4 }}>
+                    {!l.success && (
+                      <button onClick={() => redeliver(l.id)} style={{ border: 'none', background: 'none', cursor: 'pointer', fontSize: 12 }}>Redeliver</button>
+                    )}
+                  </td>
                 </tr>
               ))}
               {logs.length === 0 && (
-                <tr><td colSpan={4} style={{ padding: 8, textAlign: 'center', color: '#999' }}>No deliveries yet</td></tr>
+                <tr><td colSpan={5} style={{ padding: 8, textAlign: 'center', color: '#999' }}>No deliveries yet</td></tr>
               )}
             </tbody>
           </table>
@@ -42,6 +42,7 @@ function UserMenu({ onLogout }: UserMenuProps) {
 
   const handleLogout = () => {
     localStorage.removeItem('token');
+    localStorage.removeItem('refreshToken');
     localStorage.removeItem('user');
     setUser(null);
     onLogout();
@@ -269,6 +269,7 @@ export function initSheetCollab(
     url: serverUrl,
     name: `sheet:${documentName}`,
     document: ydoc,
+    token: () => localStorage.getItem('token') ?? '',
   });
 
   // Set user info on awareness
@@ -342,6 +342,7 @@ export function initSlideCollab(
     url: serverUrl,
     name: `slides:${documentName}`,
     document: ydoc,
+    token: () => localStorage.getItem('token') ?? '',
   });
 
   if (provider.awareness) {
@@ -9,6 +9,18 @@ export interface FileContent {
   path: string;
   content: string;
   lastModified: string;
+  size?: number; // of the whole file, when truncated
+  truncated?: boolean; // content is only a preview of a large file
+  hash?: string; // of the content, sent back as baseHash when saving
+}
+
+// Returned with 409 when a file changed on the server since it was loaded
+export interface SaveConflict {
+  code: 'conflict';
+  exists: boolean; // false if the file was deleted
+  currentHash?: string;
+  currentContent?: string;
+  yourContent: string;
 }
 
 export interface GitCommit {
@@ -20,6 +32,7 @@ export interface GitCommit {
 
 export interface GitHistory {
   commits: GitCommit[];
+  nextCursor?: string;
 }
 
 export interface GitBranch {
@@ -42,6 +55,7 @@ export interface User {
 
 export interface AuthResponse {
   token: string;
+  refreshToken: string;
   user: User;
 }
 
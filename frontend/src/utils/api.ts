@@ -13,7 +13,8 @@ import {
   CreateWorkspaceRequest,
   SwitchWorkspaceRequest,
   WorkspaceMember,
-  InviteUserRequest
+  InviteUserRequest,
+  SaveConflict
 } from '../types';
 
 const api = axios.create({
@@ -30,12 +31,45 @@ api.interceptors.request.use((config) => {
   return config;
 });
 
+// Access tokens last 15 minutes; renew with the refresh token (which is
+// single-use) and retry once before sending the user to the login page.
+let refreshing: Promise<string> | null = null;
+
+const refreshAccessToken = (): Promise<string> => {
+  if (!refreshing) {
+    refreshing = axios
+      .post<APIResponse<AuthResponse>>('/api/auth/refresh', { refreshToken: localStorage.getItem('refreshToken') })
+      .then((response) => {
+        const auth = response.data.data!;
+        localStorage.setItem('token', auth.token);
+        localStorage.setItem('refreshToken', auth.refreshToken);
+        return auth.token;
+      })
+      .finally(() => {
+        refreshing = null;
+      });
+  }
+  return refreshing;
+};
+
 // Handle auth errors
 api.interceptors.response.use(
   (response) => response,
-  (error) => {
+  async (error) => {
+    const original = error.config;
+    if (error.response?.status === 401 && original && !original._retried && localStorage.getItem('refreshToken')) {
+      original._retried = true;
+      try {
+        const token = await refreshAccessToken();
+        original.headers.Authorization = `Bearer ${token}`;
+        return api(original);
+      } catch {
+        // fall through to logging out
+      }
+    }
     if (error.response?.status === 401) {
       localStorage.removeItem('token');
+      localStorage.removeItem('refreshToken');
       localStorage.removeItem('user');
       // Redirect to login
       window.location.href = '/login';
@@ -96,12 +130,34 @@ export const workspaceAPI = {
     return response.data.data!;
   },
 
+  updateMemberPermission: async (workspaceId: string, userId: string, permission: 'editor' | 'viewer'): Promise<WorkspaceMember> => {
+    const response = await api.patch<APIResponse<WorkspaceMember>>(`/workspaces/${workspaceId}/members/${userId}`, { permission });
+    if (response.data.error) throw new Error(response.data.error);
+    return response.data.data!;
+  },
+
   removeUser: async (workspaceId: string, userId: string): Promise<void> => {
     const response = await api.delete<APIResponse<void>>(`/workspaces/${workspaceId}/members/${userId}`);
     if (response.data.error) throw new Error(response.data.error);
   }
 };
 
+// Thrown by fileAPI.saveFile when someone else changed the file since it was
+// loaded; the conflict carries both versions.
+export class SaveConflictError extends Error {
+  conflict: SaveConflict;
+
+  constructor(message: string, conflict: SaveConflict) {
+    super(message);
+    this.name = 'SaveConflictError';
+    this.conflict = conflict;
+  }
+}
+
+// Hash of the version of each file last loaded or saved, so saves only
+// succeed on top of it
+const fileHashes = new Map<string, string>();
+
 // File API
 export const fileAPI = {
   // Get file tree structure
@@ -115,13 +171,25 @@ export const fileAPI = {
   getFile: async (path: string): Promise<FileContent> => {
     const response = await api.get<APIResponse<FileContent>>(`/files/${encodeURIComponent(path)}`);
     if (response.data.error) throw new Error(response.data.error);
-    return response.data.data!;
+    const file = response.data.data!;
+    if (file.hash) fileHashes.set(path, file.hash);
+    return file;
   },
 
-  // Save file content
+  // Save file content. Throws SaveConflictError if the file changed since
+  // it was loaded.
   saveFile: async (path: string, content: string): Promise<void> => {
-    const response = await api.post<APIResponse<void>>('/files', { path, content });
-    if (response.data.error) throw new Error(response.data.error);
+    try {
+      const response = await api.post<APIResponse<{ path: string; hash: string }>>('/files', { path, content, baseHash: fileHashes.get(path) });
+      if (response.data.error) throw new Error(response.data.error);
+      fileHashes.set(path, response.data.data!.hash);
+    } catch (error) {
+      const response = (error as { response?: { status: number; data: APIResponse<SaveConflict> } }).response;
+      if (response?.status === 409 && response.data.data) {
+        throw new SaveConflictError(response.data.error || 'File has changed', response.data.data);
+      }
+      throw error;
+    }
   },
 
   // Create new file
@@ -140,12 +208,16 @@ export const fileAPI = {
   deleteItem: async (path: string): Promise<void> => {
     const response = await api.delete<APIResponse<void>>(`/files/${encodeURIComponent(path)}`);
     if (response.data.error) throw new Error(response.data.error);
+    fileHashes.delete(path);
   },
 
   // Rename file or directory
   renameItem: async (oldPath: string, newPath: string): Promise<void> => {
     const response = await api.put<APIResponse<void>>('/files/rename', { oldPath, newPath });
     if (response.data.error) throw new Error(response.data.error);
+    const hash = fileHashes.get(oldPath);
+    fileHashes.delete(oldPath);
+    if (hash) fileHashes.set(newPath, hash);
   }
 };
 
@@ -188,7 +260,7 @@ export const gitAPI = {
   },
 
   deleteBranch: async (name: string): Promise<void> => {
-    const response = await api.post<APIResponse<void>>('/git/branches', { name, delete: true });
+    const response = await api.delete<APIResponse<void>>(`/git/branches/${name.split('/').map(encodeURIComponent).join('/')}`);
     if (response.data.error) throw new Error(response.data.error);
   },
 
@@ -46,6 +46,10 @@ export interface PRResponse {
   number: number;
   htmlUrl: string;
   title: string;
+  state?: 'open' | 'merged' | 'closed';
+  author?: string;
+  head?: string;
+  base?: string;
 }
 
 export interface SyncStatus {
@@ -77,9 +81,11 @@ export const oauthAPI = {
     return resp.data.data || [];
   },
 
-  disconnectProvider: async (provider: string, giteaUrl?: string): Promise<void> => {
+  // Resolves to warnings, e.g. when the provider couldn't revoke the token
+  disconnectProvider: async (provider: string, giteaUrl?: string): Promise<string[]> => {
     const params = giteaUrl ? `?gitea_url=${encodeURIComponent(giteaUrl)}` : '';
-    await api.delete(`/auth/providers/${provider}${params}`);
+    const resp = await api.delete(`/auth/providers/${provider}${params}`);
+    return resp.data.warnings || [];
   },
 
   savePAT: async (provider: string, token: string, giteaUrl?: string): Promise<ProviderConnection> => {
@@ -116,6 +122,13 @@ export const gitProviderAPI = {
     return resp.data.data || [];
   },
 
+  listPulls: async (provider: GitProvider, owner: string, name: string, state: 'open' | 'closed' | 'merged' | 'all' = 'open', giteaUrl?: string): Promise<PRResponse[]> => {
+    const params = new URLSearchParams({ provider, state });
+    if (giteaUrl) params.set('gitea_url', giteaUrl);
+    const resp = await api.get(`/git-provider/repos/${owner}/${name}/pulls?${params}`);
+    return resp.data.data || [];
+  },
+
   connectRepo: async (config: {
     provider: GitProvider;
     giteaUrl?: string;
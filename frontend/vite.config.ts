@@ -9,6 +9,11 @@ export default defineConfig({
       '/api': {
         target: 'http://localhost:8080',
         changeOrigin: true,
+      },
+      // Uploaded images and other workspace files
+      '/files': {
+        target: 'http://localhost:8080',
+        changeOrigin: true,
       }
     }
   },
@@ -36,6 +36,13 @@ if [ ! -d "node_modules" ]; then
     npm install
 fi
 
+# The collaboration server verifies the backend's tokens, so it needs the
+# same JWT_SECRET the backend runs with
+if [ -z "$JWT_SECRET" ]; then
+    echo -e "${RED}❌ JWT_SECRET is not set; use the backend's secret${NC}"
+    exit 1
+fi
+
 # Set environment variables
 export COLLABORATION_PORT=${COLLABORATION_PORT:-1234}
 export BACKEND_URL=${BACKEND_URL:-http://localhost:8080}
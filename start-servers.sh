@@ -9,6 +9,14 @@ pkill -f "collab-server"
 # Wait a bit for cleanup
 sleep 1
 
+# Both servers must share the JWT secret: the collaboration server verifies
+# the tokens the backend issues. Generate one for this run if none is set.
+if [ -z "$JWT_SECRET" ]; then
+    JWT_SECRET=$(openssl rand -hex 32)
+    echo "JWT_SECRET is not set; using a random secret for this run"
+fi
+export JWT_SECRET
+
 # Start collaboration server in the background
 echo "Starting Hocuspocus collaboration server on port 1234..."
 cd collab-server